@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"log"
 
 	"github.com/strowk/foxy-contexts/pkg/app"
+	"github.com/strowk/foxy-contexts/pkg/server"
+	"github.com/strowk/foxy-contexts/pkg/session"
 	"github.com/strowk/foxy-contexts/pkg/stdio"
 	"go.uber.org/fx"
 	"go.uber.org/fx/fxevent"
@@ -12,7 +15,7 @@ import (
 
 // This example defines an MCP Server with 'intialized' callback
 // , that demonstrates how you can plug into server lifecycle and do
-// some workafter the client has finished initialization and notified the server
+// some work after the client has finished initialization and notified the server
 // , run it with:
 // npx @modelcontextprotocol/inspector go run main.go
 // , then in browser open http://localhost:6274
@@ -23,29 +26,21 @@ func main() {
 	log.Printf("starting server")
 	app.
 		NewBuilder().
-		// this bit is WIP for now:
-
-		// WithInitializedFinishedHandler(func(
-		// 	shutdowner fx.Shutdowner,
-		// ) server.ServerOption {
-		// 	return &server.InitializationFininshedHandlerOption{
-		// 		Callback: func(req *mcp.InitializedNotification) {
-		// 			// do some work after client has finished initialization
-
-		// 			// this is tad strange, but we would like to simply shut down when client is ready...
-		// 			// why not, maybe we just want to test something and then shut down?
-
-		// 			// Note: This currently is causing deadlock, as we are inside of input handling routine
-		// 			// , which cannot finish as it waits for us here, where we wait for graceful shutdown,
-		// 			// which in turn waits for input handling routine to finish, so.. essentially asking
-		// 			// for shutdown anywhere that is processed within server's Handle method, would always
-		// 			// cause this to stuck.
-
-		// 			log.Printf("asking fx to shut down")
-		// 			shutdowner.Shutdown()
-		// 		},
-		// 	}
-		// }).
+		WithOnInitialized(func() server.OnInitializedFunc {
+			return func(ctx context.Context) {
+				// do some work after client has finished initialization,
+				// here we just log who has connected
+				if s, ok := session.FromContext(ctx); ok {
+					client := s.ClientInfo()
+					log.Printf("client %s %s initialized session using protocol version %s", client.Name, client.Version, s.ProtocolVersion())
+				}
+			}
+		}).
+		WithOnShutdown(func() server.OnShutdownFunc {
+			return func(ctx context.Context) {
+				log.Printf("session is shutting down")
+			}
+		}).
 		// setting up server
 		WithName("example-server").
 		WithVersion("0.0.1").
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/strowk/foxy-contexts/pkg/foxytest"
+)
+
+func TestWithFoxytest(t *testing.T) {
+	ts, err := foxytest.Read("testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.WithExecutable("go", []string{"run", "main.go"})
+	ts.WithTransport(foxytest.NewTestTransportWebSocket("ws://localhost:8080/mcp"))
+	ts.WithLogging()
+	cntrl := foxytest.NewTestRunner(t)
+	ts.Run(cntrl)
+	ts.AssertNoErrors(cntrl)
+}
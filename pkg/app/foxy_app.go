@@ -3,6 +3,9 @@ package app
 import (
 	"context"
 	"errors"
+	"fmt"
+	"slices"
+	"sync"
 
 	"github.com/strowk/foxy-contexts/pkg/fxctx"
 	"github.com/strowk/foxy-contexts/pkg/mcp"
@@ -15,6 +18,23 @@ var (
 	ErrNoTransportSpecified = errors.New("no transport specified, please use WithTransport to specify a transport")
 )
 
+// TransportError is reported when one of transports of the app
+// fails to run or to shut down
+type TransportError struct {
+	// Index is position of transport in order of WithTransport calls
+	Index     int
+	Transport server.Transport
+	Err       error
+}
+
+func (e *TransportError) Error() string {
+	return fmt.Sprintf("transport %d (%T): %v", e.Index, e.Transport, e.Err)
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
 func NewBuilder() *Builder {
 	return &Builder{
 		implementation: &mcp.Implementation{
@@ -30,18 +50,19 @@ func NewBuilder() *Builder {
 // You would be calling WithTool, WithResource, WithResourceProvider, WithPrompt
 // to register your tools, resources, resource providers and prompts and then
 // calling Run to start the server, or you can instead call BuildFxApp to get the
-// fx.App instance and run it yourself. You must set transport using
-// WithTransport. Unless you configure server using
+// fx.App instance and run it yourself. You must set at least one transport
+// using WithTransport. Unless you configure server using
 // WithName and WithVersion, it will use default values "my-foxy-contexts-server" and "0.0.1".
 // Finally you can use WithFxOptions to pass additional fx.Options to the fx.App instance
 // before it is built.
 type Builder struct {
 	implementation *mcp.Implementation
-	transport      server.Transport
+	transports     []server.Transport
 
 	capabilities *mcp.ServerCapabilities
 
-	transportError error
+	transportErrors   []error
+	transportErrorsMu sync.Mutex
 
 	options []fx.Option
 
@@ -99,11 +120,57 @@ func (f *Builder) WithPrompt(newPrompt any) *Builder {
 	return f
 }
 
-// WithStdioTransport sets up the server to use stdio transport
+// WithMethod adds custom request or notification method to the app,
+// such as vendor extension, which is not part of MCP specification
+//
+// newMethod must be a function that returns a fxctx.Method, created with
+// fxctx.NewMethod or fxctx.NewNotificationMethod, it can also take in any
+// dependencies that you want to inject into the method, that will be
+// resolved by the fx framework. Every method is advertised to clients
+// in experimental capabilities of the server under its name, unless
+// capability with that name is already set by WithServerCapabilities.
+func (f *Builder) WithMethod(newMethod any) *Builder {
+	f.options = append(f.options, fx.Provide(fxctx.AsMethod(newMethod)))
+	return f
+}
+
+// WithOnInitialized adds a callback to be called when client has finished
+// initialization of the session and sent notifications/initialized
+//
+// newCallback must be a function that returns a server.OnInitializedFunc
+// it can also take in any dependencies that you want to inject
+// into the callback, that will be resolved by the fx framework
 //
-// options can be used to configure the stdio transport
+// Callback is called in its own goroutine for every initialized session,
+// so it is safe to send requests to client or to ask fx.Shutdowner to stop
+// the application from it.
+func (f *Builder) WithOnInitialized(newCallback any) *Builder {
+	f.options = append(f.options, fx.Provide(fx.Annotate(newCallback, fx.ResultTags(`group:"on_initialized"`))))
+	return f
+}
+
+// WithOnShutdown adds a callback to be called once for every session when
+// it starts shutting down, either because client has disconnected or
+// because application is stopping
+//
+// newCallback must be a function that returns a server.OnShutdownFunc
+// it can also take in any dependencies that you want to inject
+// into the callback, that will be resolved by the fx framework
+func (f *Builder) WithOnShutdown(newCallback any) *Builder {
+	f.options = append(f.options, fx.Provide(fx.Annotate(newCallback, fx.ResultTags(`group:"on_shutdown"`))))
+	return f
+}
+
+// WithTransport adds transport that the server would be served over
+//
+// It can be called several times to serve the same tools, resources and
+// prompts over several transports at once, for example stdio for desktop
+// client and streamable HTTP for remote agents. Transports are started and
+// stopped together, when any of them is done, the whole app is stopped.
+// Transports implementing server.SessionSharingTransport keep sessions
+// in the same session manager, which is the one provided to fx.
 func (f *Builder) WithTransport(transport server.Transport) *Builder {
-	f.transport = transport
+	f.transports = append(f.transports, transport)
 	return f
 }
 
@@ -138,18 +205,19 @@ func (f *Builder) WithExtraServerOptions(extraOptions ...server.ServerOption) *B
 
 // BuildFxApp builds the fx.App instance as configured by `With*` methods
 func (f *Builder) BuildFxApp() (*fx.App, error) {
-	if f.transport == nil {
+	if len(f.transports) == 0 {
 		return nil, ErrNoTransportSpecified
 	}
+	sessionManager := f.shareSessionManager()
 
 	f.options = append(f.options, fxctx.ProvideToolMux())
 	f.options = append(f.options, fxctx.ProvideResourceMux())
 	f.options = append(f.options, fxctx.ProvidePromptMux())
 	f.options = append(f.options, fxctx.ProvideCompleteMux())
 	f.options = append(f.options, fx.Provide(func() *session.SessionManager {
-		return f.transport.GetSessionManager()
+		return sessionManager
 	}))
-	f.options = append(f.options, f.provideServerLifecycle(f.transport))
+	f.options = append(f.options, f.provideServerLifecycle(f.transports))
 
 	return fx.New(fx.Options(f.options...)), nil
 }
@@ -161,14 +229,49 @@ func (f *Builder) Run() error {
 		return err
 	}
 	app.Run()
-	if f.transportError != nil {
-		return f.transportError
+	if err := f.Err(); err != nil {
+		return err
 	}
 	return app.Err()
 }
 
+// Err returns errors of transports that failed to run, joined together,
+// each of them is *TransportError
 func (f *Builder) Err() error {
-	return f.transportError
+	f.transportErrorsMu.Lock()
+	defer f.transportErrorsMu.Unlock()
+	return errors.Join(f.transportErrors...)
+}
+
+func (f *Builder) addTransportError(index int, err error) {
+	f.transportErrorsMu.Lock()
+	defer f.transportErrorsMu.Unlock()
+	f.transportErrors = append(f.transportErrors, &TransportError{
+		Index:     index,
+		Transport: f.transports[index],
+		Err:       err,
+	})
+}
+
+// shareSessionManager makes transports keep sessions in session manager
+// of the first transport that supports sharing and returns it
+func (f *Builder) shareSessionManager() *session.SessionManager {
+	var shared *session.SessionManager
+	for _, transport := range f.transports {
+		sharing, ok := transport.(server.SessionSharingTransport)
+		if !ok {
+			continue
+		}
+		if shared == nil {
+			shared = sharing.GetSessionManager()
+			continue
+		}
+		sharing.SetSessionManager(shared)
+	}
+	if shared == nil {
+		shared = f.transports[0].GetSessionManager()
+	}
+	return shared
 }
 
 type ServerLifecycleParams struct {
@@ -179,18 +282,41 @@ type ServerLifecycleParams struct {
 	PromptMux   fxctx.PromptMux   `optional:"true"`
 	CompleteMux fxctx.CompleteMux `optional:"true"`
 
+	Methods []fxctx.Method `group:"methods"`
+
+	OnInitialized []server.OnInitializedFunc `group:"on_initialized"`
+	OnShutdown    []server.OnShutdownFunc    `group:"on_shutdown"`
+
 	SessionManager *session.SessionManager
 }
 
-func (f *Builder) getServerCapabilities() *mcp.ServerCapabilities {
-	if f.capabilities != nil {
+func (f *Builder) getServerCapabilities(methods []fxctx.Method) *mcp.ServerCapabilities {
+	if len(methods) == 0 && f.capabilities != nil {
 		return f.capabilities
 	}
 	serverCapabilities := &mcp.ServerCapabilities{}
+	if f.capabilities != nil {
+		// copy, so that capabilities given to WithServerCapabilities are not changed
+		*serverCapabilities = *f.capabilities
+	}
+	if len(methods) == 0 {
+		return serverCapabilities
+	}
+
+	experimental := mcp.ServerCapabilitiesExperimental{}
+	for name, capability := range serverCapabilities.Experimental {
+		experimental[name] = capability
+	}
+	for _, method := range methods {
+		if _, ok := experimental[method.GetMethod()]; !ok {
+			experimental[method.GetMethod()] = map[string]interface{}{}
+		}
+	}
+	serverCapabilities.Experimental = experimental
 	return serverCapabilities
 }
 
-func (f *Builder) provideServerLifecycle(transport server.Transport) fx.Option {
+func (f *Builder) provideServerLifecycle(transports []server.Transport) fx.Option {
 	return fx.Invoke((func(
 		lc fx.Lifecycle,
 		p ServerLifecycleParams,
@@ -212,26 +338,50 @@ func (f *Builder) provideServerLifecycle(transport server.Transport) fx.Option {
 						if p.CompleteMux != nil {
 							p.CompleteMux.RegisterHandlers(s)
 						}
+						for _, method := range p.Methods {
+							method.RegisterHandler(s)
+						}
 					},
 				}
-				options := append(f.extraServerOptions, serverStartOption)
-				go func() {
-					err := transport.Run(
-						f.getServerCapabilities(),
-						f.implementation,
-						options...,
-					)
-					if err != nil {
-						f.transportError = err
-					}
-
-					// shutdown the server when transport is done
-					_ = shutdowner.Shutdown()
-				}()
+				options := append(slices.Clone(f.extraServerOptions), serverStartOption)
+				for _, callback := range p.OnInitialized {
+					options = append(options, server.OnInitializedOption{Callback: callback})
+				}
+				for _, callback := range p.OnShutdown {
+					options = append(options, server.OnShutdownOption{Callback: callback})
+				}
+				capabilities := f.getServerCapabilities(p.Methods)
+				for i, transport := range transports {
+					go func() {
+						err := transport.Run(
+							capabilities,
+							f.implementation,
+							options...,
+						)
+						if err != nil {
+							f.addTransportError(i, err)
+						}
+
+						// shutdown the server when any transport is done
+						_ = shutdowner.Shutdown()
+					}()
+				}
 				return nil
 			},
 			OnStop: func(ctx context.Context) error {
-				return transport.Shutdown(ctx)
+				errs := make([]error, len(transports))
+				var wg sync.WaitGroup
+				for i, transport := range transports {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						if err := transport.Shutdown(ctx); err != nil {
+							errs[i] = &TransportError{Index: i, Transport: transport, Err: err}
+						}
+					}()
+				}
+				wg.Wait()
+				return errors.Join(errs...)
 			},
 		})
 	}))
@@ -0,0 +1,307 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/strowk/foxy-contexts/pkg/client"
+	foxyevent "github.com/strowk/foxy-contexts/pkg/foxy_event"
+	"github.com/strowk/foxy-contexts/pkg/fxctx"
+	"github.com/strowk/foxy-contexts/pkg/inmemory"
+	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/server"
+	"github.com/strowk/foxy-contexts/pkg/session"
+	"go.uber.org/fx"
+)
+
+// newSessionTool reports whether session of the call
+// is known to session manager provided by the app
+func newSessionTool(sessionManager *session.SessionManager) fxctx.Tool {
+	return fxctx.NewTool(
+		&mcp.Tool{Name: "session", InputSchema: mcp.ToolInputSchema{Type: "object"}},
+		func(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
+			_, found := sessionManager.GetSessionFromContext(ctx)
+			return &mcp.CallToolResult{
+				Content: []interface{}{mcp.TextContent{Type: "text", Text: fmt.Sprint(found)}},
+			}
+		},
+	)
+}
+
+func TestMultipleTransports(t *testing.T) {
+	first := inmemory.NewTransport()
+	second := inmemory.NewTransport()
+	fxApp, err := NewBuilder().
+		WithTool(newSessionTool).
+		WithServerCapabilities(&mcp.ServerCapabilities{Tools: &mcp.ServerCapabilitiesTools{}}).
+		WithTransport(first).
+		WithTransport(second).
+		WithFxOptions(fx.NopLogger).
+		BuildFxApp()
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, fxApp.Start(ctx))
+	defer func() { assert.NoError(t, fxApp.Stop(ctx)) }()
+
+	assert.Same(t, first.GetSessionManager(), second.GetSessionManager())
+
+	for _, transport := range []*inmemory.Transport{first, second} {
+		c, err := transport.Connect(ctx)
+		require.NoError(t, err)
+		_, err = c.Initialize(ctx)
+		require.NoError(t, err)
+
+		called, err := c.CallTool(ctx, "session", nil)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"type": "text", "text": "true"}, called.Content[0])
+		require.NoError(t, c.Close())
+	}
+}
+
+// failingTransport fails to run right away
+type failingTransport struct {
+	*inmemory.Transport
+}
+
+var errFailedToListen = errors.New("failed to listen")
+
+func (failingTransport) Run(*mcp.ServerCapabilities, *mcp.Implementation, ...server.ServerOption) error {
+	return errFailedToListen
+}
+
+func TestTransportErrorStopsApp(t *testing.T) {
+	builder := NewBuilder().
+		WithTransport(inmemory.NewTransport()).
+		WithTransport(failingTransport{inmemory.NewTransport()}).
+		WithFxOptions(fx.NopLogger)
+
+	done := make(chan error, 1)
+	go func() { done <- builder.Run() }()
+
+	select {
+	case err := <-done:
+		var transportErr *TransportError
+		require.True(t, errors.As(err, &transportErr))
+		assert.Equal(t, 1, transportErr.Index)
+		assert.ErrorIs(t, err, errFailedToListen)
+	case <-time.After(5 * time.Second):
+		t.Fatal("app was not stopped")
+	}
+}
+
+func TestNoTransport(t *testing.T) {
+	_, err := NewBuilder().BuildFxApp()
+	assert.ErrorIs(t, err, ErrNoTransportSpecified)
+}
+
+type watchRequest struct {
+	Params struct {
+		Kind string `json:"kind"`
+	} `json:"params"`
+}
+
+func (watchRequest) GetMethod() string {
+	return "x-k8s/watch"
+}
+
+type watchResult struct {
+	Watching string `json:"watching"`
+}
+
+func TestWithMethod(t *testing.T) {
+	transport := inmemory.NewTransport()
+	fxApp, err := NewBuilder().
+		WithMethod(func() fxctx.Method {
+			return fxctx.NewMethod(func(ctx context.Context, req *watchRequest) (*watchResult, *jsonrpc2.Error) {
+				return &watchResult{Watching: req.Params.Kind}, nil
+			})
+		}).
+		WithServerCapabilities(&mcp.ServerCapabilities{
+			Experimental: mcp.ServerCapabilitiesExperimental{"other": {"enabled": true}},
+		}).
+		WithTransport(transport).
+		WithFxOptions(fx.NopLogger).
+		BuildFxApp()
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, fxApp.Start(ctx))
+	defer func() { assert.NoError(t, fxApp.Stop(ctx)) }()
+
+	c, err := transport.Connect(ctx)
+	require.NoError(t, err)
+	defer c.Close()
+	initialized, err := c.Initialize(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, mcp.ServerCapabilitiesExperimental{
+		"other":       {"enabled": true},
+		"x-k8s/watch": {},
+	}, initialized.Capabilities.Experimental)
+
+	request := &watchRequest{}
+	request.Params.Kind = "pods"
+	var result watchResult
+	require.NoError(t, c.Request(ctx, request, &result))
+	assert.Equal(t, "pods", result.Watching)
+
+	var responseErr *client.ResponseError
+	require.True(t, errors.As(c.Request(ctx, &unknownRequest{}, &result), &responseErr))
+	assert.Equal(t, -32601, responseErr.Code)
+}
+
+type unknownRequest struct{}
+
+func (unknownRequest) GetMethod() string {
+	return "x-k8s/unknown"
+}
+
+type recordingLogger struct {
+	mu     sync.Mutex
+	events []foxyevent.Event
+}
+
+func (l *recordingLogger) LogEvent(e foxyevent.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, e)
+}
+
+func (l *recordingLogger) Events() []foxyevent.Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]foxyevent.Event(nil), l.events...)
+}
+
+func TestToolEvents(t *testing.T) {
+	logger := &recordingLogger{}
+	transport := inmemory.NewTransport()
+	fxApp, err := NewBuilder().
+		WithTool(func() fxctx.Tool {
+			return fxctx.NewTool(
+				&mcp.Tool{Name: "fail", InputSchema: mcp.ToolInputSchema{Type: "object"}},
+				func(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
+					isError := true
+					return &mcp.CallToolResult{
+						Content: []interface{}{mcp.TextContent{Type: "text", Text: "disk is full"}},
+						IsError: &isError,
+					}
+				},
+			)
+		}).
+		WithServerCapabilities(&mcp.ServerCapabilities{Tools: &mcp.ServerCapabilitiesTools{}}).
+		WithExtraServerOptions(server.LoggerOption{Logger: logger}).
+		WithTransport(transport).
+		WithFxOptions(fx.NopLogger).
+		BuildFxApp()
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, fxApp.Start(ctx))
+	defer func() { assert.NoError(t, fxApp.Stop(ctx)) }()
+
+	c, err := transport.Connect(ctx)
+	require.NoError(t, err)
+	defer c.Close()
+	_, err = c.Initialize(ctx)
+	require.NoError(t, err)
+	_, err = c.CallTool(ctx, "fail", nil)
+	require.NoError(t, err)
+	_, err = c.CallTool(ctx, "missing", nil)
+	require.Error(t, err)
+
+	var sessionId string
+	var toolEvents []foxyevent.Event
+	for _, event := range logger.Events() {
+		switch e := event.(type) {
+		case foxyevent.SessionCreated:
+			assert.Equal(t, "inmemory", e.Transport)
+			sessionId = e.SessionId
+		case foxyevent.ToolInvoked, foxyevent.ToolFailed:
+			toolEvents = append(toolEvents, e)
+		}
+	}
+	require.NotEmpty(t, sessionId)
+	require.Len(t, toolEvents, 4)
+	assert.Equal(t, foxyevent.ToolInvoked{SessionId: sessionId, RequestId: "2", Tool: "fail"}, toolEvents[0])
+	assert.Equal(t, foxyevent.ToolFailed{SessionId: sessionId, RequestId: "2", Tool: "fail", Err: errors.New("disk is full")}, toolEvents[1])
+	assert.Equal(t, foxyevent.ToolInvoked{SessionId: sessionId, RequestId: "3", Tool: "missing"}, toolEvents[2])
+	assert.Equal(t, foxyevent.ToolFailed{SessionId: sessionId, RequestId: "3", Tool: "missing", Err: fxctx.ErrToolNotFound}, toolEvents[3])
+}
+
+func TestResourceAndPromptEvents(t *testing.T) {
+	logger := &recordingLogger{}
+	transport := inmemory.NewTransport()
+	fxApp, err := NewBuilder().
+		WithResource(func() fxctx.Resource {
+			return fxctx.NewResource(
+				mcp.Resource{Name: "broken", Uri: "test://broken"},
+				func(_ context.Context, uri string) (*mcp.ReadResourceResult, error) {
+					return nil, errors.New("disk is full")
+				},
+			)
+		}).
+		WithPrompt(func() fxctx.Prompt {
+			return fxctx.NewPrompt(
+				mcp.Prompt{Name: "greeting"},
+				func(_ context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+					return &mcp.GetPromptResult{Messages: []mcp.PromptMessage{}}, nil
+				},
+			)
+		}).
+		WithServerCapabilities(&mcp.ServerCapabilities{
+			Resources: &mcp.ServerCapabilitiesResources{},
+			Prompts:   &mcp.ServerCapabilitiesPrompts{},
+		}).
+		WithExtraServerOptions(server.LoggerOption{Logger: logger}).
+		WithTransport(transport).
+		WithFxOptions(fx.NopLogger).
+		BuildFxApp()
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, fxApp.Start(ctx))
+	defer func() { assert.NoError(t, fxApp.Stop(ctx)) }()
+
+	c, err := transport.Connect(ctx)
+	require.NoError(t, err)
+	defer c.Close()
+	_, err = c.Initialize(ctx)
+	require.NoError(t, err)
+	_, err = c.ReadResource(ctx, "test://broken")
+	require.Error(t, err)
+	_, err = c.GetPrompt(ctx, "greeting", nil)
+	require.NoError(t, err)
+	_, err = c.GetPrompt(ctx, "missing", nil)
+	require.Error(t, err)
+
+	var sessionId string
+	var events []foxyevent.Event
+	for _, event := range logger.Events() {
+		switch e := event.(type) {
+		case foxyevent.SessionCreated:
+			sessionId = e.SessionId
+		case foxyevent.ResourceRequested, foxyevent.ResourceFailed, foxyevent.PromptRequested, foxyevent.PromptFailed:
+			events = append(events, e)
+		}
+	}
+	require.NotEmpty(t, sessionId)
+	assert.Equal(t, []foxyevent.Event{
+		foxyevent.ResourceRequested{SessionId: sessionId, RequestId: "2", Uri: "test://broken"},
+		foxyevent.ResourceFailed{SessionId: sessionId, RequestId: "2", Uri: "test://broken", Err: errors.New("disk is full")},
+		foxyevent.PromptRequested{SessionId: sessionId, RequestId: "3", Prompt: "greeting"},
+		foxyevent.PromptRequested{SessionId: sessionId, RequestId: "4", Prompt: "missing"},
+		foxyevent.PromptFailed{SessionId: sessionId, RequestId: "4", Prompt: "missing", Err: errors.New("prompt not found: missing")},
+	}, events)
+}
@@ -0,0 +1,355 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	foxyevent "github.com/strowk/foxy-contexts/pkg/foxy_event"
+)
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func signJWT(t *testing.T, alg string, kid string, key crypto.Signer, claims map[string]any) string {
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		require.NoError(t, err)
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + b64(signature)
+}
+
+func writeJWKS(t *testing.T, path string, rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) {
+	keys := []map[string]string{}
+	if rsaKey != nil {
+		keys = append(keys, map[string]string{
+			"kty": "RSA", "kid": "rsa-1", "alg": "RS256", "use": "sig",
+			"n": b64(rsaKey.N.Bytes()),
+			"e": b64(big.NewInt(int64(rsaKey.E)).Bytes()),
+		})
+	}
+	if ecKey != nil {
+		keys = append(keys, map[string]string{
+			"kty": "EC", "kid": "ec-1", "crv": "P-256",
+			"x": b64(ecKey.X.FillBytes(make([]byte, 32))),
+			"y": b64(ecKey.Y.FillBytes(make([]byte, 32))),
+		})
+	}
+	data, err := json.Marshal(map[string]any{"keys": keys})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+}
+
+func TestJWKSFileVerifier(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, jwksPath, rsaKey, nil)
+
+	v, err := NewJWKSFileVerifier(jwksPath,
+		JWTIssuer{Issuer: "https://auth.example.com"},
+		JWTAudience{Audience: "https://mcp.example.com"},
+	)
+	require.NoError(t, err)
+
+	claims := func(modify func(map[string]any)) map[string]any {
+		c := map[string]any{
+			"iss":   "https://auth.example.com",
+			"sub":   "alice",
+			"aud":   []string{"https://mcp.example.com"},
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"scope": "tools:read tools:call",
+		}
+		if modify != nil {
+			modify(c)
+		}
+		return c
+	}
+
+	t.Run("valid RS256 token", func(t *testing.T) {
+		p, err := v.VerifyToken(context.Background(), signJWT(t, "RS256", "rsa-1", rsaKey, claims(nil)))
+		require.NoError(t, err)
+		assert.Equal(t, "alice", p.Subject)
+		assert.True(t, p.HasScope("tools:call"))
+		assert.Equal(t, "https://auth.example.com", p.Claims["iss"])
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		_, err := v.VerifyToken(context.Background(), signJWT(t, "RS256", "rsa-1", rsaKey, claims(func(c map[string]any) {
+			c["exp"] = time.Now().Add(-time.Minute).Unix()
+		})))
+		assert.ErrorIs(t, err, ErrTokenExpired)
+	})
+
+	t.Run("wrong audience", func(t *testing.T) {
+		_, err := v.VerifyToken(context.Background(), signJWT(t, "RS256", "rsa-1", rsaKey, claims(func(c map[string]any) {
+			c["aud"] = "https://other.example.com"
+		})))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("wrong issuer", func(t *testing.T) {
+		_, err := v.VerifyToken(context.Background(), signJWT(t, "RS256", "rsa-1", rsaKey, claims(func(c map[string]any) {
+			c["iss"] = "https://evil.example.com"
+		})))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("tampered payload", func(t *testing.T) {
+		token := signJWT(t, "RS256", "rsa-1", rsaKey, claims(nil))
+		parts := strings.Split(token, ".")
+		payload, err := json.Marshal(claims(func(c map[string]any) { c["sub"] = "mallory" }))
+		require.NoError(t, err)
+		_, err = v.VerifyToken(context.Background(), parts[0]+"."+b64(payload)+"."+parts[2])
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("alg none is rejected", func(t *testing.T) {
+		header, _ := json.Marshal(map[string]string{"alg": "none", "kid": "rsa-1"})
+		payload, _ := json.Marshal(claims(nil))
+		_, err := v.VerifyToken(context.Background(), b64(header)+"."+b64(payload)+".")
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("token without expiration", func(t *testing.T) {
+		_, err := v.VerifyToken(context.Background(), signJWT(t, "RS256", "rsa-1", rsaKey, claims(func(c map[string]any) {
+			delete(c, "exp")
+		})))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+	})
+
+	t.Run("rotated key is picked up from file", func(t *testing.T) {
+		now := time.Now()
+		v.now = func() time.Time { return now }
+		defer func() { v.now = time.Now }()
+
+		token := signJWT(t, "ES256", "ec-1", ecKey, claims(nil))
+		_, err := v.VerifyToken(context.Background(), token)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+
+		// file is not checked again until reload interval passes
+		writeJWKS(t, jwksPath, rsaKey, ecKey)
+		_, err = v.VerifyToken(context.Background(), token)
+		assert.ErrorIs(t, err, ErrInvalidToken)
+
+		now = now.Add(DEFAULT_JWKS_RELOAD_INTERVAL)
+		p, err := v.VerifyToken(context.Background(), token)
+		require.NoError(t, err)
+		assert.Equal(t, "alice", p.Subject)
+	})
+
+	t.Run("failure to reload file rejects token", func(t *testing.T) {
+		now := time.Now().Add(2 * DEFAULT_JWKS_RELOAD_INTERVAL)
+		v.now = func() time.Time { return now }
+		defer func() { v.now = time.Now }()
+		logger := &recordingLogger{}
+		v.logger = logger
+
+		require.NoError(t, os.Remove(jwksPath))
+		_, err := v.VerifyToken(context.Background(), signJWT(t, "RS256", "rsa-2", rsaKey, claims(nil)))
+		assert.ErrorIs(t, err, ErrInvalidToken)
+		require.Len(t, logger.events(), 1)
+		assert.Equal(t, jwksPath, logger.events()[0].(foxyevent.JWKSFailedReloading).Path)
+
+		// keys loaded before are still used
+		_, err = v.VerifyToken(context.Background(), signJWT(t, "RS256", "rsa-1", rsaKey, claims(nil)))
+		assert.NoError(t, err)
+	})
+}
+
+type recordingLogger struct {
+	mu       sync.Mutex
+	recorded []foxyevent.Event
+}
+
+func (l *recordingLogger) LogEvent(e foxyevent.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.recorded = append(l.recorded, e)
+}
+
+func (l *recordingLogger) events() []foxyevent.Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]foxyevent.Event(nil), l.recorded...)
+}
+
+func TestJWKSFileVerifierAudienceIsRequired(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, jwksPath, rsaKey, nil)
+
+	_, err = NewJWKSFileVerifier(jwksPath)
+	assert.Error(t, err)
+
+	v, err := NewJWKSFileVerifier(jwksPath, JWTSkipAudience{})
+	require.NoError(t, err)
+	_, err = v.VerifyToken(context.Background(), signJWT(t, "RS256", "rsa-1", rsaKey, map[string]any{
+		"sub": "alice",
+		"aud": "https://other.example.com",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}))
+	assert.NoError(t, err)
+}
+
+func TestIntrospectionVerifier(t *testing.T) {
+	introspect := func(ctx context.Context, token string) (*IntrospectionResponse, error) {
+		audience := Audience{"https://mcp.example.com"}
+		switch token {
+		case "active":
+			return &IntrospectionResponse{Active: true, Subject: "bob", Scope: "a b", Audience: audience, ExpiresAt: time.Now().Add(time.Hour).Unix()}, nil
+		case "expired":
+			return &IntrospectionResponse{Active: true, Subject: "bob", Audience: audience, ExpiresAt: time.Now().Add(-time.Hour).Unix()}, nil
+		case "other":
+			return &IntrospectionResponse{Active: true, Subject: "bob", Audience: Audience{"https://other.example.com"}}, nil
+		default:
+			return &IntrospectionResponse{Active: false}, nil
+		}
+	}
+
+	_, err := NewIntrospectionVerifier(introspect)
+	assert.Error(t, err)
+
+	v, err := NewIntrospectionVerifier(introspect, IntrospectionAudience{Audience: "https://mcp.example.com"})
+	require.NoError(t, err)
+
+	p, err := v.VerifyToken(context.Background(), "active")
+	require.NoError(t, err)
+	assert.Equal(t, "bob", p.Subject)
+	assert.Equal(t, []string{"a", "b"}, p.Scopes)
+
+	_, err = v.VerifyToken(context.Background(), "expired")
+	assert.ErrorIs(t, err, ErrTokenExpired)
+
+	_, err = v.VerifyToken(context.Background(), "revoked")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	_, err = v.VerifyToken(context.Background(), "other")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	v, err = NewIntrospectionVerifier(introspect, IntrospectionSkipAudience{})
+	require.NoError(t, err)
+	_, err = v.VerifyToken(context.Background(), "other")
+	assert.NoError(t, err)
+}
+
+func TestMiddleware(t *testing.T) {
+	config := Config{
+		Verifier: NewStaticTokenVerifier(map[string]Principal{
+			"reader": {Subject: "carol", Scopes: []string{"mcp"}},
+			"other":  {Subject: "dave"},
+		}),
+		RequiredScopes: []string{"mcp"},
+		Metadata: &ProtectedResourceMetadata{
+			AuthorizationServers: []string{"https://auth.example.com"},
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET "+PROTECTED_RESOURCE_METADATA_PATH, MetadataHandler(config))
+	mux.Handle("POST /mcp", Middleware(config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := PrincipalFromContext(r.Context())
+		require.True(t, ok)
+		_, _ = w.Write([]byte(p.Subject))
+	})))
+
+	do := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Host = "mcp.example.com"
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("missing token", func(t *testing.T) {
+		rec := do("POST", "/mcp", "")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Equal(t,
+			`Bearer realm="mcp", resource_metadata="http://mcp.example.com/.well-known/oauth-protected-resource"`,
+			rec.Header().Get("WWW-Authenticate"))
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		rec := do("POST", "/mcp", "nope")
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Contains(t, rec.Header().Get("WWW-Authenticate"), `error="invalid_token"`)
+	})
+
+	t.Run("insufficient scope", func(t *testing.T) {
+		rec := do("POST", "/mcp", "other")
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+		assert.Contains(t, rec.Header().Get("WWW-Authenticate"), `error="insufficient_scope", error_description="bearer token does not have required scope", scope="mcp"`)
+	})
+
+	t.Run("valid token", func(t *testing.T) {
+		rec := do("POST", "/mcp", "reader")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "carol", rec.Body.String())
+	})
+
+	t.Run("metadata", func(t *testing.T) {
+		rec := do("GET", PROTECTED_RESOURCE_METADATA_PATH, "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{
+			"resource": "http://mcp.example.com",
+			"authorization_servers": ["https://auth.example.com"],
+			"bearer_methods_supported": ["header"]
+		}`, rec.Body.String())
+	})
+
+	t.Run("forwarded proto", func(t *testing.T) {
+		forwarded := func(config Config) string {
+			req := httptest.NewRequest("POST", "/mcp", nil)
+			req.Host = "mcp.example.com"
+			req.Header.Set("X-Forwarded-Proto", "https")
+			rec := httptest.NewRecorder()
+			Middleware(config)(http.NotFoundHandler()).ServeHTTP(rec, req)
+			return rec.Header().Get("WWW-Authenticate")
+		}
+
+		// header is set by client, unless proxy is trusted to set it
+		assert.Contains(t, forwarded(config), `resource_metadata="http://mcp.example.com/`)
+
+		trusted := config
+		trusted.TrustForwardedProto = true
+		assert.Contains(t, forwarded(trusted), `resource_metadata="https://mcp.example.com/`)
+	})
+}
@@ -0,0 +1,482 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	foxyevent "github.com/strowk/foxy-contexts/pkg/foxy_event"
+)
+
+// DEFAULT_JWKS_RELOAD_INTERVAL is how often JWKS file can be read again
+// at most, when tokens signed by keys with unknown "kid" are presented.
+const DEFAULT_JWKS_RELOAD_INTERVAL = time.Minute
+
+// Audience is the "aud" claim, which can be either a single string or an array of strings.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return fmt.Errorf("audience must be a string or an array of strings: %w", err)
+	}
+	*a = multiple
+	return nil
+}
+
+// JWTVerifier validates JWT access tokens signed by keys from a JSON Web Key Set file.
+//
+// Supported algorithms are RS256, RS384, RS512, PS256, PS384, PS512,
+// ES256, ES384, ES512 and EdDSA. Symmetric algorithms and "none" are rejected.
+// Tokens must have "exp" claim.
+type JWTVerifier struct {
+	jwksPath       string
+	issuer         string
+	audience       string
+	skipAudience   bool
+	leeway         time.Duration
+	reloadInterval time.Duration
+	logger         foxyevent.Logger
+	now            func() time.Time
+
+	mu   sync.RWMutex
+	keys []jwk
+
+	// reloadMu guards reading of the file when key is not found,
+	// so that concurrent requests do not read it more than once
+	reloadMu   sync.Mutex
+	lastReload time.Time
+	modTime    time.Time
+	size       int64
+}
+
+type JWTVerifierOption interface {
+	apply(*JWTVerifier)
+}
+
+// JWTIssuer requires tokens to have "iss" claim equal to Issuer.
+type JWTIssuer struct {
+	Issuer string
+}
+
+func (o JWTIssuer) apply(v *JWTVerifier) {
+	v.issuer = o.Issuer
+}
+
+// JWTAudience requires tokens to contain Audience in "aud" claim.
+//
+// MCP servers should set this to their canonical resource URI,
+// so that tokens issued for other services are not accepted.
+// Either this or JWTSkipAudience must be given.
+type JWTAudience struct {
+	Audience string
+}
+
+func (o JWTAudience) apply(v *JWTVerifier) {
+	v.audience = o.Audience
+}
+
+// JWTSkipAudience accepts tokens issued for any audience, which is only
+// safe when authorization server issues tokens for this server alone.
+type JWTSkipAudience struct{}
+
+func (o JWTSkipAudience) apply(v *JWTVerifier) {
+	v.skipAudience = true
+}
+
+// JWTLeeway allows for clock skew when validating "exp" and "nbf" claims.
+type JWTLeeway struct {
+	Leeway time.Duration
+}
+
+func (o JWTLeeway) apply(v *JWTVerifier) {
+	v.leeway = o.Leeway
+}
+
+// JWTReloadInterval limits how often JWKS file is read again, when tokens signed
+// by keys with unknown "kid" are presented, defaults to DEFAULT_JWKS_RELOAD_INTERVAL.
+type JWTReloadInterval struct {
+	Interval time.Duration
+}
+
+func (o JWTReloadInterval) apply(v *JWTVerifier) {
+	v.reloadInterval = o.Interval
+}
+
+// JWTLogger sets logger for failures to reload JWKS file,
+// defaults to slog.Default().
+type JWTLogger struct {
+	Logger foxyevent.Logger
+}
+
+func (o JWTLogger) apply(v *JWTVerifier) {
+	v.logger = o.Logger
+}
+
+// NewJWKSFileVerifier creates JWTVerifier using keys from JWKS file at given path.
+//
+// The file is read once on creation and then again when token is signed
+// by a key with unknown "kid", which allows to rotate keys without restart.
+// The file is checked at most once per JWTReloadInterval and only read
+// when it has been modified, until then unknown keys are rejected right away,
+// so that presenting made up "kid" does not cost anything.
+//
+// Either JWTAudience or JWTSkipAudience option is required.
+func NewJWKSFileVerifier(path string, options ...JWTVerifierOption) (*JWTVerifier, error) {
+	v := &JWTVerifier{
+		jwksPath:       path,
+		reloadInterval: DEFAULT_JWKS_RELOAD_INTERVAL,
+		logger:         foxyevent.NewSlogLogger(slog.Default()),
+		now:            time.Now,
+	}
+	for _, o := range options {
+		o.apply(v)
+	}
+	if v.audience == "" && !v.skipAudience {
+		return nil, errors.New("auth: JWTAudience is required, use JWTSkipAudience to accept tokens for any audience")
+	}
+	v.lastReload = v.now()
+	if err := v.reload(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+type jwk struct {
+	kid string
+	alg string
+	key crypto.PublicKey
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (v *JWTVerifier) reload() error {
+	info, err := os.Stat(v.jwksPath)
+	if err != nil {
+		return fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+	if info.ModTime().Equal(v.modTime) && info.Size() == v.size {
+		// keys are the same as already loaded
+		return nil
+	}
+	data, err := os.ReadFile(v.jwksPath)
+	if err != nil {
+		return fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse JWKS file %s: %w", v.jwksPath, err)
+	}
+	v.modTime = info.ModTime()
+	v.size = info.Size()
+	v.mu.Lock()
+	v.keys = keys
+	v.mu.Unlock()
+	return nil
+}
+
+// reloadUnknown reads JWKS file again to look for key that was not found,
+// unless it has been checked recently, it returns true if file was checked
+func (v *JWTVerifier) reloadUnknown() (bool, error) {
+	v.reloadMu.Lock()
+	defer v.reloadMu.Unlock()
+	now := v.now()
+	if now.Sub(v.lastReload) < v.reloadInterval {
+		return false, nil
+	}
+	v.lastReload = now
+	return true, v.reload()
+}
+
+func parseJWKS(data []byte) ([]jwk, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make([]jwk, 0, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", k.Kid, err)
+		}
+		keys = append(keys, jwk{kid: k.Kid, alg: k.Alg, key: key})
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent: %w", err)
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("exponent is too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key: %w", err)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 public key size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+type jwtClaims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub"`
+	Audience  Audience `json:"aud"`
+	ExpiresAt *float64 `json:"exp"`
+	NotBefore *float64 `json:"nbf"`
+	ClientID  string   `json:"client_id"`
+	Scope     string   `json:"scope"`
+	Scp       []string `json:"scp"`
+}
+
+func (v *JWTVerifier) VerifyToken(_ context.Context, token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: token is not a JWT", ErrInvalidToken)
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed header: %v", ErrInvalidToken, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature: %v", ErrInvalidToken, err)
+	}
+	if err := v.verifySignature(header, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims: %v", ErrInvalidToken, err)
+	}
+	var allClaims map[string]any
+	if err := decodeSegment(parts[1], &allClaims); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims: %v", ErrInvalidToken, err)
+	}
+
+	now := v.now()
+	principal := &Principal{
+		Subject:  claims.Subject,
+		ClientID: claims.ClientID,
+		Scopes:   strings.Fields(claims.Scope),
+		Claims:   allClaims,
+	}
+	if len(principal.Scopes) == 0 {
+		principal.Scopes = claims.Scp
+	}
+	if claims.ExpiresAt == nil {
+		return nil, fmt.Errorf("%w: token has no expiration", ErrInvalidToken)
+	}
+	principal.ExpiresAt = time.Unix(int64(*claims.ExpiresAt), 0)
+	if !now.Before(principal.ExpiresAt.Add(v.leeway)) {
+		return nil, ErrTokenExpired
+	}
+	if claims.NotBefore != nil {
+		notBefore := time.Unix(int64(*claims.NotBefore), 0)
+		if now.Add(v.leeway).Before(notBefore) {
+			return nil, fmt.Errorf("%w: token is not valid yet", ErrInvalidToken)
+		}
+	}
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, claims.Issuer)
+	}
+	if !v.skipAudience && !slices.Contains(claims.Audience, v.audience) {
+		return nil, fmt.Errorf("%w: token was not issued for this resource", ErrInvalidToken)
+	}
+	return principal, nil
+}
+
+func decodeSegment(segment string, into any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, into)
+}
+
+func (v *JWTVerifier) findKeys(header jwtHeader) []jwk {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	var found []jwk
+	for _, k := range v.keys {
+		if header.Kid != "" && k.kid != header.Kid {
+			continue
+		}
+		if k.alg != "" && k.alg != header.Alg {
+			continue
+		}
+		found = append(found, k)
+	}
+	return found
+}
+
+func (v *JWTVerifier) verifySignature(header jwtHeader, signed []byte, signature []byte) error {
+	keys := v.findKeys(header)
+	if len(keys) == 0 && header.Kid != "" {
+		// key might have been rotated since file was read
+		reloaded, err := v.reloadUnknown()
+		if err != nil {
+			// previously loaded keys are still used, so only this token is rejected
+			v.logger.LogEvent(foxyevent.JWKSFailedReloading{Path: v.jwksPath, Err: err})
+			return fmt.Errorf("%w: no key found to verify signature", ErrInvalidToken)
+		}
+		if reloaded {
+			keys = v.findKeys(header)
+		}
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("%w: no key found to verify signature", ErrInvalidToken)
+	}
+
+	for _, k := range keys {
+		if err := verifyWithKey(header.Alg, k.key, signed, signature); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: signature verification failed", ErrInvalidToken)
+}
+
+func verifyWithKey(alg string, key crypto.PublicKey, signed []byte, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "PS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "PS512", "ES512":
+		hash = crypto.SHA512
+	case "EdDSA":
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok || !ed25519.Verify(pub, signed, signature) {
+			return ErrInvalidToken
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, alg)
+	}
+
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch alg[0] {
+	case 'R':
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrInvalidToken
+		}
+		return rsa.VerifyPKCS1v15(pub, hash, digest, signature)
+	case 'P':
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrInvalidToken
+		}
+		return rsa.VerifyPSS(pub, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	default:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return ErrInvalidToken
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return ErrInvalidToken
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return ErrInvalidToken
+		}
+		return nil
+	}
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// PROTECTED_RESOURCE_METADATA_PATH is where HTTP transports serve
+// OAuth 2.0 Protected Resource Metadata, see RFC 9728.
+const PROTECTED_RESOURCE_METADATA_PATH = "/.well-known/oauth-protected-resource"
+
+// ProtectedResourceMetadata describes MCP server as OAuth 2.0 protected resource,
+// so that clients could discover which authorization server to use.
+//
+// see https://modelcontextprotocol.io/specification/2025-06-18/basic/authorization
+type ProtectedResourceMetadata struct {
+	// Resource is the canonical URI of the MCP server, when empty
+	// it is derived from the request
+	Resource               string   `json:"resource"`
+	AuthorizationServers   []string `json:"authorization_servers,omitempty"`
+	ScopesSupported        []string `json:"scopes_supported,omitempty"`
+	BearerMethodsSupported []string `json:"bearer_methods_supported,omitempty"`
+	ResourceName           string   `json:"resource_name,omitempty"`
+	ResourceDocumentation  string   `json:"resource_documentation,omitempty"`
+}
+
+// Config configures authentication of HTTP transports.
+type Config struct {
+	// Verifier validates bearer tokens, it is required
+	Verifier TokenVerifier
+
+	// RequiredScopes must all be granted to the token, otherwise
+	// request is rejected with 403 Forbidden
+	RequiredScopes []string
+
+	// Metadata is served at PROTECTED_RESOURCE_METADATA_PATH and advertised
+	// in WWW-Authenticate header, when nil the metadata endpoint is not served
+	Metadata *ProtectedResourceMetadata
+
+	// Realm is reported in WWW-Authenticate header, defaults to "mcp"
+	Realm string
+
+	// TrustForwardedProto makes URLs advertised to clients use scheme
+	// from X-Forwarded-Proto header, it should only be set when server
+	// runs behind proxy that sets this header, as otherwise clients
+	// could make server advertise any scheme
+	TrustForwardedProto bool
+}
+
+type principalContextKey struct{}
+
+// WithPrincipal returns context carrying authenticated principal.
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, principal)
+}
+
+// PrincipalFromContext returns principal that has made the request,
+// tools and other handlers can use it to authorize per user.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalContextKey{}).(*Principal)
+	return principal, ok && principal != nil
+}
+
+// MetadataHandler serves Protected Resource Metadata from the config.
+func MetadataHandler(config Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if config.Metadata == nil {
+			http.NotFound(w, r)
+			return
+		}
+		metadata := *config.Metadata
+		if metadata.Resource == "" {
+			metadata.Resource = baseURL(r, config)
+		}
+		if metadata.BearerMethodsSupported == nil {
+			metadata.BearerMethodsSupported = []string{"header"}
+		}
+		writeJSON(w, http.StatusOK, metadata)
+	})
+}
+
+// Middleware rejects requests that do not carry a valid bearer token
+// in Authorization header and puts authenticated principal into request context.
+//
+// Failures are reported as 401 Unauthorized or 403 Forbidden
+// with WWW-Authenticate header per RFC 6750.
+func Middleware(config Config) func(http.Handler) http.Handler {
+	if config.Verifier == nil {
+		panic("auth: Config.Verifier is required")
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r)
+			if !ok {
+				challenge(w, r, config, http.StatusUnauthorized, "", ErrMissingToken)
+				return
+			}
+
+			principal, err := config.Verifier.VerifyToken(r.Context(), token)
+			if err != nil {
+				if errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrTokenExpired) {
+					challenge(w, r, config, http.StatusUnauthorized, "invalid_token", err)
+					return
+				}
+				http.Error(w, "failed to verify token", http.StatusInternalServerError)
+				return
+			}
+
+			for _, scope := range config.RequiredScopes {
+				if !principal.HasScope(scope) {
+					challenge(w, r, config, http.StatusForbidden, "insufficient_scope", ErrInsufficientScope)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+		})
+	}
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+func baseURL(r *http.Request, config Config) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	} else if config.TrustForwardedProto {
+		switch forwarded := r.Header.Get("X-Forwarded-Proto"); forwarded {
+		case "http", "https":
+			scheme = forwarded
+		}
+	}
+	return scheme + "://" + r.Host
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func challenge(w http.ResponseWriter, r *http.Request, config Config, status int, errorCode string, err error) {
+	realm := config.Realm
+	if realm == "" {
+		realm = "mcp"
+	}
+
+	params := []string{fmt.Sprintf("realm=%q", realm)}
+	if config.Metadata != nil {
+		params = append(params, fmt.Sprintf("resource_metadata=%q", baseURL(r, config)+PROTECTED_RESOURCE_METADATA_PATH))
+	}
+	if errorCode != "" {
+		params = append(params,
+			fmt.Sprintf("error=%q", errorCode),
+			fmt.Sprintf("error_description=%q", err.Error()))
+	}
+	if errorCode == "insufficient_scope" {
+		params = append(params, fmt.Sprintf("scope=%q", strings.Join(config.RequiredScopes, " ")))
+	}
+	w.Header().Set("WWW-Authenticate", "Bearer "+strings.Join(params, ", "))
+
+	body := map[string]string{"error_description": err.Error()}
+	if errorCode != "" {
+		body["error"] = errorCode
+	}
+	writeJSON(w, status, body)
+}
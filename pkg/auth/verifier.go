@@ -0,0 +1,209 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrMissingToken      = errors.New("bearer token is missing")
+	ErrInvalidToken      = errors.New("bearer token is invalid")
+	ErrTokenExpired      = errors.New("bearer token has expired")
+	ErrInsufficientScope = errors.New("bearer token does not have required scope")
+)
+
+// Principal is the authenticated user or client on whose behalf
+// the request is made.
+type Principal struct {
+	// Subject identifies the user, usually "sub" claim of the token
+	Subject string
+	// ClientID identifies OAuth client that obtained the token, if known
+	ClientID string
+	// Scopes granted to the token
+	Scopes []string
+	// ExpiresAt is when the token expires, zero if unknown
+	ExpiresAt time.Time
+	// Claims are all the claims known about the token,
+	// such as JWT payload or introspection response
+	Claims map[string]any
+}
+
+// HasScope reports whether the token was granted given scope.
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// TokenVerifier validates bearer token and returns the principal it was issued for.
+//
+// Implementations should return error wrapping ErrInvalidToken or ErrTokenExpired
+// when token is not acceptable, any other error is treated as a failure
+// to verify token and results in 500 Internal Server Error.
+type TokenVerifier interface {
+	VerifyToken(ctx context.Context, token string) (*Principal, error)
+}
+
+// TokenVerifierFunc allows to use a plain function as TokenVerifier.
+type TokenVerifierFunc func(ctx context.Context, token string) (*Principal, error)
+
+func (f TokenVerifierFunc) VerifyToken(ctx context.Context, token string) (*Principal, error) {
+	return f(ctx, token)
+}
+
+type staticTokenVerifier struct {
+	tokens []staticToken
+}
+
+// staticToken keeps hash of the token, so that tokens of different length
+// are compared in constant time too
+type staticToken struct {
+	hash      [sha256.Size]byte
+	principal Principal
+}
+
+// NewStaticTokenVerifier creates TokenVerifier that accepts only given tokens,
+// each of them authenticating corresponding principal.
+//
+// This is mostly useful for development and for servers used by a few
+// automated clients with pre-shared secrets.
+func NewStaticTokenVerifier(tokens map[string]Principal) TokenVerifier {
+	v := &staticTokenVerifier{tokens: make([]staticToken, 0, len(tokens))}
+	for token, principal := range tokens {
+		v.tokens = append(v.tokens, staticToken{hash: sha256.Sum256([]byte(token)), principal: principal})
+	}
+	return v
+}
+
+func (v *staticTokenVerifier) VerifyToken(_ context.Context, token string) (*Principal, error) {
+	hash := sha256.Sum256([]byte(token))
+	var found *Principal
+	// compare with every token, so that time taken does not tell which one is close
+	for i := range v.tokens {
+		if subtle.ConstantTimeCompare(v.tokens[i].hash[:], hash[:]) == 1 {
+			principal := v.tokens[i].principal
+			found = &principal
+		}
+	}
+	if found == nil {
+		return nil, ErrInvalidToken
+	}
+	return found, nil
+}
+
+// IntrospectionResponse is the result of token introspection
+// as defined in RFC 7662.
+type IntrospectionResponse struct {
+	Active    bool     `json:"active"`
+	Scope     string   `json:"scope,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	Username  string   `json:"username,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Issuer    string   `json:"iss,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+
+	// Extra holds any other information about the token
+	Extra map[string]any `json:"-"`
+}
+
+// IntrospectionFunc asks authorization server about the token,
+// typically by calling its introspection endpoint.
+type IntrospectionFunc func(ctx context.Context, token string) (*IntrospectionResponse, error)
+
+type introspectionVerifier struct {
+	introspect   IntrospectionFunc
+	audience     string
+	skipAudience bool
+	now          func() time.Time
+}
+
+type IntrospectionVerifierOption interface {
+	apply(*introspectionVerifier)
+}
+
+// IntrospectionAudience requires introspection response to contain Audience
+// in "aud", same as JWTAudience does for JWT verifier.
+// Either this or IntrospectionSkipAudience must be given.
+type IntrospectionAudience struct {
+	Audience string
+}
+
+func (o IntrospectionAudience) apply(v *introspectionVerifier) {
+	v.audience = o.Audience
+}
+
+// IntrospectionSkipAudience accepts tokens issued for any audience, which is only
+// safe when authorization server issues tokens for this server alone.
+type IntrospectionSkipAudience struct{}
+
+func (o IntrospectionSkipAudience) apply(v *introspectionVerifier) {
+	v.skipAudience = true
+}
+
+// NewIntrospectionVerifier creates TokenVerifier that delegates validation
+// of tokens to given introspection callback.
+//
+// Tokens are rejected when introspection reports them as not active,
+// when they are expired or were not issued for this server.
+// Either IntrospectionAudience or IntrospectionSkipAudience option is required.
+func NewIntrospectionVerifier(introspect IntrospectionFunc, options ...IntrospectionVerifierOption) (TokenVerifier, error) {
+	v := &introspectionVerifier{
+		introspect: introspect,
+		now:        time.Now,
+	}
+	for _, o := range options {
+		o.apply(v)
+	}
+	if v.audience == "" && !v.skipAudience {
+		return nil, errors.New("auth: IntrospectionAudience is required, use IntrospectionSkipAudience to accept tokens for any audience")
+	}
+	return v, nil
+}
+
+func (v *introspectionVerifier) VerifyToken(ctx context.Context, token string) (*Principal, error) {
+	res, err := v.introspect(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to introspect token: %w", err)
+	}
+	if res == nil || !res.Active {
+		return nil, ErrInvalidToken
+	}
+
+	principal := &Principal{
+		Subject:  res.Subject,
+		ClientID: res.ClientID,
+		Scopes:   strings.Fields(res.Scope),
+		Claims:   map[string]any{},
+	}
+	if principal.Subject == "" {
+		principal.Subject = res.Username
+	}
+	if res.ExpiresAt != 0 {
+		principal.ExpiresAt = time.Unix(res.ExpiresAt, 0)
+		if !v.now().Before(principal.ExpiresAt) {
+			return nil, ErrTokenExpired
+		}
+	}
+	if !v.skipAudience && !slices.Contains(res.Audience, v.audience) {
+		return nil, fmt.Errorf("%w: token was not issued for this resource", ErrInvalidToken)
+	}
+
+	for k, val := range res.Extra {
+		principal.Claims[k] = val
+	}
+	if res.Username != "" {
+		principal.Claims["username"] = res.Username
+	}
+	if res.Issuer != "" {
+		principal.Claims["iss"] = res.Issuer
+	}
+	if len(res.Audience) > 0 {
+		principal.Claims["aud"] = res.Audience
+	}
+	return principal, nil
+}
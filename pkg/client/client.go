@@ -0,0 +1,373 @@
+// Package client implements MCP client, which can be used to talk
+// to MCP servers over any Transport, for example to test them
+// or to build agents and gateways in Go.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/server"
+)
+
+var (
+	ErrClosed       = errors.New("client is closed")
+	ErrDisconnected = errors.New("disconnected from server")
+)
+
+// ResponseError is returned when server has responded to request with error.
+type ResponseError struct {
+	Code    int
+	Message string
+	Data    any
+}
+
+func (e *ResponseError) Error() string {
+	if e.Data != nil {
+		return fmt.Sprintf("server responded with error %d %s: %v", e.Code, e.Message, e.Data)
+	}
+	return fmt.Sprintf("server responded with error %d %s", e.Code, e.Message)
+}
+
+type serverResponse struct {
+	result json.RawMessage
+	err    *jsonrpc2.Error
+}
+
+// Client talks to MCP server over transport, it is safe
+// to send requests from several goroutines at once.
+type Client struct {
+	transport Transport
+	router    jsonrpc2.JsonRpcRouter
+
+	clientInfo   mcp.Implementation
+	capabilities mcp.ClientCapabilities
+
+	lastRequestId    atomic.Int64
+	pendingRequests  map[jsonrpc2.RequestId]chan serverResponse
+	pendingRequestMu sync.Mutex
+
+	// closed is closed once client is closed by Close
+	closed    chan struct{}
+	closeOnce sync.Once
+	// disconnected is closed once server would not send anything anymore
+	disconnected chan struct{}
+}
+
+// Connect starts transport and returns client talking to server over it.
+//
+// Client has to be initialized with Initialize before it can use the server.
+func Connect(ctx context.Context, transport Transport, options ...ClientOption) (*Client, error) {
+	c := &Client{
+		transport: transport,
+		router:    jsonrpc2.NewJsonRPCRouter(),
+
+		clientInfo: mcp.Implementation{
+			Name:    "foxy-contexts-client",
+			Version: "0.0.1",
+		},
+
+		pendingRequests: map[jsonrpc2.RequestId]chan serverResponse{},
+		closed:          make(chan struct{}),
+		disconnected:    make(chan struct{}),
+	}
+	jsonrpc2.Handle(c.router, func(_ context.Context, _ *mcp.PingRequest) (*struct{}, *jsonrpc2.Error) {
+		return &struct{}{}, nil
+	})
+	c.router.SetResponseHandler(c.handleServerResponse)
+	for _, o := range options {
+		o.apply(c)
+	}
+
+	messages, err := transport.Start(ctx)
+	if err != nil {
+		return nil, err
+	}
+	go c.read(messages)
+	return c, nil
+}
+
+// read handles messages from server until it disconnects
+func (c *Client) read(messages <-chan []byte) {
+	defer close(c.disconnected)
+	ctx := context.Background()
+	for data := range messages {
+		if jsonrpc2.IsResponse(data) || isNotification(data) {
+			// notifications are handled in order they were sent
+			c.router.Handle(ctx, data)
+			continue
+		}
+		// server waits for response to its request while handling
+		// request of the client, so it must not block reading
+		go c.respond(ctx, data)
+	}
+}
+
+func (c *Client) respond(ctx context.Context, data []byte) {
+	for _, res := range c.router.Handle(ctx, data) {
+		if res == nil || res.Id.IdIsMissing {
+			continue
+		}
+		out, err := json.Marshal(res)
+		if err != nil {
+			continue
+		}
+		_ = c.send(ctx, out)
+	}
+}
+
+func isNotification(data []byte) bool {
+	var msg struct {
+		Id json.RawMessage `json:"id"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return false
+	}
+	return msg.Id == nil
+}
+
+func (c *Client) handleServerResponse(_ context.Context, id jsonrpc2.RequestId, result json.RawMessage, err *jsonrpc2.Error) {
+	// only the first response is delivered, so duplicate one
+	// would not find the request pending anymore
+	c.pendingRequestMu.Lock()
+	responses, ok := c.pendingRequests[id]
+	delete(c.pendingRequests, id)
+	c.pendingRequestMu.Unlock()
+	if !ok {
+		// client has stopped waiting for this response
+		return
+	}
+	select {
+	case responses <- serverResponse{result: result, err: err}:
+	default:
+		// channel is buffered for the only response,
+		// so this is not expected, but reading must never block
+	}
+}
+
+func (c *Client) send(ctx context.Context, data []byte) error {
+	// closing client also disconnects it, so closed is checked first
+	select {
+	case <-c.closed:
+		return ErrClosed
+	default:
+	}
+	select {
+	case <-c.disconnected:
+		return ErrDisconnected
+	default:
+	}
+	return c.transport.Send(ctx, data)
+}
+
+// Request sends request to server, waits for response and unmarshals its result into result,
+// which can be nil if result is not needed. Error responses are returned as *ResponseError.
+func (c *Client) Request(ctx context.Context, request jsonrpc2.Request, result any) error {
+	id := jsonrpc2.NewIntRequestId(int(c.lastRequestId.Add(1)))
+	data, err := json.Marshal(jsonrpc2.JsonRpcRequest{Id: id, Request: request})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	responses := make(chan serverResponse, 1)
+	c.pendingRequestMu.Lock()
+	c.pendingRequests[id] = responses
+	c.pendingRequestMu.Unlock()
+	defer func() {
+		c.pendingRequestMu.Lock()
+		delete(c.pendingRequests, id)
+		c.pendingRequestMu.Unlock()
+	}()
+
+	if err := c.send(ctx, data); err != nil {
+		return err
+	}
+
+	select {
+	case res := <-responses:
+		if res.err != nil {
+			return &ResponseError{Code: res.err.Code, Message: res.err.Message, Data: res.err.Data}
+		}
+		if result == nil {
+			return nil
+		}
+		if err := json.Unmarshal(res.result, result); err != nil {
+			return fmt.Errorf("failed to parse %s result: %w", request.GetMethod(), err)
+		}
+		return nil
+	case <-c.disconnected:
+		return ErrDisconnected
+	case <-c.closed:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Notify sends notification to server.
+func (c *Client) Notify(ctx context.Context, notification jsonrpc2.Request) error {
+	data, err := json.Marshal(jsonrpc2.JsonRpcRequest{Id: jsonrpc2.NewMissingRequestId(), Request: notification})
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+	return c.send(ctx, data)
+}
+
+// initializeRequest is mcp.InitializeRequest that keeps declared
+// sampling capability, which is otherwise omitted as empty map
+type initializeRequest struct {
+	Params struct {
+		Capabilities struct {
+			Experimental mcp.ClientCapabilitiesExperimental `json:"experimental,omitempty"`
+			Roots        *mcp.ClientCapabilitiesRoots       `json:"roots,omitempty"`
+			Sampling     *mcp.ClientCapabilitiesSampling    `json:"sampling,omitempty"`
+		} `json:"capabilities"`
+		ClientInfo      mcp.Implementation `json:"clientInfo"`
+		ProtocolVersion string             `json:"protocolVersion"`
+	} `json:"params"`
+}
+
+func (initializeRequest) GetMethod() string {
+	return mcp.InitializeRequest{}.GetMethod()
+}
+
+// Initialize performs initialization handshake, declaring capabilities
+// for which handlers were given in options.
+func (c *Client) Initialize(ctx context.Context) (*mcp.InitializeResult, error) {
+	request := &initializeRequest{}
+	request.Params.ProtocolVersion = string(server.LATEST_PROTOCOL_VERSION)
+	request.Params.ClientInfo = c.clientInfo
+	request.Params.Capabilities.Experimental = c.capabilities.Experimental
+	request.Params.Capabilities.Roots = c.capabilities.Roots
+	if c.capabilities.Sampling != nil {
+		request.Params.Capabilities.Sampling = &c.capabilities.Sampling
+	}
+
+	var result mcp.InitializeResult
+	err := c.Request(ctx, request, &result)
+	if err != nil {
+		return nil, err
+	}
+	if setter, ok := c.transport.(protocolVersionSetter); ok {
+		setter.setProtocolVersion(result.ProtocolVersion)
+	}
+	if err := c.Notify(ctx, &mcp.InitializedNotification{}); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) Ping(ctx context.Context) error {
+	return c.Request(ctx, &mcp.PingRequest{}, nil)
+}
+
+func (c *Client) ListTools(ctx context.Context) (*mcp.ListToolsResult, error) {
+	var result mcp.ListToolsResult
+	if err := c.Request(ctx, &mcp.ListToolsRequest{}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) CallTool(ctx context.Context, name string, arguments map[string]any) (*mcp.CallToolResult, error) {
+	var result mcp.CallToolResult
+	err := c.Request(ctx, &mcp.CallToolRequest{
+		Params: mcp.CallToolRequestParams{Name: name, Arguments: arguments},
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) ListResources(ctx context.Context) (*mcp.ListResourcesResult, error) {
+	var result mcp.ListResourcesResult
+	if err := c.Request(ctx, &mcp.ListResourcesRequest{}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) ListResourceTemplates(ctx context.Context) (*mcp.ListResourceTemplatesResult, error) {
+	var result mcp.ListResourceTemplatesResult
+	if err := c.Request(ctx, &mcp.ListResourceTemplatesRequest{}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) ReadResource(ctx context.Context, uri string) (*mcp.ReadResourceResult, error) {
+	var result mcp.ReadResourceResult
+	err := c.Request(ctx, &mcp.ReadResourceRequest{
+		Params: mcp.ReadResourceRequestParams{Uri: uri},
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Subscribe asks server to send notifications/resources/updated
+// when resource with given uri changes, notifications are passed
+// to NotificationHandler.
+func (c *Client) Subscribe(ctx context.Context, uri string) error {
+	return c.Request(ctx, &mcp.SubscribeRequest{
+		Params: mcp.SubscribeRequestParams{Uri: uri},
+	}, nil)
+}
+
+func (c *Client) Unsubscribe(ctx context.Context, uri string) error {
+	return c.Request(ctx, &mcp.UnsubscribeRequest{
+		Params: mcp.UnsubscribeRequestParams{Uri: uri},
+	}, nil)
+}
+
+func (c *Client) ListPrompts(ctx context.Context) (*mcp.ListPromptsResult, error) {
+	var result mcp.ListPromptsResult
+	if err := c.Request(ctx, &mcp.ListPromptsRequest{}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) GetPrompt(ctx context.Context, name string, arguments map[string]string) (*mcp.GetPromptResult, error) {
+	var result mcp.GetPromptResult
+	err := c.Request(ctx, &mcp.GetPromptRequest{
+		Params: mcp.GetPromptRequestParams{Name: name, Arguments: arguments},
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Complete asks server for completion options of prompt or resource template argument.
+func (c *Client) Complete(ctx context.Context, params mcp.CompleteRequestParams) (*mcp.CompleteResult, error) {
+	var result mcp.CompleteResult
+	if err := c.Request(ctx, &mcp.CompleteRequest{Params: params}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Close disconnects from server, which ends the session.
+func (c *Client) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		err = c.transport.Close()
+	})
+	return err
+}
+
+// handlerError reports error returned by client handler as internal error,
+// unless handler has returned *jsonrpc2.Error itself
+func handlerError(err error) *jsonrpc2.Error {
+	return jsonrpc2.AsError(err)
+}
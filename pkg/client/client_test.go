@@ -0,0 +1,248 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/strowk/foxy-contexts/internal/utils"
+	"github.com/strowk/foxy-contexts/pkg/app"
+	"github.com/strowk/foxy-contexts/pkg/fxctx"
+	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/server"
+	"github.com/strowk/foxy-contexts/pkg/sse"
+	"github.com/strowk/foxy-contexts/pkg/stdio"
+	"github.com/strowk/foxy-contexts/pkg/streamable_http"
+	"go.uber.org/fx"
+)
+
+// STDIO_SERVER_ENV makes test binary run as stdio server for NewStdioTransport tests
+const STDIO_SERVER_ENV = "FOXY_CONTEXTS_CLIENT_TEST_STDIO_SERVER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(STDIO_SERVER_ENV) != "" {
+		fxApp, err := newTestApp(stdio.NewTransport())
+		if err != nil {
+			os.Exit(1)
+		}
+		fxApp.Run()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+func newGreetTool() fxctx.Tool {
+	return fxctx.NewTool(
+		&mcp.Tool{
+			Name:        "greet",
+			InputSchema: mcp.ToolInputSchema{Type: "object"},
+		},
+		func(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
+			return &mcp.CallToolResult{
+				Content: []interface{}{
+					mcp.TextContent{Type: "text", Text: "Hello, " + args["name"].(string)},
+				},
+			}
+		},
+	)
+}
+
+func newRootsTool() fxctx.Tool {
+	return fxctx.NewTool(
+		&mcp.Tool{
+			Name:        "roots",
+			InputSchema: mcp.ToolInputSchema{Type: "object"},
+		},
+		func(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
+			srv, _ := server.FromContext(ctx)
+			result, err := srv.ListRoots(ctx)
+			if err != nil {
+				return &mcp.CallToolResult{
+					IsError: utils.Ptr(true),
+					Content: []interface{}{mcp.TextContent{Type: "text", Text: err.Error()}},
+				}
+			}
+			uris := []string{}
+			for _, root := range result.Roots {
+				uris = append(uris, root.Uri)
+			}
+			return &mcp.CallToolResult{
+				Content: []interface{}{mcp.TextContent{Type: "text", Text: strings.Join(uris, ",")}},
+			}
+		},
+	)
+}
+
+func newTestApp(transport server.Transport) (*fx.App, error) {
+	return app.NewBuilder().
+		WithTool(newGreetTool).
+		WithTool(newRootsTool).
+		WithServerCapabilities(&mcp.ServerCapabilities{
+			Tools: &mcp.ServerCapabilitiesTools{},
+		}).
+		WithTransport(transport).
+		WithFxOptions(fx.NopLogger).
+		BuildFxApp()
+}
+
+// startApp runs application with given transport until test is finished
+func startApp(t *testing.T, transport server.Transport) {
+	t.Helper()
+	fxApp, err := newTestApp(transport)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, fxApp.Start(ctx))
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = fxApp.Stop(ctx)
+	})
+}
+
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	return l
+}
+
+func connect(t *testing.T, transport Transport, options ...ClientOption) *Client {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := Connect(ctx, transport, options...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+
+	_, err = c.Initialize(ctx)
+	require.NoError(t, err)
+	return c
+}
+
+var testRoots = RootsHandler{
+	Handler: func(ctx context.Context) (*mcp.ListRootsResult, error) {
+		return &mcp.ListRootsResult{
+			Roots: []mcp.Root{{Uri: "file:///a"}, {Uri: "file:///b"}},
+		}, nil
+	},
+}
+
+func testGreet(t *testing.T, c *Client) {
+	t.Helper()
+	ctx := context.Background()
+	require.NoError(t, c.Ping(ctx))
+
+	tools, err := c.ListTools(ctx)
+	require.NoError(t, err)
+	require.Len(t, tools.Tools, 2)
+
+	called, err := c.CallTool(ctx, "greet", map[string]any{"name": "Alice"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"type": "text", "text": "Hello, Alice"}, called.Content[0])
+}
+
+func testRootsRoundTrip(t *testing.T, c *Client) {
+	t.Helper()
+	called, err := c.CallTool(context.Background(), "roots", nil)
+	require.NoError(t, err)
+	assert.Nil(t, called.IsError)
+	assert.Equal(t, map[string]any{"type": "text", "text": "file:///a,file:///b"}, called.Content[0])
+}
+
+func TestStdioTransport(t *testing.T) {
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), STDIO_SERVER_ENV+"=1")
+	c := connect(t, NewStdioTransport(cmd), testRoots)
+
+	testGreet(t, c)
+	testRootsRoundTrip(t, c)
+
+	require.NoError(t, c.Close())
+	assert.ErrorIs(t, c.Ping(context.Background()), ErrClosed)
+}
+
+func TestStreamableHTTPTransport(t *testing.T) {
+	l := listen(t)
+	startApp(t, streamable_http.NewTransport(streamable_http.Listener{Listener: l}))
+
+	c := connect(t, NewStreamableHTTPTransport(fmt.Sprintf("http://%s/mcp", l.Addr())))
+	testGreet(t, c)
+
+	_, err := c.CallTool(context.Background(), "missing", nil)
+	var responseErr *ResponseError
+	require.True(t, errors.As(err, &responseErr))
+	assert.Equal(t, jsonrpc2.InvalidParams, responseErr.Code)
+}
+
+func TestSSETransport(t *testing.T) {
+	l := listen(t)
+	startApp(t, sse.NewTransport(sse.WithListener(l)))
+
+	c := connect(t, NewSSETransport(fmt.Sprintf("http://%s/sse", l.Addr())), testRoots)
+	testGreet(t, c)
+	testRootsRoundTrip(t, c)
+}
+
+func TestConnectFailsWhenServerIsNotThere(t *testing.T) {
+	l := listen(t)
+	require.NoError(t, l.Close())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := Connect(ctx, NewSSETransport(fmt.Sprintf("http://%s/sse", l.Addr())))
+	assert.Error(t, err)
+}
+
+// echoTransport answers every request with the same response several times
+type echoTransport struct {
+	messages chan []byte
+}
+
+func (e *echoTransport) Start(context.Context) (<-chan []byte, error) {
+	return e.messages, nil
+}
+
+func (e *echoTransport) Send(_ context.Context, message []byte) error {
+	var request struct {
+		Id json.RawMessage `json:"id"`
+	}
+	if err := json.Unmarshal(message, &request); err != nil {
+		return err
+	}
+	response := []byte(`{"jsonrpc":"2.0","id":` + string(request.Id) + `,"result":{}}`)
+	go func() {
+		for i := 0; i < 3; i++ {
+			e.messages <- response
+		}
+	}()
+	return nil
+}
+
+func (e *echoTransport) Close() error {
+	return nil
+}
+
+func TestDuplicateResponseDoesNotBlockReading(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := Connect(ctx, &echoTransport{messages: make(chan []byte)})
+	require.NoError(t, err)
+	defer func() { _ = c.Close() }()
+
+	// second request is only answered if duplicate
+	// response to the first one did not block reading
+	require.NoError(t, c.Ping(ctx))
+	require.NoError(t, c.Ping(ctx))
+}
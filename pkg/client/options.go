@@ -0,0 +1,129 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+)
+
+type ClientOption interface {
+	apply(*Client)
+}
+
+// ClientInfo is an option for the client that sets name and version
+// it reports to server during initialization, by default "foxy-contexts-client"
+// and "0.0.1" are used.
+type ClientInfo struct {
+	Name    string
+	Version string
+}
+
+func (o ClientInfo) apply(c *Client) {
+	c.clientInfo = mcp.Implementation{Name: o.Name, Version: o.Version}
+}
+
+// SamplingHandler is an option for the client that makes it
+// declare sampling capability and answer sampling requests from server.
+type SamplingHandler struct {
+	Handler func(ctx context.Context, params mcp.CreateMessageRequestParams) (*mcp.CreateMessageResult, error)
+}
+
+func (o SamplingHandler) apply(c *Client) {
+	c.capabilities.Sampling = mcp.ClientCapabilitiesSampling{}
+	jsonrpc2.Handle(c.router, func(ctx context.Context, req *mcp.CreateMessageRequest) (*mcp.CreateMessageResult, *jsonrpc2.Error) {
+		result, err := o.Handler(ctx, req.Params)
+		if err != nil {
+			return nil, handlerError(err)
+		}
+		return result, nil
+	})
+}
+
+// RootsHandler is an option for the client that makes it
+// declare roots capability and answer requests for roots from server.
+type RootsHandler struct {
+	Handler func(ctx context.Context) (*mcp.ListRootsResult, error)
+}
+
+func (o RootsHandler) apply(c *Client) {
+	c.capabilities.Roots = &mcp.ClientCapabilitiesRoots{}
+	jsonrpc2.Handle(c.router, func(ctx context.Context, _ *mcp.ListRootsRequest) (*mcp.ListRootsResult, *jsonrpc2.Error) {
+		result, err := o.Handler(ctx)
+		if err != nil {
+			return nil, handlerError(err)
+		}
+		return result, nil
+	})
+}
+
+// NotificationHandler is an option for the client that sets
+// handler called for every notification sent by server, such as
+// *mcp.ProgressNotification or *mcp.ToolListChangedNotification.
+//
+// Notifications are handled one by one in the order they were sent,
+// so handler should not block for long.
+type NotificationHandler struct {
+	Handler func(ctx context.Context, notification jsonrpc2.Request)
+}
+
+func (o NotificationHandler) apply(c *Client) {
+	for _, newNotification := range serverNotifications {
+		c.router.SetMethodNotificationHandler(newNotification().GetMethod(), newNotification, o.Handler)
+	}
+}
+
+var serverNotifications = []func() jsonrpc2.Request{
+	jsonrpc2.RequestConstructor[mcp.CancelledNotification](),
+	jsonrpc2.RequestConstructor[mcp.ProgressNotification](),
+	jsonrpc2.RequestConstructor[mcp.LoggingMessageNotification](),
+	jsonrpc2.RequestConstructor[mcp.ResourceUpdatedNotification](),
+	jsonrpc2.RequestConstructor[mcp.ResourceListChangedNotification](),
+	jsonrpc2.RequestConstructor[mcp.ToolListChangedNotification](),
+	jsonrpc2.RequestConstructor[mcp.PromptListChangedNotification](),
+}
+
+type HTTPTransportOption interface {
+	apply(*httpTransportConfig)
+}
+
+type httpTransportConfig struct {
+	httpClient *http.Client
+	header     http.Header
+}
+
+func newHTTPTransportConfig(options []HTTPTransportOption) httpTransportConfig {
+	config := httpTransportConfig{
+		httpClient: http.DefaultClient,
+		header:     http.Header{},
+	}
+	for _, o := range options {
+		o.apply(&config)
+	}
+	return config
+}
+
+// HTTPClient is an option for HTTP transports that sets client used
+// to send requests, for example to configure TLS or proxy.
+type HTTPClient struct {
+	Client *http.Client
+}
+
+func (o HTTPClient) apply(c *httpTransportConfig) {
+	c.httpClient = o.Client
+}
+
+// Header is an option for HTTP transports that adds headers
+// to every request, for example Authorization with bearer token.
+type Header struct {
+	Header http.Header
+}
+
+func (o Header) apply(c *httpTransportConfig) {
+	for key, values := range o.Header {
+		for _, value := range values {
+			c.header.Add(key, value)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package client
+
+import "context"
+
+// Transport delivers JSON-RPC messages between client and server.
+//
+// Package provides transports for servers started as child process
+// (NewStdioTransport), servers serving streamable HTTP (NewStreamableHTTPTransport)
+// and SSE (NewSSETransport), while package inmemory connects clients
+// to servers running in the same process.
+type Transport interface {
+	// Start connects to server and returns channel with messages sent by server,
+	// which is closed once connection is lost or closed
+	Start(ctx context.Context) (<-chan []byte, error)
+
+	// Send delivers one message to server
+	Send(ctx context.Context, message []byte) error
+
+	// Close disconnects from server
+	Close() error
+}
+
+// protocolVersionSetter is implemented by transports that have to
+// tell server negotiated protocol version with every message
+type protocolVersionSetter interface {
+	setProtocolVersion(version string)
+}
@@ -0,0 +1,212 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/strowk/foxy-contexts/pkg/server"
+	"github.com/strowk/foxy-contexts/pkg/sse"
+)
+
+var ErrNoEndpoint = errors.New("server did not send endpoint event")
+
+type sseTransport struct {
+	url    string
+	config httpTransportConfig
+
+	// endpoint is where messages are posted, server tells it in the first event
+	endpoint        string
+	protocolVersion string
+	mu              sync.Mutex
+
+	// stopStream cancels request reading the event stream
+	stopStream context.CancelFunc
+	// streamDone is closed once event stream is finished
+	streamDone chan struct{}
+	closeOnce  sync.Once
+}
+
+// NewSSETransport returns transport that receives messages from server
+// as events from event stream opened by GET request to given url
+// and sends messages as POST requests to endpoint announced by server.
+func NewSSETransport(url string, options ...HTTPTransportOption) Transport {
+	return &sseTransport{
+		url:        url,
+		config:     newHTTPTransportConfig(options),
+		streamDone: make(chan struct{}),
+	}
+}
+
+func (t *sseTransport) Start(ctx context.Context) (<-chan []byte, error) {
+	// stream has to outlive ctx, which only bounds connecting
+	streamCtx, stopStream := context.WithCancel(context.Background())
+	t.stopStream = stopStream
+	fail := func(err error) (<-chan []byte, error) {
+		stopStream()
+		close(t.streamDone)
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodGet, t.url, nil)
+	if err != nil {
+		return fail(err)
+	}
+	for key, values := range t.config.header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	type connected struct {
+		resp *http.Response
+		err  error
+	}
+	connecting := make(chan connected, 1)
+	go func() {
+		resp, err := t.config.httpClient.Do(req)
+		connecting <- connected{resp: resp, err: err}
+	}()
+
+	var resp *http.Response
+	select {
+	case <-ctx.Done():
+		return fail(ctx.Err())
+	case c := <-connecting:
+		if c.err != nil {
+			return fail(c.err)
+		}
+		resp = c.resp
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		_ = resp.Body.Close()
+		return fail(fmt.Errorf("%w: %s %s", ErrUnexpectedStatus, resp.Status, bytes.TrimSpace(body)))
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	endpoint := make(chan error, 1)
+	go func() {
+		endpoint <- t.readEndpoint(reader)
+	}()
+	select {
+	case <-ctx.Done():
+		_ = resp.Body.Close()
+		return fail(ctx.Err())
+	case err := <-endpoint:
+		if err != nil {
+			_ = resp.Body.Close()
+			return fail(err)
+		}
+	}
+
+	messages := make(chan []byte)
+	go func() {
+		defer close(t.streamDone)
+		defer close(messages)
+		defer resp.Body.Close()
+		for {
+			event, err := sse.DecodeEvent(reader)
+			if errors.Is(err, sse.ErrNoData) {
+				continue
+			}
+			if err != nil {
+				return
+			}
+			if len(event.Event) > 0 && string(event.Event) != "message" {
+				continue
+			}
+			messages <- event.Data
+		}
+	}()
+	return messages, nil
+}
+
+// readEndpoint waits for endpoint event and resolves it against url of the stream
+func (t *sseTransport) readEndpoint(reader *bufio.Reader) error {
+	for {
+		event, err := sse.DecodeEvent(reader)
+		if errors.Is(err, sse.ErrNoData) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrNoEndpoint, err)
+		}
+		if string(event.Event) != "endpoint" {
+			continue
+		}
+		base, err := url.Parse(t.url)
+		if err != nil {
+			return err
+		}
+		ref, err := url.Parse(string(event.Data))
+		if err != nil {
+			return fmt.Errorf("server sent invalid endpoint: %w", err)
+		}
+		t.mu.Lock()
+		t.endpoint = base.ResolveReference(ref).String()
+		t.mu.Unlock()
+		return nil
+	}
+}
+
+func (t *sseTransport) setProtocolVersion(version string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.protocolVersion = version
+}
+
+func (t *sseTransport) Send(ctx context.Context, message []byte) error {
+	select {
+	case <-t.streamDone:
+		return ErrDisconnected
+	default:
+	}
+
+	t.mu.Lock()
+	endpoint := t.endpoint
+	protocolVersion := t.protocolVersion
+	t.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(message))
+	if err != nil {
+		return err
+	}
+	for key, values := range t.config.header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if protocolVersion != "" {
+		req.Header.Set(server.PROTOCOL_VERSION_HEADER, protocolVersion)
+	}
+
+	resp, err := t.config.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%w: %s %s", ErrUnexpectedStatus, resp.Status, bytes.TrimSpace(body))
+	}
+	// responses are delivered over event stream
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// Close closes event stream, which ends session on server.
+func (t *sseTransport) Close() error {
+	t.closeOnce.Do(func() {
+		if t.stopStream == nil {
+			return
+		}
+		t.stopStream()
+		<-t.streamDone
+	})
+	return nil
+}
@@ -0,0 +1,106 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// stdioCloseTimeout is how long server process is given to exit
+// after its stdin is closed, before it is killed
+const stdioCloseTimeout = 5 * time.Second
+
+type stdioTransport struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+
+	writeMu   sync.Mutex
+	closeOnce sync.Once
+	// exited is closed once server process has exited
+	exited chan struct{}
+}
+
+// NewStdioTransport returns transport that starts server as child process
+// and exchanges messages with it over its stdin and stdout, one per line.
+//
+// Command should not have Stdin or Stdout set, while Stderr can be used
+// to see logs of the server, by default they are discarded.
+func NewStdioTransport(cmd *exec.Cmd) Transport {
+	return &stdioTransport{
+		cmd:    cmd,
+		exited: make(chan struct{}),
+	}
+}
+
+func (t *stdioTransport) Start(ctx context.Context) (<-chan []byte, error) {
+	stdin, err := t.cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := t.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := t.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start server: %w", err)
+	}
+	t.stdin = stdin
+
+	messages := make(chan []byte)
+	go func() {
+		defer close(messages)
+		defer close(t.exited)
+		reader := bufio.NewReader(stdout)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				messages <- line
+			}
+			if err != nil {
+				break
+			}
+		}
+		// reading is finished, so now it is safe to wait for process
+		_ = t.cmd.Wait()
+	}()
+	return messages, nil
+}
+
+func (t *stdioTransport) Send(ctx context.Context, message []byte) error {
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	if _, err := t.stdin.Write(append(message, '\n')); err != nil {
+		if errors.Is(err, io.ErrClosedPipe) || errors.Is(err, exec.ErrWaitDelay) {
+			return ErrDisconnected
+		}
+		return err
+	}
+	return nil
+}
+
+// Close closes stdin of the server, which tells it to stop,
+// and kills the process if it does not exit in time.
+func (t *stdioTransport) Close() error {
+	t.closeOnce.Do(func() {
+		if t.stdin == nil {
+			return
+		}
+		t.writeMu.Lock()
+		_ = t.stdin.Close()
+		t.writeMu.Unlock()
+
+		select {
+		case <-t.exited:
+		case <-time.After(stdioCloseTimeout):
+			_ = t.cmd.Process.Kill()
+			<-t.exited
+		}
+	})
+	return nil
+}
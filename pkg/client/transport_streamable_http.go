@@ -0,0 +1,220 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/strowk/foxy-contexts/pkg/server"
+	"github.com/strowk/foxy-contexts/pkg/sse"
+)
+
+var ErrUnexpectedStatus = errors.New("server responded with unexpected status")
+
+// httpCloseTimeout limits how long closing session on server can take
+const httpCloseTimeout = 5 * time.Second
+
+type streamableHTTPTransport struct {
+	url    string
+	config httpTransportConfig
+
+	// sessionId is remembered from the first response that has it
+	// and is sent with all subsequent requests
+	sessionId       string
+	protocolVersion string
+	mu              sync.Mutex
+
+	messages chan []byte
+	// closed is closed once transport is closed
+	closed    chan struct{}
+	closeOnce sync.Once
+	// active counts requests and event streams that can still deliver
+	// messages, it is only added to under mu while transport is not closed
+	active sync.WaitGroup
+}
+
+// NewStreamableHTTPTransport returns transport that sends messages
+// to server as POST requests to given url and reads responses
+// from response bodies, either JSON or event streams.
+func NewStreamableHTTPTransport(url string, options ...HTTPTransportOption) Transport {
+	return &streamableHTTPTransport{
+		url:      url,
+		config:   newHTTPTransportConfig(options),
+		messages: make(chan []byte),
+		closed:   make(chan struct{}),
+	}
+}
+
+func (t *streamableHTTPTransport) Start(ctx context.Context) (<-chan []byte, error) {
+	return t.messages, nil
+}
+
+func (t *streamableHTTPTransport) setProtocolVersion(version string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.protocolVersion = version
+}
+
+func (t *streamableHTTPTransport) newRequest(ctx context.Context, method string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, t.url, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range t.config.header {
+		req.Header[key] = values
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.sessionId != "" {
+		req.Header.Set("Mcp-Session-Id", t.sessionId)
+	}
+	if t.protocolVersion != "" {
+		req.Header.Set(server.PROTOCOL_VERSION_HEADER, t.protocolVersion)
+	}
+	return req, nil
+}
+
+func (t *streamableHTTPTransport) Send(ctx context.Context, message []byte) error {
+	t.mu.Lock()
+	select {
+	case <-t.closed:
+		t.mu.Unlock()
+		return ErrClosed
+	default:
+	}
+	t.active.Add(1)
+	t.mu.Unlock()
+	defer t.active.Done()
+
+	req, err := t.newRequest(ctx, http.MethodPost, bytes.NewReader(message))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+
+	resp, err := t.config.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	if sessionId := resp.Header.Get("Mcp-Session-Id"); sessionId != "" {
+		t.mu.Lock()
+		if t.sessionId == "" {
+			t.sessionId = sessionId
+		}
+		t.mu.Unlock()
+	}
+
+	if resp.StatusCode == http.StatusAccepted {
+		// server has accepted notification or response and has nothing to respond
+		_ = resp.Body.Close()
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		_ = resp.Body.Close()
+		return fmt.Errorf("%w: %s %s", ErrUnexpectedStatus, resp.Status, bytes.TrimSpace(body))
+	}
+
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch contentType {
+	case "application/json":
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		t.deliver(body)
+		return nil
+	case "text/event-stream":
+		// stream can stay open while server is sending requests
+		// and notifications, so it is read in background
+		t.active.Add(1)
+		go func() {
+			defer t.active.Done()
+			read := make(chan struct{})
+			go func() {
+				defer close(read)
+				readEvents(resp.Body, t.deliver)
+			}()
+			select {
+			case <-read:
+			case <-t.closed:
+			}
+			_ = resp.Body.Close()
+			<-read
+		}()
+		return nil
+	default:
+		_ = resp.Body.Close()
+		return fmt.Errorf("server responded with unexpected content type: %s", contentType)
+	}
+}
+
+// deliver passes message to client unless transport is closed
+func (t *streamableHTTPTransport) deliver(message []byte) {
+	select {
+	case t.messages <- message:
+	case <-t.closed:
+	}
+}
+
+// readEvents decodes events from stream and delivers their data,
+// keep-alive comments and other events without data are skipped
+func readEvents(stream io.Reader, deliver func([]byte)) {
+	reader := bufio.NewReader(stream)
+	for {
+		event, err := sse.DecodeEvent(reader)
+		if errors.Is(err, sse.ErrNoData) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+		deliver(event.Data)
+	}
+}
+
+// Close ends session on server and stops delivering messages.
+func (t *streamableHTTPTransport) Close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		t.mu.Lock()
+		sessionId := t.sessionId
+		t.mu.Unlock()
+		if sessionId != "" {
+			err = t.deleteSession()
+		}
+		t.mu.Lock()
+		close(t.closed)
+		t.mu.Unlock()
+		t.active.Wait()
+		close(t.messages)
+	})
+	return err
+}
+
+func (t *streamableHTTPTransport) deleteSession() error {
+	ctx, cancel := context.WithTimeout(context.Background(), httpCloseTimeout)
+	defer cancel()
+	req, err := t.newRequest(ctx, http.MethodDelete, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := t.config.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrUnexpectedStatus, resp.Status)
+	}
+	return nil
+}
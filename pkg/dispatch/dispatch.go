@@ -0,0 +1,174 @@
+// Package dispatch hands messages read from a connection over to the server
+// without ever holding up reading of the connection.
+package dispatch
+
+import (
+	"context"
+	"sync"
+
+	"github.com/strowk/foxy-contexts/pkg/drain"
+	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
+)
+
+// DEFAULT_LIMIT is how many messages can wait in queue by default
+const DEFAULT_LIMIT = 100
+
+// QUEUE_FULL is code of error returned for requests rejected by full queue
+const QUEUE_FULL = -32000
+
+// Handler handles one message read from a connection and sends responses
+// to it, server.Server is a Handler.
+type Handler interface {
+	Handle(ctx context.Context, b []byte)
+	GetResponses() chan jsonrpc2.JsonRpcResponse
+}
+
+// Queue hands messages over to the handler one by one in the order
+// they arrive, except for responses to server requests, which are
+// handled right away, as otherwise handler waiting for such response
+// would never get it.
+//
+// Reader of the connection is never blocked by a handler waiting for
+// client, which could only be unblocked by a message that comes later,
+// so instead of waiting for room in full queue, messages that do not
+// fit are rejected: requests in them are answered with QUEUE_FULL error
+// and notifications are dropped.
+type Queue struct {
+	ctx      context.Context
+	handler  Handler
+	requests *drain.Group
+	limit    int
+
+	mu      sync.Mutex
+	pending [][]byte
+	closed  bool
+	// wake is signalled when message is queued or queue is closed
+	wake chan struct{}
+	done chan struct{}
+}
+
+type Option interface {
+	apply(*Queue)
+}
+
+// Limit sets how many messages can wait in queue, while another one
+// is handled, by default DEFAULT_LIMIT.
+type Limit struct {
+	Limit int
+}
+
+func (o Limit) apply(q *Queue) {
+	q.limit = o.Limit
+}
+
+// NewQueue starts handling messages in ctx, each message is registered
+// in requests while it is handled, and messages that get their turn
+// once requests are draining are dropped.
+func NewQueue(ctx context.Context, handler Handler, requests *drain.Group, options ...Option) *Queue {
+	q := &Queue{
+		ctx:      ctx,
+		handler:  handler,
+		requests: requests,
+		limit:    DEFAULT_LIMIT,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	for _, o := range options {
+		o.apply(q)
+	}
+	go q.run()
+	return q
+}
+
+// Push queues message for handling, it returns without waiting for
+// messages before it to be handled. Messages pushed after Close are dropped.
+func (q *Queue) Push(input []byte) {
+	if jsonrpc2.IsResponse(input) {
+		q.handler.Handle(q.ctx, input)
+		return
+	}
+
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	if len(q.pending) >= q.limit {
+		q.mu.Unlock()
+		q.reject(input)
+		return
+	}
+	q.pending = append(q.pending, input)
+	q.mu.Unlock()
+	q.signal()
+}
+
+// reject answers requests in message, which did not fit into queue
+func (q *Queue) reject(input []byte) {
+	rejection := jsonrpc2.NewServerError(QUEUE_FULL, "too many messages are waiting to be handled")
+	for _, response := range jsonrpc2.ErrorResponses(input, rejection) {
+		select {
+		case q.handler.GetResponses() <- *response:
+		case <-q.ctx.Done():
+			return
+		}
+	}
+}
+
+// Close stops accepting new messages, ones already queued are still handled.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.signal()
+}
+
+// Done is closed once queue is closed and all queued messages are handled.
+func (q *Queue) Done() <-chan struct{} {
+	return q.done
+}
+
+func (q *Queue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+		// handling goroutine is going to look at the queue anyway
+	}
+}
+
+func (q *Queue) run() {
+	defer close(q.done)
+	for {
+		input, ok := q.next()
+		if !ok {
+			return
+		}
+		if !q.requests.Begin() {
+			// transport is draining, so new messages are not processed anymore
+			continue
+		}
+		q.handler.Handle(q.ctx, input)
+		q.requests.End()
+	}
+}
+
+// next waits for the next queued message, it returns false
+// once queue is closed and there is nothing left to handle
+func (q *Queue) next() ([]byte, bool) {
+	for {
+		q.mu.Lock()
+		if len(q.pending) > 0 {
+			input := q.pending[0]
+			q.pending[0] = nil
+			q.pending = q.pending[1:]
+			q.mu.Unlock()
+			return input, true
+		}
+		closed := q.closed
+		q.mu.Unlock()
+		if closed {
+			return nil, false
+		}
+		<-q.wake
+	}
+}
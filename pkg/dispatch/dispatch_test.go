@@ -0,0 +1,147 @@
+package dispatch
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/strowk/foxy-contexts/pkg/drain"
+	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
+)
+
+type handlerFunc func(ctx context.Context, b []byte)
+
+func (f handlerFunc) Handle(ctx context.Context, b []byte) {
+	f(ctx, b)
+}
+
+func (f handlerFunc) GetResponses() chan jsonrpc2.JsonRpcResponse {
+	return nil
+}
+
+// recordingHandler waits for release before handling every message
+type recordingHandler struct {
+	release   chan struct{}
+	responses chan jsonrpc2.JsonRpcResponse
+
+	mu      sync.Mutex
+	handled []string
+}
+
+func (h *recordingHandler) Handle(_ context.Context, b []byte) {
+	<-h.release
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.handled = append(h.handled, string(b))
+}
+
+func (h *recordingHandler) GetResponses() chan jsonrpc2.JsonRpcResponse {
+	return h.responses
+}
+
+func TestQueue(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		handled []string
+	)
+	response := make(chan struct{})
+	var requests drain.Group
+	q := NewQueue(context.Background(), handlerFunc(func(_ context.Context, b []byte) {
+		if string(b) == `{"jsonrpc":"2.0","id":1,"method":"tools/call"}` {
+			// handler waits for client to respond to server request
+			<-response
+		}
+		if string(b) == `{"jsonrpc":"2.0","id":7,"result":{}}` {
+			close(response)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		handled = append(handled, string(b))
+	}), &requests)
+
+	pushed := make(chan struct{})
+	go func() {
+		defer close(pushed)
+		q.Push([]byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call"}`))
+		q.Push([]byte(`{"jsonrpc":"2.0","id":2,"method":"ping"}`))
+		q.Push([]byte(`{"jsonrpc":"2.0","method":"notifications/cancelled"}`))
+		q.Push([]byte(`{"jsonrpc":"2.0","id":7,"result":{}}`))
+	}()
+	select {
+	case <-pushed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("pushing was blocked by handler waiting for response")
+	}
+
+	q.Close()
+	q.Push([]byte(`{"jsonrpc":"2.0","id":3,"method":"ping"}`))
+	select {
+	case <-q.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued messages were not handled")
+	}
+
+	assert.Equal(t, []string{
+		`{"jsonrpc":"2.0","id":7,"result":{}}`,
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"ping"}`,
+		`{"jsonrpc":"2.0","method":"notifications/cancelled"}`,
+	}, handled)
+	assert.Equal(t, 0, requests.InFlight())
+}
+
+func TestQueueDropsMessagesWhileDraining(t *testing.T) {
+	var requests drain.Group
+	require.NoError(t, requests.Drain(context.Background()))
+
+	handled := 0
+	q := NewQueue(context.Background(), handlerFunc(func(context.Context, []byte) {
+		handled++
+	}), &requests)
+	q.Push([]byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	q.Close()
+	<-q.Done()
+	assert.Equal(t, 0, handled)
+}
+
+func TestQueueRejectsMessagesOverLimit(t *testing.T) {
+	var requests drain.Group
+	h := &recordingHandler{
+		release:   make(chan struct{}),
+		responses: make(chan jsonrpc2.JsonRpcResponse, 10),
+	}
+	q := NewQueue(context.Background(), h, &requests, Limit{Limit: 2})
+
+	// first message is taken by handler, next two wait in queue
+	q.Push([]byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	require.Eventually(t, func() bool {
+		return requests.InFlight() == 1
+	}, time.Second, time.Millisecond)
+	q.Push([]byte(`{"jsonrpc":"2.0","id":2,"method":"ping"}`))
+	q.Push([]byte(`{"jsonrpc":"2.0","id":3,"method":"ping"}`))
+
+	q.Push([]byte(`[{"jsonrpc":"2.0","id":4,"method":"ping"},{"jsonrpc":"2.0","id":5,"method":"ping"}]`))
+	q.Push([]byte(`{"jsonrpc":"2.0","method":"notifications/cancelled"}`))
+	// responses are still handled, even when queue is full
+	close(h.release)
+	q.Push([]byte(`[{"jsonrpc":"2.0","id":9,"result":{}}]`))
+
+	q.Close()
+	<-q.Done()
+	close(h.responses)
+	var rejected []jsonrpc2.RequestId
+	for response := range h.responses {
+		assert.Equal(t, QUEUE_FULL, response.Error.Code)
+		rejected = append(rejected, response.Id)
+	}
+	assert.Equal(t, []jsonrpc2.RequestId{jsonrpc2.NewIntRequestId(4), jsonrpc2.NewIntRequestId(5)}, rejected)
+	assert.ElementsMatch(t, []string{
+		`[{"jsonrpc":"2.0","id":9,"result":{}}]`,
+		`{"jsonrpc":"2.0","id":1,"method":"ping"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"ping"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"ping"}`,
+	}, h.handled)
+}
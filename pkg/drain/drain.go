@@ -0,0 +1,67 @@
+// Package drain helps transports to shut down gracefully
+// by waiting for requests that are still being handled
+// and closing connections once they are.
+package drain
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Group tracks requests in flight and stops admitting
+// new ones once draining has started.
+//
+// Zero value is ready to use.
+type Group struct {
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+	inFlight atomic.Int64
+	draining bool
+}
+
+// Begin registers new request in flight, it returns false when
+// group is already draining, in which case request must be rejected.
+// Every successful Begin must be followed by End.
+func (g *Group) Begin() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.draining {
+		return false
+	}
+	g.wg.Add(1)
+	g.inFlight.Add(1)
+	return true
+}
+
+// End marks request registered with Begin as finished.
+func (g *Group) End() {
+	g.inFlight.Add(-1)
+	g.wg.Done()
+}
+
+// InFlight returns number of requests that are currently being handled.
+func (g *Group) InFlight() int {
+	return int(g.inFlight.Load())
+}
+
+// Drain stops admitting new requests and waits until all requests
+// in flight are finished, or until ctx is done, in which case
+// error of the context is returned.
+func (g *Group) Drain(ctx context.Context) error {
+	g.mu.Lock()
+	g.draining = true
+	g.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
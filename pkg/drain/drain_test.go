@@ -0,0 +1,125 @@
+package drain
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	foxyevent "github.com/strowk/foxy-contexts/pkg/foxy_event"
+)
+
+func TestGroup(t *testing.T) {
+	var g Group
+	require.True(t, g.Begin())
+	require.True(t, g.Begin())
+	assert.Equal(t, 2, g.InFlight())
+
+	g.End()
+	drained := make(chan error)
+	go func() {
+		drained <- g.Drain(context.Background())
+	}()
+
+	require.Eventually(t, func() bool {
+		if g.Begin() {
+			// drain has not started yet
+			g.End()
+			return false
+		}
+		return true
+	}, time.Second, time.Millisecond, "new requests should be rejected while draining")
+
+	select {
+	case <-drained:
+		t.Fatal("drain finished while request is still in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	g.End()
+	require.NoError(t, <-drained)
+	assert.Equal(t, 0, g.InFlight())
+}
+
+func TestGroupDrainTimeout(t *testing.T) {
+	var g Group
+	require.True(t, g.Begin())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, g.Drain(ctx), context.DeadlineExceeded)
+	assert.Equal(t, 1, g.InFlight())
+}
+
+type recordingLogger struct {
+	mu     sync.Mutex
+	events []foxyevent.Event
+}
+
+func (l *recordingLogger) LogEvent(e foxyevent.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, e)
+}
+
+func (l *recordingLogger) Events() []foxyevent.Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]foxyevent.Event(nil), l.events...)
+}
+
+func TestLifecycle(t *testing.T) {
+	var l Lifecycle
+	assert.ErrorIs(t, l.Available(), ErrNotRunning)
+	l.Start()
+	require.NoError(t, l.Available())
+
+	require.True(t, l.BeginConnection())
+	require.True(t, l.Requests.Begin())
+	connectionClosed := make(chan struct{})
+	go func() {
+		defer close(connectionClosed)
+		<-l.Closing()
+		l.EndConnection()
+	}()
+
+	logger := &recordingLogger{}
+	stopped := false
+	shutdownDone := make(chan error)
+	go func() {
+		shutdownDone <- l.Shutdown(context.Background(), logger, "test", func(ctx context.Context) error {
+			stopped = true
+			return nil
+		})
+	}()
+	<-l.Stopping()
+	assert.ErrorIs(t, l.Available(), ErrShuttingDown)
+	assert.False(t, l.BeginConnection(), "new connections should be rejected while draining")
+
+	select {
+	case <-l.Closing():
+		t.Fatal("connections are closed while request is still in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	l.Requests.End()
+	<-connectionClosed
+	require.NoError(t, <-shutdownDone)
+	assert.True(t, stopped)
+
+	events := logger.Events()
+	assert.Equal(t, foxyevent.DrainStarted{Transport: "test", InFlight: 1}, events[0])
+	assert.Equal(t, foxyevent.DrainClosingStreams{Transport: "test", Streams: 1}, events[1])
+	assert.IsType(t, foxyevent.DrainFinished{}, events[2])
+}
+
+func TestLifecycleShutdownTimeout(t *testing.T) {
+	var l Lifecycle
+	l.Start()
+	require.True(t, l.BeginConnection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.Shutdown(ctx, &recordingLogger{}, "test", nil), context.DeadlineExceeded)
+}
@@ -0,0 +1,172 @@
+package drain
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	foxyevent "github.com/strowk/foxy-contexts/pkg/foxy_event"
+)
+
+var (
+	ErrNotRunning   = errors.New("transport is not running yet")
+	ErrShuttingDown = errors.New("transport is shutting down")
+)
+
+// Lifecycle tracks state of transport serving long-lived connections,
+// such as WebSocket connections or SSE streams: whether it is running,
+// requests in flight and open connections, which are closed on shutdown
+// once requests are drained.
+//
+// Zero value is ready to use.
+type Lifecycle struct {
+	// Requests tracks messages received over connections, that are being handled
+	Requests Group
+
+	initOnce sync.Once
+	// ready is closed once transport is running
+	ready     chan struct{}
+	startOnce sync.Once
+	// stopping is closed once transport stops accepting new connections and messages
+	stopping chan struct{}
+	stopOnce sync.Once
+	// closing is closed once messages in flight are drained
+	// and open connections should be closed
+	closing   chan struct{}
+	closeOnce sync.Once
+
+	connectionsMu sync.Mutex
+	connections   sync.WaitGroup
+	open          atomic.Int64
+}
+
+func (l *Lifecycle) init() {
+	l.initOnce.Do(func() {
+		l.ready = make(chan struct{})
+		l.stopping = make(chan struct{})
+		l.closing = make(chan struct{})
+	})
+}
+
+// Start marks transport as running, it is called by Run of transport.
+func (l *Lifecycle) Start() {
+	l.init()
+	l.startOnce.Do(func() {
+		close(l.ready)
+	})
+}
+
+// Ready is closed once transport is running.
+func (l *Lifecycle) Ready() <-chan struct{} {
+	l.init()
+	return l.ready
+}
+
+// Stopping is closed once transport stops accepting new connections and messages.
+func (l *Lifecycle) Stopping() <-chan struct{} {
+	l.init()
+	return l.stopping
+}
+
+// Closing is closed once open connections should be closed.
+func (l *Lifecycle) Closing() <-chan struct{} {
+	l.init()
+	return l.closing
+}
+
+// Available returns ErrShuttingDown after shutdown has started,
+// ErrNotRunning before transport is running and nil otherwise.
+func (l *Lifecycle) Available() error {
+	select {
+	case <-l.Stopping():
+		return ErrShuttingDown
+	default:
+	}
+	select {
+	case <-l.Ready():
+		return nil
+	default:
+		return ErrNotRunning
+	}
+}
+
+// BeginConnection registers new open connection, it returns false when
+// transport is shutting down, in which case connection must be rejected.
+// Every successful BeginConnection must be followed by EndConnection.
+func (l *Lifecycle) BeginConnection() bool {
+	l.init()
+	l.connectionsMu.Lock()
+	defer l.connectionsMu.Unlock()
+	select {
+	case <-l.stopping:
+		return false
+	default:
+		l.connections.Add(1)
+		l.open.Add(1)
+		return true
+	}
+}
+
+// EndConnection marks connection registered with BeginConnection as closed.
+func (l *Lifecycle) EndConnection() {
+	l.open.Add(-1)
+	l.connections.Done()
+}
+
+// Shutdown stops accepting new connections and messages, waits for requests
+// in flight, then closes open connections and waits for them to end,
+// ctx bounds how long it would wait. Progress is logged to logger
+// as drain events of the transport.
+//
+// stopServing is called after connections are told to close, to stop
+// HTTP server owned by transport, it can be nil if there is none.
+func (l *Lifecycle) Shutdown(
+	ctx context.Context,
+	logger foxyevent.Logger,
+	transport string,
+	stopServing func(ctx context.Context) error,
+) error {
+	started := time.Now()
+	l.init()
+	l.stopOnce.Do(func() {
+		// taken to not let new connection in while waiting for open ones
+		l.connectionsMu.Lock()
+		close(l.stopping)
+		l.connectionsMu.Unlock()
+	})
+	logger.LogEvent(foxyevent.DrainStarted{Transport: transport, InFlight: l.Requests.InFlight()})
+
+	err := l.Requests.Drain(ctx)
+	if err != nil {
+		logger.LogEvent(foxyevent.DrainTimedOut{Transport: transport, InFlight: l.Requests.InFlight()})
+	}
+
+	logger.LogEvent(foxyevent.DrainClosingStreams{Transport: transport, Streams: int(l.open.Load())})
+	l.closeOnce.Do(func() {
+		close(l.closing)
+	})
+
+	if stopServing != nil {
+		if stopErr := stopServing(ctx); err == nil {
+			err = stopErr
+		}
+	}
+
+	// wait until sessions of closed connections are cleaned up
+	closed := make(chan struct{})
+	go func() {
+		l.connections.Wait()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-ctx.Done():
+		if err == nil {
+			err = ctx.Err()
+		}
+	}
+	logger.LogEvent(foxyevent.DrainFinished{Transport: transport, Duration: time.Since(started)})
+	return err
+}
@@ -1,17 +1,21 @@
 package foxyevent
 
+import "time"
+
 type Event interface {
 	event()
 }
 
 type SSEClientConnected struct {
-	ClientIP string
+	SessionId string
+	ClientIP  string
 }
 
 func (SSEClientConnected) event() {}
 
 type SSEClientDisconnected struct {
-	ClientIP string
+	SessionId string
+	ClientIP  string
 }
 
 func (SSEClientDisconnected) event() {}
@@ -28,6 +32,44 @@ type SSEFailedMarshalEvent struct {
 
 func (SSEFailedMarshalEvent) event() {}
 
+type WebSocketClientConnected struct {
+	SessionId string
+	ClientIP  string
+}
+
+func (WebSocketClientConnected) event() {}
+
+type WebSocketClientDisconnected struct {
+	SessionId string
+	ClientIP  string
+}
+
+func (WebSocketClientDisconnected) event() {}
+
+type WebSocketFailedReading struct {
+	Err error
+}
+
+func (WebSocketFailedReading) event() {}
+
+type WebSocketFailedWriting struct {
+	Err error
+}
+
+func (WebSocketFailedWriting) event() {}
+
+type WebSocketFailedMarshal struct {
+	Err error
+}
+
+func (WebSocketFailedMarshal) event() {}
+
+type InMemoryFailedMarshal struct {
+	Err error
+}
+
+func (InMemoryFailedMarshal) event() {}
+
 type StreamingHTTPFailedMarshalEvent struct {
 	Err error
 }
@@ -58,8 +100,237 @@ type StdioFailedWriting struct {
 
 func (StdioFailedWriting) event() {}
 
+// StdioStrayOutput is logged for every line written to stdout
+// by something else than stdio transport, when stdout is isolated
+type StdioStrayOutput struct {
+	Line string
+}
+
+func (StdioStrayOutput) event() {}
+
+// SessionCreated is logged when transport creates new session
+type SessionCreated struct {
+	SessionId string
+	Transport string
+}
+
+func (SessionCreated) event() {}
+
+// SessionDeleted is logged when transport deletes session,
+// after client has disconnected or terminated it
+type SessionDeleted struct {
+	SessionId string
+	Transport string
+}
+
+func (SessionDeleted) event() {}
+
+// SessionInitialized is logged when server has answered initialize request
+// and agreed with client on version of protocol
+type SessionInitialized struct {
+	SessionId string
+	RequestId string
+	// ClientName and ClientVersion are taken from clientInfo sent by client
+	ClientName    string
+	ClientVersion string
+	// RequestedVersion is version of protocol requested by client
+	RequestedVersion string
+	// ProtocolVersion is version of protocol negotiated for the session
+	ProtocolVersion string
+}
+
+func (SessionInitialized) event() {}
+
+// RequestReceived is logged when server starts handling request
+type RequestReceived struct {
+	SessionId string
+	RequestId string
+	Method    string
+}
+
+func (RequestReceived) event() {}
+
+// RequestCompleted is logged when server has handled request,
+// ErrorCode and ErrorMessage are only set if request has failed
+type RequestCompleted struct {
+	SessionId    string
+	RequestId    string
+	Method       string
+	Duration     time.Duration
+	ErrorCode    int
+	ErrorMessage string
+}
+
+func (RequestCompleted) event() {}
+
+// NotificationReceived is logged when server handles notification
+type NotificationReceived struct {
+	SessionId string
+	Method    string
+}
+
+func (NotificationReceived) event() {}
+
+// UnknownMethod is logged when request or notification is received
+// for method, which server has no handler for, RequestId is empty
+// for notifications
+type UnknownMethod struct {
+	SessionId string
+	RequestId string
+	Method    string
+}
+
+func (UnknownMethod) event() {}
+
+// PanicRecovered is logged when handling of request or notification
+// has panicked, request is then answered with internal error
+type PanicRecovered struct {
+	SessionId string
+	RequestId string
+	Method    string
+	Value     any
+	Stack     string
+}
+
+func (PanicRecovered) event() {}
+
+// ToolInvoked is logged when tool is called by client
+type ToolInvoked struct {
+	SessionId string
+	RequestId string
+	Tool      string
+}
+
+func (ToolInvoked) event() {}
+
+// ToolFailed is logged when called tool was not found
+// or returned result with error
+type ToolFailed struct {
+	SessionId string
+	RequestId string
+	Tool      string
+	Err       error
+}
+
+func (ToolFailed) event() {}
+
+// ResourceRequested is logged when resource is read by client
+type ResourceRequested struct {
+	SessionId string
+	RequestId string
+	Uri       string
+}
+
+func (ResourceRequested) event() {}
+
+// ResourceFailed is logged when reading of resource failed
+type ResourceFailed struct {
+	SessionId string
+	RequestId string
+	Uri       string
+	Err       error
+}
+
+func (ResourceFailed) event() {}
+
+// PromptRequested is logged when prompt is got by client
+type PromptRequested struct {
+	SessionId string
+	RequestId string
+	Prompt    string
+}
+
+func (PromptRequested) event() {}
+
+// PromptFailed is logged when requested prompt was not found
+// or failed to be got
+type PromptFailed struct {
+	SessionId string
+	RequestId string
+	Prompt    string
+	Err       error
+}
+
+func (PromptFailed) event() {}
+
 type FailedCreatingSession struct {
 	Err error
 }
 
 func (FailedCreatingSession) event() {}
+
+// DrainStarted is logged when transport stops accepting new requests
+// and starts waiting for requests in flight to finish
+type DrainStarted struct {
+	Transport string
+	InFlight  int
+}
+
+func (DrainStarted) event() {}
+
+// DrainTimedOut is logged when shutdown deadline is reached
+// while some requests are still in flight
+type DrainTimedOut struct {
+	Transport string
+	InFlight  int
+}
+
+func (DrainTimedOut) event() {}
+
+// DrainClosingStreams is logged when transport notifies
+// streaming clients that it is going away and closes their streams
+type DrainClosingStreams struct {
+	Transport string
+	Streams   int
+}
+
+func (DrainClosingStreams) event() {}
+
+// DrainFinished is logged when transport has finished shutting down
+type DrainFinished struct {
+	Transport string
+	Duration  time.Duration
+}
+
+func (DrainFinished) event() {}
+
+// GatewayFailedRefreshing is logged when gateway could not update
+// tools, resources or prompts of upstream after it reported changes
+type GatewayFailedRefreshing struct {
+	Upstream string
+	Err      error
+}
+
+func (GatewayFailedRefreshing) event() {}
+
+// GatewayFailedNotifying is logged when gateway could not forward
+// notification of upstream to connected client
+type GatewayFailedNotifying struct {
+	Method string
+	Err    error
+}
+
+func (GatewayFailedNotifying) event() {}
+
+// JWKSFailedReloading is logged when JWKS file could not be read again
+// to find key of presented token, which is then rejected
+type JWKSFailedReloading struct {
+	Path string
+	Err  error
+}
+
+func (JWKSFailedReloading) event() {}
+
+// WireMessage is logged for every JSON-RPC message received or sent
+// by the server, when wire tracing is enabled with logger sink
+type WireMessage struct {
+	Time      time.Time
+	SessionId string
+	// Direction is "in" for messages received from client and "out" for sent ones
+	Direction string
+	// Latency is time since request until response to it, zero for other messages
+	Latency time.Duration
+	Message string
+}
+
+func (WireMessage) event() {}
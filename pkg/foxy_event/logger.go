@@ -3,3 +3,28 @@ package foxyevent
 type Logger interface {
 	LogEvent(Event)
 }
+
+type multiLogger []Logger
+
+// NewMultiLogger returns logger passing every event to all given loggers
+// in order, for example to write events to slog and collect them elsewhere
+func NewMultiLogger(loggers ...Logger) Logger {
+	var multi multiLogger
+	for _, logger := range loggers {
+		if logger == nil {
+			continue
+		}
+		if nested, ok := logger.(multiLogger); ok {
+			multi = append(multi, nested...)
+			continue
+		}
+		multi = append(multi, logger)
+	}
+	return multi
+}
+
+func (l multiLogger) LogEvent(e Event) {
+	for _, logger := range l {
+		logger.LogEvent(e)
+	}
+}
@@ -0,0 +1,84 @@
+package foxyevent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingLogger struct {
+	events []Event
+}
+
+func (l *recordingLogger) LogEvent(e Event) {
+	l.events = append(l.events, e)
+}
+
+func TestMultiLogger(t *testing.T) {
+	first := &recordingLogger{}
+	second := &recordingLogger{}
+	logger := NewMultiLogger(first, nil, NewMultiLogger(second))
+
+	logger.LogEvent(SessionCreated{SessionId: "s", Transport: "stdio"})
+
+	assert.Equal(t, []Event{SessionCreated{SessionId: "s", Transport: "stdio"}}, first.events)
+	assert.Equal(t, first.events, second.events)
+	NewMultiLogger().LogEvent(SessionDeleted{})
+}
+
+func TestSlogLogger(t *testing.T) {
+	var out bytes.Buffer
+	logger := NewSlogLogger(slog.New(slog.NewJSONHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	logger.LogEvent(RequestCompleted{
+		SessionId:    "s",
+		RequestId:    "1",
+		Method:       "tools/call",
+		Duration:     time.Millisecond,
+		ErrorCode:    -32602,
+		ErrorMessage: "Invalid params",
+	})
+	logger.LogEvent(NotificationReceived{Method: "notifications/initialized"})
+	logger.LogEvent(ToolFailed{SessionId: "s", RequestId: "2", Tool: "greet", Err: errors.New("boom")})
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 3)
+
+	records := make([]map[string]any, len(lines))
+	for i, line := range lines {
+		require.NoError(t, json.Unmarshal([]byte(line), &records[i]))
+		delete(records[i], "time")
+	}
+	assert.Equal(t, []map[string]any{
+		{
+			"level":         "DEBUG",
+			"msg":           "request completed",
+			"session_id":    "s",
+			"request_id":    "1",
+			"method":        "tools/call",
+			"duration":      float64(time.Millisecond),
+			"error_code":    float64(-32602),
+			"error_message": "Invalid params",
+		},
+		{
+			"level":  "DEBUG",
+			"msg":    "notification received",
+			"method": "notifications/initialized",
+		},
+		{
+			"level":      "ERROR",
+			"msg":        "tool failed",
+			"session_id": "s",
+			"request_id": "2",
+			"tool":       "greet",
+			"err":        "boom",
+		},
+	}, records)
+}
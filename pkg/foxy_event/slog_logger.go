@@ -39,13 +39,25 @@ func (l SlogLogger) logError(msg string, args ...any) {
 func (l SlogLogger) LogEvent(e Event) {
 	switch e := e.(type) {
 	case SSEClientConnected:
-		l.logEvent("sse client connected", slog.String("client_ip", e.ClientIP))
+		l.logEvent("sse client connected", withIds(e.SessionId, "", slog.String("client_ip", e.ClientIP))...)
 	case SSEClientDisconnected:
-		l.logEvent("sse client disconnected", slog.String("client_ip", e.ClientIP))
+		l.logEvent("sse client disconnected", withIds(e.SessionId, "", slog.String("client_ip", e.ClientIP))...)
 	case SSEFailedCreatingEvent:
 		l.logError("failed creating sse event", slog.String("err", e.Err.Error()))
 	case SSEFailedMarshalEvent:
 		l.logError("failed marshalling sse event", slog.String("err", e.Err.Error()))
+	case WebSocketClientConnected:
+		l.logEvent("websocket client connected", withIds(e.SessionId, "", slog.String("client_ip", e.ClientIP))...)
+	case WebSocketClientDisconnected:
+		l.logEvent("websocket client disconnected", withIds(e.SessionId, "", slog.String("client_ip", e.ClientIP))...)
+	case WebSocketFailedReading:
+		l.logError("failed reading websocket message", slog.String("err", e.Err.Error()))
+	case WebSocketFailedWriting:
+		l.logError("failed writing websocket message", slog.String("err", e.Err.Error()))
+	case WebSocketFailedMarshal:
+		l.logError("failed marshalling websocket message", slog.String("err", e.Err.Error()))
+	case InMemoryFailedMarshal:
+		l.logError("failed marshalling in-memory message", slog.String("err", e.Err.Error()))
 	case StdioFailedMarhalResponse:
 		l.logError("failed marshalling stdio response", slog.String("err", e.Err.Error()))
 	case StdioFailedReadingInput:
@@ -54,9 +66,87 @@ func (l SlogLogger) LogEvent(e Event) {
 		l.logEvent("sending stdio response", slog.String("data", string(e.Data)))
 	case StdioFailedWriting:
 		l.logError("failed writing to stdout", slog.String("err", e.Err.Error()))
+	case StdioStrayOutput:
+		l.logError("stray output written to stdout", slog.String("line", e.Line))
 	case StreamingHTTPFailedMarshalEvent:
 		l.logError("failed marshalling streaming http event", slog.String("err", e.Err.Error()))
+	case SessionCreated:
+		l.logEvent("session created", withIds(e.SessionId, "", slog.String("transport", e.Transport))...)
+	case SessionDeleted:
+		l.logEvent("session deleted", withIds(e.SessionId, "", slog.String("transport", e.Transport))...)
+	case SessionInitialized:
+		l.logEvent("session initialized", withIds(e.SessionId, e.RequestId,
+			slog.String("client_name", e.ClientName),
+			slog.String("client_version", e.ClientVersion),
+			slog.String("requested_version", e.RequestedVersion),
+			slog.String("protocol_version", e.ProtocolVersion),
+		)...)
+	case RequestReceived:
+		l.logEvent("request received", withIds(e.SessionId, e.RequestId, slog.String("method", e.Method))...)
+	case RequestCompleted:
+		args := withIds(e.SessionId, e.RequestId, slog.String("method", e.Method), slog.Duration("duration", e.Duration))
+		if e.ErrorCode != 0 {
+			args = append(args, slog.Int("error_code", e.ErrorCode), slog.String("error_message", e.ErrorMessage))
+		}
+		l.logEvent("request completed", args...)
+	case NotificationReceived:
+		l.logEvent("notification received", withIds(e.SessionId, "", slog.String("method", e.Method))...)
+	case UnknownMethod:
+		l.logEvent("unknown method", withIds(e.SessionId, e.RequestId, slog.String("method", e.Method))...)
+	case PanicRecovered:
+		l.logError("recovered from panic", withIds(e.SessionId, e.RequestId,
+			slog.String("method", e.Method),
+			slog.Any("panic", e.Value),
+			slog.String("stack", e.Stack),
+		)...)
+	case ToolInvoked:
+		l.logEvent("tool invoked", withIds(e.SessionId, e.RequestId, slog.String("tool", e.Tool))...)
+	case ToolFailed:
+		l.logError("tool failed", withIds(e.SessionId, e.RequestId, slog.String("tool", e.Tool), slog.String("err", e.Err.Error()))...)
+	case ResourceRequested:
+		l.logEvent("resource requested", withIds(e.SessionId, e.RequestId, slog.String("uri", e.Uri))...)
+	case ResourceFailed:
+		l.logError("resource failed", withIds(e.SessionId, e.RequestId, slog.String("uri", e.Uri), slog.String("err", e.Err.Error()))...)
+	case PromptRequested:
+		l.logEvent("prompt requested", withIds(e.SessionId, e.RequestId, slog.String("prompt", e.Prompt))...)
+	case PromptFailed:
+		l.logError("prompt failed", withIds(e.SessionId, e.RequestId, slog.String("prompt", e.Prompt), slog.String("err", e.Err.Error()))...)
 	case FailedCreatingSession:
 		l.logError("failed creating session", slog.String("err", e.Err.Error()))
+	case DrainStarted:
+		l.logEvent("draining transport", slog.String("transport", e.Transport), slog.Int("in_flight", e.InFlight))
+	case DrainTimedOut:
+		l.logError("transport drain timed out", slog.String("transport", e.Transport), slog.Int("in_flight", e.InFlight))
+	case DrainClosingStreams:
+		l.logEvent("closing streams", slog.String("transport", e.Transport), slog.Int("streams", e.Streams))
+	case DrainFinished:
+		l.logEvent("transport drained", slog.String("transport", e.Transport), slog.Duration("duration", e.Duration))
+	case GatewayFailedRefreshing:
+		l.logError("failed refreshing upstream", slog.String("upstream", e.Upstream), slog.String("err", e.Err.Error()))
+	case GatewayFailedNotifying:
+		l.logError("failed forwarding notification", slog.String("method", e.Method), slog.String("err", e.Err.Error()))
+	case JWKSFailedReloading:
+		l.logError("failed reloading jwks file", slog.String("path", e.Path), slog.String("err", e.Err.Error()))
+	case WireMessage:
+		l.logEvent("wire message",
+			slog.Time("time", e.Time),
+			slog.String("session_id", e.SessionId),
+			slog.String("direction", e.Direction),
+			slog.Duration("latency", e.Latency),
+			slog.String("message", e.Message),
+		)
 	}
 }
+
+// withIds returns attributes of session and request ids, which are set,
+// followed by other attributes of event
+func withIds(sessionId, requestId string, attrs ...any) []any {
+	args := make([]any, 0, len(attrs)+2)
+	if sessionId != "" {
+		args = append(args, slog.String("session_id", sessionId))
+	}
+	if requestId != "" {
+		args = append(args, slog.String("request_id", requestId))
+	}
+	return append(args, attrs...)
+}
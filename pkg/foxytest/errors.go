@@ -5,4 +5,5 @@ import "errors"
 var (
 	ErrFailedToParseInput  = errors.New("failed to parse input")
 	ErrFailedToParseOutput = errors.New("failed to parse output")
+	ErrFailedToInitialize  = errors.New("failed to initialize session")
 )
@@ -0,0 +1,54 @@
+package foxytest
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/strowk/foxy-contexts/pkg/server"
+)
+
+// initializeSession performs initialization handshake with the server,
+// since servers are not serving any requests apart from pings before that
+func (ts *testSuite) initializeSession() error {
+	ts.inputChan <- &singleInput{
+		input: map[string]any{
+			"jsonrpc": "2.0",
+			"id":      "foxytest-initialize",
+			"method":  "initialize",
+			"params": map[string]any{
+				"protocolVersion": string(server.LATEST_PROTOCOL_VERSION),
+				"capabilities":    map[string]any{},
+				"clientInfo": map[string]any{
+					"name":    "foxytest",
+					"version": "0.0.1",
+				},
+			},
+		},
+	}
+
+	select {
+	case <-ts.executableDone:
+		return fmt.Errorf("%w: process finished before responding to initialize", ErrFailedToInitialize)
+	case got := <-ts.outputChan:
+		var out struct {
+			Error *struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(got), &out); err != nil {
+			return fmt.Errorf("%w: unexpected response to initialize: %s", ErrFailedToInitialize, got)
+		}
+		if out.Error != nil {
+			return fmt.Errorf("%w: server responded with error %d %s", ErrFailedToInitialize, out.Error.Code, out.Error.Message)
+		}
+	}
+
+	ts.inputChan <- &singleInput{
+		input: map[string]any{
+			"jsonrpc": "2.0",
+			"method":  "notifications/initialized",
+		},
+	}
+	return nil
+}
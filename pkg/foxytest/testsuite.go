@@ -82,6 +82,7 @@ type TestSuite interface {
 	WithBeforeEach(func() error) TestSuite
 	WithAfterEach(func() error) TestSuite
 	WithLogging() TestSuite
+	WithoutInitialization() TestSuite
 
 	WithExecutable(command string, args []string) TestSuite
 	WithTransport(transport TestTransport) TestSuite
@@ -117,6 +118,9 @@ type testSuite struct {
 
 	logging bool
 
+	// skipInitialization disables initialization of MCP session before tests
+	skipInitialization bool
+
 	executableDone chan struct{}
 	testsDone      chan struct{}
 	completed      chan struct{}
@@ -162,6 +166,14 @@ func (ts *testSuite) WithLogging() TestSuite {
 	return ts
 }
 
+// WithoutInitialization makes test suite to not initialize MCP session
+// before running tests, which is useful when tests themselves are checking
+// how server handles initialize request
+func (ts *testSuite) WithoutInitialization() TestSuite {
+	ts.skipInitialization = true
+	return ts
+}
+
 func (ts *testSuite) WithTransport(transport TestTransport) TestSuite {
 	ts.transport = transport
 	return ts
@@ -201,6 +213,17 @@ func (ts *testSuite) runTests(t TestRunner) []error {
 	}
 	ts.setup(t)
 
+	if !ts.skipInitialization {
+		if ts.logging {
+			t.Log("initializing session")
+		}
+		if err := ts.initializeSession(); err != nil {
+			t.Errorf("failed to initialize session: %v", err)
+			ts.errors = append(ts.errors, err)
+			return nil
+		}
+	}
+
 	if ts.logging {
 		t.Logf("running %d tests", len(ts.tests))
 	}
@@ -5,6 +5,7 @@ type TestTransportType string
 const (
 	TestTransportTypeStdio          TestTransportType = "stdio"
 	TestTransportTypeStreamableHTTP TestTransportType = "streamable_http"
+	TestTransportTypeWebSocket      TestTransportType = "websocket"
 )
 
 type TestTransport interface {
@@ -18,6 +18,10 @@ type testTransportStreamableHTTP struct {
 
 	httpClient *http.Client
 
+	// sessionId is remembered from the first response that has it
+	// and is sent with all subsequent requests
+	sessionId string
+
 	postResponses chan *response
 }
 
@@ -122,13 +126,17 @@ func (t *testTransportStreamableHTTP) pipeInput(tr TestRunner, ts *testSuite) {
 
 			req.Header.Set("Content-Type", "application/json")
 			req.Header.Set("Accept", "application/json, text/event-stream")
-
-			// TODO: figure out how to define session id
-			// req.Header.Set("Mcp-Session-Id", ts.sessionId.String())
+			if t.sessionId != "" {
+				req.Header.Set("Mcp-Session-Id", t.sessionId)
+			}
 
 			resp, err := t.httpClient.Do(req)
 			if err != nil {
 				tr.Errorf("error sending request: %v", err)
+				return
+			}
+			if t.sessionId == "" {
+				t.sessionId = resp.Header.Get("Mcp-Session-Id")
 			}
 			defer func() {
 				err := resp.Body.Close()
@@ -143,6 +151,14 @@ func (t *testTransportStreamableHTTP) pipeInput(tr TestRunner, ts *testSuite) {
 				tr.Errorf("error reading response body: %v", err)
 			}
 
+			if resp.StatusCode == http.StatusAccepted {
+				// server accepted notification and has nothing to respond
+				if ts.logging {
+					tr.Logf("received response: %s", resp.Status)
+				}
+				continue
+			}
+
 			respForChannel := &response{
 				body:        body,
 				contentType: resp.Header.Get("Content-Type"),
@@ -0,0 +1,131 @@
+package foxytest
+
+import (
+	"encoding/json"
+	"math"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+type testTransportWebSocket struct {
+	url string
+
+	// connected receives connection once it is established,
+	// or is closed without a value if connecting has failed
+	connected chan *websocket.Conn
+}
+
+func NewTestTransportWebSocket(url string) *testTransportWebSocket {
+	return &testTransportWebSocket{
+		url:       url,
+		connected: make(chan *websocket.Conn, 1),
+	}
+}
+
+func (t *testTransportWebSocket) dial() (*websocket.Conn, error) {
+	u, err := url.Parse(t.url)
+	if err != nil {
+		return nil, err
+	}
+	origin := "http://" + u.Host
+	if u.Scheme == "wss" {
+		origin = "https://" + u.Host
+	}
+	return websocket.Dial(t.url, "mcp", origin)
+}
+
+func (t *testTransportWebSocket) pipeInput(tr TestRunner, ts *testSuite) {
+	var conn *websocket.Conn
+	var retries = 0
+	retriesLimit := 3
+	for {
+		var err error
+		conn, err = t.dial()
+		if err != nil {
+			if ts.logging {
+				tr.Logf("error connecting: %v, retried %d/%d", err, retries, retriesLimit)
+			}
+			// retrying because servers often are not ready when their process is only started
+			if retries < retriesLimit {
+				retries++
+				time.Sleep(time.Duration(math.Round(300+100*math.Pow(float64(retries), 2))) * time.Millisecond)
+				continue
+			} else {
+				tr.Errorf("failed to connect to starting server: %v, retries exhausted", err)
+				close(t.connected)
+				return
+			}
+		}
+		if ts.logging {
+			tr.Logf("connected to %s", t.url)
+		}
+		break
+	}
+	t.connected <- conn
+
+	for {
+		select {
+		case <-ts.testsDone:
+			// closing connection also stops reading outputs
+			if err := conn.Close(); err != nil {
+				tr.Logf("error closing connection: %v", err)
+			}
+			if ts.logging {
+				tr.Log("finished reading inputs")
+			}
+			return
+		case in := <-ts.inputChan:
+			data, err := json.Marshal(in.getForMarshalling())
+			if err != nil {
+				tr.Errorf("error marshalling input: %v", err)
+			}
+
+			if ts.logging {
+				tr.Logf("sending input: %s", string(data))
+			}
+
+			if err := websocket.Message.Send(conn, string(data)); err != nil {
+				tr.Errorf("error sending message: %v", err)
+				return
+			}
+		}
+	}
+}
+
+func (t *testTransportWebSocket) pipeOutput(tr TestRunner, ts *testSuite) {
+	conn, ok := <-t.connected
+	if !ok {
+		return
+	}
+
+	if ts.logging {
+		tr.Log("reading messages")
+	}
+	for {
+		var msg string
+		if err := websocket.Message.Receive(conn, &msg); err != nil {
+			select {
+			case <-ts.testsDone:
+				// connection was closed after tests were done
+			default:
+				tr.Errorf("error reading message: %v", err)
+			}
+			break
+		}
+
+		if ts.logging {
+			tr.Logf("received message: %s", msg)
+		}
+
+		select {
+		case ts.outputChan <- msg:
+		case <-ts.testsDone:
+		}
+	}
+
+	if ts.logging {
+		tr.Log("finished reading messages")
+	}
+}
@@ -7,7 +7,6 @@ import (
 
 	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
 	"github.com/strowk/foxy-contexts/pkg/mcp"
-	"github.com/strowk/foxy-contexts/pkg/server"
 	"go.uber.org/fx"
 )
 
@@ -17,7 +16,7 @@ type Completer interface {
 
 type CompleteMux interface {
 	Complete(ctx context.Context, req *mcp.CompleteRequest) (*mcp.CompleteResult, error)
-	RegisterHandlers(s server.Server)
+	RegisterHandlers(s jsonrpc2.HandlerRegistry)
 }
 
 var (
@@ -84,16 +83,15 @@ func NewCompleteMux(params CompletMuxParams) CompleteMux {
 	}
 }
 
-func (c *completeMux) RegisterHandlers(s server.Server) {
+func (c *completeMux) RegisterHandlers(s jsonrpc2.HandlerRegistry) {
 	c.setCompletionCompleteHandler(s)
 }
 
-func (c *completeMux) setCompletionCompleteHandler(s server.Server) {
-	s.SetRequestHandler(&mcp.CompleteRequest{}, func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
-		r := req.(*mcp.CompleteRequest)
+func (c *completeMux) setCompletionCompleteHandler(s jsonrpc2.HandlerRegistry) {
+	jsonrpc2.Handle(s, func(ctx context.Context, r *mcp.CompleteRequest) (*mcp.CompleteResult, *jsonrpc2.Error) {
 		res, err := c.Complete(ctx, r)
 		if err != nil {
-			return nil, jsonrpc2.NewServerError(CompleteFailed, fmt.Sprintf("failed to complete: %v", err.Error()))
+			return nil, responseError(err, jsonrpc2.NewServerError(CompleteFailed, fmt.Sprintf("failed to complete: %v", err.Error())))
 		}
 		return res, nil
 	})
@@ -1,9 +1,28 @@
 package fxctx
 
+import (
+	"errors"
+
+	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
+)
+
 const (
 	ListResourcesFailed = iota - 32099
 	ReadResourceFailed
 	GetPromptFailed
+	// Deprecated: unknown tools are reported with jsonrpc2.InvalidParams,
+	// as MCP specification requires
 	ToolNotFound
 	CompleteFailed
 )
+
+// responseError returns *jsonrpc2.Error from chain of err, so that resources,
+// prompts and completions can fail with errors such as jsonrpc2.NewInvalidParamsError,
+// otherwise it returns fallback
+func responseError(err error, fallback *jsonrpc2.Error) *jsonrpc2.Error {
+	var rpcErr *jsonrpc2.Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	return fallback
+}
@@ -0,0 +1,65 @@
+package fxctx
+
+import (
+	"context"
+
+	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
+	"go.uber.org/fx"
+)
+
+// Method is custom request or notification method, which is not part
+// of MCP specification, such as vendor extension "x-k8s/watch".
+//
+// Methods are advertised to clients in experimental capabilities
+// of the server, keyed by name of the method.
+type Method interface {
+	// GetMethod returns name of the method
+	GetMethod() string
+	// RegisterHandler registers handler of the method in server
+	RegisterHandler(s jsonrpc2.HandlerRegistry)
+}
+
+type method struct {
+	name     string
+	register func(s jsonrpc2.HandlerRegistry)
+}
+
+func (m *method) GetMethod() string {
+	return m.name
+}
+
+func (m *method) RegisterHandler(s jsonrpc2.HandlerRegistry) {
+	m.register(s)
+}
+
+// NewMethod returns Method handling requests, which are decoded into Req.
+// Method is named by GetMethod of *Req, same as with jsonrpc2.Handle.
+func NewMethod[Req any, Res any, PReq interface {
+	*Req
+	jsonrpc2.Request
+}](handler func(ctx context.Context, req *Req) (*Res, *jsonrpc2.Error)) Method {
+	return &method{
+		name: PReq(new(Req)).GetMethod(),
+		register: func(s jsonrpc2.HandlerRegistry) {
+			jsonrpc2.Handle[Req, Res, PReq](s, handler)
+		},
+	}
+}
+
+// NewNotificationMethod returns Method handling notifications,
+// which are decoded into Req.
+func NewNotificationMethod[Req any, PReq interface {
+	*Req
+	jsonrpc2.Request
+}](handler func(ctx context.Context, req *Req)) Method {
+	return &method{
+		name: PReq(new(Req)).GetMethod(),
+		register: func(s jsonrpc2.HandlerRegistry) {
+			jsonrpc2.HandleNotification[Req, PReq](s, handler)
+		},
+	}
+}
+
+func AsMethod(f any) any {
+	return fx.Annotate(f, fx.As(new(Method)), fx.ResultTags(`group:"methods"`))
+}
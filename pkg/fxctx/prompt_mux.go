@@ -5,16 +5,16 @@ import (
 	"fmt"
 	"sort"
 
+	foxyevent "github.com/strowk/foxy-contexts/pkg/foxy_event"
 	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
 	"github.com/strowk/foxy-contexts/pkg/mcp"
-	"github.com/strowk/foxy-contexts/pkg/server"
 	"go.uber.org/fx"
 )
 
 type PromptMux interface {
 	Completer
 	ListPrompts(ctx context.Context) []mcp.Prompt
-	RegisterHandlers(s server.Server)
+	RegisterHandlers(s jsonrpc2.HandlerRegistry)
 }
 
 type promptMux struct {
@@ -69,13 +69,13 @@ func ProvidePromptMux() fx.Option {
 	))
 }
 
-func (p *promptMux) RegisterHandlers(s server.Server) {
+func (p *promptMux) RegisterHandlers(s jsonrpc2.HandlerRegistry) {
 	p.setListPromptsHandler(s)
 	p.setGetPromptHandler(s)
 }
 
-func (p *promptMux) setListPromptsHandler(s server.Server) {
-	s.SetRequestHandler(&mcp.ListPromptsRequest{}, func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
+func (p *promptMux) setListPromptsHandler(s jsonrpc2.HandlerRegistry) {
+	jsonrpc2.Handle(s, func(ctx context.Context, _ *mcp.ListPromptsRequest) (*mcp.ListPromptsResult, *jsonrpc2.Error) {
 		resp := &mcp.ListPromptsResult{
 			Prompts: []mcp.Prompt{},
 		}
@@ -86,12 +86,15 @@ func (p *promptMux) setListPromptsHandler(s server.Server) {
 	})
 }
 
-func (p *promptMux) setGetPromptHandler(s server.Server) {
-	s.SetRequestHandler(&mcp.GetPromptRequest{}, func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
-		r := req.(*mcp.GetPromptRequest)
+func (p *promptMux) setGetPromptHandler(s jsonrpc2.HandlerRegistry) {
+	jsonrpc2.Handle(s, func(ctx context.Context, r *mcp.GetPromptRequest) (*mcp.GetPromptResult, *jsonrpc2.Error) {
+		logger := eventLogger(ctx)
+		sessionId, requestId := eventIds(ctx)
+		logger.LogEvent(foxyevent.PromptRequested{SessionId: sessionId, RequestId: requestId, Prompt: r.Params.Name})
 		res, err := p.GetPrompt(ctx, r)
 		if err != nil {
-			return nil, jsonrpc2.NewServerError(GetPromptFailed, fmt.Sprintf("failed to get prompt: %v", err.Error()))
+			logger.LogEvent(foxyevent.PromptFailed{SessionId: sessionId, RequestId: requestId, Prompt: r.Params.Name, Err: err})
+			return nil, responseError(err, jsonrpc2.NewServerError(GetPromptFailed, fmt.Sprintf("failed to get prompt: %v", err.Error())))
 		}
 		return res, nil
 	})
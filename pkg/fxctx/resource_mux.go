@@ -5,9 +5,9 @@ import (
 	"fmt"
 
 	"github.com/strowk/foxy-contexts/internal/utils"
+	foxyevent "github.com/strowk/foxy-contexts/pkg/foxy_event"
 	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
 	"github.com/strowk/foxy-contexts/pkg/mcp"
-	"github.com/strowk/foxy-contexts/pkg/server"
 	"go.uber.org/fx"
 )
 
@@ -15,7 +15,7 @@ type ResourceMux interface {
 	Completer
 	GetResources(ctx context.Context) ([]mcp.Resource, error)
 	ReadResource(ctx context.Context, uri string) (*mcp.ReadResourceResult, error)
-	RegisterHandlers(s server.Server)
+	RegisterHandlers(s jsonrpc2.HandlerRegistry)
 }
 
 type resourceMux struct {
@@ -87,20 +87,20 @@ func (m *resourceMux) ReadResource(ctx context.Context, uri string) (*mcp.ReadRe
 	return res.ReadResource(ctx, uri)
 }
 
-func (m *resourceMux) RegisterHandlers(s server.Server) {
+func (m *resourceMux) RegisterHandlers(s jsonrpc2.HandlerRegistry) {
 	m.setResourceListHandler(s)
 	m.setReadResourceHandler(s)
 }
 
-func (m *resourceMux) setResourceListHandler(s server.Server) {
-	s.SetRequestHandler(&mcp.ListResourcesRequest{}, func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
+func (m *resourceMux) setResourceListHandler(s jsonrpc2.HandlerRegistry) {
+	jsonrpc2.Handle(s, func(ctx context.Context, _ *mcp.ListResourcesRequest) (*mcp.ListResourcesResult, *jsonrpc2.Error) {
 		resp := &mcp.ListResourcesResult{
 			Resources: []mcp.Resource{},
 		}
 
 		list, err := m.GetResources(ctx)
 		if err != nil {
-			return nil, jsonrpc2.NewServerError(ListResourcesFailed, fmt.Sprintf("failed to get resources: %v", err.Error()))
+			return nil, responseError(err, jsonrpc2.NewServerError(ListResourcesFailed, fmt.Sprintf("failed to get resources: %v", err.Error())))
 		}
 
 		resp.Resources = append(resp.Resources, list...)
@@ -109,14 +109,17 @@ func (m *resourceMux) setResourceListHandler(s server.Server) {
 	})
 }
 
-func (m *resourceMux) setReadResourceHandler(s server.Server) {
-	s.SetRequestHandler(&mcp.ReadResourceRequest{}, func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
-		r := req.(*mcp.ReadResourceRequest)
+func (m *resourceMux) setReadResourceHandler(s jsonrpc2.HandlerRegistry) {
+	jsonrpc2.Handle(s, func(ctx context.Context, r *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, *jsonrpc2.Error) {
+		logger := eventLogger(ctx)
+		sessionId, requestId := eventIds(ctx)
+		logger.LogEvent(foxyevent.ResourceRequested{SessionId: sessionId, RequestId: requestId, Uri: r.Params.Uri})
 		res, err := m.ReadResource(ctx, r.Params.Uri)
 		if err != nil {
-			return nil, jsonrpc2.NewServerError(ReadResourceFailed, fmt.Sprintf("failed to read resource: %v", err.Error()))
+			logger.LogEvent(foxyevent.ResourceFailed{SessionId: sessionId, RequestId: requestId, Uri: r.Params.Uri, Err: err})
+			return nil, responseError(err, jsonrpc2.NewServerError(ReadResourceFailed, fmt.Sprintf("failed to read resource: %v", err.Error())))
 		}
-		return &res, nil
+		return res, nil
 	})
 }
 
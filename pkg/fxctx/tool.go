@@ -12,6 +12,15 @@ type Tool interface {
 	Callback(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult
 }
 
+// FallibleTool is Tool, which can fail call with error instead of returning
+// result marked as error, for example when call is forwarded to another
+// server, which answers with error. Tool mux answers such call with
+// *jsonrpc2.Error found in the error, or with Internal error.
+type FallibleTool interface {
+	Tool
+	Call(ctx context.Context, args map[string]interface{}) (*mcp.CallToolResult, error)
+}
+
 type tool struct {
 	mcpTool  *mcp.Tool
 	callback func(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult
@@ -5,10 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"strings"
 
+	foxyevent "github.com/strowk/foxy-contexts/pkg/foxy_event"
 	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
 	"github.com/strowk/foxy-contexts/pkg/mcp"
 	"github.com/strowk/foxy-contexts/pkg/server"
+	"github.com/strowk/foxy-contexts/pkg/session"
 	"go.uber.org/fx"
 )
 
@@ -19,7 +22,7 @@ var (
 type ToolMux interface {
 	GetMcpTools() []mcp.Tool
 	CallToolNamed(ctx context.Context, name string, args map[string]interface{}) (*mcp.CallToolResult, error)
-	RegisterHandlers(s server.Server)
+	RegisterHandlers(s jsonrpc2.HandlerRegistry)
 }
 
 type toolMux struct {
@@ -46,6 +49,9 @@ func (t *toolMux) CallToolNamed(ctx context.Context, name string, args map[strin
 		return nil, ErrToolNotFound
 	}
 
+	if fallible, ok := tool.(FallibleTool); ok {
+		return fallible.Call(ctx, args)
+	}
 	return tool.Callback(ctx, args), nil
 }
 
@@ -72,13 +78,13 @@ func ProvideToolMux() fx.Option {
 	))
 }
 
-func (t *toolMux) RegisterHandlers(s server.Server) {
+func (t *toolMux) RegisterHandlers(s jsonrpc2.HandlerRegistry) {
 	t.setToolsListHandler(s)
 	t.setCallToolHandler(s)
 }
 
-func (t *toolMux) setToolsListHandler(s server.Server) {
-	s.SetRequestHandler(&mcp.ListToolsRequest{}, func(_ context.Context, r jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
+func (t *toolMux) setToolsListHandler(s jsonrpc2.HandlerRegistry) {
+	jsonrpc2.Handle(s, func(_ context.Context, _ *mcp.ListToolsRequest) (*mcp.ListToolsResult, *jsonrpc2.Error) {
 		tools := t.GetMcpTools()
 		return &mcp.ListToolsResult{
 			Tools: tools,
@@ -86,13 +92,23 @@ func (t *toolMux) setToolsListHandler(s server.Server) {
 	})
 }
 
-func (t *toolMux) setCallToolHandler(s server.Server) {
-	s.SetRequestHandler(&mcp.CallToolRequest{}, func(ctx context.Context, r jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
-		req := r.(*mcp.CallToolRequest)
+func (t *toolMux) setCallToolHandler(s jsonrpc2.HandlerRegistry) {
+	jsonrpc2.Handle(s, func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, *jsonrpc2.Error) {
 		toolName := req.Params.Name
+		logger := eventLogger(ctx)
+		sessionId, requestId := eventIds(ctx)
+		logger.LogEvent(foxyevent.ToolInvoked{SessionId: sessionId, RequestId: requestId, Tool: toolName})
 		res, err := t.CallToolNamed(ctx, toolName, req.Params.Arguments)
 		if err != nil {
-			return nil, jsonrpc2.NewServerError(ToolNotFound, fmt.Sprintf("tool not found: %s", toolName))
+			logger.LogEvent(foxyevent.ToolFailed{SessionId: sessionId, RequestId: requestId, Tool: toolName, Err: err})
+			if errors.Is(err, ErrToolNotFound) {
+				// MCP specification requires unknown tools to be reported as invalid params
+				return nil, jsonrpc2.NewInvalidParamsError(fmt.Sprintf("tool not found: %s", toolName))
+			}
+			return nil, responseError(err, jsonrpc2.NewInternalError(fmt.Sprintf("failed to call tool: %v", err.Error())))
+		}
+		if res.IsError != nil && *res.IsError {
+			logger.LogEvent(foxyevent.ToolFailed{SessionId: sessionId, RequestId: requestId, Tool: toolName, Err: resultError(res)})
 		}
 
 		return &mcp.CallToolResult{
@@ -102,3 +118,41 @@ func (t *toolMux) setCallToolHandler(s server.Server) {
 		}, nil
 	})
 }
+
+// resultError returns error with text contents of result, which tool has marked as error
+func resultError(res *mcp.CallToolResult) error {
+	var texts []string
+	for _, content := range res.Content {
+		switch c := content.(type) {
+		case mcp.TextContent:
+			texts = append(texts, c.Text)
+		case *mcp.TextContent:
+			texts = append(texts, c.Text)
+		}
+	}
+	if len(texts) == 0 {
+		return errors.New("tool returned error result")
+	}
+	return errors.New(strings.Join(texts, "\n"))
+}
+
+// eventLogger returns logger of server handling the call, which is taken from ctx,
+// as muxes could be registered to collections of handlers shared by servers,
+// such as in gateway, events are dropped if there is no server in ctx
+func eventLogger(ctx context.Context) foxyevent.Logger {
+	if s, ok := server.FromContext(ctx); ok {
+		return s.GetLogger()
+	}
+	return foxyevent.NewMultiLogger()
+}
+
+// eventIds returns ids of session and request being handled to be logged in events
+func eventIds(ctx context.Context) (sessionId string, requestId string) {
+	if sess, ok := session.FromContext(ctx); ok {
+		sessionId = sess.SessionID.String()
+	}
+	if id, ok := jsonrpc2.RequestIdFromContext(ctx); ok {
+		requestId = id.String()
+	}
+	return sessionId, requestId
+}
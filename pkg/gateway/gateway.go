@@ -0,0 +1,343 @@
+// Package gateway implements transport, which aggregates several upstream
+// MCP servers and exposes their tools, resources, resource templates and
+// prompts to clients connected to another transport, so that clients only
+// have to know about one server.
+//
+// Gateway connects to upstreams with package client and keeps their lists
+// in fxctx muxes, which are rebuilt whenever upstream notifies that its list
+// has changed, after which connected clients are notified as well.
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/strowk/foxy-contexts/internal/utils"
+	"github.com/strowk/foxy-contexts/pkg/client"
+	foxyevent "github.com/strowk/foxy-contexts/pkg/foxy_event"
+	"github.com/strowk/foxy-contexts/pkg/fxctx"
+	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/server"
+	"github.com/strowk/foxy-contexts/pkg/session"
+)
+
+// ErrDuplicateResource is returned when resources of several upstreams have the same URI,
+// as resource URIs are not prefixed and gateway could not tell which upstream to read from
+var ErrDuplicateResource = errors.New("resource with the same URI is served by several upstreams")
+
+const (
+	// connectTimeout limits how long connecting to every upstream can take
+	connectTimeout = 30 * time.Second
+	// notifyTimeout limits how long forwarding notification to one client can take
+	notifyTimeout = 5 * time.Second
+)
+
+// Upstream is MCP server, which gateway connects to.
+type Upstream struct {
+	// Prefix is prepended to names of tools, prompts and resources of upstream,
+	// for example "k8s_", so that names from different upstreams do not clash.
+	// Resource URIs are kept as is, so they must be unique across upstreams.
+	Prefix string
+
+	// Transport connects to upstream, such as one returned by
+	// client.NewStdioTransport or client.NewStreamableHTTPTransport.
+	Transport client.Transport
+
+	// ClientOptions are passed to client.Connect when connecting to upstream.
+	ClientOptions []client.ClientOption
+}
+
+type gateway struct {
+	transport server.Transport
+	upstreams []*upstream
+	logger    foxyevent.Logger
+
+	// handlers are request handlers registered by muxes
+	// for current lists of tools, resources and prompts
+	handlers atomic.Pointer[handlers]
+	// rebuildMu serializes rebuilding of muxes
+	rebuildMu sync.Mutex
+
+	// servers holds server.Server of every session connected to gateway
+	// with *atomic.Bool telling whether it was already reported
+	// that transport of the session cannot deliver notifications
+	servers sync.Map
+
+	progress      progressForwarder
+	subscriptions subscriptions
+}
+
+// NewTransport returns transport, which connects to upstreams once it is run
+// and serves their tools, resources and prompts over given transport.
+//
+// Tools, resources and prompts registered in app.Builder are replaced
+// by those of upstreams, as gateway handles corresponding requests itself.
+func NewTransport(transport server.Transport, upstreams ...Upstream) server.Transport {
+	g := &gateway{
+		transport: transport,
+	}
+	for _, u := range upstreams {
+		g.upstreams = append(g.upstreams, &upstream{Upstream: u})
+	}
+	return g
+}
+
+func (g *gateway) Run(
+	capabilities *mcp.ServerCapabilities,
+	serverInfo *mcp.Implementation,
+	serverOptions ...server.ServerOption,
+) error {
+	g.logger = server.LoggerFromOptions(serverOptions)
+
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+	if err := g.connect(ctx); err != nil {
+		g.closeUpstreams()
+		return err
+	}
+	if err := g.rebuild(); err != nil {
+		g.closeUpstreams()
+		return err
+	}
+
+	serverOptions = append(serverOptions,
+		server.ServerStartCallbackOption{Callback: g.registerHandlers},
+		server.OnShutdownOption{Callback: func(ctx context.Context) {
+			if s, ok := server.FromContext(ctx); ok {
+				g.servers.Delete(s)
+				g.subscriptions.drop(s)
+			}
+		}},
+	)
+	return g.transport.Run(g.withListChanged(capabilities), serverInfo, serverOptions...)
+}
+
+// withListChanged declares that lists of tools, resources and prompts
+// can change, as they come from upstreams, and that resources can be
+// subscribed to, if any upstream supports it
+func (g *gateway) withListChanged(capabilities *mcp.ServerCapabilities) *mcp.ServerCapabilities {
+	result := mcp.ServerCapabilities{}
+	if capabilities != nil {
+		result = *capabilities
+	}
+	subscribe := false
+	for _, u := range g.upstreams {
+		subscribe = subscribe || u.canSubscribe()
+	}
+	result.Tools = &mcp.ServerCapabilitiesTools{ListChanged: utils.Ptr(true)}
+	result.Resources = &mcp.ServerCapabilitiesResources{ListChanged: utils.Ptr(true), Subscribe: utils.Ptr(subscribe)}
+	result.Prompts = &mcp.ServerCapabilitiesPrompts{ListChanged: utils.Ptr(true)}
+	return &result
+}
+
+func (g *gateway) connect(ctx context.Context) error {
+	for _, u := range g.upstreams {
+		options := append([]client.ClientOption{
+			client.NotificationHandler{Handler: g.notificationHandler(u)},
+		}, u.ClientOptions...)
+		c, err := client.Connect(ctx, u.Transport, options...)
+		if err != nil {
+			return fmt.Errorf("failed to connect to upstream %q: %w", u.Prefix, err)
+		}
+		u.client = c
+
+		initialized, err := c.Initialize(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to initialize upstream %q: %w", u.Prefix, err)
+		}
+		u.capabilities = initialized.Capabilities
+
+		for _, list := range []listKind{toolsList, resourcesList, promptsList} {
+			if err := u.refresh(ctx, list); err != nil {
+				return fmt.Errorf("failed to list %s of upstream %q: %w", list, u.Prefix, err)
+			}
+		}
+	}
+	return nil
+}
+
+// notificationHandler handles notifications of upstream, list changes are
+// handled separately, as refreshing lists needs responses from upstream,
+// which are only read once handler returns
+func (g *gateway) notificationHandler(u *upstream) func(ctx context.Context, notification jsonrpc2.Request) {
+	return func(ctx context.Context, notification jsonrpc2.Request) {
+		switch n := notification.(type) {
+		case *mcp.ToolListChangedNotification:
+			go g.refresh(u, toolsList)
+		case *mcp.ResourceListChangedNotification:
+			go g.refresh(u, resourcesList)
+		case *mcp.PromptListChangedNotification:
+			go g.refresh(u, promptsList)
+		case *mcp.ProgressNotification:
+			g.progress.forward(n, g.notify)
+		case *mcp.ResourceUpdatedNotification:
+			for _, s := range g.subscriptions.subscribers(u, n.Params.Uri) {
+				g.notify(s, n)
+			}
+		}
+	}
+}
+
+// refresh updates list of upstream and notifies connected clients about it
+func (g *gateway) refresh(u *upstream, list listKind) {
+	ctx, cancel := context.WithTimeout(context.Background(), connectTimeout)
+	defer cancel()
+	if err := u.refresh(ctx, list); err != nil {
+		g.logger.LogEvent(foxyevent.GatewayFailedRefreshing{Upstream: u.Prefix, Err: err})
+		return
+	}
+	if err := g.rebuild(); err != nil {
+		g.logger.LogEvent(foxyevent.GatewayFailedRefreshing{Upstream: u.Prefix, Err: err})
+		return
+	}
+	g.notifyAll(list.changedNotification())
+}
+
+// rebuild creates muxes from current lists of upstreams
+// and replaces handlers used by connected sessions, unless
+// several upstreams serve resource with the same URI, in which
+// case handlers are kept as they were
+func (g *gateway) rebuild() error {
+	g.rebuildMu.Lock()
+	defer g.rebuildMu.Unlock()
+
+	h := newHandlers()
+	var tools []fxctx.Tool
+	var resourceProviders []fxctx.ResourceProvider
+	var prompts []fxctx.Prompt
+	for _, u := range g.upstreams {
+		tools = append(tools, u.proxyTools(&g.progress)...)
+		provider, uris := u.proxyResources(h)
+		for _, uri := range uris {
+			if other, ok := h.resources[uri]; ok && other != u {
+				return fmt.Errorf("%w: %s is served by upstreams %q and %q", ErrDuplicateResource, uri, other.Prefix, u.Prefix)
+			}
+			h.resources[uri] = u
+		}
+		resourceProviders = append(resourceProviders, provider)
+		h.templates = append(h.templates, u.proxyTemplates()...)
+		prompts = append(prompts, u.proxyPrompts()...)
+	}
+
+	resourceMux := &completingResourceMux{ResourceMux: fxctx.NewResourceMux(nil, resourceProviders), handlers: h}
+	promptMux := fxctx.NewPromptMux(prompts)
+	fxctx.NewToolMux(tools).RegisterHandlers(h)
+	resourceMux.RegisterHandlers(h)
+	promptMux.RegisterHandlers(h)
+	fxctx.NewCompleteMux(fxctx.CompletMuxParams{ResourceMux: resourceMux, PromptMux: promptMux}).RegisterHandlers(h)
+	jsonrpc2.Handle(h, h.listTemplates)
+	g.handlers.Store(h)
+	return nil
+}
+
+// registerHandlers makes server of new session delegate requests
+// to handlers of current muxes
+func (g *gateway) registerHandlers(s server.Server) {
+	g.servers.Store(s, &atomic.Bool{})
+	for _, newRequest := range []func() jsonrpc2.Request{
+		jsonrpc2.RequestConstructor[mcp.ListToolsRequest](),
+		jsonrpc2.RequestConstructor[mcp.ListResourcesRequest](),
+		jsonrpc2.RequestConstructor[mcp.ListResourceTemplatesRequest](),
+		jsonrpc2.RequestConstructor[mcp.ReadResourceRequest](),
+		jsonrpc2.RequestConstructor[mcp.ListPromptsRequest](),
+		jsonrpc2.RequestConstructor[mcp.GetPromptRequest](),
+		jsonrpc2.RequestConstructor[mcp.CompleteRequest](),
+	} {
+		method := newRequest().GetMethod()
+		s.SetMethodHandler(method, newRequest, func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
+			return g.handlers.Load().handle(ctx, method, req)
+		})
+	}
+	// tool calls are decoded by gateway itself to find progress token
+	newCallTool := jsonrpc2.RequestConstructor[callToolRequest]()
+	s.SetMethodHandler(newCallTool().GetMethod(), newCallTool, func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
+		r := req.(*callToolRequest)
+		if r.Params.Meta != nil && r.Params.Meta.ProgressToken != nil {
+			ctx = withProgressTarget(ctx, progressTarget{server: s, token: r.Params.Meta.ProgressToken})
+		}
+		return g.handlers.Load().handle(ctx, r.GetMethod(), &mcp.CallToolRequest{
+			Params: mcp.CallToolRequestParams{Name: r.Params.Name, Arguments: r.Params.Arguments},
+		})
+	})
+	// subscriptions belong to session, so they are handled by gateway itself
+	jsonrpc2.Handle(s, func(ctx context.Context, req *mcp.SubscribeRequest) (*struct{}, *jsonrpc2.Error) {
+		uri := req.Params.Uri
+		u := g.handlers.Load().upstreamServing(uri)
+		if u == nil {
+			return nil, jsonrpc2.NewInvalidParamsError(fmt.Sprintf("resource not found: %s", uri))
+		}
+		if err := g.subscriptions.subscribe(ctx, s, u, uri); err != nil {
+			return nil, jsonrpc2.AsError(err)
+		}
+		return &struct{}{}, nil
+	})
+	jsonrpc2.Handle(s, func(ctx context.Context, req *mcp.UnsubscribeRequest) (*struct{}, *jsonrpc2.Error) {
+		if err := g.subscriptions.unsubscribe(ctx, s, req.Params.Uri); err != nil {
+			return nil, jsonrpc2.AsError(err)
+		}
+		return &struct{}{}, nil
+	})
+}
+
+// notifyAll sends notification to clients of all sessions that are ready
+func (g *gateway) notifyAll(notification jsonrpc2.Request) {
+	g.servers.Range(func(key, _ any) bool {
+		s := key.(server.Server)
+		if s.GetLifecycleState() != server.LifecycleReady {
+			return true
+		}
+		g.notify(s, notification)
+		return true
+	})
+}
+
+// notify sends notification to client of the session, failure is logged,
+// though when transport cannot send anything to client besides responses,
+// as is the case with streamable HTTP, it is only logged once per session
+func (g *gateway) notify(s server.Server, notification jsonrpc2.Request) {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	err := s.Notify(ctx, notification)
+	if err == nil {
+		return
+	}
+	if errors.Is(err, server.ErrServerRequestsNotSupported) {
+		reported, ok := g.servers.Load(s)
+		if !ok || reported.(*atomic.Bool).Swap(true) {
+			return
+		}
+	}
+	g.logger.LogEvent(foxyevent.GatewayFailedNotifying{Method: notification.GetMethod(), Err: err})
+}
+
+// Shutdown shuts down transport serving clients and then disconnects from upstreams.
+func (g *gateway) Shutdown(ctx context.Context) error {
+	err := g.transport.Shutdown(ctx)
+	g.closeUpstreams()
+	return err
+}
+
+func (g *gateway) closeUpstreams() {
+	for _, u := range g.upstreams {
+		if u.client != nil {
+			_ = u.client.Close()
+		}
+	}
+}
+
+func (g *gateway) GetSessionManager() *session.SessionManager {
+	return g.transport.GetSessionManager()
+}
+
+// SetSessionManager replaces session manager of transport serving clients,
+// if that transport supports it.
+func (g *gateway) SetSessionManager(sessionManager *session.SessionManager) {
+	if sharing, ok := g.transport.(server.SessionSharingTransport); ok {
+		sharing.SetSessionManager(sessionManager)
+	}
+}
@@ -0,0 +1,446 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/strowk/foxy-contexts/internal/utils"
+	"github.com/strowk/foxy-contexts/pkg/app"
+	"github.com/strowk/foxy-contexts/pkg/client"
+	foxyevent "github.com/strowk/foxy-contexts/pkg/foxy_event"
+	"github.com/strowk/foxy-contexts/pkg/fxctx"
+	"github.com/strowk/foxy-contexts/pkg/inmemory"
+	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/server"
+	"github.com/strowk/foxy-contexts/pkg/sse"
+	"github.com/strowk/foxy-contexts/pkg/streamable_http"
+	"go.uber.org/fx"
+)
+
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	return l
+}
+
+func textResult(text string) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		Content: []interface{}{mcp.TextContent{Type: "text", Text: text}},
+	}
+}
+
+// startAppUpstream runs upstream built with app.Builder
+// over streamable HTTP transport and returns its url
+func startAppUpstream(t *testing.T) string {
+	t.Helper()
+	l := listen(t)
+	fxApp, err := app.NewBuilder().
+		WithTool(func() fxctx.Tool {
+			return fxctx.NewTool(
+				&mcp.Tool{Name: "greet", InputSchema: mcp.ToolInputSchema{Type: "object"}},
+				func(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
+					return textResult("Hello, " + args["name"].(string))
+				},
+			)
+		}).
+		WithResource(func() fxctx.Resource {
+			return fxctx.NewResource(
+				mcp.Resource{Name: "greeting", Uri: "greeting://hello"},
+				func(_ context.Context, uri string) (*mcp.ReadResourceResult, error) {
+					return &mcp.ReadResourceResult{
+						Contents: []interface{}{mcp.TextResourceContents{Uri: uri, Text: "hello"}},
+					}, nil
+				},
+			)
+		}).
+		WithPrompt(func() fxctx.Prompt {
+			return fxctx.NewPrompt(
+				mcp.Prompt{Name: "greeting", Arguments: []mcp.PromptArgument{{Name: "name"}}},
+				func(_ context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+					return &mcp.GetPromptResult{
+						Messages: []mcp.PromptMessage{
+							{Role: mcp.RoleUser, Content: mcp.TextContent{Type: "text", Text: "greet " + req.Params.Arguments["name"]}},
+						},
+					}, nil
+				},
+			).WithCompleter(func(_ context.Context, _ *mcp.PromptArgument, value string) (*mcp.CompleteResult, error) {
+				return &mcp.CompleteResult{Completion: mcp.CompleteResultCompletion{Values: []string{value + "ob"}}}, nil
+			})
+		}).
+		WithServerCapabilities(&mcp.ServerCapabilities{
+			Tools:     &mcp.ServerCapabilitiesTools{},
+			Resources: &mcp.ServerCapabilitiesResources{},
+			Prompts:   &mcp.ServerCapabilitiesPrompts{},
+		}).
+		WithTransport(streamable_http.NewTransport(streamable_http.Listener{Listener: l})).
+		WithFxOptions(fx.NopLogger).
+		BuildFxApp()
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, fxApp.Start(ctx))
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = fxApp.Stop(ctx)
+	})
+	return fmt.Sprintf("http://%s/mcp", l.Addr())
+}
+
+// dynamicUpstream serves tools and templated resources over SSE,
+// it reports progress for tool calls, can change its list of tools
+// and records subscriptions to its resources
+type dynamicUpstream struct {
+	url string
+	// extended adds "extra" tool to the list
+	extended atomic.Bool
+	servers  sync.Map
+
+	mu            sync.Mutex
+	subscriptions []string
+}
+
+func startDynamicUpstream(t *testing.T) *dynamicUpstream {
+	t.Helper()
+	u := &dynamicUpstream{}
+	l := listen(t)
+	u.url = fmt.Sprintf("http://%s/sse", l.Addr())
+
+	transport := sse.NewTransport(sse.WithListener(l))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = transport.Run(
+			&mcp.ServerCapabilities{
+				Tools:     &mcp.ServerCapabilitiesTools{ListChanged: new(bool)},
+				Resources: &mcp.ServerCapabilitiesResources{Subscribe: utils.Ptr(true)},
+			},
+			&mcp.Implementation{Name: "dynamic", Version: "0.0.0"},
+			server.ServerStartCallbackOption{Callback: u.register},
+		)
+	}()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = transport.Shutdown(ctx)
+		<-done
+	})
+	return u
+}
+
+func (u *dynamicUpstream) register(s server.Server) {
+	u.servers.Store(s, struct{}{})
+	s.SetRequestHandler(&mcp.ListToolsRequest{}, func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
+		tools := []mcp.Tool{
+			{Name: "greet", InputSchema: mcp.ToolInputSchema{Type: "object"}},
+		}
+		if u.extended.Load() {
+			tools = append(tools, mcp.Tool{Name: "extra", InputSchema: mcp.ToolInputSchema{Type: "object"}})
+		}
+		return &mcp.ListToolsResult{Tools: tools}, nil
+	})
+	s.SetRequestHandler(&callToolRequest{}, func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
+		r := req.(*callToolRequest)
+		if r.Params.Meta != nil && r.Params.Meta.ProgressToken != nil {
+			progress := &progressNotification{}
+			progress.Params.ProgressToken = r.Params.Meta.ProgressToken
+			progress.Params.Progress = 1
+			_ = s.Notify(ctx, progress)
+		}
+		if r.Params.Name == "extra" {
+			return nil, jsonrpc2.NewServerError(-32042, "extra is out of order")
+		}
+		return textResult("Hi from dynamic " + r.Params.Name), nil
+	})
+	jsonrpc2.Handle(s, func(ctx context.Context, req *mcp.ListResourcesRequest) (*mcp.ListResourcesResult, *jsonrpc2.Error) {
+		return &mcp.ListResourcesResult{Resources: []mcp.Resource{}}, nil
+	})
+	jsonrpc2.Handle(s, func(ctx context.Context, req *mcp.ListResourceTemplatesRequest) (*mcp.ListResourceTemplatesResult, *jsonrpc2.Error) {
+		return &mcp.ListResourceTemplatesResult{ResourceTemplates: []mcp.ResourceTemplate{
+			{Name: "item", UriTemplate: "dynamic://items/{id}"},
+		}}, nil
+	})
+	jsonrpc2.Handle(s, func(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, *jsonrpc2.Error) {
+		return &mcp.ReadResourceResult{
+			Contents: []interface{}{mcp.TextResourceContents{Uri: req.Params.Uri, Text: "item"}},
+		}, nil
+	})
+	jsonrpc2.Handle(s, func(ctx context.Context, req *mcp.CompleteRequest) (*mcp.CompleteResult, *jsonrpc2.Error) {
+		ref, _ := req.Params.Ref.(map[string]interface{})
+		return &mcp.CompleteResult{Completion: mcp.CompleteResultCompletion{
+			Values: []string{fmt.Sprintf("%v %s", ref["uri"], req.Params.Argument.Value)},
+		}}, nil
+	})
+	jsonrpc2.Handle(s, func(ctx context.Context, req *mcp.SubscribeRequest) (*struct{}, *jsonrpc2.Error) {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		u.subscriptions = append(u.subscriptions, "subscribe "+req.Params.Uri)
+		return &struct{}{}, nil
+	})
+	jsonrpc2.Handle(s, func(ctx context.Context, req *mcp.UnsubscribeRequest) (*struct{}, *jsonrpc2.Error) {
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		u.subscriptions = append(u.subscriptions, "unsubscribe "+req.Params.Uri)
+		return &struct{}{}, nil
+	})
+}
+
+func (u *dynamicUpstream) recordedSubscriptions() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return slices.Clone(u.subscriptions)
+}
+
+// update notifies connected clients that resource has changed
+func (u *dynamicUpstream) update(t *testing.T, uri string) {
+	u.servers.Range(func(key, _ any) bool {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		assert.NoError(t, key.(server.Server).Notify(ctx, &mcp.ResourceUpdatedNotification{
+			Params: mcp.ResourceUpdatedNotificationParams{Uri: uri},
+		}))
+		return true
+	})
+}
+
+// changeTools adds tool and notifies connected clients
+func (u *dynamicUpstream) changeTools(t *testing.T) {
+	u.extended.Store(true)
+	u.servers.Range(func(key, _ any) bool {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		assert.NoError(t, key.(server.Server).Notify(ctx, &mcp.ToolListChangedNotification{}))
+		return true
+	})
+}
+
+// startGateway runs gateway over in-memory transport
+// and connects initialized client to it
+func startGateway(t *testing.T, notifications chan jsonrpc2.Request, upstreams ...Upstream) *client.Client {
+	t.Helper()
+	inner := inmemory.NewTransport()
+	g := NewTransport(inner, upstreams...)
+	done := make(chan error, 1)
+	go func() {
+		done <- g.Run(&mcp.ServerCapabilities{}, &mcp.Implementation{Name: "gateway", Version: "0.0.0"})
+	}()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		assert.NoError(t, g.Shutdown(ctx))
+		assert.NoError(t, <-done)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c, err := inner.Connect(ctx, client.NotificationHandler{
+		Handler: func(ctx context.Context, notification jsonrpc2.Request) {
+			notifications <- notification
+		},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+	_, err = c.Initialize(ctx)
+	require.NoError(t, err)
+	return c
+}
+
+func TestGateway(t *testing.T) {
+	dynamic := startDynamicUpstream(t)
+	notifications := make(chan jsonrpc2.Request, 10)
+	c := startGateway(t, notifications,
+		Upstream{Prefix: "app_", Transport: client.NewStreamableHTTPTransport(startAppUpstream(t))},
+		Upstream{Prefix: "dynamic_", Transport: client.NewSSETransport(dynamic.url)},
+	)
+	ctx := context.Background()
+
+	toolNames := func() []string {
+		tools, err := c.ListTools(ctx)
+		require.NoError(t, err)
+		names := []string{}
+		for _, tool := range tools.Tools {
+			names = append(names, tool.Name)
+		}
+		return names
+	}
+
+	t.Run("tools are namespaced", func(t *testing.T) {
+		assert.Equal(t, []string{"app_greet", "dynamic_greet"}, toolNames())
+
+		called, err := c.CallTool(ctx, "app_greet", map[string]any{"name": "Alice"})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"type": "text", "text": "Hello, Alice"}, called.Content[0])
+
+		called, err = c.CallTool(ctx, "dynamic_greet", nil)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"type": "text", "text": "Hi from dynamic greet"}, called.Content[0])
+	})
+
+	t.Run("resources and prompts are proxied", func(t *testing.T) {
+		resources, err := c.ListResources(ctx)
+		require.NoError(t, err)
+		require.Len(t, resources.Resources, 1)
+		assert.Equal(t, "app_greeting", resources.Resources[0].Name)
+
+		read, err := c.ReadResource(ctx, "greeting://hello")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"uri": "greeting://hello", "text": "hello"}, read.Contents[0])
+
+		prompts, err := c.ListPrompts(ctx)
+		require.NoError(t, err)
+		require.Len(t, prompts.Prompts, 1)
+		assert.Equal(t, "app_greeting", prompts.Prompts[0].Name)
+
+		prompt, err := c.GetPrompt(ctx, "app_greeting", map[string]string{"name": "Bob"})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"type": "text", "text": "greet Bob"}, prompt.Messages[0].Content)
+	})
+
+	t.Run("progress is forwarded with original token", func(t *testing.T) {
+		request := &callToolRequest{}
+		request.Params.Name = "dynamic_greet"
+		request.Params.Meta = &requestMeta{ProgressToken: json.RawMessage(`42`)}
+		var result mcp.CallToolResult
+		require.NoError(t, c.Request(ctx, request, &result))
+
+		select {
+		case notification := <-notifications:
+			data, err := json.Marshal(jsonrpc2.JsonRpcRequest{Id: jsonrpc2.NewMissingRequestId(), Request: notification})
+			require.NoError(t, err)
+			assert.JSONEq(t, `{"jsonrpc":"2.0","method":"notifications/progress","params":{"progress":1,"progressToken":42}}`, string(data))
+		case <-time.After(5 * time.Second):
+			t.Fatal("progress was not forwarded")
+		}
+	})
+
+	t.Run("list changes are forwarded", func(t *testing.T) {
+		dynamic.changeTools(t)
+		select {
+		case notification := <-notifications:
+			assert.IsType(t, &mcp.ToolListChangedNotification{}, notification)
+		case <-time.After(5 * time.Second):
+			t.Fatal("list change was not forwarded")
+		}
+		assert.Equal(t, []string{"app_greet", "dynamic_extra", "dynamic_greet"}, toolNames())
+	})
+
+	t.Run("errors of upstream are returned as is", func(t *testing.T) {
+		_, err := c.CallTool(ctx, "dynamic_extra", nil)
+		var responseErr *client.ResponseError
+		require.ErrorAs(t, err, &responseErr)
+		assert.Equal(t, -32042, responseErr.Code)
+		assert.Equal(t, "extra is out of order", responseErr.Data)
+	})
+
+	t.Run("resource templates are proxied", func(t *testing.T) {
+		var templates mcp.ListResourceTemplatesResult
+		require.NoError(t, c.Request(ctx, &mcp.ListResourceTemplatesRequest{}, &templates))
+		assert.Equal(t, []mcp.ResourceTemplate{
+			{Name: "dynamic_item", UriTemplate: "dynamic://items/{id}"},
+		}, templates.ResourceTemplates)
+
+		read, err := c.ReadResource(ctx, "dynamic://items/7")
+		require.NoError(t, err)
+		assert.Equal(t, map[string]any{"uri": "dynamic://items/7", "text": "item"}, read.Contents[0])
+	})
+
+	t.Run("completions are proxied", func(t *testing.T) {
+		completed, err := c.Complete(ctx, mcp.CompleteRequestParams{
+			Ref:      map[string]interface{}{"type": "ref/prompt", "name": "app_greeting"},
+			Argument: mcp.CompleteRequestParamsArgument{Name: "name", Value: "B"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Bob"}, completed.Completion.Values)
+
+		completed, err = c.Complete(ctx, mcp.CompleteRequestParams{
+			Ref:      map[string]interface{}{"type": "ref/resource", "uri": "dynamic://items/{id}"},
+			Argument: mcp.CompleteRequestParamsArgument{Name: "id", Value: "4"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"dynamic://items/{id} 4"}, completed.Completion.Values)
+	})
+
+	t.Run("resource updates are forwarded to subscribers", func(t *testing.T) {
+		require.NoError(t, c.Subscribe(ctx, "dynamic://items/7"))
+		dynamic.update(t, "dynamic://items/8")
+		dynamic.update(t, "dynamic://items/7")
+		select {
+		case notification := <-notifications:
+			assert.Equal(t, &mcp.ResourceUpdatedNotification{
+				Method: "notifications/resources/updated",
+				Params: mcp.ResourceUpdatedNotificationParams{Uri: "dynamic://items/7"},
+			}, notification)
+		case <-time.After(5 * time.Second):
+			t.Fatal("resource update was not forwarded")
+		}
+
+		require.NoError(t, c.Unsubscribe(ctx, "dynamic://items/7"))
+		assert.Equal(t, []string{"subscribe dynamic://items/7", "unsubscribe dynamic://items/7"}, dynamic.recordedSubscriptions())
+
+		err := c.Subscribe(ctx, "unknown://resource")
+		var responseErr *client.ResponseError
+		require.ErrorAs(t, err, &responseErr)
+		assert.Equal(t, jsonrpc2.InvalidParams, responseErr.Code)
+	})
+}
+
+func TestGatewayRejectsDuplicateResources(t *testing.T) {
+	g := NewTransport(inmemory.NewTransport(),
+		Upstream{Prefix: "first_", Transport: client.NewStreamableHTTPTransport(startAppUpstream(t))},
+		Upstream{Prefix: "second_", Transport: client.NewStreamableHTTPTransport(startAppUpstream(t))},
+	)
+	err := g.Run(&mcp.ServerCapabilities{}, &mcp.Implementation{Name: "gateway", Version: "0.0.0"})
+	assert.ErrorIs(t, err, ErrDuplicateResource)
+	assert.ErrorContains(t, err, "greeting://hello")
+}
+
+func TestGatewayFailsWhenUpstreamIsNotThere(t *testing.T) {
+	l := listen(t)
+	require.NoError(t, l.Close())
+
+	g := NewTransport(inmemory.NewTransport(), Upstream{
+		Prefix:    "missing_",
+		Transport: client.NewStreamableHTTPTransport(fmt.Sprintf("http://%s/mcp", l.Addr())),
+	})
+	err := g.Run(&mcp.ServerCapabilities{}, &mcp.Implementation{Name: "gateway", Version: "0.0.0"})
+	assert.ErrorContains(t, err, `upstream "missing_"`)
+}
+
+type recordingLogger struct {
+	mu     sync.Mutex
+	events []foxyevent.Event
+}
+
+func (l *recordingLogger) LogEvent(e foxyevent.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, e)
+}
+
+func TestGatewayReportsUndeliverableNotificationsOnce(t *testing.T) {
+	logger := &recordingLogger{}
+	g := &gateway{logger: logger}
+	// streamable HTTP transport cannot send notifications to clients
+	s := server.NewServer(&mcp.ServerCapabilities{}, &mcp.Implementation{}, server.DisableServerRequestsOption{})
+	g.servers.Store(s, &atomic.Bool{})
+
+	g.notify(s, &mcp.ToolListChangedNotification{})
+	g.notify(s, &mcp.PromptListChangedNotification{})
+
+	require.Len(t, logger.events, 1)
+	failed, ok := logger.events[0].(foxyevent.GatewayFailedNotifying)
+	require.True(t, ok)
+	assert.ErrorIs(t, failed.Err, server.ErrServerRequestsNotSupported)
+}
@@ -0,0 +1,140 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/strowk/foxy-contexts/pkg/fxctx"
+	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+)
+
+type requestHandler = func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error)
+
+// handlers collects request handlers registered by muxes,
+// so that they could be replaced for all sessions at once,
+// together with upstreams serving resources at that time
+type handlers struct {
+	byMethod map[string]requestHandler
+
+	// resources holds upstream by URI of resource it has listed
+	resources map[string]*upstream
+	// templates are resource templates of all upstreams in their order
+	templates []routedTemplate
+}
+
+var _ jsonrpc2.HandlerRegistry = &handlers{}
+
+func newHandlers() *handlers {
+	return &handlers{
+		byMethod:  map[string]requestHandler{},
+		resources: map[string]*upstream{},
+	}
+}
+
+// upstreamServing returns upstream, which has listed resource with uri
+// or has template matching it, or nil if there is no such upstream
+func (h *handlers) upstreamServing(uri string) *upstream {
+	if u, ok := h.resources[uri]; ok {
+		return u
+	}
+	for _, t := range h.templates {
+		if t.pattern.MatchString(uri) {
+			return t.upstream
+		}
+	}
+	return nil
+}
+
+// upstreamCompleting returns upstream for completion of resource reference,
+// which is either URI template or URI of resource
+func (h *handlers) upstreamCompleting(uri string) *upstream {
+	for _, t := range h.templates {
+		if t.template.UriTemplate == uri {
+			return t.upstream
+		}
+	}
+	return h.upstreamServing(uri)
+}
+
+// listTemplates answers with resource templates of all upstreams
+func (h *handlers) listTemplates(context.Context, *mcp.ListResourceTemplatesRequest) (*mcp.ListResourceTemplatesResult, *jsonrpc2.Error) {
+	templates := []mcp.ResourceTemplate{}
+	for _, t := range h.templates {
+		templates = append(templates, t.template)
+	}
+	return &mcp.ListResourceTemplatesResult{ResourceTemplates: templates}, nil
+}
+
+// completingResourceMux is resource mux, which completes
+// arguments of resource templates with completions of upstreams
+type completingResourceMux struct {
+	fxctx.ResourceMux
+	handlers *handlers
+}
+
+func (m *completingResourceMux) Complete(ctx context.Context, req *mcp.CompleteRequest, uri string) (*mcp.CompleteResult, error) {
+	u := m.handlers.upstreamCompleting(uri)
+	if u == nil {
+		return nil, jsonrpc2.NewInvalidParamsError(fmt.Sprintf("resource not found: %s", uri))
+	}
+	result, err := u.client.Complete(ctx, req.Params)
+	if err != nil {
+		return nil, upstreamError(err)
+	}
+	return result, nil
+}
+
+// SetMethodHandler keeps handler by method, requests are decoded
+// by servers of sessions, so newRequest is not needed
+func (h *handlers) SetMethodHandler(method string, _ func() jsonrpc2.Request, handler requestHandler) {
+	h.byMethod[method] = handler
+}
+
+// SetMethodNotificationHandler ignores handler, only requests
+// are delegated to handlers by servers of sessions
+func (h *handlers) SetMethodNotificationHandler(string, func() jsonrpc2.Request, func(ctx context.Context, req jsonrpc2.Request)) {
+}
+
+func (h *handlers) handle(ctx context.Context, method string, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
+	handler, ok := h.byMethod[method]
+	if !ok {
+		return nil, jsonrpc2.NewMethodNotFoundError(fmt.Sprintf("handler for method %v not found", method))
+	}
+	return handler(ctx, req)
+}
+
+// requestMeta is _meta of request, progress token
+// is kept as is, as it can be either string or number
+type requestMeta struct {
+	ProgressToken json.RawMessage `json:"progressToken,omitempty"`
+}
+
+// callToolRequest is mcp.CallToolRequest with _meta,
+// which is needed to forward progress
+type callToolRequest struct {
+	Params struct {
+		Meta      *requestMeta           `json:"_meta,omitempty"`
+		Name      string                 `json:"name"`
+		Arguments map[string]interface{} `json:"arguments,omitempty"`
+	} `json:"params"`
+}
+
+func (callToolRequest) GetMethod() string {
+	return mcp.CallToolRequest{}.GetMethod()
+}
+
+// progressNotification is mcp.ProgressNotification
+// with progress token of any type
+type progressNotification struct {
+	Params struct {
+		ProgressToken json.RawMessage `json:"progressToken"`
+		Progress      float64         `json:"progress"`
+		Total         *float64        `json:"total,omitempty"`
+	} `json:"params"`
+}
+
+func (progressNotification) GetMethod() string {
+	return mcp.ProgressNotification{}.GetMethod()
+}
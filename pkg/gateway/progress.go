@@ -0,0 +1,64 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/server"
+)
+
+// progressTarget is where progress of tool call has to be forwarded
+type progressTarget struct {
+	server server.Server
+	token  json.RawMessage
+}
+
+type progressTargetContextKey struct{}
+
+func withProgressTarget(ctx context.Context, target progressTarget) context.Context {
+	return context.WithValue(ctx, progressTargetContextKey{}, target)
+}
+
+func progressTargetFromContext(ctx context.Context) (progressTarget, bool) {
+	target, ok := ctx.Value(progressTargetContextKey{}).(progressTarget)
+	return target, ok
+}
+
+// progressForwarder replaces progress tokens of clients with tokens
+// unique across all sessions when calling upstreams and forwards
+// progress reported by upstreams back with original tokens
+type progressForwarder struct {
+	lastToken atomic.Int64
+	// targets holds progressTarget by token sent to upstream
+	targets sync.Map
+}
+
+// begin returns token for upstream and function to call once call is done
+func (p *progressForwarder) begin(target progressTarget) (json.RawMessage, func()) {
+	token := int(p.lastToken.Add(1))
+	p.targets.Store(token, target)
+	return json.RawMessage(strconv.Itoa(token)), func() {
+		p.targets.Delete(token)
+	}
+}
+
+// forward sends progress reported by upstream to client that asked for it
+func (p *progressForwarder) forward(n *mcp.ProgressNotification, notify func(server.Server, jsonrpc2.Request)) {
+	value, ok := p.targets.Load(int(n.Params.ProgressToken))
+	if !ok {
+		// call has already finished
+		return
+	}
+	target := value.(progressTarget)
+
+	notification := &progressNotification{}
+	notification.Params.ProgressToken = target.token
+	notification.Params.Progress = n.Params.Progress
+	notification.Params.Total = n.Params.Total
+	notify(target.server, notification)
+}
@@ -0,0 +1,120 @@
+package gateway
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/strowk/foxy-contexts/pkg/server"
+)
+
+// subscriptions tracks sessions subscribed to updates of resources,
+// upstream is subscribed to resource while any session is subscribed to it
+type subscriptions struct {
+	// upstreamMu serializes subscribing in upstreams, so that subscribing
+	// and unsubscribing of the same resource are not reordered
+	upstreamMu sync.Mutex
+
+	mu sync.Mutex
+	// byUri holds subscription by URI of resource
+	byUri map[string]*subscription
+}
+
+type subscription struct {
+	upstream *upstream
+	servers  map[server.Server]struct{}
+}
+
+// subscribe subscribes session of s to resource served by u,
+// upstream is only asked for it by the first subscriber
+func (subs *subscriptions) subscribe(ctx context.Context, s server.Server, u *upstream, uri string) error {
+	subs.upstreamMu.Lock()
+	defer subs.upstreamMu.Unlock()
+
+	subs.mu.Lock()
+	if sub, ok := subs.byUri[uri]; ok {
+		sub.servers[s] = struct{}{}
+		subs.mu.Unlock()
+		return nil
+	}
+	subs.mu.Unlock()
+
+	if err := u.client.Subscribe(ctx, uri); err != nil {
+		return upstreamError(err)
+	}
+
+	subs.mu.Lock()
+	defer subs.mu.Unlock()
+	if subs.byUri == nil {
+		subs.byUri = map[string]*subscription{}
+	}
+	subs.byUri[uri] = &subscription{upstream: u, servers: map[server.Server]struct{}{s: {}}}
+	return nil
+}
+
+// unsubscribe unsubscribes session of s from resource,
+// upstream is unsubscribed once there are no subscribers left
+func (subs *subscriptions) unsubscribe(ctx context.Context, s server.Server, uri string) error {
+	subs.upstreamMu.Lock()
+	defer subs.upstreamMu.Unlock()
+
+	subs.mu.Lock()
+	sub, ok := subs.byUri[uri]
+	if !ok {
+		subs.mu.Unlock()
+		return nil
+	}
+	delete(sub.servers, s)
+	if len(sub.servers) > 0 {
+		subs.mu.Unlock()
+		return nil
+	}
+	delete(subs.byUri, uri)
+	subs.mu.Unlock()
+
+	return upstreamError(sub.upstream.client.Unsubscribe(ctx, uri))
+}
+
+// drop unsubscribes session of s from all resources once it is shut down,
+// failing to unsubscribe upstream only means that updates it keeps
+// sending are not forwarded to anyone
+func (subs *subscriptions) drop(s server.Server) {
+	subs.mu.Lock()
+	var uris []string
+	for uri, sub := range subs.byUri {
+		if _, ok := sub.servers[s]; ok {
+			uris = append(uris, uri)
+		}
+	}
+	subs.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	for _, uri := range uris {
+		_ = subs.unsubscribe(ctx, s, uri)
+	}
+}
+
+// subscribers returns sessions subscribed to resource updated in u,
+// which are subscribed to the resource or to one containing it
+func (subs *subscriptions) subscribers(u *upstream, uri string) []server.Server {
+	subs.mu.Lock()
+	defer subs.mu.Unlock()
+
+	found := map[server.Server]struct{}{}
+	for subscribed, sub := range subs.byUri {
+		if sub.upstream != u {
+			continue
+		}
+		if uri == subscribed || strings.HasPrefix(uri, strings.TrimSuffix(subscribed, "/")+"/") {
+			for s := range sub.servers {
+				found[s] = struct{}{}
+			}
+		}
+	}
+	servers := make([]server.Server, 0, len(found))
+	for s := range found {
+		servers = append(servers, s)
+	}
+	return servers
+}
@@ -0,0 +1,66 @@
+package gateway
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+)
+
+// routedTemplate is resource template of upstream with pattern
+// matching URIs of resources, which can be read by it
+type routedTemplate struct {
+	template mcp.ResourceTemplate
+	upstream *upstream
+	pattern  *regexp.Regexp
+}
+
+// templatePattern returns regular expression matching URIs expanded from
+// URI template of RFC 6570, such as "file:///{path}". Variables of simple
+// expansion match anything but delimiters of URI, as these are encoded
+// when expanded, while reserved expansion "{+path}" and fragment
+// expansion "{#section}" match anything.
+func templatePattern(template string) (*regexp.Regexp, error) {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	for {
+		start := strings.IndexByte(template, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(template[start:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("expression is not closed in URI template %q", template)
+		}
+		pattern.WriteString(regexp.QuoteMeta(template[:start]))
+		pattern.WriteString(expressionPattern(template[start+1 : start+end]))
+		template = template[start+end+1:]
+	}
+	pattern.WriteString(regexp.QuoteMeta(template))
+	pattern.WriteString("$")
+	return regexp.Compile(pattern.String())
+}
+
+// expressionPattern returns regular expression matching expansion
+// of expression, operators that prepend their own delimiter
+// expand to nothing when variables are undefined
+func expressionPattern(expression string) string {
+	if expression == "" {
+		return ""
+	}
+	switch expression[0] {
+	case '+', '#':
+		return ".*"
+	case '?', '&':
+		return `(?:[?&][^#]*)?`
+	case '/':
+		return `(?:/[^?#]*)?`
+	case '.':
+		return `(?:\.[^/?#]*)?`
+	case ';':
+		return `(?:;[^/?#]*)?`
+	default:
+		return `[^/?#]*`
+	}
+}
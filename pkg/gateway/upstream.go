@@ -0,0 +1,286 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/strowk/foxy-contexts/internal/utils"
+	"github.com/strowk/foxy-contexts/pkg/client"
+	"github.com/strowk/foxy-contexts/pkg/fxctx"
+	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+)
+
+type listKind string
+
+const (
+	toolsList     listKind = "tools"
+	resourcesList listKind = "resources"
+	promptsList   listKind = "prompts"
+)
+
+func (l listKind) changedNotification() jsonrpc2.Request {
+	switch l {
+	case toolsList:
+		return &mcp.ToolListChangedNotification{}
+	case resourcesList:
+		return &mcp.ResourceListChangedNotification{}
+	default:
+		return &mcp.PromptListChangedNotification{}
+	}
+}
+
+// upstream holds connection to upstream server and its last known lists
+type upstream struct {
+	Upstream
+
+	client       *client.Client
+	capabilities mcp.ServerCapabilities
+
+	mu        sync.Mutex
+	tools     []mcp.Tool
+	resources []mcp.Resource
+	templates []mcp.ResourceTemplate
+	prompts   []mcp.Prompt
+}
+
+// refresh lists given kind of items of upstream, if upstream supports them
+func (u *upstream) refresh(ctx context.Context, list listKind) error {
+	switch list {
+	case toolsList:
+		if u.capabilities.Tools == nil {
+			return nil
+		}
+		result, err := u.client.ListTools(ctx)
+		if err != nil {
+			return err
+		}
+		u.mu.Lock()
+		u.tools = result.Tools
+		u.mu.Unlock()
+	case resourcesList:
+		if u.capabilities.Resources == nil {
+			return nil
+		}
+		result, err := u.client.ListResources(ctx)
+		if err != nil {
+			return err
+		}
+		templates, err := u.listTemplates(ctx)
+		if err != nil {
+			return err
+		}
+		u.mu.Lock()
+		u.resources = result.Resources
+		u.templates = templates
+		u.mu.Unlock()
+	case promptsList:
+		if u.capabilities.Prompts == nil {
+			return nil
+		}
+		result, err := u.client.ListPrompts(ctx)
+		if err != nil {
+			return err
+		}
+		u.mu.Lock()
+		u.prompts = result.Prompts
+		u.mu.Unlock()
+	}
+	return nil
+}
+
+// listTemplates lists resource templates of upstream, servers
+// that do not implement listing of templates have none
+func (u *upstream) listTemplates(ctx context.Context) ([]mcp.ResourceTemplate, error) {
+	result, err := u.client.ListResourceTemplates(ctx)
+	var responseErr *client.ResponseError
+	if errors.As(err, &responseErr) && responseErr.Code == jsonrpc2.MethodNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result.ResourceTemplates, nil
+}
+
+// canSubscribe tells whether upstream can send updates of resources
+func (u *upstream) canSubscribe() bool {
+	return u.capabilities.Resources != nil &&
+		u.capabilities.Resources.Subscribe != nil &&
+		*u.capabilities.Resources.Subscribe
+}
+
+// proxyTools returns tools calling tools of upstream
+func (u *upstream) proxyTools(progress *progressForwarder) []fxctx.Tool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	tools := []fxctx.Tool{}
+	for _, tool := range u.tools {
+		name := tool.Name
+		prefixed := tool
+		prefixed.Name = u.Prefix + name
+		tools = append(tools, &proxyTool{tool: &prefixed, call: func(ctx context.Context, args map[string]interface{}) (*mcp.CallToolResult, error) {
+			request := &callToolRequest{}
+			request.Params.Name = name
+			request.Params.Arguments = args
+			if target, ok := progressTargetFromContext(ctx); ok {
+				token, done := progress.begin(target)
+				defer done()
+				request.Params.Meta = &requestMeta{ProgressToken: token}
+			}
+
+			var result mcp.CallToolResult
+			if err := u.client.Request(ctx, request, &result); err != nil {
+				return nil, upstreamError(err)
+			}
+			return &result, nil
+		}})
+	}
+	return tools
+}
+
+// proxyTool is tool of upstream, calls of which fail
+// with the same error as they have failed in upstream
+type proxyTool struct {
+	tool *mcp.Tool
+	call func(ctx context.Context, args map[string]interface{}) (*mcp.CallToolResult, error)
+}
+
+var _ fxctx.FallibleTool = &proxyTool{}
+
+func (t *proxyTool) GetMcpTool() *mcp.Tool {
+	return t.tool
+}
+
+func (t *proxyTool) Call(ctx context.Context, args map[string]interface{}) (*mcp.CallToolResult, error) {
+	return t.call(ctx, args)
+}
+
+// Callback returns failure of call as result marked as error,
+// tool mux uses Call instead, so this is only for other callers
+func (t *proxyTool) Callback(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
+	result, err := t.call(ctx, args)
+	if err != nil {
+		return &mcp.CallToolResult{
+			IsError: utils.Ptr(true),
+			Content: []interface{}{mcp.TextContent{Type: "text", Text: err.Error()}},
+		}
+	}
+	return result
+}
+
+// upstreamError returns error response of upstream as *jsonrpc2.Error,
+// so that muxes answer clients with it as is
+func upstreamError(err error) error {
+	var responseErr *client.ResponseError
+	if errors.As(err, &responseErr) {
+		return &jsonrpc2.Error{Code: responseErr.Code, Message: responseErr.Message, Data: responseErr.Data}
+	}
+	return err
+}
+
+// proxyResources returns provider reading resources of upstream and their URIs,
+// resources are only read if they are served by upstream according to h
+func (u *upstream) proxyResources(h *handlers) (fxctx.ResourceProvider, []string) {
+	u.mu.Lock()
+	resources := slices.Clone(u.resources)
+	u.mu.Unlock()
+
+	uris := []string{}
+	prefixed := []mcp.Resource{}
+	for _, resource := range resources {
+		uris = append(uris, resource.Uri)
+		resource.Name = u.Prefix + resource.Name
+		prefixed = append(prefixed, resource)
+	}
+
+	return fxctx.NewResourceProvider(
+		func(ctx context.Context) ([]mcp.Resource, error) {
+			return prefixed, nil
+		},
+		func(ctx context.Context, uri string) (*mcp.ReadResourceResult, error) {
+			if h.upstreamServing(uri) != u {
+				// resource belongs to another upstream
+				return nil, nil
+			}
+			result, err := u.client.ReadResource(ctx, uri)
+			if err != nil {
+				return nil, upstreamError(err)
+			}
+			return result, nil
+		},
+	), uris
+}
+
+// proxyTemplates returns resource templates of upstream, templates
+// which cannot be parsed are skipped, as no URI could be matched to them
+func (u *upstream) proxyTemplates() []routedTemplate {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	templates := []routedTemplate{}
+	for _, template := range u.templates {
+		pattern, err := templatePattern(template.UriTemplate)
+		if err != nil {
+			continue
+		}
+		template.Name = u.Prefix + template.Name
+		templates = append(templates, routedTemplate{template: template, upstream: u, pattern: pattern})
+	}
+	return templates
+}
+
+// proxyPrompts returns prompts getting prompts of upstream
+func (u *upstream) proxyPrompts() []fxctx.Prompt {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	prompts := []fxctx.Prompt{}
+	for _, prompt := range u.prompts {
+		prefixed := prompt
+		prefixed.Name = u.Prefix + prompt.Name
+		prompts = append(prompts, &proxyPrompt{prompt: prefixed, name: prompt.Name, upstream: u})
+	}
+	return prompts
+}
+
+// proxyPrompt is prompt of upstream, which also completes
+// arguments of the prompt with completions of upstream
+type proxyPrompt struct {
+	prompt mcp.Prompt
+	// name is name of prompt in upstream
+	name     string
+	upstream *upstream
+}
+
+var _ fxctx.Prompt = &proxyPrompt{}
+
+func (p *proxyPrompt) GetMcpPrompt() mcp.Prompt {
+	return p.prompt
+}
+
+func (p *proxyPrompt) Get(ctx context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	result, err := p.upstream.client.GetPrompt(ctx, p.name, req.Params.Arguments)
+	if err != nil {
+		return nil, upstreamError(err)
+	}
+	return result, nil
+}
+
+func (p *proxyPrompt) Complete(ctx context.Context, req *mcp.CompleteRequest) (*mcp.CompleteResult, error) {
+	params := req.Params
+	params.Ref = map[string]interface{}{"type": "ref/prompt", "name": p.name}
+	result, err := p.upstream.client.Complete(ctx, params)
+	if err != nil {
+		return nil, upstreamError(err)
+	}
+	return result, nil
+}
+
+// WithCompleter does not change the prompt, as completions come from upstream
+func (p *proxyPrompt) WithCompleter(fxctx.CompleterFunc) fxctx.Prompt {
+	return p
+}
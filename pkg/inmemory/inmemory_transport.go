@@ -0,0 +1,250 @@
+// Package inmemory implements transport connecting clients to server
+// running in the same process, so that MCP servers could be embedded
+// into applications as libraries and tested without processes or sockets.
+//
+// Messages are still encoded as JSON-RPC and go through the same router,
+// lifecycle and session handling as with any other transport.
+package inmemory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/strowk/foxy-contexts/pkg/client"
+	"github.com/strowk/foxy-contexts/pkg/dispatch"
+	"github.com/strowk/foxy-contexts/pkg/drain"
+	foxyevent "github.com/strowk/foxy-contexts/pkg/foxy_event"
+	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/server"
+	"github.com/strowk/foxy-contexts/pkg/session"
+)
+
+// ErrTransportClosed is returned when transport has been shut down,
+// it is also client.ErrDisconnected for clients that were connected
+var ErrTransportClosed = fmt.Errorf("%w: in-memory transport is shut down", client.ErrDisconnected)
+
+// Transport serves clients created by Connect, every client
+// gets its own session, just like separate connection would.
+type Transport struct {
+	// servers holds server.Server for every session by its uuid.UUID
+	servers sync.Map
+
+	sessionManager *session.SessionManager
+
+	// lifecycle tracks connected clients and messages received from them,
+	// that are being handled, to disconnect clients on shutdown
+	lifecycle drain.Lifecycle
+
+	capabilities  *mcp.ServerCapabilities
+	serverInfo    *mcp.Implementation
+	serverOptions []server.ServerOption
+}
+
+func NewTransport() *Transport {
+	return &Transport{
+		sessionManager: session.NewSessionManager(),
+	}
+}
+
+// Run makes transport ready to accept clients and blocks until it is shut down.
+func (t *Transport) Run(
+	capabilities *mcp.ServerCapabilities,
+	serverInfo *mcp.Implementation,
+	serverOptions ...server.ServerOption,
+) error {
+	t.capabilities = capabilities
+	t.serverInfo = serverInfo
+	t.serverOptions = serverOptions
+	t.lifecycle.Start()
+
+	<-t.lifecycle.Stopping()
+	return nil
+}
+
+// Connect creates new client connected to the server with its own session.
+//
+// If transport is not running yet, for example because application
+// is still starting, Connect waits until it is or ctx is done.
+// Client has to be initialized with Initialize before it can use the server.
+func (t *Transport) Connect(ctx context.Context, options ...client.ClientOption) (*client.Client, error) {
+	select {
+	case <-t.lifecycle.Stopping():
+		return nil, ErrTransportClosed
+	case <-t.lifecycle.Ready():
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if !t.lifecycle.BeginConnection() {
+		return nil, ErrTransportClosed
+	}
+
+	p := newPipe()
+	go func() {
+		defer t.lifecycle.EndConnection()
+		t.serveConnection(p)
+	}()
+	return client.Connect(ctx, p, options...)
+}
+
+// pipe carries messages between client and its session,
+// each side closes its own channel when it stops
+type pipe struct {
+	toServer chan []byte
+	toClient chan []byte
+
+	// clientClosed is closed when client is closed
+	clientClosed chan struct{}
+	closeOnce    sync.Once
+	// serverClosed is closed when server stops reading messages from client
+	serverClosed chan struct{}
+}
+
+func newPipe() *pipe {
+	return &pipe{
+		toServer:     make(chan []byte),
+		toClient:     make(chan []byte),
+		clientClosed: make(chan struct{}),
+		serverClosed: make(chan struct{}),
+	}
+}
+
+// Start implements client.Transport, connection is already established
+// by the time client is created, so it only returns messages from server
+func (p *pipe) Start(context.Context) (<-chan []byte, error) {
+	return p.toClient, nil
+}
+
+func (p *pipe) Send(ctx context.Context, message []byte) error {
+	select {
+	case p.toServer <- message:
+		return nil
+	case <-p.clientClosed:
+		return client.ErrClosed
+	case <-p.serverClosed:
+		return ErrTransportClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *pipe) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.clientClosed)
+	})
+	return nil
+}
+
+func (t *Transport) serveConnection(p *pipe) {
+	sessionId := uuid.New()
+	srv := server.NewServer(t.capabilities, t.serverInfo, t.serverOptions...)
+	ctx, _, err := t.sessionManager.CreateNewSession(context.Background(), &sessionId)
+	if err != nil {
+		srv.GetLogger().LogEvent(foxyevent.FailedCreatingSession{Err: err})
+		close(p.serverClosed)
+		close(p.toClient)
+		return
+	}
+	t.servers.Store(sessionId, srv)
+	srv.GetLogger().LogEvent(foxyevent.SessionCreated{SessionId: sessionId.String(), Transport: "inmemory"})
+	defer func() {
+		t.servers.Delete(sessionId)
+		t.sessionManager.DeleteSession(sessionId)
+		srv.GetLogger().LogEvent(foxyevent.SessionDeleted{SessionId: sessionId.String(), Transport: "inmemory"})
+	}()
+
+	stopWriting := make(chan struct{})
+	stoppedWriting := make(chan struct{})
+	go func() {
+		defer close(stoppedWriting)
+		t.write(p, srv, stopWriting)
+	}()
+
+	// messages are queued, so that reading goes on while handler
+	// waits for client to respond to server request
+	queue := dispatch.NewQueue(ctx, srv, &t.lifecycle.Requests)
+
+reading:
+	for {
+		select {
+		case <-p.clientClosed:
+			break reading
+		case <-t.lifecycle.Closing():
+			break reading
+		case input := <-p.toServer:
+			queue.Push(input)
+		}
+	}
+	close(p.serverClosed)
+	queue.Close()
+	<-queue.Done()
+
+	// session is shut down while writing is still possible,
+	// as callbacks might want to send notifications
+	srv.Shutdown(ctx)
+	close(stopWriting)
+	<-stoppedWriting
+	close(p.toClient)
+}
+
+// write delivers responses, requests and notifications of the server
+// to the client until stop is closed
+func (t *Transport) write(p *pipe, srv server.Server, stop chan struct{}) {
+	send := func(data []byte) {
+		select {
+		case p.toClient <- data:
+		case <-p.clientClosed:
+			// client would not get anything anymore,
+			// but server still has to be able to finish its work
+		}
+	}
+
+	for {
+		select {
+		case <-stop:
+			return
+		case res := <-srv.GetResponses():
+			data, err := jsonrpc2.Marshal(res.Id, res.Result, res.Error)
+			if err != nil {
+				srv.GetLogger().LogEvent(foxyevent.InMemoryFailedMarshal{Err: err})
+				continue
+			}
+			send(data)
+		case req := <-srv.GetRequests():
+			data, err := json.Marshal(req)
+			if err != nil {
+				srv.GetLogger().LogEvent(foxyevent.InMemoryFailedMarshal{Err: err})
+				continue
+			}
+			send(data)
+		}
+	}
+}
+
+// Shutdown stops accepting new clients and messages, waits for messages
+// in flight to be handled and responded to, then disconnects clients,
+// ctx bounds how long transport would wait.
+func (t *Transport) Shutdown(ctx context.Context) error {
+	return t.lifecycle.Shutdown(ctx, t.logger(), "inmemory", nil)
+}
+
+// logger returns logger configured for servers once transport is running
+func (t *Transport) logger() foxyevent.Logger {
+	select {
+	case <-t.lifecycle.Ready():
+		return server.LoggerFromOptions(t.serverOptions)
+	default:
+		return server.LoggerFromOptions(nil)
+	}
+}
+
+func (t *Transport) GetSessionManager() *session.SessionManager {
+	return t.sessionManager
+}
+
+func (t *Transport) SetSessionManager(sessionManager *session.SessionManager) {
+	t.sessionManager = sessionManager
+}
@@ -0,0 +1,240 @@
+package inmemory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/strowk/foxy-contexts/internal/utils"
+	"github.com/strowk/foxy-contexts/pkg/app"
+	"github.com/strowk/foxy-contexts/pkg/client"
+	"github.com/strowk/foxy-contexts/pkg/fxctx"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/server"
+	"go.uber.org/fx"
+)
+
+func newGreetTool() fxctx.Tool {
+	return fxctx.NewTool(
+		&mcp.Tool{
+			Name:        "greet",
+			InputSchema: mcp.ToolInputSchema{Type: "object"},
+		},
+		func(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
+			return &mcp.CallToolResult{
+				Content: []interface{}{
+					mcp.TextContent{Type: "text", Text: "Hello, " + args["name"].(string)},
+				},
+			}
+		},
+	)
+}
+
+func newSampleTool() fxctx.Tool {
+	return fxctx.NewTool(
+		&mcp.Tool{
+			Name:        "sample",
+			InputSchema: mcp.ToolInputSchema{Type: "object"},
+		},
+		func(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
+			srv, _ := server.FromContext(ctx)
+			result, err := srv.CreateMessage(ctx, mcp.CreateMessageRequestParams{
+				MaxTokens: 10,
+				Messages: []mcp.SamplingMessage{
+					{Role: mcp.RoleUser, Content: mcp.TextContent{Type: "text", Text: "hi"}},
+				},
+			})
+			if err != nil {
+				return &mcp.CallToolResult{
+					IsError: utils.Ptr(true),
+					Content: []interface{}{mcp.TextContent{Type: "text", Text: err.Error()}},
+				}
+			}
+			return &mcp.CallToolResult{
+				Content: []interface{}{mcp.TextContent{Type: "text", Text: "sampled with " + result.Model}},
+			}
+		},
+	)
+}
+
+func newGreetingResource() fxctx.Resource {
+	return fxctx.NewResource(
+		mcp.Resource{Name: "greeting", Uri: "greeting://hello"},
+		func(_ context.Context, uri string) (*mcp.ReadResourceResult, error) {
+			return &mcp.ReadResourceResult{
+				Contents: []interface{}{mcp.TextResourceContents{Uri: uri, Text: "hello"}},
+			}, nil
+		},
+	)
+}
+
+func newGreetingPrompt() fxctx.Prompt {
+	return fxctx.NewPrompt(
+		mcp.Prompt{Name: "greeting"},
+		func(_ context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			return &mcp.GetPromptResult{
+				Messages: []mcp.PromptMessage{
+					{Role: mcp.RoleUser, Content: mcp.TextContent{Type: "text", Text: "greet " + req.Params.Arguments["name"]}},
+				},
+			}, nil
+		},
+	)
+}
+
+// startApp runs application built by app.Builder with in-memory transport
+func startApp(t *testing.T) *Transport {
+	t.Helper()
+	transport := NewTransport()
+	fxApp, err := app.NewBuilder().
+		WithTool(newGreetTool).
+		WithTool(newSampleTool).
+		WithResource(newGreetingResource).
+		WithPrompt(newGreetingPrompt).
+		WithServerCapabilities(&mcp.ServerCapabilities{
+			Tools:     &mcp.ServerCapabilitiesTools{},
+			Resources: &mcp.ServerCapabilitiesResources{},
+			Prompts:   &mcp.ServerCapabilitiesPrompts{},
+		}).
+		WithTransport(transport).
+		WithFxOptions(fx.NopLogger).
+		BuildFxApp()
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, fxApp.Start(ctx))
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		require.NoError(t, fxApp.Stop(ctx))
+	})
+	return transport
+}
+
+func connect(t *testing.T, transport *Transport, options ...client.ClientOption) *client.Client {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := transport.Connect(ctx, options...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func TestClientWithAppBuilder(t *testing.T) {
+	transport := startApp(t)
+	c := connect(t, transport)
+	ctx := context.Background()
+
+	initResult, err := c.Initialize(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "my-foxy-contexts-server", initResult.ServerInfo.Name)
+
+	require.NoError(t, c.Ping(ctx))
+
+	tools, err := c.ListTools(ctx)
+	require.NoError(t, err)
+	require.Len(t, tools.Tools, 2)
+
+	called, err := c.CallTool(ctx, "greet", map[string]any{"name": "Alice"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"type": "text", "text": "Hello, Alice"}, called.Content[0])
+
+	resources, err := c.ListResources(ctx)
+	require.NoError(t, err)
+	require.Len(t, resources.Resources, 1)
+
+	read, err := c.ReadResource(ctx, "greeting://hello")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"uri": "greeting://hello", "text": "hello"}, read.Contents[0])
+
+	prompt, err := c.GetPrompt(ctx, "greeting", map[string]string{"name": "Bob"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"type": "text", "text": "greet Bob"}, prompt.Messages[0].Content)
+}
+
+func TestClientRequiresInitialization(t *testing.T) {
+	transport := startApp(t)
+	initialized := connect(t, transport)
+	_, err := initialized.Initialize(context.Background())
+	require.NoError(t, err)
+
+	// every client has its own session, so this one is not initialized
+	c := connect(t, transport)
+	_, err = c.ListTools(context.Background())
+	var responseErr *client.ResponseError
+	require.True(t, errors.As(err, &responseErr))
+	assert.Equal(t, server.ServerNotInitialized, responseErr.Code)
+}
+
+func TestClientAnswersSamplingRequests(t *testing.T) {
+	transport := startApp(t)
+	c := connect(t, transport, client.SamplingHandler{
+		Handler: func(ctx context.Context, params mcp.CreateMessageRequestParams) (*mcp.CreateMessageResult, error) {
+			return &mcp.CreateMessageResult{
+				Model:   "test-model",
+				Role:    mcp.RoleAssistant,
+				Content: mcp.TextContent{Type: "text", Text: "hello"},
+			}, nil
+		},
+	})
+	ctx := context.Background()
+	_, err := c.Initialize(ctx)
+	require.NoError(t, err)
+
+	result, err := c.CallTool(ctx, "sample", nil)
+	require.NoError(t, err)
+	assert.Nil(t, result.IsError)
+	assert.Equal(t, map[string]any{"type": "text", "text": "sampled with test-model"}, result.Content[0])
+}
+
+func TestClientCanSendWhileServerWaitsForResponse(t *testing.T) {
+	transport := startApp(t)
+	var c *client.Client
+	c = connect(t, transport, client.SamplingHandler{
+		Handler: func(ctx context.Context, params mcp.CreateMessageRequestParams) (*mcp.CreateMessageResult, error) {
+			// notification comes before response to server request
+			// and must not stop response from being read
+			err := c.Notify(ctx, &mcp.RootsListChangedNotification{Method: "notifications/roots/list_changed"})
+			if err != nil {
+				return nil, err
+			}
+			return &mcp.CreateMessageResult{
+				Model:   "test-model",
+				Role:    mcp.RoleAssistant,
+				Content: mcp.TextContent{Type: "text", Text: "hello"},
+			}, nil
+		},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := c.Initialize(ctx)
+	require.NoError(t, err)
+
+	result, err := c.CallTool(ctx, "sample", nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"type": "text", "text": "sampled with test-model"}, result.Content[0])
+}
+
+func TestShutdownDisconnectsClients(t *testing.T) {
+	transport := NewTransport()
+	runDone := make(chan error)
+	go func() {
+		runDone <- transport.Run(&mcp.ServerCapabilities{}, &mcp.Implementation{Name: "TestServer", Version: "0.0.0"})
+	}()
+	c := connect(t, transport)
+	_, err := c.Initialize(context.Background())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, transport.Shutdown(ctx))
+	require.NoError(t, <-runDone)
+
+	assert.ErrorIs(t, c.Ping(context.Background()), client.ErrDisconnected)
+	_, err = transport.Connect(context.Background())
+	assert.ErrorIs(t, err, ErrTransportClosed)
+}
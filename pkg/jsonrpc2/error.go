@@ -1,37 +1,109 @@
 package jsonrpc2
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
+// Error codes defined by JSON-RPC 2.0 specification
+const (
+	// ParseError means that invalid JSON was received
+	ParseError = -32700
+	// InvalidRequest means that JSON sent is not a valid request object
+	InvalidRequest = -32600
+	// MethodNotFound means that method does not exist or is not available
+	MethodNotFound = -32601
+	// InvalidParams means that params of the method are invalid,
+	// for example they have wrong types or refer to something unknown
+	InvalidParams = -32602
+	// InternalError means that server has failed to handle request
+	InternalError = -32603
+)
+
+// Error is error object of JSON-RPC response.
+//
+// It is also Go error, so it can be wrapped by handlers and
+// found with errors.As or turned back into response with AsError.
 type Error struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
 	Data    any    `json:"data"`
 }
 
-func invalidRequest(data string) *Error {
+func (e *Error) Error() string {
+	if e.Data == nil {
+		return fmt.Sprintf("jsonrpc2 error %d: %s", e.Code, e.Message)
+	}
+	return fmt.Sprintf("jsonrpc2 error %d: %s: %v", e.Code, e.Message, e.Data)
+}
+
+// AsError returns *Error found in chain of err with errors.As,
+// or Internal error carrying message of err if there is none.
+func AsError(err error) *Error {
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+	return NewInternalError(err.Error())
+}
+
+// NewParseError returns error for invalid JSON received
+func NewParseError(data any) *Error {
 	return &Error{
-		Code:    -32600,
+		Code:    ParseError,
+		Message: "Parse error",
+		Data:    data,
+	}
+}
+
+// NewInvalidRequestError returns error for JSON that is not a valid request
+func NewInvalidRequestError(data any) *Error {
+	return &Error{
+		Code:    InvalidRequest,
 		Message: "Invalid Request",
 		Data:    data,
 	}
 }
 
-func methodNotFound(data string) *Error {
+// NewMethodNotFoundError returns error for request of unknown method
+func NewMethodNotFoundError(data any) *Error {
 	return &Error{
-		Code:    -32601,
+		Code:    MethodNotFound,
 		Message: "Method not found",
 		Data:    data,
 	}
 }
 
-func parseError(data string) *Error {
+// NewInvalidParamsError returns error for request with invalid params
+func NewInvalidParamsError(data any) *Error {
 	return &Error{
-		Code:    -32700,
-		Message: "Parse error",
+		Code:    InvalidParams,
+		Message: "Invalid params",
+		Data:    data,
+	}
+}
+
+// NewInternalError returns error for request that server has failed to handle
+func NewInternalError(data any) *Error {
+	return &Error{
+		Code:    InternalError,
+		Message: "Internal error",
 		Data:    data,
 	}
 }
 
+func invalidRequest(data string) *Error {
+	return NewInvalidRequestError(data)
+}
+
+func methodNotFound(data string) *Error {
+	return NewMethodNotFoundError(data)
+}
+
+func parseError(data string) *Error {
+	return NewParseError(data)
+}
+
 func NewServerError(
 	code int,
 	data interface{},
@@ -0,0 +1,76 @@
+package jsonrpc2
+
+import "context"
+
+// HandlerRegistry is where handlers of methods are registered, it is
+// implemented by JsonRpcRouter and server.Server. Handle and HandleNotification
+// register typed handlers in it.
+type HandlerRegistry interface {
+	// SetMethodHandler sets handler for requests of method, every request
+	// is decoded into new value returned by newRequest
+	SetMethodHandler(method string, newRequest func() Request, handler func(ctx context.Context, req Request) (Result, *Error))
+
+	// SetMethodNotificationHandler sets handler for notifications of method, every notification
+	// is decoded into new value returned by newRequest
+	SetMethodNotificationHandler(method string, newRequest func() Request, handler func(ctx context.Context, req Request))
+}
+
+// Handle registers handler for requests of method of Req, for example:
+//
+//	jsonrpc2.Handle(router, func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, *jsonrpc2.Error) {
+//		...
+//	})
+//
+// Every request is decoded into new Req, so handler gets it already typed.
+// Custom methods are handled the same way, with Req being any struct
+// which pointer implements Request.
+func Handle[Req any, Res any, PReq interface {
+	*Req
+	Request
+}](registry HandlerRegistry, handler func(ctx context.Context, req *Req) (*Res, *Error)) {
+	registry.SetMethodHandler(methodOf[Req, PReq](), newRequestOf[Req, PReq], func(ctx context.Context, req Request) (Result, *Error) {
+		res, err := handler(ctx, req.(PReq))
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	})
+}
+
+// HandleNotification registers handler for notifications of method of Req,
+// every notification is decoded into new Req, same as requests with Handle.
+func HandleNotification[Req any, PReq interface {
+	*Req
+	Request
+}](registry HandlerRegistry, handler func(ctx context.Context, req *Req)) {
+	registry.SetMethodNotificationHandler(methodOf[Req, PReq](), newRequestOf[Req, PReq], func(ctx context.Context, req Request) {
+		handler(ctx, req.(PReq))
+	})
+}
+
+// RequestConstructor returns function creating new Req, which can be passed
+// to SetMethodHandler and SetMethodNotificationHandler, when handler has
+// to deal with requests of several types, for example:
+//
+//	newRequest := jsonrpc2.RequestConstructor[mcp.ListToolsRequest]()
+//	router.SetMethodHandler(newRequest().GetMethod(), newRequest, handler)
+func RequestConstructor[Req any, PReq interface {
+	*Req
+	Request
+}]() func() Request {
+	return newRequestOf[Req, PReq]
+}
+
+func methodOf[Req any, PReq interface {
+	*Req
+	Request
+}]() string {
+	return PReq(new(Req)).GetMethod()
+}
+
+func newRequestOf[Req any, PReq interface {
+	*Req
+	Request
+}]() Request {
+	return PReq(new(Req))
+}
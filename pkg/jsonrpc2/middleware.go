@@ -0,0 +1,113 @@
+package jsonrpc2
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+)
+
+// Call describes request or notification being handled by router.
+type Call struct {
+	Method string
+	// Id is missing for notifications
+	Id RequestId
+	// Params are raw params of the call, nil if call has none
+	Params json.RawMessage
+	// Registered is false for calls of methods not in registry of router,
+	// names of such methods come from clients as is, so for example metrics
+	// should not use them as labels
+	Registered bool
+}
+
+// CallHandler handles call and returns its result or error,
+// both of which are nil for handled notifications.
+type CallHandler func(ctx context.Context, call *Call) (Result, *Error)
+
+// Middleware wraps handling of every request and notification with methods
+// known to router or not, it can inspect call, result and error, replace
+// result and error or answer call without calling next. Results and errors
+// returned for notifications are never sent.
+//
+// Middlewares are installed with MiddlewareOption, so that tracing, metrics,
+// auditing and such could be set up once for all methods.
+type Middleware func(next CallHandler) CallHandler
+
+// MiddlewareOption installs middlewares to router, first one given
+// is the outermost, so it sees the call first and the result last.
+type MiddlewareOption struct {
+	Middlewares []Middleware
+}
+
+func (o MiddlewareOption) apply(r *router) {
+	r.middlewares = append(r.middlewares, o.Middlewares...)
+}
+
+// ForMethods returns middleware, which applies given middleware
+// only to calls of listed methods and passes other calls through.
+func ForMethods(middleware Middleware, methods ...string) Middleware {
+	return func(next CallHandler) CallHandler {
+		wrapped := middleware(next)
+		return func(ctx context.Context, call *Call) (Result, *Error) {
+			if slices.Contains(methods, call.Method) {
+				return wrapped(ctx, call)
+			}
+			return next(ctx, call)
+		}
+	}
+}
+
+// handleCall handles call wrapped into middlewares of router
+func (r *router) handleCall(
+	ctx context.Context,
+	buf []byte,
+	method string,
+	id RequestId,
+) (Result, RequestId, *Error) {
+	if !id.IdIsMissing {
+		ctx = context.WithValue(ctx, requestIdContextKey{}, id)
+	}
+	if len(r.middlewares) == 0 {
+		return r.handle(ctx, buf, method, id)
+	}
+
+	resId := id
+	_, registered := r.requestRegistry[method]
+	handler := r.chain(func(ctx context.Context, call *Call) (Result, *Error) {
+		res, handledId, err := r.handle(ctx, buf, method, id)
+		resId = handledId
+		return res, err
+	})
+	res, err := handler(ctx, &Call{Method: method, Id: id, Params: rawParams(buf), Registered: registered})
+	if resId.IdIsMissing {
+		return nil, resId, nil
+	}
+	return res, resId, err
+}
+
+type requestIdContextKey struct{}
+
+// RequestIdFromContext returns id of request being handled by router,
+// it is not found while handling notifications
+func RequestIdFromContext(ctx context.Context) (RequestId, bool) {
+	id, ok := ctx.Value(requestIdContextKey{}).(RequestId)
+	return id, ok
+}
+
+// chain wraps handler into middlewares of router
+func (r *router) chain(handler CallHandler) CallHandler {
+	for i := len(r.middlewares) - 1; i >= 0; i-- {
+		handler = r.middlewares[i](handler)
+	}
+	return handler
+}
+
+// rawParams returns params of the call without decoding them
+func rawParams(buf []byte) json.RawMessage {
+	var call struct {
+		Params json.RawMessage `json:"params"`
+	}
+	if err := json.Unmarshal(buf, &call); err != nil {
+		return nil
+	}
+	return call.Params
+}
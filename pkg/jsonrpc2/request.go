@@ -0,0 +1,47 @@
+package jsonrpc2
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// JsonRpcRequest is a request or notification sent from the server to the client.
+//
+// When Id is missing, the message is marshalled as a notification.
+type JsonRpcRequest struct {
+	Id      RequestId
+	Request Request
+}
+
+func (r JsonRpcRequest) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(r.Request)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("request is expected to be marshalled as an object: %w", err)
+	}
+	if fields == nil {
+		fields = map[string]json.RawMessage{}
+	}
+
+	fields["jsonrpc"] = json.RawMessage(`"2.0"`)
+
+	method, err := json.Marshal(r.Request.GetMethod())
+	if err != nil {
+		return nil, err
+	}
+	fields["method"] = method
+
+	if !r.Id.IdIsMissing {
+		id, err := json.Marshal(r.Id)
+		if err != nil {
+			return nil, err
+		}
+		fields["id"] = id
+	}
+
+	return json.Marshal(fields)
+}
@@ -5,7 +5,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
 	"reflect"
+	"strconv"
+	"sync"
 )
 
 type Result any
@@ -15,12 +18,25 @@ type Request interface {
 }
 
 type JsonRpcRouter interface {
-	/// SetRequestHandler sets a handler for a request that would return a response
+	HandlerRegistry
+
+	/// SetRequestHandler sets a handler for a request that would return a response,
+	// incoming requests are decoded into new values of the same type as request,
+	// which are created with reflection.
+	//
+	// Deprecated: use Handle to get typed requests in handler, or SetMethodHandler
+	// with RequestConstructor, which create requests without reflection.
 	SetRequestHandler(request Request, handler func(ctx context.Context, req Request) (Result, *Error))
 
-	/// SetNotificationHandler sets a handler for a notification, that would not return any response
+	/// SetNotificationHandler sets a handler for a notification, that would not return any response.
+	//
+	// Deprecated: use HandleNotification to get typed notifications in handler,
+	// or SetMethodNotificationHandler with RequestConstructor.
 	SetNotificationHandler(request Request, handler func(ctx context.Context, req Request))
 
+	/// SetResponseHandler sets a handler for responses arriving to requests that were sent to the other side
+	SetResponseHandler(handler func(ctx context.Context, id RequestId, result json.RawMessage, err *Error))
+
 	/// Handle processes incoming JSON-RPC request and either returns an array of
 	// JSON-RPC results or error responses or nil if successfully processed notification
 	Handle(ctx context.Context, b []byte) []*JsonRpcResponse
@@ -66,6 +82,21 @@ func (r RequestId) MarshalJSON() ([]byte, error) {
 	return json.Marshal(r.IdString)
 }
 
+// String returns id as it is written in logs: string ids as they are,
+// numbers in decimal, "null" for null id and empty string for missing one
+func (r RequestId) String() string {
+	switch {
+	case r.IdIsMissing:
+		return ""
+	case r.IdIsNull:
+		return "null"
+	case r.IdIsNum:
+		return strconv.Itoa(r.IdNumber)
+	default:
+		return r.IdString
+	}
+}
+
 func NewNullRequestId() RequestId {
 	return RequestId{
 		IdIsNull: true,
@@ -76,36 +107,93 @@ type router struct {
 	requestHandlers      map[string]func(ctx context.Context, req Request) (Result, *Error)
 	notificationHandlers map[string]func(ctx context.Context, req Request)
 	requestRegistry      map[string]func() Request
+	responseHandler      func(ctx context.Context, id RequestId, result json.RawMessage, err *Error)
+
+	// batchConcurrency limits how many entries of batch are handled at the same time
+	batchConcurrency int
+	middlewares      []Middleware
+	// strict enables full validation of messages, see StrictOption
+	strict bool
+	// unknownMethodHandlers are called for calls of methods not in registry
+	unknownMethodHandlers []func(ctx context.Context, call *Call)
 }
 
-func NewJsonRPCRouter() JsonRpcRouter {
-	return &router{
+func NewJsonRPCRouter(options ...RouterOption) JsonRpcRouter {
+	r := &router{
 		requestHandlers:      map[string]func(ctx context.Context, req Request) (Result, *Error){},
 		requestRegistry:      map[string]func() Request{},
 		notificationHandlers: map[string]func(ctx context.Context, req Request){},
+		batchConcurrency:     1,
+	}
+	for _, o := range options {
+		o.apply(r)
 	}
+	return r
+}
+
+type RouterOption interface {
+	apply(*router)
+}
+
+// BatchConcurrencyOption makes router handle entries of batch concurrently,
+// at most Limit of them at the same time. Responses are still returned in
+// the same order as requests in batch. Limit of 1 or less, which is default,
+// handles entries one by one.
+//
+// JSON-RPC 2.0 allows entries of batch to be processed in any order,
+// so clients cannot rely on one entry being handled before another.
+type BatchConcurrencyOption struct {
+	Limit int
 }
 
-func (r *router) saveRequestToRegistry(method string, request Request) {
-	r.requestRegistry[method] = func() Request {
-		// copy using reflect, note that request is expected to be a pointer
-		requestCopy := reflect.New(reflect.TypeOf(request).Elem()).Interface().(Request)
-		return requestCopy
+func (o BatchConcurrencyOption) apply(r *router) {
+	r.batchConcurrency = max(o.Limit, 1)
+}
+
+// UnknownMethodOption makes router call Handler for every request
+// or notification of method, which has no handler registered,
+// before request is answered with "Method not found" error
+// and notification is ignored.
+type UnknownMethodOption struct {
+	Handler func(ctx context.Context, call *Call)
+}
+
+func (o UnknownMethodOption) apply(r *router) {
+	r.unknownMethodHandlers = append(r.unknownMethodHandlers, o.Handler)
+}
+
+// newRequestLike returns function creating new values of the same type as request,
+// which is only known at runtime for handlers registered with deprecated SetRequestHandler
+func newRequestLike(request Request) func() Request {
+	// note that request is expected to be a pointer
+	requestType := reflect.TypeOf(request).Elem()
+	return func() Request {
+		return reflect.New(requestType).Interface().(Request)
 	}
 }
 
-func (r *router) SetRequestHandler(request Request, handler func(ctx context.Context, req Request) (Result, *Error)) {
-	method := request.GetMethod()
-	r.saveRequestToRegistry(method, request)
+func (r *router) SetMethodHandler(method string, newRequest func() Request, handler func(ctx context.Context, req Request) (Result, *Error)) {
+	r.requestRegistry[method] = newRequest
 	r.requestHandlers[method] = handler
 }
 
-func (r *router) SetNotificationHandler(request Request, handler func(ctx context.Context, req Request)) {
-	method := request.GetMethod()
-	r.saveRequestToRegistry(method, request)
+func (r *router) SetMethodNotificationHandler(method string, newRequest func() Request, handler func(ctx context.Context, req Request)) {
+	r.requestRegistry[method] = newRequest
 	r.notificationHandlers[method] = handler
 }
 
+func (r *router) SetRequestHandler(request Request, handler func(ctx context.Context, req Request) (Result, *Error)) {
+	r.SetMethodHandler(request.GetMethod(), newRequestLike(request), handler)
+}
+
+func (r *router) SetNotificationHandler(request Request, handler func(ctx context.Context, req Request)) {
+	r.SetMethodNotificationHandler(request.GetMethod(), newRequestLike(request), handler)
+}
+
+func (r *router) SetResponseHandler(handler func(ctx context.Context, id RequestId, result json.RawMessage, err *Error)) {
+	r.responseHandler = handler
+}
+
 func (r *router) getRequestHandler(method string) func(ctx context.Context, req Request) (Result, *Error) {
 	if handler, ok := r.requestHandlers[method]; ok {
 		return handler
@@ -126,43 +214,57 @@ func (r *router) handle(
 	method string,
 	id RequestId,
 ) (Result, RequestId, *Error) {
-	if regEntry, ok := r.requestRegistry[method]; ok {
-		req := regEntry()
-		err := json.Unmarshal(buf, req)
-		if err != nil {
-			return nil, id, &Error{
-				Code:    -32700,
-				Message: "Parse error",
-				Data:    err.Error(),
-			}
+	regEntry, ok := r.requestRegistry[method]
+	if !ok {
+		for _, handler := range r.unknownMethodHandlers {
+			handler(ctx, &Call{Method: method, Id: id, Params: rawParams(buf)})
 		}
-
 		if id.IdIsMissing {
-			handler := r.getNotificationHandler(method)
-			if handler == nil {
-				return nil, NewNullRequestId(), methodNotFound(fmt.Sprintf("handler for method %v not found to process notification", method))
-			}
-			handler(ctx, req)
+			// notifications are never answered, even with errors
 			return nil, id, nil
-		} else {
-			handler := r.getRequestHandler(method)
-			if handler == nil {
-				return nil, id, methodNotFound(fmt.Sprintf("handler for method %v not found to process request", method))
-			}
+		}
+		return nil, id, methodNotFound(fmt.Sprintf("request for method %v not found in registry", method))
+	}
 
-			res, err := handler(ctx, req)
-			if err != nil {
-				return nil, id, err
-			}
-			return res, id, nil
+	if id.IdIsMissing {
+		handler := r.getNotificationHandler(method)
+		if handler == nil {
+			// method is known, but only as request
+			return nil, id, nil
+		}
+		req := regEntry()
+		if err := json.Unmarshal(buf, req); err != nil {
+			return nil, id, nil
 		}
+		handler(ctx, req)
+		return nil, id, nil
+	}
 
-	} else {
-		return nil, id, methodNotFound(fmt.Sprintf("request for method %v not found in registry", method))
+	handler := r.getRequestHandler(method)
+	if handler == nil {
+		// method is known, so it is not "Method not found", but it is only notification
+		return nil, id, invalidRequest(fmt.Sprintf("method %v is notification and cannot be sent as request with id", method))
+	}
+
+	req := regEntry()
+	if err := json.Unmarshal(buf, req); err != nil {
+		// request was already parsed as JSON object,
+		// so it is params that do not match the method
+		return nil, id, NewInvalidParamsError(err.Error())
 	}
+
+	res, err := handler(ctx, req)
+	if err != nil {
+		return nil, id, err
+	}
+	return res, id, nil
 }
 
-func getId(raw map[string]interface{}) (*RequestId, error) {
+// integers below maxExactFloatInt are held by float64 exactly, while bigger
+// ones might have been rounded when JSON was decoded
+const maxExactFloatInt = 1 << 53
+
+func getId(raw map[string]interface{}, buf []byte, strict bool) (*RequestId, error) {
 	if idField, ok := raw["id"]; ok {
 		if idField == nil {
 			return nil, fmt.Errorf("field id in request is required cannot be null")
@@ -172,6 +274,27 @@ func getId(raw map[string]interface{}) (*RequestId, error) {
 				IdString: idString,
 			}, nil
 		} else if idNumber, ok := idField.(float64); ok {
+			if idNumber == math.Trunc(idNumber) && math.Abs(idNumber) < maxExactFloatInt {
+				return &RequestId{
+					IdNumber: int(idNumber),
+					IdIsNum:  true,
+				}, nil
+			}
+			// id is read again as text, as float64 loses precision of large integers
+			var exact struct {
+				Id json.Number `json:"id"`
+			}
+			if err := json.Unmarshal(buf, &exact); err == nil {
+				if n, err := strconv.ParseInt(exact.Id.String(), 10, strconv.IntSize); err == nil {
+					return &RequestId{
+						IdNumber: int(n),
+						IdIsNum:  true,
+					}, nil
+				}
+			}
+			if strict {
+				return nil, fmt.Errorf("field id in request is expected to be string or integer, but got number %v", exact.Id)
+			}
 			return &RequestId{
 				IdNumber: int(idNumber),
 				IdIsNum:  true,
@@ -199,11 +322,10 @@ func (r *router) Handle(ctx context.Context, buf []byte) []*JsonRpcResponse {
 		if err := json.Unmarshal(buf, &rawArray); err != nil {
 			return errResponseWithNullId(parseError(err.Error()))
 		}
-		var resp []*JsonRpcResponse
-		for _, raw := range rawArray {
-			resp = append(resp, getResponse(r.handleSingleObject(ctx, raw)))
+		if len(rawArray) == 0 {
+			return errResponseWithNullId(invalidRequest("Batch is empty, but must contain at least one request"))
 		}
-		return resp
+		return r.handleBatch(ctx, rawArray)
 	}
 
 	if isObject {
@@ -224,6 +346,34 @@ func (r *router) Handle(ctx context.Context, buf []byte) []*JsonRpcResponse {
 	return errResponseWithNullId(invalidRequest(fmt.Sprintf("Request is expected to be an object or array, but was %T' : %s", raw, string(trimmedBytes))))
 }
 
+// handleBatch handles entries of batch, concurrently if allowed by
+// BatchConcurrencyOption, and returns responses in order of entries
+func (r *router) handleBatch(ctx context.Context, rawArray []json.RawMessage) []*JsonRpcResponse {
+	resp := make([]*JsonRpcResponse, len(rawArray))
+	if r.batchConcurrency <= 1 {
+		for i, raw := range rawArray {
+			resp[i] = getResponse(r.handleSingleObject(ctx, raw))
+		}
+		return resp
+	}
+
+	slots := make(chan struct{}, r.batchConcurrency)
+	var wg sync.WaitGroup
+	for i, raw := range rawArray {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			resp[i] = getResponse(r.handleSingleObject(ctx, raw))
+		}()
+	}
+	wg.Wait()
+	return resp
+}
+
 func (r *router) handleSingleObject(ctx context.Context, raw json.RawMessage) (Result, RequestId, *Error) {
 	if raw == nil {
 		return nil, NewNullRequestId(), invalidRequest("Request is null, but must be an object")
@@ -235,18 +385,28 @@ func (r *router) handleSingleObject(ctx context.Context, raw json.RawMessage) (R
 		return nil, NewNullRequestId(), parseError(err.Error())
 	}
 
-	id, err := getId(rawMap)
+	id, err := getId(rawMap, raw, r.strict)
 	if err != nil {
 		return nil, NewNullRequestId(), invalidRequest(err.Error())
 	}
 
+	if r.strict {
+		if err := validateEnvelope(rawMap); err != nil {
+			respId := *id
+			if respId.IdIsMissing {
+				respId = NewNullRequestId()
+			}
+			return nil, respId, invalidRequest(err.Error())
+		}
+	}
+
 	if method, ok := rawMap["method"]; ok {
 		if method == nil {
 			return nil, *id, invalidRequest("Method is required, but was null")
 		}
 
 		if methodString, ok := method.(string); ok {
-			res, resId, err := r.handle(ctx, raw, methodString, *id)
+			res, resId, err := r.handleCall(ctx, raw, methodString, *id)
 			if err != nil {
 				return nil, resId, err
 			}
@@ -255,11 +415,97 @@ func (r *router) handleSingleObject(ctx context.Context, raw json.RawMessage) (R
 			return nil, *id, invalidRequest(fmt.Sprintf("field method in request must be a string, but got %v", reflect.TypeOf(method)))
 		}
 
+	} else if isResponse(rawMap) && r.responseHandler != nil && !id.IdIsMissing {
+		var response struct {
+			Result json.RawMessage `json:"result"`
+			Error  *Error          `json:"error"`
+		}
+		if err := json.Unmarshal(raw, &response); err != nil {
+			return nil, *id, invalidRequest(err.Error())
+		}
+		r.responseHandler(ctx, *id, response.Result, response.Error)
+		// responses are not answered, so same as for notifications we return nothing
+		return nil, *id, nil
 	} else {
 		return nil, *id, invalidRequest("Method is required, but is missing")
 	}
 }
 
+func isResponse(rawMap map[string]any) bool {
+	if _, ok := rawMap["method"]; ok {
+		return false
+	}
+	_, hasResult := rawMap["result"]
+	_, hasError := rawMap["error"]
+	return hasResult || hasError
+}
+
+// IsResponse reports whether b is JSON-RPC response object or batch of
+// them, which transports can use to deliver responses to server requests
+// without waiting for other messages to be processed.
+func IsResponse(b []byte) bool {
+	trimmedBytes := bytes.TrimLeft(b, " \t\r\n")
+	if len(trimmedBytes) == 0 {
+		return false
+	}
+	switch trimmedBytes[0] {
+	case '{':
+		var rawMap map[string]any
+		if err := json.Unmarshal(b, &rawMap); err != nil {
+			return false
+		}
+		return isResponse(rawMap)
+	case '[':
+		var batch []map[string]any
+		if err := json.Unmarshal(b, &batch); err != nil || len(batch) == 0 {
+			return false
+		}
+		for _, rawMap := range batch {
+			if !isResponse(rawMap) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// ErrorResponses returns responses with err to every request in b,
+// which is single message or batch, notifications and responses are not
+// answered. Transports use it to reject messages they would not handle.
+func ErrorResponses(b []byte, err *Error) []*JsonRpcResponse {
+	trimmedBytes := bytes.TrimLeft(b, " \t\r\n")
+	var batch []json.RawMessage
+	if len(trimmedBytes) > 0 && trimmedBytes[0] == '[' {
+		if json.Unmarshal(b, &batch) != nil {
+			return errResponseWithNullId(err)
+		}
+	} else {
+		batch = []json.RawMessage{b}
+	}
+
+	var responses []*JsonRpcResponse
+	for _, raw := range batch {
+		var rawMap map[string]any
+		if json.Unmarshal(raw, &rawMap) != nil {
+			responses = append(responses, getResponse(nil, NewNullRequestId(), err))
+			continue
+		}
+		if isResponse(rawMap) {
+			continue
+		}
+		id, idErr := getId(rawMap, raw, false)
+		if idErr != nil {
+			responses = append(responses, getResponse(nil, NewNullRequestId(), err))
+			continue
+		}
+		if !id.IdIsMissing {
+			responses = append(responses, getResponse(nil, *id, err))
+		}
+	}
+	return responses
+}
+
 func getResponse(res Result, id RequestId, err *Error) *JsonRpcResponse {
 	if err != nil {
 		return &JsonRpcResponse{
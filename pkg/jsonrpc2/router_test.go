@@ -2,8 +2,12 @@ package jsonrpc2
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -121,6 +125,61 @@ func TestRouter(t *testing.T) {
 		assert.Equal(t, "request for method unknown not found in registry", res.Error.Data)
 	})
 
+	t.Run("Handle invalid params", func(t *testing.T) {
+		data := `{"method":"resources/list","params":{"cursor":1},"id":1}`
+		responses := r.Handle(testContext(), []byte(data))
+		require.Len(t, responses, 1)
+		assert.Equal(t, InvalidParams, responses[0].Error.Code)
+		assert.Equal(t, "Invalid params", responses[0].Error.Message)
+	})
+
+	t.Run("Handle unknown notification", func(t *testing.T) {
+		responses := r.Handle(testContext(), []byte(`{"method":"notifications/unknown","params":{}}`))
+		require.Len(t, responses, 1)
+		require.Nil(t, responses[0])
+	})
+
+	t.Run("Handle notification sent as request", func(t *testing.T) {
+		responses := r.Handle(testContext(), []byte(`{"method":"notifications/initialized","params":{},"id":1}`))
+		require.Len(t, responses, 1)
+		assert.Equal(t, -32600, responses[0].Error.Code)
+	})
+
+	t.Run("Handle response to server request", func(t *testing.T) {
+		var gotId RequestId
+		var gotResult string
+		r.SetResponseHandler(func(ctx context.Context, id RequestId, result json.RawMessage, err *Error) {
+			gotId = id
+			gotResult = string(result)
+		})
+		defer r.SetResponseHandler(nil)
+
+		data := `{"jsonrpc":"2.0","result":{"roots":[]},"id":5}`
+		responses := r.Handle(testContext(), []byte(data))
+		require.Len(t, responses, 1)
+		require.Nil(t, responses[0])
+		assert.Equal(t, NewIntRequestId(5), gotId)
+		assert.JSONEq(t, `{"roots":[]}`, gotResult)
+	})
+
+	t.Run("Handle empty batch", func(t *testing.T) {
+		responses := r.Handle(testContext(), []byte(`[]`))
+		require.Len(t, responses, 1)
+		assert.Equal(t, NewNullRequestId(), responses[0].Id)
+		assert.Equal(t, -32600, responses[0].Error.Code)
+	})
+
+	t.Run("Handle batch", func(t *testing.T) {
+		data := `[{"method":"resources/list","params":{},"id":1},{"method":"notifications/initialized"},{"method":"unknown","id":"2"}]`
+		responses := r.Handle(testContext(), []byte(data))
+		require.Len(t, responses, 3)
+		assert.Equal(t, NewIntRequestId(1), responses[0].Id)
+		assert.NotNil(t, responses[0].Result)
+		assert.Nil(t, responses[1])
+		assert.Equal(t, NewStringRequestId("2"), responses[2].Id)
+		assert.Equal(t, -32601, responses[2].Error.Code)
+	})
+
 	t.Run("Handle invalid method type", func(t *testing.T) {
 		data := `{"method":1,"params":{}, "id":1}`
 		responses := r.Handle(testContext(), []byte(data))
@@ -134,6 +193,322 @@ func TestRouter(t *testing.T) {
 	})
 }
 
+func TestConcurrentBatch(t *testing.T) {
+	const size = 3
+	r := NewJsonRPCRouter(BatchConcurrencyOption{Limit: size})
+
+	// every handler waits for all others to start,
+	// which would never happen if batch was handled sequentially
+	var started sync.WaitGroup
+	started.Add(size)
+	r.SetRequestHandler(&mcp.CallToolRequest{},
+		func(ctx context.Context, req Request) (Result, *Error) {
+			started.Done()
+			started.Wait()
+			return &mcp.CallToolResult{
+				Content: []interface{}{mcp.TextContent{Type: "text", Text: req.(*mcp.CallToolRequest).Params.Name}},
+			}, nil
+		},
+	)
+
+	done := make(chan []*JsonRpcResponse)
+	go func() {
+		data := `[
+			{"method":"tools/call","params":{"name":"a"},"id":1},
+			{"method":"tools/call","params":{"name":"b"},"id":2},
+			{"method":"tools/call","params":{"name":"c"},"id":3}
+		]`
+		done <- r.Handle(testContext(), []byte(data))
+	}()
+
+	select {
+	case responses := <-done:
+		require.Len(t, responses, size)
+		for i, name := range []string{"a", "b", "c"} {
+			assert.Equal(t, NewIntRequestId(i+1), responses[i].Id)
+			result := (*responses[i].Result).(*mcp.CallToolResult)
+			assert.Equal(t, name, result.Content[0].(mcp.TextContent).Text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("batch entries were not handled concurrently")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next CallHandler) CallHandler {
+			return func(ctx context.Context, call *Call) (Result, *Error) {
+				calls = append(calls, name+" "+call.Method+" "+string(call.Params))
+				return next(ctx, call)
+			}
+		}
+	}
+	registered := map[string]bool{}
+	recordRegistered := func(next CallHandler) CallHandler {
+		return func(ctx context.Context, call *Call) (Result, *Error) {
+			registered[call.Method] = call.Registered
+			return next(ctx, call)
+		}
+	}
+	denyList := func(next CallHandler) CallHandler {
+		return func(ctx context.Context, call *Call) (Result, *Error) {
+			return nil, NewServerError(-32000, "denied")
+		}
+	}
+
+	r := NewJsonRPCRouter(MiddlewareOption{Middlewares: []Middleware{
+		record("outer"),
+		record("inner"),
+		recordRegistered,
+		ForMethods(denyList, "resources/list"),
+	}})
+	r.SetRequestHandler(&mcp.ListResourcesRequest{}, func(ctx context.Context, req Request) (Result, *Error) {
+		return &mcp.ListResourcesResult{}, nil
+	})
+	r.SetRequestHandler(&mcp.ListPromptsRequest{}, func(ctx context.Context, req Request) (Result, *Error) {
+		return &mcp.ListPromptsResult{}, nil
+	})
+	r.SetNotificationHandler(&mcp.InitializedNotification{}, func(ctx context.Context, req Request) {})
+
+	responses := r.Handle(testContext(), []byte(`{"method":"prompts/list","params":{"cursor":"a"},"id":1}`))
+	require.Len(t, responses, 1)
+	assert.Nil(t, responses[0].Error)
+
+	responses = r.Handle(testContext(), []byte(`{"method":"resources/list","id":2}`))
+	require.Len(t, responses, 1)
+	assert.Equal(t, -32000, responses[0].Error.Code)
+
+	responses = r.Handle(testContext(), []byte(`{"method":"notifications/initialized"}`))
+	require.Len(t, responses, 1)
+	assert.Nil(t, responses[0])
+
+	responses = r.Handle(testContext(), []byte(`{"method":"vendor/unknown","id":3}`))
+	require.Len(t, responses, 1)
+	assert.Equal(t, MethodNotFound, responses[0].Error.Code)
+
+	assert.Equal(t, []string{
+		`outer prompts/list {"cursor":"a"}`,
+		`inner prompts/list {"cursor":"a"}`,
+		`outer resources/list `,
+		`inner resources/list `,
+		`outer notifications/initialized `,
+		`inner notifications/initialized `,
+		`outer vendor/unknown `,
+		`inner vendor/unknown `,
+	}, calls)
+	assert.Equal(t, map[string]bool{
+		"prompts/list":              true,
+		"resources/list":            true,
+		"notifications/initialized": true,
+		"vendor/unknown":            false,
+	}, registered)
+}
+
+type echoRequest struct {
+	Params struct {
+		Text string `json:"text"`
+	} `json:"params"`
+}
+
+func (echoRequest) GetMethod() string {
+	return "vendor/echo"
+}
+
+type echoResult struct {
+	Text string `json:"text"`
+}
+
+func TestHandle(t *testing.T) {
+	r := NewJsonRPCRouter()
+	Handle(r, func(ctx context.Context, req *echoRequest) (*echoResult, *Error) {
+		if req.Params.Text == "" {
+			return nil, NewAppError(1, "text is required", nil)
+		}
+		return &echoResult{Text: req.Params.Text}, nil
+	})
+	notified := make(chan string, 1)
+	HandleNotification(r, func(ctx context.Context, req *mcp.CancelledNotification) {
+		notified <- *req.Params.Reason
+	})
+
+	responses := r.Handle(testContext(), []byte(`{"method":"vendor/echo","params":{"text":"hi"},"id":1}`))
+	require.Len(t, responses, 1)
+	require.Nil(t, responses[0].Error)
+	assert.Equal(t, &echoResult{Text: "hi"}, *responses[0].Result)
+
+	responses = r.Handle(testContext(), []byte(`{"method":"vendor/echo","params":{},"id":2}`))
+	require.Len(t, responses, 1)
+	assert.Equal(t, 1, responses[0].Error.Code)
+
+	responses = r.Handle(testContext(), []byte(`{"method":"notifications/cancelled","params":{"requestId":1,"reason":"bored"}}`))
+	require.Len(t, responses, 1)
+	assert.Nil(t, responses[0])
+	assert.Equal(t, "bored", <-notified)
+}
+
+func TestRequestConstructor(t *testing.T) {
+	newRequest := RequestConstructor[echoRequest]()
+	first, second := newRequest(), newRequest()
+	assert.IsType(t, &echoRequest{}, first)
+	assert.NotSame(t, first, second)
+
+	r := NewJsonRPCRouter()
+	r.SetMethodHandler(first.GetMethod(), newRequest, func(ctx context.Context, req Request) (Result, *Error) {
+		return &echoResult{Text: req.(*echoRequest).Params.Text}, nil
+	})
+	responses := r.Handle(testContext(), []byte(`{"method":"vendor/echo","params":{"text":"hi"},"id":1}`))
+	require.Len(t, responses, 1)
+	assert.Equal(t, &echoResult{Text: "hi"}, *responses[0].Result)
+}
+
+func TestUnknownMethodAndRequestId(t *testing.T) {
+	var unknown []string
+	var seenIds []string
+	r := NewJsonRPCRouter(UnknownMethodOption{Handler: func(ctx context.Context, call *Call) {
+		unknown = append(unknown, call.Method+" "+call.Id.String())
+	}})
+	r.SetRequestHandler(&mcp.ListPromptsRequest{}, func(ctx context.Context, req Request) (Result, *Error) {
+		id, _ := RequestIdFromContext(ctx)
+		seenIds = append(seenIds, id.String())
+		return &mcp.ListPromptsResult{}, nil
+	})
+	r.SetNotificationHandler(&mcp.InitializedNotification{}, func(ctx context.Context, req Request) {
+		_, found := RequestIdFromContext(ctx)
+		assert.False(t, found)
+	})
+
+	r.Handle(testContext(), []byte(`{"jsonrpc":"2.0","method":"prompts/list","id":"abc"}`))
+	r.Handle(testContext(), []byte(`{"jsonrpc":"2.0","method":"prompts/list","id":7}`))
+	r.Handle(testContext(), []byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`))
+	responses := r.Handle(testContext(), []byte(`{"jsonrpc":"2.0","method":"vendor/unknown","id":8}`))
+	require.Len(t, responses, 1)
+	assert.Equal(t, MethodNotFound, responses[0].Error.Code)
+	r.Handle(testContext(), []byte(`{"jsonrpc":"2.0","method":"notifications/unknown"}`))
+
+	assert.Equal(t, []string{"abc", "7"}, seenIds)
+	assert.Equal(t, []string{"vendor/unknown 8", "notifications/unknown "}, unknown)
+	assert.Equal(t, "null", NewNullRequestId().String())
+}
+
+func TestLargeId(t *testing.T) {
+	r := NewJsonRPCRouter()
+	r.SetRequestHandler(&mcp.PingRequest{}, func(ctx context.Context, req Request) (Result, *Error) {
+		return struct{}{}, nil
+	})
+
+	responses := r.Handle(testContext(), []byte(`{"jsonrpc":"2.0","method":"ping","id":9007199254740993}`))
+	require.Len(t, responses, 1)
+	data, err := json.Marshal(responses[0].Id)
+	require.NoError(t, err)
+	assert.Equal(t, "9007199254740993", string(data))
+
+	// lenient router truncates fractional ids
+	responses = r.Handle(testContext(), []byte(`{"jsonrpc":"2.0","method":"ping","id":1.5}`))
+	require.Len(t, responses, 1)
+	assert.Equal(t, NewIntRequestId(1), responses[0].Id)
+}
+
+func TestStrict(t *testing.T) {
+	r := NewJsonRPCRouter(StrictOption{})
+	r.SetRequestHandler(&mcp.ListResourcesRequest{}, func(ctx context.Context, req Request) (Result, *Error) {
+		return &mcp.ListResourcesResult{}, nil
+	})
+	r.SetResponseHandler(func(ctx context.Context, id RequestId, result json.RawMessage, err *Error) {})
+
+	t.Run("valid request", func(t *testing.T) {
+		responses := r.Handle(testContext(), []byte(`{"jsonrpc":"2.0","method":"resources/list","params":{},"id":1}`))
+		require.Len(t, responses, 1)
+		assert.Nil(t, responses[0].Error)
+	})
+
+	for _, tc := range []struct {
+		name    string
+		message string
+		id      RequestId
+		data    string
+	}{
+		{
+			name:    "missing version",
+			message: `{"method":"resources/list","id":1}`,
+			id:      NewIntRequestId(1),
+			data:    `member jsonrpc is required and must be "2.0"`,
+		},
+		{
+			name:    "wrong version",
+			message: `{"jsonrpc":"1.0","method":"resources/list","id":1}`,
+			id:      NewIntRequestId(1),
+			data:    `member jsonrpc must be exactly "2.0", but got string "1.0"`,
+		},
+		{
+			name:    "numeric version",
+			message: `{"jsonrpc":2.0,"method":"resources/list","id":1}`,
+			id:      NewIntRequestId(1),
+			data:    `member jsonrpc must be exactly "2.0", but got number 2`,
+		},
+		{
+			name:    "fractional id",
+			message: `{"jsonrpc":"2.0","method":"resources/list","id":1.5}`,
+			id:      NewNullRequestId(),
+			data:    "field id in request is expected to be string or integer, but got number 1.5",
+		},
+		{
+			name:    "id out of range",
+			message: `{"jsonrpc":"2.0","method":"resources/list","id":99999999999999999999}`,
+			id:      NewNullRequestId(),
+			data:    "field id in request is expected to be string or integer, but got number 99999999999999999999",
+		},
+		{
+			name:    "params of wrong type",
+			message: `{"jsonrpc":"2.0","method":"resources/list","params":"all","id":"a"}`,
+			id:      NewStringRequestId("a"),
+			data:    `member params must be object or array, but got string "all"`,
+		},
+		{
+			name:    "null params of notification",
+			message: `{"jsonrpc":"2.0","method":"notifications/initialized","params":null}`,
+			id:      NewNullRequestId(),
+			data:    "member params must be object or array, but got null",
+		},
+		{
+			name:    "unknown member",
+			message: `{"jsonrpc":"2.0","method":"resources/list","id":1,"extra":true}`,
+			id:      NewIntRequestId(1),
+			data:    `member "extra" is not allowed by specification`,
+		},
+		{
+			name:    "response with result and error",
+			message: `{"jsonrpc":"2.0","result":{},"error":{"code":1,"message":"no"},"id":1}`,
+			id:      NewIntRequestId(1),
+			data:    "response must have either result or error, but has both",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			responses := r.Handle(testContext(), []byte(tc.message))
+			require.Len(t, responses, 1)
+			require.NotNil(t, responses[0])
+			assert.Equal(t, tc.id, responses[0].Id)
+			assert.Equal(t, InvalidRequest, responses[0].Error.Code)
+			assert.Equal(t, tc.data, responses[0].Error.Data)
+		})
+	}
+}
+
+func TestError(t *testing.T) {
+	rich := NewInvalidParamsError(map[string]any{"field": "uri"})
+	wrapped := fmt.Errorf("failed to read resource: %w", rich)
+
+	var rpcErr *Error
+	require.True(t, errors.As(wrapped, &rpcErr))
+	assert.Same(t, rich, rpcErr)
+	assert.Same(t, rich, AsError(wrapped))
+	assert.Equal(t, "jsonrpc2 error -32602: Invalid params: map[field:uri]", rich.Error())
+
+	internal := AsError(errors.New("boom"))
+	assert.Equal(t, InternalError, internal.Code)
+	assert.Equal(t, "boom", internal.Data)
+}
+
 func TestMarshal(t *testing.T) {
 	t.Run("Marshal list resources", func(t *testing.T) {
 		res := &mcp.ListResourcesResult{
@@ -154,3 +529,32 @@ func TestMarshal(t *testing.T) {
 		}
 	})
 }
+
+func TestIsResponse(t *testing.T) {
+	assert.True(t, IsResponse([]byte(`{"jsonrpc":"2.0","id":1,"result":{}}`)))
+	assert.True(t, IsResponse([]byte(` [{"jsonrpc":"2.0","id":1,"result":{}},{"jsonrpc":"2.0","id":2,"error":{"code":-32601,"message":"Method not found"}}]`)))
+	assert.False(t, IsResponse([]byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`)))
+	assert.False(t, IsResponse([]byte(`[{"jsonrpc":"2.0","id":1,"result":{}},{"jsonrpc":"2.0","id":2,"method":"ping"}]`)))
+	assert.False(t, IsResponse([]byte(`[]`)))
+	assert.False(t, IsResponse([]byte(`not json`)))
+}
+
+func TestErrorResponses(t *testing.T) {
+	busy := NewServerError(-32000, "busy")
+
+	responses := ErrorResponses([]byte(`{"jsonrpc":"2.0","id":"a","method":"ping"}`), busy)
+	require.Len(t, responses, 1)
+	assert.Equal(t, NewStringRequestId("a"), responses[0].Id)
+	assert.Equal(t, busy, responses[0].Error)
+
+	responses = ErrorResponses([]byte(`[{"jsonrpc":"2.0","id":1,"method":"ping"},{"jsonrpc":"2.0","method":"notifications/initialized"},{"jsonrpc":"2.0","id":7,"result":{}},{"jsonrpc":"2.0","id":2,"method":"ping"}]`), busy)
+	require.Len(t, responses, 2)
+	assert.Equal(t, NewIntRequestId(1), responses[0].Id)
+	assert.Equal(t, NewIntRequestId(2), responses[1].Id)
+
+	assert.Empty(t, ErrorResponses([]byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`), busy))
+
+	responses = ErrorResponses([]byte(`not json`), busy)
+	require.Len(t, responses, 1)
+	assert.True(t, responses[0].Id.IdIsNull)
+}
@@ -0,0 +1,94 @@
+package jsonrpc2
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// StrictOption makes router validate every message fully against
+// JSON-RPC 2.0 specification and answer with Invalid Request error
+// when message has:
+//   - member "jsonrpc" missing or not exactly "2.0"
+//   - id, which is not a string or an integer
+//   - params, which are neither object nor array
+//   - members not defined by specification
+//   - both result and error, when it is response
+//
+// By default router is lenient and only checks what it needs
+// to handle message, fractional ids are truncated then.
+type StrictOption struct{}
+
+func (StrictOption) apply(r *router) {
+	r.strict = true
+}
+
+var (
+	requestMembers  = []string{"jsonrpc", "method", "params", "id"}
+	responseMembers = []string{"jsonrpc", "result", "error", "id"}
+)
+
+// validateEnvelope checks members of request or response except id,
+// which is checked when it is read
+func validateEnvelope(rawMap map[string]any) error {
+	version, ok := rawMap["jsonrpc"]
+	if !ok {
+		return fmt.Errorf(`member jsonrpc is required and must be "2.0"`)
+	}
+	if version != "2.0" {
+		return fmt.Errorf(`member jsonrpc must be exactly "2.0", but got %s`, describe(version))
+	}
+
+	members := requestMembers
+	_, isRequest := rawMap["method"]
+	if !isRequest {
+		members = responseMembers
+	}
+	keys := make([]string, 0, len(rawMap))
+	for key := range rawMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !slices.Contains(members, key) {
+			return fmt.Errorf("member %q is not allowed by specification", key)
+		}
+	}
+
+	if !isRequest {
+		_, hasResult := rawMap["result"]
+		_, hasError := rawMap["error"]
+		if hasResult && hasError {
+			return fmt.Errorf("response must have either result or error, but has both")
+		}
+		return nil
+	}
+
+	if params, ok := rawMap["params"]; ok {
+		switch params.(type) {
+		case map[string]any, []any:
+		default:
+			return fmt.Errorf("member params must be object or array, but got %s", describe(params))
+		}
+	}
+	return nil
+}
+
+// describe returns JSON type of value decoded from JSON with its value,
+// such as `number 2`, for error messages
+func describe(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return fmt.Sprintf("string %q", v)
+	case bool:
+		return fmt.Sprintf("boolean %v", v)
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	default:
+		return fmt.Sprintf("number %v", v)
+	}
+}
@@ -0,0 +1,152 @@
+// Package listener opens listeners for HTTP transports on unix domain
+// sockets and takes over sockets passed by systemd socket activation.
+package listener
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrSocketInUse           = errors.New("unix socket is already in use")
+	ErrNoSystemdSockets      = errors.New("no sockets were passed by systemd")
+	ErrSystemdSocketNotFound = errors.New("socket with given name was not passed by systemd")
+	ErrSystemdSocketTaken    = errors.New("socket passed by systemd is already taken by another transport")
+)
+
+// Unix listens on unix domain socket at given path.
+//
+// Stale socket file left by previous process is removed, while socket
+// that still accepts connections results in ErrSocketInUse.
+// When mode is not zero, socket file permissions are set to it,
+// which allows to control which local users can connect.
+func Unix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		conn, err := net.DialTimeout("unix", path, time.Second)
+		if err == nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("%w: %s", ErrSocketInUse, path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			_ = l.Close()
+			return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+		}
+	}
+	return l, nil
+}
+
+const systemdFirstFd = 3
+
+var (
+	systemdOnce    sync.Once
+	systemdSockets *inherited
+	systemdErr     error
+)
+
+// Systemd returns listener passed by systemd socket activation.
+//
+// When name is empty, the first passed socket is returned, otherwise
+// the socket with matching FileDescriptorName= from the .socket unit.
+// Each socket is handed out only once, so that several transports
+// would not accept connections from the same one, instead the next
+// matching socket is returned or ErrSystemdSocketTaken when none is left.
+//
+// see https://www.freedesktop.org/software/systemd/man/latest/sd_listen_fds.html
+func Systemd(name string) (net.Listener, error) {
+	systemdOnce.Do(func() {
+		systemdSockets, systemdErr = inheritSystemdSockets()
+	})
+	if systemdErr != nil {
+		return nil, systemdErr
+	}
+	return systemdSockets.take(name)
+}
+
+// inherited holds sockets passed by systemd and which of them are taken
+type inherited struct {
+	mu      sync.Mutex
+	sockets []inheritedSocket
+}
+
+type inheritedSocket struct {
+	name     string
+	listener net.Listener
+	taken    bool
+}
+
+func (i *inherited) take(name string) (net.Listener, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if len(i.sockets) == 0 {
+		return nil, ErrNoSystemdSockets
+	}
+	found := false
+	for n := range i.sockets {
+		socket := &i.sockets[n]
+		if name != "" && socket.name != name {
+			continue
+		}
+		found = true
+		if !socket.taken {
+			socket.taken = true
+			return socket.listener, nil
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("%w: %s", ErrSystemdSocketNotFound, name)
+	}
+	if name == "" {
+		return nil, ErrSystemdSocketTaken
+	}
+	return nil, fmt.Errorf("%w: %s", ErrSystemdSocketTaken, name)
+}
+
+func inheritSystemdSockets() (*inherited, error) {
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, ErrNoSystemdSockets
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, ErrNoSystemdSockets
+	}
+	var names []string
+	if fdNames := os.Getenv("LISTEN_FDNAMES"); fdNames != "" {
+		names = strings.Split(fdNames, ":")
+	}
+
+	sockets := &inherited{sockets: make([]inheritedSocket, 0, count)}
+	for i := 0; i < count; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(systemdFirstFd+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		file := os.NewFile(uintptr(systemdFirstFd+i), name)
+		l, err := net.FileListener(file)
+		_ = file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("systemd socket %s is not a listening socket: %w", name, err)
+		}
+		sockets.sockets = append(sockets.sockets, inheritedSocket{name: name, listener: l})
+	}
+	return sockets, nil
+}
@@ -0,0 +1,90 @@
+package listener
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mcp.sock")
+
+	l, err := Unix(path, 0o660)
+	require.NoError(t, err)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o660), info.Mode().Perm())
+
+	t.Run("socket in use", func(t *testing.T) {
+		go func() {
+			if conn, err := l.Accept(); err == nil {
+				_ = conn.Close()
+			}
+		}()
+		_, err := Unix(path, 0)
+		assert.ErrorIs(t, err, ErrSocketInUse)
+	})
+
+	t.Run("stale socket is replaced", func(t *testing.T) {
+		// leave socket file behind, as if process was killed
+		l.(*net.UnixListener).SetUnlinkOnClose(false)
+		require.NoError(t, l.Close())
+		_, err := os.Stat(path)
+		require.NoError(t, err)
+
+		l, err := Unix(path, 0)
+		require.NoError(t, err)
+		assert.NoError(t, l.Close())
+	})
+
+	t.Run("not a socket", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "file")
+		require.NoError(t, os.WriteFile(file, nil, 0o600))
+		_, err := Unix(file, 0)
+		assert.Error(t, err)
+	})
+}
+
+func TestSystemdWithoutActivation(t *testing.T) {
+	t.Setenv("LISTEN_PID", "")
+	t.Setenv("LISTEN_FDS", "")
+	_, err := Systemd("")
+	assert.ErrorIs(t, err, ErrNoSystemdSockets)
+}
+
+func TestSystemdSocketsAreTakenOnce(t *testing.T) {
+	listen := func() net.Listener {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = l.Close() })
+		return l
+	}
+	first, second, named := listen(), listen(), listen()
+	sockets := &inherited{sockets: []inheritedSocket{
+		{name: "LISTEN_FD_3", listener: first},
+		{name: "LISTEN_FD_4", listener: second},
+		{name: "mcp", listener: named},
+	}}
+
+	l, err := sockets.take("mcp")
+	require.NoError(t, err)
+	assert.Same(t, named, l)
+	_, err = sockets.take("mcp")
+	assert.ErrorIs(t, err, ErrSystemdSocketTaken)
+
+	l, err = sockets.take("")
+	require.NoError(t, err)
+	assert.Same(t, first, l)
+	l, err = sockets.take("")
+	require.NoError(t, err)
+	assert.Same(t, second, l)
+	_, err = sockets.take("")
+	assert.ErrorIs(t, err, ErrSystemdSocketTaken)
+
+	_, err = sockets.take("other")
+	assert.ErrorIs(t, err, ErrSystemdSocketNotFound)
+}
@@ -89,6 +89,10 @@ func (r ListRootsRequest) GetMethod() string {
 	return "roots/list"
 }
 
+func (r ResourceListChangedNotification) GetMethod() string {
+	return "notifications/resources/list_changed"
+}
+
 func (r RootsListChangedNotification) GetMethod() string {
 	return "notifications/roots/list_changed"
 }
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// CONTENT_TYPE is content type of Prometheus text format
+const CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+
+// ServeHTTP serves metrics in Prometheus text format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", CONTENT_TYPE)
+	_ = m.Write(w)
+}
+
+// Write writes metrics in Prometheus text format to writer
+func (m *Metrics) Write(writer io.Writer) error {
+	w := bufio.NewWriter(writer)
+	if m != nil {
+		m.writeCalls(w)
+		writeFamily(w, "mcp_active_sessions", "gauge", "Number of initialized sessions, which are not shut down yet.")
+		writeSample(w, "mcp_active_sessions", nil, strconv.FormatInt(m.activeSessions.Load(), 10))
+		writeFamily(w, "mcp_open_streams", "gauge", "Number of open SSE streams.")
+		writeSample(w, "mcp_open_streams", nil, strconv.FormatInt(m.openStreams.Load(), 10))
+		writeFamily(w, "mcp_received_bytes_total", "counter", "Bytes of HTTP request bodies received by transport.")
+		writeSample(w, "mcp_received_bytes_total", nil, strconv.FormatInt(m.receivedBytes.Load(), 10))
+		writeFamily(w, "mcp_sent_bytes_total", "counter", "Bytes of HTTP response bodies sent by transport.")
+		writeSample(w, "mcp_sent_bytes_total", nil, strconv.FormatInt(m.sentBytes.Load(), 10))
+	}
+	return w.Flush()
+}
+
+type label struct {
+	name  string
+	value string
+}
+
+func (l callLabels) labels() []label {
+	labels := []label{{name: "method", value: l.method}}
+	if l.tool != "" {
+		labels = append(labels, label{name: "tool", value: l.tool})
+	}
+	return labels
+}
+
+func (m *Metrics) writeCalls(w *bufio.Writer) {
+	m.callsMu.Lock()
+	defer m.callsMu.Unlock()
+
+	// output is sorted to be stable between scrapes
+	calls := slices.SortedFunc(maps.Keys(m.calls), func(a, b callLabels) int {
+		return cmp.Or(cmp.Compare(a.method, b.method), cmp.Compare(a.tool, b.tool))
+	})
+
+	writeFamily(w, "mcp_requests_total", "counter", "Number of requests handled by server.")
+	for _, call := range calls {
+		writeSample(w, "mcp_requests_total", call.labels(), strconv.FormatUint(m.calls[call].count, 10))
+	}
+
+	writeFamily(w, "mcp_request_errors_total", "counter", "Number of requests answered with error by JSON-RPC error code.")
+	for _, call := range calls {
+		stats := m.calls[call]
+		for _, code := range slices.Sorted(maps.Keys(stats.errors)) {
+			labels := append(call.labels(), label{name: "code", value: strconv.Itoa(code)})
+			writeSample(w, "mcp_request_errors_total", labels, strconv.FormatUint(stats.errors[code], 10))
+		}
+	}
+
+	writeFamily(w, "mcp_request_duration_seconds", "histogram", "Duration of requests handled by server.")
+	for _, call := range calls {
+		stats := m.calls[call]
+		for i, bound := range m.buckets {
+			labels := append(call.labels(), label{name: "le", value: formatFloat(bound)})
+			writeSample(w, "mcp_request_duration_seconds_bucket", labels, strconv.FormatUint(stats.buckets[i], 10))
+		}
+		labels := append(call.labels(), label{name: "le", value: "+Inf"})
+		writeSample(w, "mcp_request_duration_seconds_bucket", labels, strconv.FormatUint(stats.count, 10))
+		writeSample(w, "mcp_request_duration_seconds_sum", call.labels(), formatFloat(stats.sum))
+		writeSample(w, "mcp_request_duration_seconds_count", call.labels(), strconv.FormatUint(stats.count, 10))
+	}
+}
+
+func writeFamily(w *bufio.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeSample(w *bufio.Writer, name string, labels []label, value string) {
+	w.WriteString(name)
+	if len(labels) > 0 {
+		w.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", l.name, labelValueEscaper.Replace(l.value))
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(value)
+	w.WriteByte('\n')
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+)
+
+// HTTPMiddleware counts bytes of bodies of HTTP requests and responses
+// passing through it, which are reported as received and sent bytes.
+func (m *Metrics) HTTPMiddleware(next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			r.Body = &countingBody{ReadCloser: r.Body, metrics: m}
+		}
+		next.ServeHTTP(&countingWriter{ResponseWriter: w, metrics: m}, r)
+	})
+}
+
+type countingBody struct {
+	io.ReadCloser
+	metrics *Metrics
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.metrics.receivedBytes.Add(int64(n))
+	return n, err
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	metrics *Metrics
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.metrics.sentBytes.Add(int64(n))
+	return n, err
+}
+
+// Flush keeps SSE streams working through the writer
+func (w *countingWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the original writer
+func (w *countingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
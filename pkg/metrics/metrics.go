@@ -0,0 +1,211 @@
+// Package metrics collects metrics of MCP server and serves them
+// in Prometheus text format, so that servers could be monitored
+// without adding dependencies on metrics libraries.
+//
+// Metrics are collected by HTTP transports given streamable_http.Metrics
+// or sse.WithMetrics option, which also serve them at /metrics:
+//
+//   - mcp_requests_total counts requests by method and tool, methods not
+//     registered in server and tools of failed calls are counted as "unknown"
+//   - mcp_request_errors_total counts errors by method, tool and JSON-RPC code
+//   - mcp_request_duration_seconds is histogram of durations of requests
+//   - mcp_active_sessions is number of initialized sessions
+//   - mcp_open_streams is number of open SSE streams
+//   - mcp_received_bytes_total and mcp_sent_bytes_total count HTTP traffic
+//
+// Metrics is fed by the same server hooks as other integrations, that is
+// server.MiddlewareOption and session lifecycle callbacks, which are
+// returned by ServerOptions for use with other transports.
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
+	"github.com/strowk/foxy-contexts/pkg/server"
+	"github.com/strowk/foxy-contexts/pkg/session"
+)
+
+// DEFAULT_PATH is where HTTP transports serve metrics by default
+const DEFAULT_PATH = "/metrics"
+
+// UNKNOWN is label of methods not registered in server and of tools
+// of failed calls, names of which come from clients and so could have
+// any number of values, if they were used as labels as is
+const UNKNOWN = "unknown"
+
+// DEFAULT_BUCKETS are upper bounds of buckets of request duration histogram
+// in seconds, same as default buckets of Prometheus client libraries
+var DEFAULT_BUCKETS = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics collects metrics of requests, sessions and traffic of MCP server.
+//
+// Metrics is safe for concurrent use and its methods can be called on nil
+// Metrics, which collects nothing, so that transports do not need to check
+// whether metrics are enabled.
+type Metrics struct {
+	buckets []float64
+
+	calls   map[callLabels]*callStats
+	callsMu sync.Mutex
+
+	activeSessions atomic.Int64
+	openStreams    atomic.Int64
+	receivedBytes  atomic.Int64
+	sentBytes      atomic.Int64
+
+	// sessions holds ids of initialized sessions, so that
+	// sessions shut down before initialization are not counted
+	sessions sync.Map
+}
+
+type callLabels struct {
+	method string
+	tool   string
+}
+
+type callStats struct {
+	count uint64
+	// errors counts errors by their JSON-RPC codes
+	errors map[int]uint64
+	// buckets counts durations not greater than upper bound of each bucket
+	buckets []uint64
+	sum     float64
+}
+
+type Option interface {
+	apply(*Metrics)
+}
+
+// Buckets sets upper bounds of buckets of request duration histogram in seconds,
+// by default DEFAULT_BUCKETS are used.
+type Buckets struct {
+	Buckets []float64
+}
+
+func (o Buckets) apply(m *Metrics) {
+	m.buckets = slices.Sorted(slices.Values(o.Buckets))
+}
+
+// New creates metrics with nothing collected yet
+func New(options ...Option) *Metrics {
+	m := &Metrics{
+		buckets: DEFAULT_BUCKETS,
+		calls:   map[callLabels]*callStats{},
+	}
+	for _, o := range options {
+		o.apply(m)
+	}
+	return m
+}
+
+// ServerOptions returns options making server report its requests and sessions
+// to metrics, HTTP transports given metrics option add them on their own.
+func (m *Metrics) ServerOptions() []server.ServerOption {
+	if m == nil {
+		return nil
+	}
+	return []server.ServerOption{
+		server.MiddlewareOption{Middleware: m.middleware},
+		server.OnInitializedOption{Callback: m.sessionInitialized},
+		server.OnShutdownOption{Callback: m.sessionShutdown},
+	}
+}
+
+// toolCall holds name of tool being called
+type toolCall struct {
+	Name string `json:"name"`
+}
+
+func (m *Metrics) middleware(next jsonrpc2.CallHandler) jsonrpc2.CallHandler {
+	return func(ctx context.Context, call *jsonrpc2.Call) (jsonrpc2.Result, *jsonrpc2.Error) {
+		if call.Id.IdIsMissing {
+			// notifications are not requests
+			return next(ctx, call)
+		}
+
+		labels := callLabels{method: call.Method}
+		if !call.Registered {
+			labels.method = UNKNOWN
+		}
+		if call.Method == "tools/call" && len(call.Params) > 0 {
+			var params toolCall
+			// params are validated by handler, here only name is needed
+			_ = json.Unmarshal(call.Params, &params)
+			labels.tool = params.Name
+		}
+
+		started := time.Now()
+		result, err := next(ctx, call)
+		if err != nil && labels.tool != "" {
+			// tool is only known to exist, when it was called successfully
+			labels.tool = UNKNOWN
+		}
+		m.observeCall(labels, time.Since(started), err)
+		return result, err
+	}
+}
+
+func (m *Metrics) observeCall(labels callLabels, elapsed time.Duration, err *jsonrpc2.Error) {
+	m.callsMu.Lock()
+	defer m.callsMu.Unlock()
+
+	stats, ok := m.calls[labels]
+	if !ok {
+		stats = &callStats{
+			errors:  map[int]uint64{},
+			buckets: make([]uint64, len(m.buckets)),
+		}
+		m.calls[labels] = stats
+	}
+	stats.count++
+	if err != nil {
+		stats.errors[err.Code]++
+	}
+	seconds := elapsed.Seconds()
+	stats.sum += seconds
+	for i, bound := range m.buckets {
+		if seconds <= bound {
+			stats.buckets[i]++
+		}
+	}
+}
+
+func (m *Metrics) sessionInitialized(ctx context.Context) {
+	sess, ok := session.FromContext(ctx)
+	if !ok {
+		return
+	}
+	if _, loaded := m.sessions.LoadOrStore(sess.SessionID, struct{}{}); !loaded {
+		m.activeSessions.Add(1)
+	}
+}
+
+func (m *Metrics) sessionShutdown(ctx context.Context) {
+	sess, ok := session.FromContext(ctx)
+	if !ok {
+		return
+	}
+	if _, loaded := m.sessions.LoadAndDelete(sess.SessionID); loaded {
+		m.activeSessions.Add(-1)
+	}
+}
+
+// StreamOpened is called by transports when SSE stream is opened
+func (m *Metrics) StreamOpened() {
+	if m != nil {
+		m.openStreams.Add(1)
+	}
+}
+
+// StreamClosed is called by transports when SSE stream is closed
+func (m *Metrics) StreamClosed() {
+	if m != nil {
+		m.openStreams.Add(-1)
+	}
+}
@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/strowk/foxy-contexts/pkg/fxctx"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/server"
+	"github.com/strowk/foxy-contexts/pkg/session"
+)
+
+func newTestServer(m *Metrics) server.Server {
+	s := server.NewServer(
+		&mcp.ServerCapabilities{Tools: &mcp.ServerCapabilitiesTools{}},
+		&mcp.Implementation{Name: "TestServer", Version: "0.0.0"},
+		m.ServerOptions()...,
+	)
+	fxctx.NewToolMux([]fxctx.Tool{
+		fxctx.NewTool(
+			&mcp.Tool{Name: "greet", InputSchema: mcp.ToolInputSchema{Type: "object"}},
+			func(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
+				return &mcp.CallToolResult{Content: []interface{}{mcp.TextContent{Type: "text", Text: "hello"}}}
+			},
+		),
+	}).RegisterHandlers(s)
+	return s
+}
+
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	m.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, DEFAULT_PATH, nil))
+	assert.Equal(t, CONTENT_TYPE, recorder.Header().Get("Content-Type"))
+	return recorder.Body.String()
+}
+
+func TestMetrics(t *testing.T) {
+	m := New(Buckets{Buckets: []float64{60, 0}})
+	s := newTestServer(m)
+	ctx := session.WithNewSession(context.Background())
+
+	s.HandleAndGetResponses(ctx, []byte(`{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"TestClient","version":"1.2.3"}}}`))
+	s.HandleAndGetResponses(ctx, []byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`))
+	s.HandleAndGetResponses(ctx, []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"greet"}}`))
+	s.HandleAndGetResponses(ctx, []byte(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"greet"}}`))
+	s.HandleAndGetResponses(ctx, []byte(`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"say \"hi\""}}`))
+	s.HandleAndGetResponses(ctx, []byte(`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"missing"}}`))
+	s.HandleAndGetResponses(ctx, []byte(`{"jsonrpc":"2.0","id":5,"method":"unknown"}`))
+	s.HandleAndGetResponses(ctx, []byte(`{"jsonrpc":"2.0","id":6,"method":"vendor/anything"}`))
+
+	require.Eventually(t, func() bool {
+		return strings.Contains(scrape(t, m), "mcp_active_sessions 1\n")
+	}, time.Second, 10*time.Millisecond)
+
+	scraped := scrape(t, m)
+	for _, line := range []string{
+		"# TYPE mcp_requests_total counter",
+		`mcp_requests_total{method="initialize"} 1`,
+		`mcp_requests_total{method="tools/call",tool="greet"} 2`,
+		`mcp_requests_total{method="tools/call",tool="unknown"} 2`,
+		`mcp_requests_total{method="unknown"} 2`,
+		`mcp_request_errors_total{method="tools/call",tool="unknown",code="-32602"} 2`,
+		`mcp_request_errors_total{method="unknown",code="-32601"} 2`,
+		"# TYPE mcp_request_duration_seconds histogram",
+		`mcp_request_duration_seconds_bucket{method="tools/call",tool="greet",le="60"} 2`,
+		`mcp_request_duration_seconds_bucket{method="tools/call",tool="greet",le="+Inf"} 2`,
+		`mcp_request_duration_seconds_count{method="tools/call",tool="greet"} 2`,
+		"mcp_open_streams 0",
+	} {
+		assert.Contains(t, scraped, line+"\n")
+	}
+	assert.NotContains(t, scraped, "notifications/initialized")
+	// names given by client are not used as labels, unless they are registered
+	assert.NotContains(t, scraped, "say")
+	assert.NotContains(t, scraped, "missing")
+	assert.NotContains(t, scraped, "vendor/anything")
+	assert.Contains(t, scraped, `mcp_request_duration_seconds_bucket{method="initialize",le="0"} `)
+	assert.Contains(t, scraped, `mcp_request_duration_seconds_sum{method="initialize"} `)
+
+	s.Shutdown(ctx)
+	s.Shutdown(ctx)
+	assert.Contains(t, scrape(t, m), "mcp_active_sessions 0\n")
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	m := New()
+	handler := m.HTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.ReadAll(r.Body)
+		m.StreamOpened()
+		defer m.StreamClosed()
+		_, _ = w.Write([]byte("hello"))
+		// streams must still be flushed through middleware
+		_, flushable := w.(http.Flusher)
+		assert.True(t, flushable)
+		assert.Contains(t, scrape(t, m), "mcp_open_streams 1\n")
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/mcp", bytes.NewReader([]byte("1234567"))))
+
+	scraped := scrape(t, m)
+	assert.Contains(t, scraped, "mcp_received_bytes_total 7\n")
+	assert.Contains(t, scraped, "mcp_sent_bytes_total 5\n")
+	assert.Contains(t, scraped, "mcp_open_streams 0\n")
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+	assert.Empty(t, m.ServerOptions())
+	m.StreamOpened()
+	m.StreamClosed()
+	var out bytes.Buffer
+	require.NoError(t, m.Write(&out))
+	assert.Empty(t, out.String())
+}
@@ -0,0 +1,193 @@
+// Package origin protects HTTP transports from DNS rebinding
+// and cross-origin requests and handles CORS for allowed origins.
+//
+// see https://modelcontextprotocol.io/specification/2025-03-26/basic/transports#security-warning
+package origin
+
+import (
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Config configures which origins and hosts are allowed to reach the server.
+type Config struct {
+	// AllowedOrigins lists origins, such as "https://app.example.com", that are allowed
+	// to make requests from browser. Port can be given as "*" to allow any port,
+	// e.g "http://localhost:*", while "*" alone allows any origin.
+	//
+	// Requests without Origin header are not made by browsers and are always allowed.
+	AllowedOrigins []string
+
+	// AllowedHosts lists values allowed in Host header, with or without port.
+	// Checking Host header prevents DNS rebinding attacks against servers
+	// listening on local interfaces. When empty, any host is allowed.
+	AllowedHosts []string
+
+	// AllowCredentials sets Access-Control-Allow-Credentials for allowed origins
+	AllowCredentials bool
+
+	// MaxAge tells browsers how long they can cache preflight response
+	MaxAge time.Duration
+}
+
+// LocalhostDefaults is the configuration used by HTTP transports for requests
+// arriving on loopback interface when no other configuration is given.
+//
+// It only allows requests addressed to localhost and only from pages
+// served from localhost, which stops malicious websites from reaching
+// local server via DNS rebinding.
+func LocalhostDefaults() Config {
+	return Config{
+		AllowedOrigins: []string{
+			"http://localhost:*",
+			"https://localhost:*",
+			"http://127.0.0.1:*",
+			"https://127.0.0.1:*",
+			"http://[::1]:*",
+			"https://[::1]:*",
+		},
+		AllowedHosts: []string{
+			"localhost",
+			"127.0.0.1",
+			"::1",
+		},
+	}
+}
+
+// LocalhostMiddleware applies LocalhostDefaults to requests that have arrived
+// on loopback interface and lets other requests through.
+//
+// This is how HTTP transports protect themselves by default, regardless
+// whether they listen on localhost, on all interfaces or on passed listener.
+func LocalhostMiddleware() echo.MiddlewareFunc {
+	protect := Middleware(LocalhostDefaults())
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		protected := protect(next)
+		return func(c echo.Context) error {
+			addr, ok := c.Request().Context().Value(http.LocalAddrContextKey).(net.Addr)
+			if ok && isLoopbackAddr(addr) {
+				return protected(c)
+			}
+			return next(c)
+		}
+	}
+}
+
+func isLoopbackAddr(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	return ok && tcp.IP.IsLoopback()
+}
+
+var (
+	allowedMethods = strings.Join([]string{
+		http.MethodGet,
+		http.MethodPost,
+		http.MethodDelete,
+		http.MethodOptions,
+	}, ", ")
+
+	allowedHeaders = strings.Join([]string{
+		"Accept",
+		"Authorization",
+		"Content-Type",
+		"Last-Event-ID",
+		"Mcp-Protocol-Version",
+		"Mcp-Session-Id",
+	}, ", ")
+
+	exposedHeaders = strings.Join([]string{
+		"Mcp-Session-Id",
+		"WWW-Authenticate",
+	}, ", ")
+)
+
+// Middleware rejects requests with disallowed Host or Origin header
+// with 403 Forbidden, answers CORS preflight requests and adds CORS headers
+// to responses for allowed origins.
+func Middleware(config Config) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if !config.hostAllowed(req.Host) {
+				return echo.NewHTTPError(http.StatusForbidden, "Host header is not allowed")
+			}
+
+			origin := req.Header.Get(echo.HeaderOrigin)
+			if origin == "" {
+				return next(c)
+			}
+			if !config.originAllowed(origin) {
+				return echo.NewHTTPError(http.StatusForbidden, "Origin is not allowed")
+			}
+
+			header := c.Response().Header()
+			header.Add(echo.HeaderVary, echo.HeaderOrigin)
+			header.Set(echo.HeaderAccessControlAllowOrigin, origin)
+			if config.AllowCredentials {
+				header.Set(echo.HeaderAccessControlAllowCredentials, "true")
+			}
+
+			if req.Method == http.MethodOptions && req.Header.Get(echo.HeaderAccessControlRequestMethod) != "" {
+				header.Add(echo.HeaderVary, echo.HeaderAccessControlRequestMethod)
+				header.Add(echo.HeaderVary, echo.HeaderAccessControlRequestHeaders)
+				header.Set(echo.HeaderAccessControlAllowMethods, allowedMethods)
+				header.Set(echo.HeaderAccessControlAllowHeaders, allowedHeaders)
+				if config.MaxAge > 0 {
+					header.Set(echo.HeaderAccessControlMaxAge, strconv.Itoa(int(config.MaxAge.Seconds())))
+				}
+				return c.NoContent(http.StatusNoContent)
+			}
+
+			header.Set(echo.HeaderAccessControlExposeHeaders, exposedHeaders)
+			return next(c)
+		}
+	}
+}
+
+func (config Config) hostAllowed(host string) bool {
+	if len(config.AllowedHosts) == 0 {
+		return true
+	}
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	hostname = strings.Trim(hostname, "[]")
+	return slices.ContainsFunc(config.AllowedHosts, func(allowed string) bool {
+		return allowed == "*" ||
+			strings.EqualFold(allowed, host) ||
+			strings.EqualFold(strings.Trim(allowed, "[]"), hostname)
+	})
+}
+
+func (config Config) originAllowed(origin string) bool {
+	return slices.ContainsFunc(config.AllowedOrigins, func(allowed string) bool {
+		return matchOrigin(allowed, origin)
+	})
+}
+
+func matchOrigin(pattern string, origin string) bool {
+	if pattern == "*" || strings.EqualFold(pattern, origin) {
+		return true
+	}
+	prefix, anyPort := strings.CutSuffix(pattern, ":*")
+	if !anyPort || len(origin) < len(prefix) || !strings.EqualFold(origin[:len(prefix)], prefix) {
+		return false
+	}
+	rest := origin[len(prefix):]
+	if rest == "" {
+		return true
+	}
+	port, ok := strings.CutPrefix(rest, ":")
+	if !ok || port == "" {
+		return false
+	}
+	_, err := strconv.ParseUint(port, 10, 16)
+	return err == nil
+}
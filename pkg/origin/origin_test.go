@@ -0,0 +1,115 @@
+package origin
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchOrigin(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		origin  string
+		matches bool
+	}{
+		{"*", "https://evil.example.com", true},
+		{"https://app.example.com", "https://app.example.com", true},
+		{"https://app.example.com", "https://app.example.com:8443", false},
+		{"http://localhost:*", "http://localhost", true},
+		{"http://localhost:*", "http://localhost:6274", true},
+		{"http://localhost:*", "http://localhost.evil.com", false},
+		{"http://localhost:*", "http://localhost:80.evil.com", false},
+		{"http://localhost:*", "https://localhost:6274", false},
+		{"http://[::1]:*", "http://[::1]:3000", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.pattern+" "+tc.origin, func(t *testing.T) {
+			assert.Equal(t, tc.matches, matchOrigin(tc.pattern, tc.origin))
+		})
+	}
+}
+
+func TestLocalhostMiddleware(t *testing.T) {
+	e := echo.New()
+	e.Use(LocalhostMiddleware())
+	e.POST("/mcp", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	do := func(localAddr net.Addr) int {
+		req := httptest.NewRequest("POST", "/mcp", nil)
+		req.Host = "attacker.example.com"
+		req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, localAddr))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusForbidden, do(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 8080}))
+	assert.Equal(t, http.StatusForbidden, do(&net.TCPAddr{IP: net.IPv6loopback, Port: 8080}))
+	assert.Equal(t, http.StatusOK, do(&net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 8080}))
+	assert.Equal(t, http.StatusOK, do(&net.UnixAddr{Name: "/run/mcp.sock", Net: "unix"}))
+}
+
+func TestMiddleware(t *testing.T) {
+	e := echo.New()
+	e.Use(Middleware(LocalhostDefaults()))
+	e.POST("/mcp", func(c echo.Context) error {
+		c.Response().Header().Set("Mcp-Session-Id", "123")
+		return c.NoContent(http.StatusOK)
+	})
+
+	do := func(method, host, origin string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/mcp", nil)
+		req.Host = host
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("non-browser client", func(t *testing.T) {
+		rec := do("POST", "localhost:8080", "", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("DNS rebinding", func(t *testing.T) {
+		rec := do("POST", "attacker.example.com:8080", "", nil)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("foreign origin", func(t *testing.T) {
+		rec := do("POST", "127.0.0.1:8080", "https://evil.example.com", nil)
+		assert.Equal(t, http.StatusForbidden, rec.Code)
+	})
+
+	t.Run("local origin", func(t *testing.T) {
+		rec := do("POST", "[::1]:8080", "http://localhost:6274", nil)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "http://localhost:6274", rec.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "Mcp-Session-Id, WWW-Authenticate", rec.Header().Get("Access-Control-Expose-Headers"))
+	})
+
+	t.Run("preflight", func(t *testing.T) {
+		rec := do("OPTIONS", "localhost:8080", "http://localhost:6274", map[string]string{
+			"Access-Control-Request-Method":  "POST",
+			"Access-Control-Request-Headers": "content-type, mcp-session-id",
+		})
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, "http://localhost:6274", rec.Header().Get("Access-Control-Allow-Origin"))
+		assert.Contains(t, rec.Header().Get("Access-Control-Allow-Methods"), "POST")
+		assert.Contains(t, rec.Header().Get("Access-Control-Allow-Headers"), "Mcp-Session-Id")
+	})
+}
@@ -0,0 +1,19 @@
+package foxyotel
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// HTTPMiddleware reads trace context from headers of HTTP requests,
+// so that spans of calls sent in them continue trace of the client.
+//
+// It is installed with streamable_http.HTTPMiddleware or sse.WithHTTPMiddleware
+// options, or can wrap transport mounted into existing router.
+func (i *Instrumentation) HTTPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := i.propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,151 @@
+package foxyotel
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
+	"github.com/strowk/foxy-contexts/pkg/session"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attributes set on spans and metrics
+const (
+	// MethodKey is name of JSON-RPC method being called
+	MethodKey = attribute.Key("mcp.method.name")
+	// ToolKey is name of tool called by tools/call
+	ToolKey = attribute.Key("mcp.tool.name")
+	// PromptKey is name of prompt got by prompts/get
+	PromptKey = attribute.Key("mcp.prompt.name")
+	// ResourceKey is URI of resource read by resources/read
+	ResourceKey = attribute.Key("mcp.resource.uri")
+	// SessionKey is id of session call belongs to, it is only set on spans
+	SessionKey = attribute.Key("mcp.session.id")
+	// RequestIdKey is id of JSON-RPC request, it is only set on spans
+	RequestIdKey = attribute.Key("jsonrpc.request.id")
+	// ErrorCodeKey is code of JSON-RPC error returned for request
+	ErrorCodeKey = attribute.Key("rpc.jsonrpc.error_code")
+)
+
+// UNKNOWN is recorded in metrics instead of names of methods not registered
+// in server and of tools and prompts of failed calls, as such names come
+// from clients and would make number of metric streams unbounded
+const UNKNOWN = "unknown"
+
+// callParams holds members of params, which are used to describe the call
+type callParams struct {
+	Name string         `json:"name"`
+	Uri  string         `json:"uri"`
+	Meta map[string]any `json:"_meta"`
+}
+
+// Middleware creates span for every call and records its metrics,
+// it is installed to server by ServerOptions.
+func (i *Instrumentation) Middleware(next jsonrpc2.CallHandler) jsonrpc2.CallHandler {
+	return func(ctx context.Context, call *jsonrpc2.Call) (jsonrpc2.Result, *jsonrpc2.Error) {
+		var params callParams
+		if len(call.Params) > 0 {
+			// params are validated by handler, here they are only described
+			_ = json.Unmarshal(call.Params, &params)
+		}
+
+		// trace context in _meta is more specific than one in HTTP headers,
+		// since it is set by client for this call, so it takes precedence
+		ctx = i.propagator.Extract(ctx, metaCarrier(params.Meta))
+
+		spanAttributes := []attribute.KeyValue{MethodKey.String(call.Method)}
+		switch call.Method {
+		case "tools/call":
+			spanAttributes = append(spanAttributes, ToolKey.String(params.Name))
+		case "prompts/get":
+			spanAttributes = append(spanAttributes, PromptKey.String(params.Name))
+		}
+		if call.Method == "resources/read" {
+			// URIs are not added to metrics to keep their cardinality low
+			spanAttributes = append(spanAttributes, ResourceKey.String(params.Uri))
+		}
+		if sess, ok := session.FromContext(ctx); ok {
+			spanAttributes = append(spanAttributes, SessionKey.String(sess.SessionID.String()))
+		}
+		if !call.Id.IdIsMissing {
+			spanAttributes = append(spanAttributes, RequestIdKey.String(call.Id.String()))
+		}
+
+		ctx, span := i.tracer.Start(ctx, spanName(call.Method, params),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(spanAttributes...),
+		)
+		defer span.End()
+
+		if call.Id.IdIsMissing {
+			// notifications are traced, but not counted as requests
+			return next(ctx, call)
+		}
+
+		method := call.Method
+		if !call.Registered {
+			method = UNKNOWN
+		}
+		inFlightAttributes := metric.WithAttributes(MethodKey.String(method))
+		i.inFlight.Add(ctx, 1, inFlightAttributes)
+		started := time.Now()
+		result, err := next(ctx, call)
+		elapsed := time.Since(started)
+		i.inFlight.Add(ctx, -1, inFlightAttributes)
+
+		name := params.Name
+		if err != nil {
+			span.SetAttributes(ErrorCodeKey.Int(err.Code))
+			span.SetStatus(codes.Error, err.Message)
+			// tool or prompt is only known to exist, when call has succeeded
+			name = UNKNOWN
+		}
+		metricAttributes := []attribute.KeyValue{MethodKey.String(method)}
+		switch call.Method {
+		case "tools/call":
+			metricAttributes = append(metricAttributes, ToolKey.String(name))
+		case "prompts/get":
+			metricAttributes = append(metricAttributes, PromptKey.String(name))
+		}
+		if err != nil {
+			metricAttributes = append(metricAttributes, ErrorCodeKey.Int(err.Code))
+		}
+		i.requests.Add(ctx, 1, metric.WithAttributes(metricAttributes...))
+		i.duration.Record(ctx, elapsed.Seconds(), metric.WithAttributes(metricAttributes...))
+		return result, err
+	}
+}
+
+// spanName returns method followed by name of tool or prompt, if call has one
+func spanName(method string, params callParams) string {
+	if (method == "tools/call" || method == "prompts/get") && params.Name != "" {
+		return method + " " + params.Name
+	}
+	return method
+}
+
+// metaCarrier reads trace context from string members of _meta
+type metaCarrier map[string]any
+
+var _ propagation.TextMapCarrier = metaCarrier{}
+
+func (c metaCarrier) Get(key string) string {
+	value, _ := c[key].(string)
+	return value
+}
+
+// Set is not used, since trace context is only read from _meta
+func (c metaCarrier) Set(string, string) {}
+
+func (c metaCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,170 @@
+// Package foxyotel instruments MCP servers built with foxy-contexts
+// with OpenTelemetry traces and metrics.
+//
+// Instrumentation creates span for every JSON-RPC call handled by server,
+// continuing trace started by client, which is passed either in W3C
+// traceparent and tracestate HTTP headers or in the same members of
+// params._meta of the call. It also records metrics of calls and sessions:
+//
+//   - mcp.server.requests counts handled requests
+//   - mcp.server.request.duration is histogram of durations of requests
+//   - mcp.server.requests.in_flight is number of requests being handled
+//   - mcp.server.sessions.active is number of initialized sessions
+//
+// Instrumentation is installed to server with ServerOptions and to HTTP
+// transports with HTTPMiddleware:
+//
+//	instrumentation, err := foxyotel.New()
+//	...
+//	app.NewBuilder().
+//		WithExtraServerOptions(instrumentation.ServerOptions()...).
+//		WithTransport(streamable_http.NewTransport(
+//			streamable_http.HTTPMiddleware{Middleware: instrumentation.HTTPMiddleware},
+//		))
+//
+// This package is a separate module, so that applications not using
+// OpenTelemetry do not depend on it.
+package foxyotel
+
+import (
+	"context"
+	"sync"
+
+	"github.com/strowk/foxy-contexts/pkg/server"
+	"github.com/strowk/foxy-contexts/pkg/session"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is name of tracer and meter used by instrumentation
+const instrumentationName = "github.com/strowk/foxy-contexts/pkg/otel"
+
+// Instrumentation creates spans and records metrics of MCP server.
+type Instrumentation struct {
+	tracerProvider trace.TracerProvider
+	meterProvider  metric.MeterProvider
+	propagator     propagation.TextMapPropagator
+
+	tracer trace.Tracer
+
+	requests       metric.Int64Counter
+	duration       metric.Float64Histogram
+	inFlight       metric.Int64UpDownCounter
+	activeSessions metric.Int64UpDownCounter
+
+	// sessions holds ids of initialized sessions, so that
+	// sessions shut down before initialization are not counted
+	sessions sync.Map
+}
+
+type Option interface {
+	apply(*Instrumentation)
+}
+
+// TracerProvider sets provider of tracer creating spans,
+// by default global provider is used.
+type TracerProvider struct {
+	Provider trace.TracerProvider
+}
+
+func (o TracerProvider) apply(i *Instrumentation) {
+	i.tracerProvider = o.Provider
+}
+
+// MeterProvider sets provider of meter recording metrics,
+// by default global provider is used.
+type MeterProvider struct {
+	Provider metric.MeterProvider
+}
+
+func (o MeterProvider) apply(i *Instrumentation) {
+	i.meterProvider = o.Provider
+}
+
+// Propagator sets how trace context is read from HTTP headers and _meta of calls,
+// by default W3C trace context and baggage are read.
+type Propagator struct {
+	Propagator propagation.TextMapPropagator
+}
+
+func (o Propagator) apply(i *Instrumentation) {
+	i.propagator = o.Propagator
+}
+
+// New creates instrumentation, it only fails if metrics cannot be created by meter provider.
+func New(options ...Option) (*Instrumentation, error) {
+	i := &Instrumentation{
+		tracerProvider: otel.GetTracerProvider(),
+		meterProvider:  otel.GetMeterProvider(),
+		propagator:     propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}),
+	}
+	for _, o := range options {
+		o.apply(i)
+	}
+
+	i.tracer = i.tracerProvider.Tracer(instrumentationName)
+	meter := i.meterProvider.Meter(instrumentationName)
+
+	var err error
+	i.requests, err = meter.Int64Counter("mcp.server.requests",
+		metric.WithDescription("Number of requests handled by server"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	i.duration, err = meter.Float64Histogram("mcp.server.request.duration",
+		metric.WithDescription("Duration of requests handled by server"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	i.inFlight, err = meter.Int64UpDownCounter("mcp.server.requests.in_flight",
+		metric.WithDescription("Number of requests being handled by server"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	i.activeSessions, err = meter.Int64UpDownCounter("mcp.server.sessions.active",
+		metric.WithDescription("Number of initialized sessions, which are not shut down yet"),
+		metric.WithUnit("{session}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// ServerOptions returns options installing instrumentation to server,
+// these can be passed to app.Builder with WithExtraServerOptions.
+func (i *Instrumentation) ServerOptions() []server.ServerOption {
+	return []server.ServerOption{
+		server.MiddlewareOption{Middleware: i.Middleware},
+		server.OnInitializedOption{Callback: i.sessionInitialized},
+		server.OnShutdownOption{Callback: i.sessionShutdown},
+	}
+}
+
+func (i *Instrumentation) sessionInitialized(ctx context.Context) {
+	sess, ok := session.FromContext(ctx)
+	if !ok {
+		return
+	}
+	if _, loaded := i.sessions.LoadOrStore(sess.SessionID, struct{}{}); !loaded {
+		i.activeSessions.Add(ctx, 1)
+	}
+}
+
+func (i *Instrumentation) sessionShutdown(ctx context.Context) {
+	sess, ok := session.FromContext(ctx)
+	if !ok {
+		return
+	}
+	if _, loaded := i.sessions.LoadAndDelete(sess.SessionID); loaded {
+		i.activeSessions.Add(ctx, -1)
+	}
+}
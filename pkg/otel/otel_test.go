@@ -0,0 +1,202 @@
+package foxyotel
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/strowk/foxy-contexts/pkg/fxctx"
+	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/server"
+	"github.com/strowk/foxy-contexts/pkg/session"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	clientTraceId = "4bf92f3577b34da6a3ce929d0e0e4736"
+	clientSpanId  = "00f067aa0ba902b7"
+	traceparent   = "00-" + clientTraceId + "-" + clientSpanId + "-01"
+)
+
+type testInstrumentation struct {
+	*Instrumentation
+	spans  *tracetest.SpanRecorder
+	reader *sdkmetric.ManualReader
+}
+
+func newTestInstrumentation(t *testing.T) testInstrumentation {
+	spans := tracetest.NewSpanRecorder()
+	reader := sdkmetric.NewManualReader()
+	instrumentation, err := New(
+		TracerProvider{Provider: sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))},
+		MeterProvider{Provider: sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))},
+	)
+	require.NoError(t, err)
+	return testInstrumentation{Instrumentation: instrumentation, spans: spans, reader: reader}
+}
+
+func (ti testInstrumentation) metrics(t *testing.T) map[string]metricdata.Aggregation {
+	var data metricdata.ResourceMetrics
+	require.NoError(t, ti.reader.Collect(context.Background(), &data))
+	metrics := map[string]metricdata.Aggregation{}
+	for _, scope := range data.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+	return metrics
+}
+
+func newTestServer(ti testInstrumentation) server.Server {
+	s := server.NewServer(
+		&mcp.ServerCapabilities{Tools: &mcp.ServerCapabilitiesTools{}},
+		&mcp.Implementation{Name: "TestServer", Version: "0.0.0"},
+		ti.ServerOptions()...,
+	)
+	fxctx.NewToolMux([]fxctx.Tool{
+		fxctx.NewTool(
+			&mcp.Tool{Name: "greet", InputSchema: mcp.ToolInputSchema{Type: "object"}},
+			func(ctx context.Context, args map[string]interface{}) *mcp.CallToolResult {
+				return &mcp.CallToolResult{Content: []interface{}{mcp.TextContent{Type: "text", Text: "hello"}}}
+			},
+		),
+	}).RegisterHandlers(s)
+	return s
+}
+
+func initialize(t *testing.T, s server.Server, ctx context.Context) {
+	responses := s.HandleAndGetResponses(ctx, []byte(`{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"TestClient","version":"1.2.3"}}}`))
+	require.Len(t, responses, 1)
+	require.Nil(t, responses[0].Error)
+	s.HandleAndGetResponses(ctx, []byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`))
+}
+
+func attributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	result := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		result[kv.Key] = kv.Value
+	}
+	return result
+}
+
+func TestSpans(t *testing.T) {
+	ti := newTestInstrumentation(t)
+	s := newTestServer(ti)
+	ctx := session.WithNewSession(context.Background())
+	sess, _ := session.FromContext(ctx)
+	initialize(t, s, ctx)
+
+	responses := s.HandleAndGetResponses(ctx, []byte(`{"jsonrpc":"2.0","id":"call-1","method":"tools/call","params":{"name":"greet","_meta":{"traceparent":"`+traceparent+`"}}}`))
+	require.Len(t, responses, 1)
+	require.Nil(t, responses[0].Error)
+	responses = s.HandleAndGetResponses(ctx, []byte(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"missing"}}`))
+	require.Len(t, responses, 1)
+	require.NotNil(t, responses[0].Error)
+
+	ended := ti.spans.Ended()
+	require.Len(t, ended, 4)
+	assert.Equal(t, "initialize", ended[0].Name())
+	assert.Equal(t, "notifications/initialized", ended[1].Name())
+	assert.NotContains(t, attributes(ended[1]), RequestIdKey)
+
+	called := ended[2]
+	assert.Equal(t, "tools/call greet", called.Name())
+	assert.Equal(t, trace.SpanKindServer, called.SpanKind())
+	assert.Equal(t, clientTraceId, called.SpanContext().TraceID().String())
+	assert.Equal(t, clientSpanId, called.Parent().SpanID().String())
+	assert.True(t, called.Parent().IsRemote())
+	assert.Equal(t, map[attribute.Key]attribute.Value{
+		MethodKey:    attribute.StringValue("tools/call"),
+		ToolKey:      attribute.StringValue("greet"),
+		SessionKey:   attribute.StringValue(sess.SessionID.String()),
+		RequestIdKey: attribute.StringValue("call-1"),
+	}, attributes(called))
+	assert.Equal(t, codes.Unset, called.Status().Code)
+
+	failed := ended[3]
+	assert.Equal(t, "tools/call missing", failed.Name())
+	assert.False(t, failed.Parent().IsValid())
+	assert.Equal(t, attribute.StringValue("2"), attributes(failed)[RequestIdKey])
+	assert.Equal(t, attribute.IntValue(jsonrpc2.InvalidParams), attributes(failed)[ErrorCodeKey])
+	assert.Equal(t, codes.Error, failed.Status().Code)
+}
+
+func distinct(kvs ...attribute.KeyValue) attribute.Distinct {
+	set := attribute.NewSet(kvs...)
+	return set.Equivalent()
+}
+
+func TestMetrics(t *testing.T) {
+	ti := newTestInstrumentation(t)
+	s := newTestServer(ti)
+	ctx := session.WithNewSession(context.Background())
+	initialize(t, s, ctx)
+
+	s.HandleAndGetResponses(ctx, []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"greet"}}`))
+	s.HandleAndGetResponses(ctx, []byte(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"greet"}}`))
+	s.HandleAndGetResponses(ctx, []byte(`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"missing"}}`))
+	s.HandleAndGetResponses(ctx, []byte(`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"absent"}}`))
+	s.HandleAndGetResponses(ctx, []byte(`{"jsonrpc":"2.0","id":5,"method":"vendor/anything"}`))
+
+	require.Eventually(t, func() bool {
+		sessions, ok := ti.metrics(t)["mcp.server.sessions.active"].(metricdata.Sum[int64])
+		return ok && len(sessions.DataPoints) == 1 && sessions.DataPoints[0].Value == 1
+	}, time.Second, 10*time.Millisecond)
+
+	metrics := ti.metrics(t)
+	requests := metrics["mcp.server.requests"].(metricdata.Sum[int64])
+	counts := map[attribute.Distinct]int64{}
+	for _, point := range requests.DataPoints {
+		counts[point.Attributes.Equivalent()] = point.Value
+	}
+	assert.Equal(t, map[attribute.Distinct]int64{
+		distinct(MethodKey.String("initialize")):                                                                    1,
+		distinct(MethodKey.String("tools/call"), ToolKey.String("greet")):                                           2,
+		distinct(MethodKey.String("tools/call"), ToolKey.String(UNKNOWN), ErrorCodeKey.Int(jsonrpc2.InvalidParams)): 2,
+		distinct(MethodKey.String(UNKNOWN), ErrorCodeKey.Int(jsonrpc2.MethodNotFound)):                              1,
+	}, counts)
+
+	duration := metrics["mcp.server.request.duration"].(metricdata.Histogram[float64])
+	assert.Len(t, duration.DataPoints, 4)
+
+	inFlight := metrics["mcp.server.requests.in_flight"].(metricdata.Sum[int64])
+	methods := []string{}
+	for _, point := range inFlight.DataPoints {
+		assert.Zero(t, point.Value)
+		method, _ := point.Attributes.Value(MethodKey)
+		methods = append(methods, method.AsString())
+	}
+	assert.ElementsMatch(t, []string{"initialize", "tools/call", UNKNOWN}, methods)
+
+	s.Shutdown(ctx)
+	s.Shutdown(ctx)
+	sessions := ti.metrics(t)["mcp.server.sessions.active"].(metricdata.Sum[int64])
+	assert.Equal(t, int64(0), sessions.DataPoints[0].Value)
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	ti := newTestInstrumentation(t)
+	var parent trace.SpanContext
+	handler := ti.HTTPMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parent = trace.SpanContextFromContext(r.Context())
+	}))
+
+	request := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+	request.Header.Set("traceparent", traceparent)
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	assert.Equal(t, clientTraceId, parent.TraceID().String())
+	assert.Equal(t, clientSpanId, parent.SpanID().String())
+	assert.True(t, parent.IsRemote())
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/session"
+)
+
+var (
+	ErrClientDoesNotSupportSampling = errors.New("client did not declare sampling capability")
+	ErrClientDoesNotSupportRoots    = errors.New("client did not declare roots capability")
+	ErrServerRequestsNotSupported   = errors.New("transport does not support sending requests to client")
+	ErrClientRespondedWithError     = errors.New("client responded with error")
+)
+
+type clientResponse struct {
+	result json.RawMessage
+	err    *jsonrpc2.Error
+}
+
+// SendRequest sends request to the client of the session found in ctx
+// and waits until client responds or ctx is done.
+//
+// Requests for sampling and roots are only sent if client has declared
+// corresponding capabilities during initialization.
+func (s *server) SendRequest(ctx context.Context, request jsonrpc2.Request) (json.RawMessage, error) {
+	if s.serverRequestsDisabled {
+		return nil, ErrServerRequestsNotSupported
+	}
+
+	if err := checkClientCapabilities(ctx, request.GetMethod()); err != nil {
+		return nil, err
+	}
+
+	id := jsonrpc2.NewIntRequestId(int(s.lastRequestId.Add(1)))
+	responses := make(chan clientResponse, 1)
+
+	s.pendingRequestMu.Lock()
+	s.pendingRequests[id] = responses
+	s.pendingRequestMu.Unlock()
+
+	defer func() {
+		s.pendingRequestMu.Lock()
+		delete(s.pendingRequests, id)
+		s.pendingRequestMu.Unlock()
+	}()
+
+	// traced before it is sent, so that latency of response could be measured
+	message := jsonrpc2.JsonRpcRequest{Id: id, Request: request}
+	s.traceSent(ctx, message)
+	select {
+	case s.requests <- message:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	select {
+	case res := <-responses:
+		if res.err != nil {
+			return nil, fmt.Errorf("%w: %d %s", ErrClientRespondedWithError, res.err.Code, res.err.Message)
+		}
+		return res.result, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Notify sends notification to the client of the session, such as
+// *mcp.ToolListChangedNotification, and returns once it is handed
+// over to transport or ctx is done.
+func (s *server) Notify(ctx context.Context, notification jsonrpc2.Request) error {
+	if s.serverRequestsDisabled {
+		return ErrServerRequestsNotSupported
+	}
+
+	message := jsonrpc2.JsonRpcRequest{Id: jsonrpc2.NewMissingRequestId(), Request: notification}
+	s.traceSent(ctx, message)
+	select {
+	case s.requests <- message:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *server) handleClientResponse(_ context.Context, id jsonrpc2.RequestId, result json.RawMessage, err *jsonrpc2.Error) {
+	// only the first response is delivered, so duplicate one
+	// would not find the request pending anymore
+	s.pendingRequestMu.Lock()
+	responses, ok := s.pendingRequests[id]
+	delete(s.pendingRequests, id)
+	s.pendingRequestMu.Unlock()
+	if !ok {
+		// either client responded too late or it is not a response to our request,
+		// in both cases there is nobody waiting for it
+		return
+	}
+	select {
+	case responses <- clientResponse{result: result, err: err}:
+	default:
+		// channel is buffered for the only response,
+		// so this is not expected, but reading must never block
+	}
+}
+
+// CreateMessage asks client to sample LLM, which is only possible if client has declared sampling capability
+func (s *server) CreateMessage(ctx context.Context, params mcp.CreateMessageRequestParams) (*mcp.CreateMessageResult, error) {
+	req := &mcp.CreateMessageRequest{
+		Params: params,
+	}
+	req.Method = req.GetMethod()
+
+	raw, err := s.SendRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var result mcp.CreateMessageResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse sampling result: %w", err)
+	}
+	return &result, nil
+}
+
+// ListRoots asks client for its roots, which is only possible if client has declared roots capability
+func (s *server) ListRoots(ctx context.Context) (*mcp.ListRootsResult, error) {
+	req := &mcp.ListRootsRequest{}
+	req.Method = req.GetMethod()
+
+	raw, err := s.SendRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var result mcp.ListRootsResult
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse roots result: %w", err)
+	}
+	return &result, nil
+}
+
+func checkClientCapabilities(ctx context.Context, method string) error {
+	var capabilities *mcp.ClientCapabilities
+	if sess, ok := session.FromContext(ctx); ok {
+		capabilities = sess.ClientCapabilities()
+	}
+
+	switch method {
+	case mcp.CreateMessageRequest{}.GetMethod():
+		if capabilities == nil || capabilities.Sampling == nil {
+			return ErrClientDoesNotSupportSampling
+		}
+	case mcp.ListRootsRequest{}.GetMethod():
+		if capabilities == nil || capabilities.Roots == nil {
+			return ErrClientDoesNotSupportRoots
+		}
+	}
+	return nil
+}
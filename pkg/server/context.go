@@ -0,0 +1,17 @@
+package server
+
+import "context"
+
+type serverContextKey struct{}
+
+func withServer(ctx context.Context, s Server) context.Context {
+	return context.WithValue(ctx, serverContextKey{}, s)
+}
+
+// FromContext returns the server that is handling request in given context,
+// so that handlers could use it to send requests to the client, for example
+// to ask for sampling with CreateMessage.
+func FromContext(ctx context.Context) (Server, bool) {
+	s, ok := ctx.Value(serverContextKey{}).(Server)
+	return s, ok
+}
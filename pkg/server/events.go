@@ -0,0 +1,88 @@
+package server
+
+import (
+	"context"
+	"runtime/debug"
+	"time"
+
+	foxyevent "github.com/strowk/foxy-contexts/pkg/foxy_event"
+	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
+	"github.com/strowk/foxy-contexts/pkg/session"
+)
+
+// eventRouterOptions make router report calls to logger of the server,
+// they are given before options of user, so that calls are reported
+// as they are received and completed, including ones rejected by middlewares
+func (s *server) eventRouterOptions() []jsonrpc2.RouterOption {
+	return []jsonrpc2.RouterOption{
+		jsonrpc2.MiddlewareOption{Middlewares: []jsonrpc2.Middleware{s.logCalls}},
+		jsonrpc2.UnknownMethodOption{Handler: s.logUnknownMethod},
+	}
+}
+
+// logCalls logs received and completed calls and recovers from panics
+// while handling them, so that one failing handler does not stop the server
+func (s *server) logCalls(next jsonrpc2.CallHandler) jsonrpc2.CallHandler {
+	return func(ctx context.Context, call *jsonrpc2.Call) (jsonrpc2.Result, *jsonrpc2.Error) {
+		sessionId := sessionIdFromContext(ctx)
+		if call.Id.IdIsMissing {
+			s.logger.LogEvent(foxyevent.NotificationReceived{SessionId: sessionId, Method: call.Method})
+			return s.recoverCall(ctx, sessionId, call, next)
+		}
+
+		requestId := call.Id.String()
+		s.logger.LogEvent(foxyevent.RequestReceived{SessionId: sessionId, RequestId: requestId, Method: call.Method})
+		started := time.Now()
+		result, err := s.recoverCall(ctx, sessionId, call, next)
+		completed := foxyevent.RequestCompleted{
+			SessionId: sessionId,
+			RequestId: requestId,
+			Method:    call.Method,
+			Duration:  time.Since(started),
+		}
+		if err != nil {
+			completed.ErrorCode = err.Code
+			completed.ErrorMessage = err.Message
+		}
+		s.logger.LogEvent(completed)
+		return result, err
+	}
+}
+
+func (s *server) recoverCall(
+	ctx context.Context,
+	sessionId string,
+	call *jsonrpc2.Call,
+	next jsonrpc2.CallHandler,
+) (result jsonrpc2.Result, err *jsonrpc2.Error) {
+	defer func() {
+		if value := recover(); value != nil {
+			s.logger.LogEvent(foxyevent.PanicRecovered{
+				SessionId: sessionId,
+				RequestId: call.Id.String(),
+				Method:    call.Method,
+				Value:     value,
+				Stack:     string(debug.Stack()),
+			})
+			// details of panic are only logged, as they could reveal internals of server
+			result, err = nil, jsonrpc2.NewInternalError("handler of "+call.Method+" has panicked")
+		}
+	}()
+	return next(ctx, call)
+}
+
+func (s *server) logUnknownMethod(ctx context.Context, call *jsonrpc2.Call) {
+	s.logger.LogEvent(foxyevent.UnknownMethod{
+		SessionId: sessionIdFromContext(ctx),
+		RequestId: call.Id.String(),
+		Method:    call.Method,
+	})
+}
+
+// sessionIdFromContext returns id of the session from ctx or empty string
+func sessionIdFromContext(ctx context.Context) string {
+	if sess, ok := session.FromContext(ctx); ok {
+		return sess.SessionID.String()
+	}
+	return ""
+}
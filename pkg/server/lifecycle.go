@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+
+	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+)
+
+// LifecycleState is a state of the session served by the server.
+//
+// Every server instance is serving exactly one session, so state
+// of the server is the state of the session.
+//
+// see https://spec.modelcontextprotocol.io/specification/2025-03-26/basic/lifecycle/
+type LifecycleState int32
+
+const (
+	// LifecycleUninitialized is the state before client has sent initialize request
+	LifecycleUninitialized LifecycleState = iota
+	// LifecycleInitializing is the state after server responded to initialize request,
+	// but before client has sent notifications/initialized
+	LifecycleInitializing
+	// LifecycleReady is the state when client is allowed to use all server features
+	LifecycleReady
+	// LifecycleShuttingDown is the state after transport started to close the session
+	LifecycleShuttingDown
+)
+
+func (s LifecycleState) String() string {
+	switch s {
+	case LifecycleUninitialized:
+		return "uninitialized"
+	case LifecycleInitializing:
+		return "initializing"
+	case LifecycleReady:
+		return "ready"
+	case LifecycleShuttingDown:
+		return "shutting down"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	// ServerNotInitialized is the error code returned for requests
+	// arriving before initialization has finished
+	ServerNotInitialized = -32002
+	// ServerShuttingDown is the error code returned for requests
+	// arriving after session has started shutting down
+	ServerShuttingDown = -32003
+)
+
+// OnInitializedFunc is called after client has sent notifications/initialized,
+// ctx carries the session of the client.
+type OnInitializedFunc func(ctx context.Context)
+
+// OnShutdownFunc is called once when session starts shutting down,
+// ctx carries the server, which can be found with FromContext.
+type OnShutdownFunc func(ctx context.Context)
+
+func (s *server) GetLifecycleState() LifecycleState {
+	return LifecycleState(s.state.Load())
+}
+
+// checkLifecycle returns error if request for given method
+// cannot be served in current lifecycle state
+func (s *server) checkLifecycle(method string) *jsonrpc2.Error {
+	if method == (mcp.PingRequest{}).GetMethod() {
+		// pings are allowed at any time
+		return nil
+	}
+
+	if method == (mcp.InitializeRequest{}).GetMethod() {
+		if !s.state.CompareAndSwap(int32(LifecycleUninitialized), int32(LifecycleInitializing)) {
+			return jsonrpc2.NewInvalidRequestError(
+				"initialize can only be sent once per session, but session is " + s.GetLifecycleState().String(),
+			)
+		}
+		return nil
+	}
+
+	switch state := s.GetLifecycleState(); state {
+	case LifecycleReady:
+		return nil
+	case LifecycleShuttingDown:
+		return &jsonrpc2.Error{
+			Code:    ServerShuttingDown,
+			Message: "Server shutting down",
+			Data:    "session is shutting down and cannot process " + method,
+		}
+	default:
+		return &jsonrpc2.Error{
+			Code:    ServerNotInitialized,
+			Message: "Server not initialized",
+			Data:    "session is " + state.String() + " and cannot process " + method + " before initialization is finished",
+		}
+	}
+}
+
+func (s *server) handleInitialized(ctx context.Context, req jsonrpc2.Request) {
+	if !s.state.CompareAndSwap(int32(LifecycleInitializing), int32(LifecycleReady)) {
+		// notification arrived out of order, nothing to respond to it
+		return
+	}
+
+	// callbacks are run separately to not block processing of messages,
+	// so that they could, for example, send requests to client and wait for response
+	go func() {
+		for _, callback := range s.onInitialized {
+			callback(ctx)
+		}
+		for _, callback := range s.initializedNotificationCallbacks {
+			callback(req.(*mcp.InitializedNotification))
+		}
+	}()
+}
+
+// Shutdown moves session to shutting down state, after which server
+// would reject all requests apart from pings, and calls registered
+// OnShutdownFunc callbacks. Only first call has any effect.
+func (s *server) Shutdown(ctx context.Context) {
+	previous := LifecycleState(s.state.Swap(int32(LifecycleShuttingDown)))
+	if previous == LifecycleShuttingDown {
+		return
+	}
+	ctx = withServer(ctx, s)
+	for _, callback := range s.onShutdown {
+		callback(ctx)
+	}
+	s.forgetTraced()
+}
@@ -1,7 +1,7 @@
 package server
 
 import (
-	"context"
+	"log/slog"
 
 	foxyevent "github.com/strowk/foxy-contexts/pkg/foxy_event"
 	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
@@ -28,14 +28,48 @@ func (o LoggerOption) apply(s *server) {
 	s.SetLogger(o.Logger)
 }
 
+// LoggerFromOptions returns logger set by the last LoggerOption
+// or the default logger used by servers, so that transports
+// could log their own events the same way as servers do.
+func LoggerFromOptions(options []ServerOption) foxyevent.Logger {
+	var logger foxyevent.Logger = foxyevent.NewSlogLogger(slog.Default())
+	for _, o := range options {
+		if lo, ok := o.(LoggerOption); ok {
+			logger = lo.Logger
+		}
+	}
+	return logger
+}
+
 type InitializationFininshedHandlerOption struct {
-	callback func(req *mcp.InitializedNotification)
+	Callback func(req *mcp.InitializedNotification)
 }
 
 func (o InitializationFininshedHandlerOption) apply(s *server) {
-	s.SetNotificationHandler(&mcp.InitializedNotification{}, func(ctx context.Context, req jsonrpc2.Request) {
-		o.callback(req.(*mcp.InitializedNotification))
-	})
+	s.initializedNotificationCallbacks = append(s.initializedNotificationCallbacks, o.Callback)
+}
+
+// OnInitializedOption registers callback to be called after client
+// has finished initialization by sending notifications/initialized.
+//
+// Callback is called in its own goroutine, so it can send requests
+// to client, for example to list roots, without blocking the session.
+type OnInitializedOption struct {
+	Callback OnInitializedFunc
+}
+
+func (o OnInitializedOption) apply(s *server) {
+	s.onInitialized = append(s.onInitialized, o.Callback)
+}
+
+// OnShutdownOption registers callback to be called once when
+// session served by the server starts shutting down.
+type OnShutdownOption struct {
+	Callback OnShutdownFunc
+}
+
+func (o OnShutdownOption) apply(s *server) {
+	s.onShutdown = append(s.onShutdown, o.Callback)
 }
 
 type MinimalProtocolVersionOption struct {
@@ -45,3 +79,47 @@ type MinimalProtocolVersionOption struct {
 func (minimalVersionOption MinimalProtocolVersionOption) apply(s *server) {
 	s.minimalProtocolVersionOption = &minimalVersionOption
 }
+
+// DisableServerRequestsOption is used by transports, which have no way
+// to deliver requests from server to client, so that SendRequest
+// fails immediately instead of waiting for response that would never come.
+type DisableServerRequestsOption struct{}
+
+func (DisableServerRequestsOption) apply(s *server) {
+	s.serverRequestsDisabled = true
+}
+
+// RouterOption passes options to jsonrpc2 router of the server,
+// for example jsonrpc2.BatchConcurrencyOption to handle batches concurrently.
+type RouterOption struct {
+	Options []jsonrpc2.RouterOption
+}
+
+// router options are used when router is created, before other options are applied
+func (RouterOption) apply(*server) {}
+
+// MiddlewareOption wraps handling of every request and notification
+// received by the server into given middleware, see jsonrpc2.Middleware.
+//
+// Middleware sees calls before lifecycle of the session is checked,
+// so it also sees requests rejected for arriving before initialization.
+type MiddlewareOption struct {
+	Middleware jsonrpc2.Middleware
+}
+
+func (MiddlewareOption) apply(*server) {}
+
+func routerOptionsFromOptions(options []ServerOption) []jsonrpc2.RouterOption {
+	var routerOptions []jsonrpc2.RouterOption
+	for _, o := range options {
+		switch ro := o.(type) {
+		case RouterOption:
+			routerOptions = append(routerOptions, ro.Options...)
+		case MiddlewareOption:
+			routerOptions = append(routerOptions, jsonrpc2.MiddlewareOption{
+				Middlewares: []jsonrpc2.Middleware{ro.Middleware},
+			})
+		}
+	}
+	return routerOptions
+}
@@ -2,29 +2,60 @@ package server
 
 import (
 	"context"
+	"encoding/json"
 	"log/slog"
+	"sync"
+	"sync/atomic"
 
 	foxyevent "github.com/strowk/foxy-contexts/pkg/foxy_event"
 	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
 	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/session"
+	"github.com/strowk/foxy-contexts/pkg/wiretrace"
 )
 
 type Server interface {
 	Handle(ctx context.Context, b []byte)
 	HandleAndGetResponses(ctx context.Context, b []byte) []*jsonrpc2.JsonRpcResponse
 	GetResponses() chan jsonrpc2.JsonRpcResponse
+	GetRequests() chan jsonrpc2.JsonRpcRequest
+	SendRequest(ctx context.Context, request jsonrpc2.Request) (json.RawMessage, error)
+	Notify(ctx context.Context, notification jsonrpc2.Request) error
+	CreateMessage(ctx context.Context, params mcp.CreateMessageRequestParams) (*mcp.CreateMessageResult, error)
+	ListRoots(ctx context.Context) (*mcp.ListRootsResult, error)
+	// Deprecated: use jsonrpc2.Handle, or SetMethodHandler with jsonrpc2.RequestConstructor.
 	SetRequestHandler(request jsonrpc2.Request, handler func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error))
+	// Deprecated: use jsonrpc2.HandleNotification, or SetMethodNotificationHandler with jsonrpc2.RequestConstructor.
 	SetNotificationHandler(request jsonrpc2.Request, handler func(ctx context.Context, req jsonrpc2.Request))
+	// Server is jsonrpc2.HandlerRegistry, so that typed handlers
+	// could be registered with jsonrpc2.Handle and jsonrpc2.HandleNotification
+	jsonrpc2.HandlerRegistry
 	SetLogger(logger foxyevent.Logger)
 	GetLogger() foxyevent.Logger
+	GetLifecycleState() LifecycleState
+	Shutdown(ctx context.Context)
 }
 
 type server struct {
 	router    jsonrpc2.JsonRpcRouter
 	responses chan jsonrpc2.JsonRpcResponse
+	requests  chan jsonrpc2.JsonRpcRequest
 	logger    foxyevent.Logger
 
 	minimalProtocolVersionOption *MinimalProtocolVersionOption
+	serverRequestsDisabled       bool
+
+	lastRequestId    atomic.Int64
+	pendingRequests  map[jsonrpc2.RequestId]chan clientResponse
+	pendingRequestMu sync.Mutex
+
+	state                            atomic.Int32
+	onInitialized                    []OnInitializedFunc
+	onShutdown                       []OnShutdownFunc
+	initializedNotificationCallbacks []func(req *mcp.InitializedNotification)
+
+	tracer          *wiretrace.Tracer
+	tracedSessionId atomic.Pointer[string]
 }
 
 func NewServer(
@@ -33,41 +64,60 @@ func NewServer(
 	options ...ServerOption,
 ) Server {
 	s := &server{
-		router:    jsonrpc2.NewJsonRPCRouter(),
 		responses: make(chan jsonrpc2.JsonRpcResponse),
+		requests:  make(chan jsonrpc2.JsonRpcRequest),
 		logger:    foxyevent.NewSlogLogger(slog.Default()),
+
+		pendingRequests: map[jsonrpc2.RequestId]chan clientResponse{},
 	}
+	s.router = jsonrpc2.NewJsonRPCRouter(append(s.eventRouterOptions(), routerOptionsFromOptions(options)...)...)
 
-	appliedNotificationHandler := false
 	for _, o := range options {
-		if _, ok := o.(InitializationFininshedHandlerOption); ok {
-			appliedNotificationHandler = true
-		}
 		o.apply(s)
 	}
 
-	if !appliedNotificationHandler {
-		s.SetNotificationHandler(&mcp.InitializedNotification{}, func(_ context.Context, _ jsonrpc2.Request) {
-			// just ignore it to not return any errors
-		})
-	}
-
 	s.initialize(capabilities, serverInfo)
 
 	return s
 }
 
 func (s *server) SetRequestHandler(request jsonrpc2.Request, handler func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error)) {
-	s.router.SetRequestHandler(request, func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
-		return handler(ctx, req)
-	})
+	s.router.SetRequestHandler(request, s.withLifecycleCheck(request.GetMethod(), handler))
 }
 
 func (s *server) SetNotificationHandler(request jsonrpc2.Request, handler func(ctx context.Context, req jsonrpc2.Request)) {
-	s.router.SetNotificationHandler(request,
-		func(ctx context.Context, req jsonrpc2.Request) {
-			handler(ctx, req)
-		})
+	s.router.SetNotificationHandler(request, s.whenReady(handler))
+}
+
+func (s *server) SetMethodHandler(method string, newRequest func() jsonrpc2.Request, handler func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error)) {
+	s.router.SetMethodHandler(method, newRequest, s.withLifecycleCheck(method, handler))
+}
+
+func (s *server) SetMethodNotificationHandler(method string, newRequest func() jsonrpc2.Request, handler func(ctx context.Context, req jsonrpc2.Request)) {
+	s.router.SetMethodNotificationHandler(method, newRequest, s.whenReady(handler))
+}
+
+func (s *server) withLifecycleCheck(
+	method string,
+	handler func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error),
+) func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
+	return func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
+		if err := s.checkLifecycle(method); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func (s *server) whenReady(handler func(ctx context.Context, req jsonrpc2.Request)) func(ctx context.Context, req jsonrpc2.Request) {
+	return func(ctx context.Context, req jsonrpc2.Request) {
+		if s.GetLifecycleState() != LifecycleReady {
+			// notifications cannot be answered with error,
+			// so ones arriving before initialization are dropped
+			return
+		}
+		handler(ctx, req)
+	}
 }
 
 func (s *server) initialize(
@@ -80,22 +130,28 @@ func (s *server) initialize(
 	if serverInfo == nil {
 		panic("serverInfo cannot be nil")
 	}
-	s.SetRequestHandler(&mcp.InitializeRequest{},
-		func(_ context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
-			return s.handleInitialize(req, capabilities, serverInfo), nil
+	newInitialize := jsonrpc2.RequestConstructor[mcp.InitializeRequest]()
+	s.SetMethodHandler(newInitialize().GetMethod(), newInitialize,
+		func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
+			return s.handleInitialize(ctx, req, capabilities, serverInfo), nil
 		},
 	)
-	s.SetRequestHandler(&mcp.PingRequest{}, func(_ context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
-		return struct{}{}, nil
+	jsonrpc2.Handle(s, func(_ context.Context, req *mcp.PingRequest) (*struct{}, *jsonrpc2.Error) {
+		return &struct{}{}, nil
 	})
+	newInitialized := jsonrpc2.RequestConstructor[mcp.InitializedNotification]()
+	s.router.SetMethodNotificationHandler(newInitialized().GetMethod(), newInitialized, s.handleInitialized)
+	s.router.SetResponseHandler(s.handleClientResponse)
 }
 
 func (s *server) handleInitialize(
+	ctx context.Context,
 	req jsonrpc2.Request,
 	capabilities *mcp.ServerCapabilities,
 	serverInfo *mcp.Implementation,
 ) jsonrpc2.Result {
-	requestedVersion := req.(*mcp.InitializeRequest).Params.ProtocolVersion
+	params := req.(*mcp.InitializeRequest).Params
+	requestedVersion := params.ProtocolVersion
 
 	// minimal version is either set or defaults to empty with every supprorted version
 	// being higher than empty string
@@ -104,7 +160,7 @@ func (s *server) handleInitialize(
 		minimal = string(s.minimalProtocolVersionOption.Version)
 	}
 
-	// will pick either the requested version or the highest supported version
+	// will pick either the requested version or the last listed supported version
 	supportedVersion := requestedVersion
 	for _, version := range SUPPORTED_PROTOCOL_VERSIONS {
 		versionStr := string(version)
@@ -114,6 +170,20 @@ func (s *server) handleInitialize(
 		}
 	}
 
+	if sess, ok := session.FromContext(ctx); ok {
+		sess.SetInitialized(params.ClientInfo, params.Capabilities, supportedVersion)
+	}
+
+	requestId, _ := jsonrpc2.RequestIdFromContext(ctx)
+	s.logger.LogEvent(foxyevent.SessionInitialized{
+		SessionId:        sessionIdFromContext(ctx),
+		RequestId:        requestId.String(),
+		ClientName:       params.ClientInfo.Name,
+		ClientVersion:    params.ClientInfo.Version,
+		RequestedVersion: requestedVersion,
+		ProtocolVersion:  supportedVersion,
+	})
+
 	return &mcp.InitializeResult{
 		ProtocolVersion: supportedVersion,
 		Capabilities:    *capabilities,
@@ -125,17 +195,30 @@ func (s *server) GetResponses() chan jsonrpc2.JsonRpcResponse {
 	return s.responses
 }
 
+func (s *server) GetRequests() chan jsonrpc2.JsonRpcRequest {
+	return s.requests
+}
+
 func (s *server) Handle(ctx context.Context, buffer []byte) {
-	responses := s.router.Handle(ctx, buffer)
+	s.traceMessage(ctx, wiretrace.Inbound, buffer)
+	responses := s.router.Handle(withServer(ctx, s), buffer)
 	for _, response := range responses {
 		if response != nil {
+			s.traceSent(ctx, response)
 			s.responses <- *response
 		}
 	}
 }
 
 func (s *server) HandleAndGetResponses(ctx context.Context, buffer []byte) []*jsonrpc2.JsonRpcResponse {
-	return s.router.Handle(ctx, buffer)
+	s.traceMessage(ctx, wiretrace.Inbound, buffer)
+	responses := s.router.Handle(withServer(ctx, s), buffer)
+	for _, response := range responses {
+		if response != nil {
+			s.traceSent(ctx, response)
+		}
+	}
+	return responses
 }
 
 func (s *server) SetLogger(logger foxyevent.Logger) {
@@ -0,0 +1,359 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	foxyevent "github.com/strowk/foxy-contexts/pkg/foxy_event"
+	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/session"
+	"github.com/strowk/foxy-contexts/pkg/wiretrace"
+)
+
+func newTestServer() Server {
+	return NewServer(&mcp.ServerCapabilities{}, &mcp.Implementation{
+		Name:    "TestServer",
+		Version: "0.0.0",
+	})
+}
+
+func initialize(t *testing.T, s Server, ctx context.Context, capabilities string) {
+	responses := s.HandleAndGetResponses(ctx, []byte(`{
+		"jsonrpc":"2.0",
+		"id":0,
+		"method":"initialize",
+		"params":{
+			"protocolVersion":"2024-11-05",
+			"capabilities":`+capabilities+`,
+			"clientInfo":{"name":"TestClient","version":"1.2.3"}
+		}
+	}`))
+	require.Len(t, responses, 1)
+	require.Nil(t, responses[0].Error)
+}
+
+func TestInitializeRecordsClientOnSession(t *testing.T) {
+	s := newTestServer()
+	ctx := session.WithNewSession(context.Background())
+
+	initialize(t, s, ctx, `{"roots":{"listChanged":true}}`)
+
+	sess, ok := session.FromContext(ctx)
+	require.True(t, ok)
+	assert.Equal(t, "2024-11-05", sess.ProtocolVersion())
+	require.NotNil(t, sess.ClientInfo())
+	assert.Equal(t, "TestClient", sess.ClientInfo().Name)
+	assert.Equal(t, "1.2.3", sess.ClientInfo().Version)
+	require.NotNil(t, sess.ClientCapabilities())
+	require.NotNil(t, sess.ClientCapabilities().Roots)
+	assert.Nil(t, sess.ClientCapabilities().Sampling)
+}
+
+func TestInitializeFallsBackToLastSupportedVersion(t *testing.T) {
+	negotiate := func(s Server, requested string) string {
+		responses := s.HandleAndGetResponses(session.WithNewSession(context.Background()), []byte(`{
+			"jsonrpc":"2.0",
+			"id":0,
+			"method":"initialize",
+			"params":{"protocolVersion":"`+requested+`","capabilities":{},"clientInfo":{"name":"c","version":"0"}}
+		}`))
+		require.Len(t, responses, 1)
+		return (*responses[0].Result).(*mcp.InitializeResult).ProtocolVersion
+	}
+
+	last := SUPPORTED_PROTOCOL_VERSIONS[len(SUPPORTED_PROTOCOL_VERSIONS)-1]
+	assert.Equal(t, string(last), negotiate(newTestServer(), "1999-01-01"))
+	assert.Equal(t, string(LATEST_PROTOCOL_VERSION), negotiate(newTestServer(), string(LATEST_PROTOCOL_VERSION)))
+}
+
+func TestSendRequestChecksClientCapabilities(t *testing.T) {
+	s := newTestServer()
+	ctx := session.WithNewSession(context.Background())
+	initialize(t, s, ctx, `{}`)
+
+	_, err := s.CreateMessage(ctx, mcp.CreateMessageRequestParams{MaxTokens: 10})
+	assert.ErrorIs(t, err, ErrClientDoesNotSupportSampling)
+
+	_, err = s.ListRoots(ctx)
+	assert.ErrorIs(t, err, ErrClientDoesNotSupportRoots)
+}
+
+func TestListRootsRoundTrip(t *testing.T) {
+	s := newTestServer()
+	ctx := session.WithNewSession(context.Background())
+	initialize(t, s, ctx, `{"roots":{}}`)
+
+	handled := make(chan struct{})
+	go func() {
+		req := <-s.GetRequests()
+		data, err := json.Marshal(req)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"method":"roots/list"}`, string(data))
+		s.Handle(ctx, []byte(`{"jsonrpc":"2.0","id":1,"result":{"roots":[{"uri":"file:///tmp"}]}}`))
+		// duplicate response has nobody to go to and must not block
+		s.Handle(ctx, []byte(`{"jsonrpc":"2.0","id":1,"result":{"roots":[]}}`))
+		close(handled)
+	}()
+
+	timeout, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	res, err := s.ListRoots(timeout)
+	require.NoError(t, err)
+	require.Len(t, res.Roots, 1)
+	assert.Equal(t, "file:///tmp", res.Roots[0].Uri)
+
+	select {
+	case <-handled:
+	case <-timeout.Done():
+		t.Fatal("duplicate response blocked handling")
+	}
+}
+
+func TestNotifySendsNotificationWithoutId(t *testing.T) {
+	s := newTestServer()
+	ctx := session.WithNewSession(context.Background())
+
+	timeout, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	go func() {
+		assert.NoError(t, s.Notify(timeout, &mcp.ToolListChangedNotification{}))
+	}()
+
+	data, err := json.Marshal(<-s.GetRequests())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","method":"notifications/tools/list_changed"}`, string(data))
+
+	disabled := NewServer(&mcp.ServerCapabilities{}, &mcp.Implementation{}, DisableServerRequestsOption{})
+	assert.ErrorIs(t, disabled.Notify(timeout, &mcp.ToolListChangedNotification{}), ErrServerRequestsNotSupported)
+}
+
+func TestValidateProtocolVersionHeader(t *testing.T) {
+	s := newTestServer()
+	ctx := session.WithNewSession(context.Background())
+
+	assert.NoError(t, ValidateProtocolVersionHeader(ctx, ""))
+	assert.ErrorIs(t, ValidateProtocolVersionHeader(ctx, "1999-01-01"), ErrUnsupportedProtocolVersion)
+
+	initialize(t, s, ctx, `{}`)
+	assert.NoError(t, ValidateProtocolVersionHeader(ctx, "2024-11-05"))
+	assert.ErrorIs(t, ValidateProtocolVersionHeader(ctx, "2025-03-26"), ErrProtocolVersionMismatch)
+}
+
+func TestLifecycleIsEnforced(t *testing.T) {
+	initialized := make(chan string, 1)
+	shutdown := make(chan struct{}, 2)
+	s := NewServer(&mcp.ServerCapabilities{}, &mcp.Implementation{Name: "TestServer", Version: "0.0.0"},
+		OnInitializedOption{Callback: func(ctx context.Context) {
+			sess, _ := session.FromContext(ctx)
+			initialized <- sess.ClientInfo().Name
+		}},
+		OnShutdownOption{Callback: func(ctx context.Context) {
+			shutdown <- struct{}{}
+		}},
+	)
+	s.SetRequestHandler(&mcp.ListToolsRequest{}, func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
+		return &mcp.ListToolsResult{Tools: []mcp.Tool{}}, nil
+	})
+	ctx := session.WithNewSession(context.Background())
+
+	listTools := func() *jsonrpc2.JsonRpcResponse {
+		responses := s.HandleAndGetResponses(ctx, []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+		require.Len(t, responses, 1)
+		return responses[0]
+	}
+
+	assert.Equal(t, LifecycleUninitialized, s.GetLifecycleState())
+	res := listTools()
+	require.NotNil(t, res.Error)
+	assert.Equal(t, ServerNotInitialized, res.Error.Code)
+
+	ping := s.HandleAndGetResponses(ctx, []byte(`{"jsonrpc":"2.0","id":2,"method":"ping"}`))
+	require.Len(t, ping, 1)
+	assert.Nil(t, ping[0].Error)
+
+	initialize(t, s, ctx, `{}`)
+	assert.Equal(t, LifecycleInitializing, s.GetLifecycleState())
+	res = listTools()
+	require.NotNil(t, res.Error)
+	assert.Equal(t, ServerNotInitialized, res.Error.Code)
+
+	again := s.HandleAndGetResponses(ctx, []byte(`{"jsonrpc":"2.0","id":3,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"c","version":"0"}}}`))
+	require.Len(t, again, 1)
+	require.NotNil(t, again[0].Error)
+	assert.Equal(t, -32600, again[0].Error.Code)
+
+	s.Handle(ctx, []byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`))
+	assert.Equal(t, LifecycleReady, s.GetLifecycleState())
+	select {
+	case name := <-initialized:
+		assert.Equal(t, "TestClient", name)
+	case <-time.After(5 * time.Second):
+		t.Fatal("initialized callback was not called")
+	}
+	res = listTools()
+	assert.Nil(t, res.Error)
+
+	s.Shutdown(ctx)
+	s.Shutdown(ctx)
+	assert.Len(t, shutdown, 1)
+	assert.Equal(t, LifecycleShuttingDown, s.GetLifecycleState())
+	res = listTools()
+	require.NotNil(t, res.Error)
+	assert.Equal(t, ServerShuttingDown, res.Error.Code)
+}
+
+func TestMiddlewareOption(t *testing.T) {
+	var calls []string
+	s := NewServer(&mcp.ServerCapabilities{}, &mcp.Implementation{Name: "TestServer", Version: "0.0.0"},
+		MiddlewareOption{Middleware: func(next jsonrpc2.CallHandler) jsonrpc2.CallHandler {
+			return func(ctx context.Context, call *jsonrpc2.Call) (jsonrpc2.Result, *jsonrpc2.Error) {
+				res, err := next(ctx, call)
+				calls = append(calls, fmt.Sprintf("%s %v", call.Method, err == nil))
+				return res, err
+			}
+		}},
+	)
+	ctx := session.WithNewSession(context.Background())
+
+	s.HandleAndGetResponses(ctx, []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+	initialize(t, s, ctx, `{}`)
+	s.HandleAndGetResponses(ctx, []byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`))
+
+	assert.Equal(t, []string{
+		"tools/list false",
+		"initialize true",
+		"notifications/initialized true",
+	}, calls)
+}
+
+type recordingSink struct {
+	records []wiretrace.Record
+}
+
+func (s *recordingSink) Write(record wiretrace.Record) {
+	s.records = append(s.records, record)
+}
+
+func TestWireTraceOption(t *testing.T) {
+	sink := &recordingSink{}
+	s := NewServer(&mcp.ServerCapabilities{}, &mcp.Implementation{Name: "TestServer", Version: "0.0.0"},
+		WireTraceOption{Tracer: wiretrace.NewTracer(sink)},
+	)
+	ctx := session.WithNewSession(context.Background())
+	sess, _ := session.FromContext(ctx)
+
+	s.HandleAndGetResponses(ctx, []byte(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	go func() { <-s.GetRequests() }()
+	require.NoError(t, s.Notify(context.Background(), &mcp.ToolListChangedNotification{}))
+
+	require.Len(t, sink.records, 3)
+	for _, record := range sink.records {
+		assert.Equal(t, sess.SessionID.String(), record.SessionId)
+	}
+	assert.Equal(t, wiretrace.Inbound, sink.records[0].Direction)
+	assert.Equal(t, wiretrace.Outbound, sink.records[1].Direction)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","result":{},"id":1}`, string(sink.records[1].Message))
+	assert.Positive(t, sink.records[1].Latency)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","method":"notifications/tools/list_changed"}`, string(sink.records[2].Message))
+}
+
+type recordingLogger struct {
+	mu     sync.Mutex
+	events []foxyevent.Event
+}
+
+func (l *recordingLogger) LogEvent(e foxyevent.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, e)
+}
+
+func (l *recordingLogger) Events() []foxyevent.Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]foxyevent.Event(nil), l.events...)
+}
+
+type panicRequest struct{}
+
+func (panicRequest) GetMethod() string {
+	return "vendor/panic"
+}
+
+func TestEvents(t *testing.T) {
+	logger := &recordingLogger{}
+	s := NewServer(&mcp.ServerCapabilities{}, &mcp.Implementation{Name: "TestServer", Version: "0.0.0"},
+		LoggerOption{Logger: logger},
+	)
+	jsonrpc2.Handle(s, func(ctx context.Context, req *panicRequest) (*struct{}, *jsonrpc2.Error) {
+		panic("handler is broken")
+	})
+	ctx := session.WithNewSession(context.Background())
+	sess, _ := session.FromContext(ctx)
+	sessionId := sess.SessionID.String()
+
+	initialize(t, s, ctx, `{}`)
+	s.HandleAndGetResponses(ctx, []byte(`{"jsonrpc":"2.0","method":"notifications/initialized"}`))
+	responses := s.HandleAndGetResponses(ctx, []byte(`{"jsonrpc":"2.0","id":"u","method":"vendor/unknown"}`))
+	require.Len(t, responses, 1)
+	responses = s.HandleAndGetResponses(ctx, []byte(`{"jsonrpc":"2.0","id":2,"method":"vendor/panic"}`))
+	require.Len(t, responses, 1)
+	require.NotNil(t, responses[0].Error)
+	assert.Equal(t, jsonrpc2.InternalError, responses[0].Error.Code)
+	assert.NotContains(t, fmt.Sprint(responses[0].Error.Data), "handler is broken")
+
+	var events []foxyevent.Event
+	for _, event := range logger.Events() {
+		switch e := event.(type) {
+		case foxyevent.RequestCompleted:
+			e.Duration = 0
+			events = append(events, e)
+		case foxyevent.PanicRecovered:
+			assert.Contains(t, e.Stack, "TestEvents")
+			e.Stack = ""
+			events = append(events, e)
+		default:
+			events = append(events, e)
+		}
+	}
+	assert.Equal(t, []foxyevent.Event{
+		foxyevent.RequestReceived{SessionId: sessionId, RequestId: "0", Method: "initialize"},
+		foxyevent.SessionInitialized{
+			SessionId:        sessionId,
+			RequestId:        "0",
+			ClientName:       "TestClient",
+			ClientVersion:    "1.2.3",
+			RequestedVersion: "2024-11-05",
+			ProtocolVersion:  "2024-11-05",
+		},
+		foxyevent.RequestCompleted{SessionId: sessionId, RequestId: "0", Method: "initialize"},
+		foxyevent.NotificationReceived{SessionId: sessionId, Method: "notifications/initialized"},
+		foxyevent.RequestReceived{SessionId: sessionId, RequestId: "u", Method: "vendor/unknown"},
+		foxyevent.UnknownMethod{SessionId: sessionId, RequestId: "u", Method: "vendor/unknown"},
+		foxyevent.RequestCompleted{
+			SessionId:    sessionId,
+			RequestId:    "u",
+			Method:       "vendor/unknown",
+			ErrorCode:    jsonrpc2.MethodNotFound,
+			ErrorMessage: "Method not found",
+		},
+		foxyevent.RequestReceived{SessionId: sessionId, RequestId: "2", Method: "vendor/panic"},
+		foxyevent.PanicRecovered{SessionId: sessionId, RequestId: "2", Method: "vendor/panic", Value: "handler is broken"},
+		foxyevent.RequestCompleted{
+			SessionId:    sessionId,
+			RequestId:    "2",
+			Method:       "vendor/panic",
+			ErrorCode:    jsonrpc2.InternalError,
+			ErrorMessage: "Internal error",
+		},
+	}, events)
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"net"
 
 	"github.com/strowk/foxy-contexts/pkg/mcp"
 	"github.com/strowk/foxy-contexts/pkg/session"
@@ -18,3 +19,25 @@ type Transport interface {
 
 	GetSessionManager() *session.SessionManager
 }
+
+// ListeningTransport is implemented by transports that accept connections
+// on network listener, it allows to find out which address was bound,
+// for example when transport was asked to listen on port 0.
+type ListeningTransport interface {
+	Transport
+
+	// Addr returns address transport is listening on,
+	// or nil if it is not listening yet
+	Addr() net.Addr
+}
+
+// SessionSharingTransport is implemented by transports that can keep
+// their sessions in session manager shared with other transports,
+// so that sessions of all transports of the application are found in one place.
+type SessionSharingTransport interface {
+	Transport
+
+	// SetSessionManager replaces session manager of transport,
+	// it must be called before transport is run
+	SetSessionManager(*session.SessionManager)
+}
@@ -1,5 +1,13 @@
 package server
 
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/strowk/foxy-contexts/pkg/session"
+)
+
 type ProtocolVersion string
 
 const (
@@ -13,6 +21,10 @@ const (
 	MINIMAL_FOR_STREAMABLE_HTTP ProtocolVersion = V2025_03_26
 
 	LATEST_PROTOCOL_VERSION = V2025_03_26
+
+	// PROTOCOL_VERSION_HEADER is the HTTP header that clients use to tell
+	// which protocol version they are using after initialization.
+	PROTOCOL_VERSION_HEADER = "MCP-Protocol-Version"
 )
 
 var (
@@ -21,3 +33,40 @@ var (
 		V2024_11_05,
 	}
 )
+
+var (
+	ErrUnsupportedProtocolVersion = errors.New("unsupported protocol version")
+	ErrProtocolVersionMismatch    = errors.New("protocol version does not match negotiated version")
+)
+
+// ValidateProtocolVersionHeader checks value of PROTOCOL_VERSION_HEADER sent by client
+// against the version negotiated for session found in ctx.
+//
+// Missing header is accepted for backwards compatibility with clients
+// that do not send it.
+func ValidateProtocolVersionHeader(ctx context.Context, header string) error {
+	if header == "" {
+		return nil
+	}
+
+	supported := false
+	for _, version := range SUPPORTED_PROTOCOL_VERSIONS {
+		if string(version) == header {
+			supported = true
+			break
+		}
+	}
+	if !supported {
+		return fmt.Errorf("%w: %s", ErrUnsupportedProtocolVersion, header)
+	}
+
+	sess, ok := session.FromContext(ctx)
+	if !ok {
+		return nil
+	}
+	negotiated := sess.ProtocolVersion()
+	if negotiated != "" && negotiated != header {
+		return fmt.Errorf("%w: got %s, negotiated %s", ErrProtocolVersionMismatch, header, negotiated)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/strowk/foxy-contexts/pkg/session"
+	"github.com/strowk/foxy-contexts/pkg/wiretrace"
+)
+
+// WireTraceOption makes server trace every message it receives
+// from client and sends to it, see package wiretrace.
+type WireTraceOption struct {
+	Tracer *wiretrace.Tracer
+}
+
+func (o WireTraceOption) apply(s *server) {
+	s.tracer = o.Tracer
+}
+
+// traceSessionId returns id of the session from ctx, or of the session
+// seen before, as server requests can be sent with context without session
+func (s *server) traceSessionId(ctx context.Context) string {
+	if sess, ok := session.FromContext(ctx); ok {
+		id := sess.SessionID.String()
+		s.tracedSessionId.Store(&id)
+		return id
+	}
+	if id := s.tracedSessionId.Load(); id != nil {
+		return *id
+	}
+	return ""
+}
+
+func (s *server) traceMessage(ctx context.Context, direction wiretrace.Direction, message []byte) {
+	if !s.tracer.Enabled() {
+		return
+	}
+	s.tracer.Trace(s.traceSessionId(ctx), direction, message)
+}
+
+// traceSent traces response or request, which is only marshalled
+// for tracing when tracer is enabled
+func (s *server) traceSent(ctx context.Context, message json.Marshaler) {
+	if !s.tracer.Enabled() {
+		return
+	}
+	data, err := message.MarshalJSON()
+	if err != nil {
+		// transport would fail to send it as well and log that
+		return
+	}
+	s.tracer.Trace(s.traceSessionId(ctx), wiretrace.Outbound, data)
+}
+
+// forgetTraced drops requests of the traced session, which would
+// never be answered after server has shut down
+func (s *server) forgetTraced() {
+	if id := s.tracedSessionId.Load(); id != nil {
+		s.tracer.Forget(*id)
+	}
+}
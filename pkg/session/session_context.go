@@ -17,6 +17,12 @@ func getSessionFromContext(ctx context.Context) (*Session, bool) {
 	return session, ok
 }
 
+// FromContext returns the session that is being served in given context,
+// which is how handlers can find out which client they are talking to.
+func FromContext(ctx context.Context) (*Session, bool) {
+	return getSessionFromContext(ctx)
+}
+
 func WithSession(ctx context.Context, session *Session) context.Context {
 	return context.WithValue(ctx, sessionKey, session)
 }
@@ -1,14 +1,26 @@
 package session
 
 import (
+	"bytes"
 	"context"
+	"crypto/x509"
+	"errors"
+	"sync"
 
 	"github.com/google/uuid"
+	"github.com/strowk/foxy-contexts/pkg/auth"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+)
+
+var (
+	ErrPrincipalMismatch = errors.New("session belongs to another principal")
+	ErrPeerMismatch      = errors.New("session belongs to another TLS peer")
 )
 
 // SessionManager is a struct that can manage MCP sessions.
 type SessionManager struct {
-	sessions map[uuid.UUID]*Session
+	sessions   map[uuid.UUID]*Session
+	sessionsMu sync.RWMutex
 }
 
 func NewSessionManager() *SessionManager {
@@ -38,7 +50,7 @@ func (sm *SessionManager) GetSessionFromContext(ctx context.Context) (*Session,
 	session, ok := getSessionFromContext(ctx)
 	// double check if was not removed from the session manager
 	if ok {
-		_, ok = sm.sessions[session.SessionID]
+		_, ok = sm.FindSessionById(session.SessionID)
 	}
 	if !ok {
 		return nil, false
@@ -48,6 +60,8 @@ func (sm *SessionManager) GetSessionFromContext(ctx context.Context) (*Session,
 }
 
 func (sm *SessionManager) FindSessionById(sessionId uuid.UUID) (*Session, bool) {
+	sm.sessionsMu.RLock()
+	defer sm.sessionsMu.RUnlock()
 	session, ok := sm.sessions[sessionId]
 	return session, ok
 }
@@ -66,6 +80,8 @@ func (sm *SessionManager) ResolveSessionOrCreateNew(
 }
 
 func (sm *SessionManager) DeleteSession(sessionId uuid.UUID) {
+	sm.sessionsMu.Lock()
+	defer sm.sessionsMu.Unlock()
 	delete(sm.sessions, sessionId)
 }
 
@@ -83,6 +99,8 @@ func (sm *SessionManager) CreateNewSession(
 }
 
 func (sm *SessionManager) saveSession(session *Session) {
+	sm.sessionsMu.Lock()
+	defer sm.sessionsMu.Unlock()
 	sm.sessions[session.SessionID] = session
 }
 
@@ -91,6 +109,97 @@ type Session struct {
 	SessionID uuid.UUID
 	// SessionData is the state of the session.
 	SessionData SessionData
+
+	mu                 sync.RWMutex
+	clientInfo         *mcp.Implementation
+	clientCapabilities *mcp.ClientCapabilities
+	protocolVersion    string
+	principal          *auth.Principal
+	peerCertificate    *x509.Certificate
+}
+
+// SetInitialized records what client has told about itself during initialization
+// and the protocol version that server has negotiated with it.
+func (s *Session) SetInitialized(
+	clientInfo mcp.Implementation,
+	clientCapabilities mcp.ClientCapabilities,
+	protocolVersion string,
+) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clientInfo = &clientInfo
+	s.clientCapabilities = &clientCapabilities
+	s.protocolVersion = protocolVersion
+}
+
+// ClientInfo returns name and version of the client,
+// or nil if client has not initialized the session yet.
+func (s *Session) ClientInfo() *mcp.Implementation {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.clientInfo
+}
+
+// ClientCapabilities returns capabilities declared by the client,
+// or nil if client has not initialized the session yet.
+func (s *Session) ClientCapabilities() *mcp.ClientCapabilities {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.clientCapabilities
+}
+
+// ProtocolVersion returns protocol version negotiated with the client,
+// or empty string if client has not initialized the session yet.
+func (s *Session) ProtocolVersion() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.protocolVersion
+}
+
+// BindPrincipal attaches authenticated principal to the session,
+// so that session could not be continued by another user.
+//
+// First principal is remembered, later requests must be made
+// by principal with the same subject, otherwise ErrPrincipalMismatch is returned.
+func (s *Session) BindPrincipal(principal *auth.Principal) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.principal != nil && (principal == nil || s.principal.Subject != principal.Subject) {
+		return ErrPrincipalMismatch
+	}
+	s.principal = principal
+	return nil
+}
+
+// Principal returns authenticated principal that the session belongs to,
+// or nil if transport does not authenticate clients.
+func (s *Session) Principal() *auth.Principal {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.principal
+}
+
+// BindPeerCertificate attaches client certificate presented during TLS handshake
+// to the session, so that session could not be continued by another peer.
+//
+// Later requests must present the very same certificate,
+// otherwise ErrPeerMismatch is returned.
+func (s *Session) BindPeerCertificate(cert *x509.Certificate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.peerCertificate != nil && (cert == nil || !bytes.Equal(s.peerCertificate.Raw, cert.Raw)) {
+		return ErrPeerMismatch
+	}
+	s.peerCertificate = cert
+	return nil
+}
+
+// PeerCertificate returns client certificate of the TLS peer that the session
+// belongs to, or nil if client has not presented any.
+func (s *Session) PeerCertificate() *x509.Certificate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.peerCertificate
 }
 
 type SessionData interface {
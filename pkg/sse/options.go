@@ -1,6 +1,18 @@
 package sse
 
-import "time"
+import (
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/strowk/foxy-contexts/pkg/auth"
+	"github.com/strowk/foxy-contexts/pkg/listener"
+	"github.com/strowk/foxy-contexts/pkg/metrics"
+	"github.com/strowk/foxy-contexts/pkg/origin"
+	"github.com/strowk/foxy-contexts/pkg/tlsconfig"
+)
 
 type KeepAliveOption struct {
 	Interval time.Duration
@@ -18,6 +30,238 @@ func (o PortOption) apply(t *sseTransport) {
 	t.port = o.Port
 }
 
+// HostnameOption sets interface transport listens on, default is 127.0.0.1
+type HostnameOption struct {
+	Hostname string
+}
+
+func (o HostnameOption) apply(t *sseTransport) {
+	t.hostname = o.Hostname
+}
+
+// ListenerOption makes transport serve on pre-opened listener
+// instead of listening on hostname and port, transport takes
+// ownership of the listener and closes it on shutdown.
+type ListenerOption struct {
+	Listener net.Listener
+}
+
+func (o ListenerOption) apply(t *sseTransport) {
+	t.listen = func() (net.Listener, error) {
+		return o.Listener, nil
+	}
+}
+
+// UnixSocketOption makes transport listen on unix domain socket,
+// see listener.Unix for details.
+type UnixSocketOption struct {
+	Path string
+	Mode os.FileMode
+}
+
+func (o UnixSocketOption) apply(t *sseTransport) {
+	t.listen = func() (net.Listener, error) {
+		return listener.Unix(o.Path, o.Mode)
+	}
+}
+
+// SystemdSocketOption makes transport serve on socket passed
+// by systemd socket activation, see listener.Systemd for details.
+type SystemdSocketOption struct {
+	Name string
+}
+
+func (o SystemdSocketOption) apply(t *sseTransport) {
+	t.listen = func() (net.Listener, error) {
+		return listener.Systemd(o.Name)
+	}
+}
+
+// AuthOption requires clients to authenticate with bearer tokens,
+// see auth.Config for details.
+type AuthOption struct {
+	Config auth.Config
+}
+
+func (o AuthOption) apply(t *sseTransport) {
+	config := o.Config
+	t.auth = &config
+}
+
+func WithAuth(config auth.Config) SSETransportOption {
+	return AuthOption{
+		Config: config,
+	}
+}
+
+// OriginValidationOption configures which values of Origin and Host headers
+// are accepted, by default requests arriving on loopback interface
+// are only allowed from localhost.
+type OriginValidationOption struct {
+	Config origin.Config
+}
+
+func (o OriginValidationOption) apply(t *sseTransport) {
+	config := o.Config
+	t.origin = &config
+}
+
+func WithOriginValidation(config origin.Config) SSETransportOption {
+	return OriginValidationOption{
+		Config: config,
+	}
+}
+
+// TLSOption makes transport serve HTTPS, see tlsconfig.Config for details.
+type TLSOption struct {
+	Config tlsconfig.Config
+}
+
+func (o TLSOption) apply(t *sseTransport) {
+	config := o.Config
+	t.tls = &config
+}
+
+func WithTLS(config tlsconfig.Config) SSETransportOption {
+	return TLSOption{
+		Config: config,
+	}
+}
+
+// MountOption makes transport serve its endpoints from caller-supplied
+// echo instance or http.ServeMux instead of listening on its own port.
+//
+// Transport is also an http.Handler, so when neither Echo nor ServeMux
+// is set, it can be mounted into any router.
+type MountOption struct {
+	Echo     *echo.Echo
+	ServeMux *http.ServeMux
+}
+
+func (o MountOption) apply(t *sseTransport) {
+	t.mount = &o
+}
+
+func (o MountOption) register(t *sseTransport) {
+	paths := []string{"/sse", "/message"}
+	if t.auth != nil && t.auth.Metadata != nil {
+		paths = append(paths, auth.PROTECTED_RESOURCE_METADATA_PATH)
+	}
+	if t.metrics != nil {
+		paths = append(paths, t.metricsPath)
+	}
+	for _, path := range paths {
+		if o.Echo != nil {
+			o.Echo.Any(path, echo.WrapHandler(t))
+		}
+		if o.ServeMux != nil {
+			o.ServeMux.Handle(path, t)
+		}
+	}
+}
+
+// HTTPMiddlewareOption wraps every HTTP request served by transport
+// into given middleware, for example to extract tracing headers or collect
+// metrics. Middlewares run in the order they are given, before any other
+// processing of request by transport, including validation of origin.
+type HTTPMiddlewareOption struct {
+	Middleware func(http.Handler) http.Handler
+}
+
+func (o HTTPMiddlewareOption) apply(t *sseTransport) {
+	t.httpMiddlewares = append(t.httpMiddlewares, o.Middleware)
+}
+
+func WithHTTPMiddleware(middleware func(http.Handler) http.Handler) SSETransportOption {
+	return HTTPMiddlewareOption{
+		Middleware: middleware,
+	}
+}
+
+// MetricsOption collects metrics of requests, sessions, streams and traffic
+// and serves them at Path in Prometheus text format, see package metrics.
+//
+// When Metrics is nil, new one is created, when Path is empty,
+// metrics.DEFAULT_PATH is used. Metrics endpoint does not require
+// authentication configured by AuthOption.
+type MetricsOption struct {
+	Metrics *metrics.Metrics
+	Path    string
+}
+
+func (o MetricsOption) apply(t *sseTransport) {
+	t.metrics = o.Metrics
+	if t.metrics == nil {
+		t.metrics = metrics.New()
+	}
+	t.metricsPath = o.Path
+	if t.metricsPath == "" {
+		t.metricsPath = metrics.DEFAULT_PATH
+	}
+}
+
+// WithMetrics serves metrics collected into m at /metrics
+func WithMetrics(m *metrics.Metrics) SSETransportOption {
+	return MetricsOption{
+		Metrics: m,
+	}
+}
+
+// WithEcho registers transport endpoints on given echo instance
+func WithEcho(e *echo.Echo) SSETransportOption {
+	return MountOption{
+		Echo: e,
+	}
+}
+
+// WithServeMux registers transport endpoints on given mux
+func WithServeMux(mux *http.ServeMux) SSETransportOption {
+	return MountOption{
+		ServeMux: mux,
+	}
+}
+
+// WithoutListener makes transport not listen on its own port,
+// so that it could be served as http.Handler
+func WithoutListener() SSETransportOption {
+	return MountOption{}
+}
+
+// WithHostname makes transport listen on given interface,
+// use "0.0.0.0" to accept connections from other machines
+func WithHostname(hostname string) SSETransportOption {
+	return HostnameOption{
+		Hostname: hostname,
+	}
+}
+
+// WithListener makes transport serve on given listener
+func WithListener(l net.Listener) SSETransportOption {
+	return ListenerOption{
+		Listener: l,
+	}
+}
+
+// WithUnixSocket makes transport listen on unix domain socket at path,
+// setting socket file permissions to mode when it is not zero
+func WithUnixSocket(path string, mode os.FileMode) SSETransportOption {
+	return UnixSocketOption{
+		Path: path,
+		Mode: mode,
+	}
+}
+
+// WithSystemdSocket makes transport serve on socket passed by systemd
+// with given FileDescriptorName=, or the first one when name is empty
+func WithSystemdSocket(name string) SSETransportOption {
+	return SystemdSocketOption{
+		Name: name,
+	}
+}
+
+// WithPort sets port transport listens on, when it is not set or is 0,
+// the system chooses free port, which can be read back from
+// server.ListeningTransport.Addr
 func WithPort(port int) SSETransportOption {
 	return PortOption{
 		Port: port,
@@ -3,11 +3,16 @@ package sse
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"regexp"
 )
 
+// ErrNoData is returned by DecodeEvent for events without data,
+// such as comments sent to keep connection alive
+var ErrNoData = errors.New("no data found in event")
+
 type Event struct {
 	ID    []byte
 	Data  []byte
@@ -112,7 +117,7 @@ func DecodeEvent(r *bufio.Reader) (*Event, error) {
 		readPartialEvent = true
 	}
 	if len(ev.Data) == 0 {
-		return nil, fmt.Errorf("no data found in event")
+		return nil, ErrNoData
 	}
 
 	return &ev, nil
@@ -2,6 +2,8 @@ package sse
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"io"
 	"net"
 	"net/http"
@@ -9,11 +11,16 @@ import (
 	"sync"
 	"time"
 
+	"github.com/strowk/foxy-contexts/pkg/auth"
+	"github.com/strowk/foxy-contexts/pkg/drain"
 	foxyevent "github.com/strowk/foxy-contexts/pkg/foxy_event"
 	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
 	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/metrics"
+	"github.com/strowk/foxy-contexts/pkg/origin"
 	"github.com/strowk/foxy-contexts/pkg/server"
 	"github.com/strowk/foxy-contexts/pkg/session"
+	"github.com/strowk/foxy-contexts/pkg/tlsconfig"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
@@ -30,6 +37,7 @@ type SSETransportOption interface {
 func NewTransport(options ...SSETransportOption) server.Transport {
 	tp := &sseTransport{
 		keepAliveInterval: 5 * time.Second,
+		hostname:          "127.0.0.1",
 
 		sessionManager: session.NewSessionManager(),
 	}
@@ -37,6 +45,14 @@ func NewTransport(options ...SSETransportOption) server.Transport {
 	for _, o := range options {
 		o.apply(tp)
 	}
+	if tp.listen == nil {
+		tp.listen = tp.listenTCP
+	}
+
+	tp.e = tp.newEcho()
+	if tp.mount != nil {
+		tp.mount.register(tp)
+	}
 
 	return tp
 }
@@ -45,7 +61,35 @@ type sseTransport struct {
 	keepAliveInterval time.Duration
 	e                 *echo.Echo
 	port              int
+	hostname          string
 	sessionManager    *session.SessionManager
+	auth              *auth.Config
+	origin            *origin.Config
+	tls               *tlsconfig.Config
+	mount             *MountOption
+	// httpMiddlewares wrap every HTTP request served by transport
+	httpMiddlewares []func(http.Handler) http.Handler
+	// metrics collects metrics served at metricsPath, if set
+	metrics     *metrics.Metrics
+	metricsPath string
+
+	// listen opens listener when transport is run, by default
+	// it listens on TCP hostname and port
+	listen func() (net.Listener, error)
+	// addr is the address transport is listening on
+	addr   net.Addr
+	addrMu sync.RWMutex
+
+	// servers holds server.Server for every session by its uuid.UUID
+	servers sync.Map
+
+	// lifecycle tracks open SSE streams and messages posted by clients,
+	// that are being handled, to close streams on shutdown
+	lifecycle drain.Lifecycle
+
+	capabilities  *mcp.ServerCapabilities
+	serverInfo    *mcp.Implementation
+	serverOptions []server.ServerOption
 }
 
 func newResponseEvent(res jsonrpc2.JsonRpcResponse) (*Event, error) {
@@ -60,28 +104,139 @@ func newResponseEvent(res jsonrpc2.JsonRpcResponse) (*Event, error) {
 	}, nil
 }
 
+func newRequestEvent(req jsonrpc2.JsonRpcRequest) (*Event, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Event{
+		Event: []byte("message"),
+		Data:  data,
+	}, nil
+}
+
 func (s *sseTransport) Run(
 	capabilities *mcp.ServerCapabilities,
 	serverInfo *mcp.Implementation,
 	options ...server.ServerOption,
 ) error {
+	s.capabilities = capabilities
+	s.serverInfo = serverInfo
+	s.serverOptions = append(options, s.metrics.ServerOptions()...)
+	s.lifecycle.Start()
+
+	if s.mount != nil {
+		// listener is owned by the caller, so transport
+		// is only running until it is shut down
+		<-s.lifecycle.Stopping()
+		return nil
+	}
+
+	var tlsConfig *tls.Config
+	if s.tls != nil {
+		var err error
+		tlsConfig, err = s.tls.Build()
+		if err != nil {
+			return err
+		}
+	}
+
+	l, err := s.listen()
+	if err != nil {
+		return err
+	}
+	s.addrMu.Lock()
+	s.addr = l.Addr()
+	s.addrMu.Unlock()
+
+	e := s.e
+	if tlsConfig != nil {
+		e.TLSListener = tls.NewListener(l, tlsConfig)
+		e.TLSServer.TLSConfig = tlsConfig
+		return e.StartServer(e.TLSServer)
+	}
+	e.Listener = l
+	return e.StartServer(e.Server)
+}
+
+func (s *sseTransport) listenTCP() (net.Listener, error) {
+	return net.Listen("tcp", net.JoinHostPort(s.hostname, strconv.Itoa(s.port)))
+}
+
+// Addr returns address transport is listening on,
+// or nil if it is mounted or not listening yet.
+func (s *sseTransport) Addr() net.Addr {
+	s.addrMu.RLock()
+	defer s.addrMu.RUnlock()
+	return s.addr
+}
+
+// newEcho creates echo instance serving endpoints of the transport,
+// which is used both when transport owns listener and when it is mounted
+func (s *sseTransport) newEcho() *echo.Echo {
 	e := echo.New()
-	s.e = e
 
 	// e.Use(middleware.Logger())
 
-	servers := sync.Map{}
-
 	postEndpoint := "/message"
 
+	for _, middleware := range s.httpMiddlewares {
+		e.Use(echo.WrapMiddleware(middleware))
+	}
+
+	e.Use(s.available)
+
+	if s.origin != nil {
+		e.Use(origin.Middleware(*s.origin))
+	} else {
+		e.Use(origin.LocalhostMiddleware())
+	}
+
+	var middlewares []echo.MiddlewareFunc
+	if s.metrics != nil {
+		e.GET(s.metricsPath, echo.WrapHandler(s.metrics))
+		middlewares = append(middlewares, echo.WrapMiddleware(s.metrics.HTTPMiddleware))
+	}
+	if s.auth != nil {
+		middlewares = append(middlewares, echo.WrapMiddleware(auth.Middleware(*s.auth)))
+		if s.auth.Metadata != nil {
+			e.GET(auth.PROTECTED_RESOURCE_METADATA_PATH, echo.WrapHandler(auth.MetadataHandler(*s.auth)))
+		}
+	}
+
 	e.GET("/sse", func(c echo.Context) error {
+		if !s.lifecycle.BeginConnection() {
+			return c.String(http.StatusServiceUnavailable, drain.ErrShuttingDown.Error())
+		}
+		defer s.lifecycle.EndConnection()
+
 		sessionId := uuid.New()
-		srv := server.NewServer(capabilities, serverInfo, options...)
-		servers.Store(sessionId, srv)
+		srv := server.NewServer(s.capabilities, s.serverInfo, s.serverOptions...)
+		sessionCtx, sess, err := s.sessionManager.CreateNewSession(context.Background(), &sessionId)
+		if err != nil {
+			srv.GetLogger().LogEvent(foxyevent.FailedCreatingSession{Err: err})
+			return c.String(http.StatusInternalServerError, "failed to create session")
+		}
+		// the one who opened the stream owns the session
+		_ = bindIdentity(c.Request(), sess)
+		if principal, ok := auth.PrincipalFromContext(c.Request().Context()); ok {
+			sessionCtx = auth.WithPrincipal(sessionCtx, principal)
+		}
+		s.servers.Store(sessionId, srv)
+		srv.GetLogger().LogEvent(foxyevent.SessionCreated{SessionId: sessionId.String(), Transport: "sse"})
+		defer func() {
+			s.servers.Delete(sessionId)
+			srv.Shutdown(sessionCtx)
+			s.sessionManager.DeleteSession(sessionId)
+			srv.GetLogger().LogEvent(foxyevent.SessionDeleted{SessionId: sessionId.String(), Transport: "sse"})
+		}()
 		w := c.Response()
 		w.Header().Set("Content-Type", "text/event-stream")
 		w.Header().Set("Cache-Control", "no-cache")
 		w.Header().Set("Connection", "keep-alive")
+		s.metrics.StreamOpened()
+		defer s.metrics.StreamClosed()
 		event := Event{
 			Event: []byte("endpoint"),
 			Data:  []byte(postEndpoint + "?sessionId=" + sessionId.String()),
@@ -93,24 +248,23 @@ func (s *sseTransport) Run(
 
 		ticker := time.NewTicker(s.keepAliveInterval)
 		defer ticker.Stop()
-		srv.GetLogger().LogEvent(foxyevent.SSEClientConnected{ClientIP: c.RealIP()})
-
-		shuttingDown := make(chan struct{})
-		e.Server.RegisterOnShutdown(func() {
-			close(shuttingDown)
-		})
+		srv.GetLogger().LogEvent(foxyevent.SSEClientConnected{SessionId: sessionId.String(), ClientIP: c.RealIP()})
 
 		for {
 			select {
-			case <-shuttingDown:
+			case <-s.lifecycle.Closing():
 				// Protocol does not seem to have a way to notify client about server initiated shutdown
-				// so we would just close the connection to allow server to shutdown and client to reconnect
-				// to, hopefully, a new server instance started by orchestrator
-				servers.Delete(sessionId)
+				// so we would just tell it in comment and close the connection to allow server to shutdown
+				// and client to reconnect to, hopefully, a new server instance started by orchestrator
+				event := CommentEvent{
+					Comment: []byte("shutting down"),
+				}
+				if err := event.MarshalTo(w); err == nil {
+					w.Flush()
+				}
 				return nil
 			case <-c.Request().Context().Done():
-				servers.Delete(sessionId)
-				srv.GetLogger().LogEvent(foxyevent.SSEClientDisconnected{ClientIP: c.RealIP()})
+				srv.GetLogger().LogEvent(foxyevent.SSEClientDisconnected{SessionId: sessionId.String(), ClientIP: c.RealIP()})
 				return nil
 			case res := <-srv.GetResponses():
 				event, err := newResponseEvent(res)
@@ -122,6 +276,16 @@ func (s *sseTransport) Run(
 					srv.GetLogger().LogEvent(foxyevent.SSEFailedMarshalEvent{Err: err})
 				}
 				w.Flush()
+			case req := <-srv.GetRequests():
+				event, err := newRequestEvent(req)
+				if err != nil {
+					srv.GetLogger().LogEvent(foxyevent.SSEFailedCreatingEvent{Err: err})
+					continue
+				}
+				if err := event.MarshalTo(w); err != nil {
+					srv.GetLogger().LogEvent(foxyevent.SSEFailedMarshalEvent{Err: err})
+				}
+				w.Flush()
 			case <-ticker.C:
 				event := CommentEvent{
 					Comment: []byte("keep-alive"),
@@ -132,9 +296,14 @@ func (s *sseTransport) Run(
 				w.Flush()
 			}
 		}
-	})
+	}, middlewares...)
 
 	e.POST(postEndpoint, func(c echo.Context) error {
+		if !s.lifecycle.Requests.Begin() {
+			return c.String(http.StatusServiceUnavailable, drain.ErrShuttingDown.Error())
+		}
+		defer s.lifecycle.Requests.End()
+
 		sessionId := c.QueryParams().Get("sessionId")
 		if sessionId == "" {
 			return c.String(http.StatusBadRequest, "sessionId is required")
@@ -144,7 +313,7 @@ func (s *sseTransport) Run(
 			return c.String(http.StatusBadRequest, "sessionId is not a valid UUID")
 		}
 
-		r, ok := servers.Load(parsedSessionId)
+		r, ok := s.servers.Load(parsedSessionId)
 		if !ok {
 			return c.String(http.StatusNotFound, "session not found")
 		}
@@ -154,25 +323,101 @@ func (s *sseTransport) Run(
 			return c.String(http.StatusInternalServerError, "failed to read request body")
 		}
 
-		ctx, _, err := s.sessionManager.ResolveSessionOrCreateNew(c.Request().Context(), parsedSessionId)
+		ctx, sess, err := s.sessionManager.ResolveSessionOrCreateNew(c.Request().Context(), parsedSessionId)
 		if err != nil {
 			return c.String(http.StatusNotFound, "failed to resolve session")
 		}
 
-		r.(server.Server).Handle(ctx, b)
+		if err := bindIdentity(c.Request(), sess); err != nil {
+			return c.String(http.StatusForbidden, err.Error())
+		}
+
+		if err := server.ValidateProtocolVersionHeader(ctx, c.Request().Header.Get(server.PROTOCOL_VERSION_HEADER)); err != nil {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+
+		srv := r.(server.Server)
+		s.deliver(c.Request().Context(), srv, srv.HandleAndGetResponses(ctx, b))
 		return c.JSON(http.StatusAccepted, "Accepted")
-	})
+	}, middlewares...)
 
-	return e.Start(net.JoinHostPort("127.0.0.1", strconv.Itoa(s.port)))
+	return e
 }
 
-func (s *sseTransport) Shutdown(ctx context.Context) error {
-	if s.e != nil {
-		return s.e.Shutdown(ctx)
+// deliver passes responses to the stream of the session, unless client
+// has gone away or streams are being closed, as then nobody would read them
+func (s *sseTransport) deliver(ctx context.Context, srv server.Server, responses []*jsonrpc2.JsonRpcResponse) {
+	for _, response := range responses {
+		if response == nil {
+			continue
+		}
+		select {
+		case srv.GetResponses() <- *response:
+		case <-ctx.Done():
+			return
+		case <-s.lifecycle.Closing():
+			return
+		}
+	}
+}
+
+// available rejects requests until transport is running and after it has been shut down
+func (s *sseTransport) available(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if err := s.lifecycle.Available(); err != nil {
+			return c.String(http.StatusServiceUnavailable, err.Error())
+		}
+		return next(c)
+	}
+}
+
+// ServeHTTP allows to serve transport from any http.Server or router,
+// which is useful together with WithoutListener option
+func (s *sseTransport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.e.ServeHTTP(w, r)
+}
+
+// bindIdentity makes sure that session is only used by principal
+// and TLS peer that have started it
+func bindIdentity(req *http.Request, sess *session.Session) error {
+	if principal, ok := auth.PrincipalFromContext(req.Context()); ok {
+		if err := sess.BindPrincipal(principal); err != nil {
+			return err
+		}
+	}
+	if cert := tlsconfig.PeerCertificate(req); cert != nil {
+		if err := sess.BindPeerCertificate(cert); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// Shutdown stops accepting new requests and streams, waits for messages
+// in flight to be handled and their responses sent to streams, then
+// closes open streams, ctx bounds how long transport would wait.
+func (s *sseTransport) Shutdown(ctx context.Context) error {
+	var stopServing func(ctx context.Context) error
+	if s.mount == nil {
+		stopServing = s.e.Shutdown
+	}
+	return s.lifecycle.Shutdown(ctx, s.logger(), "sse", stopServing)
+}
+
+// logger returns logger configured for servers once transport is running
+func (s *sseTransport) logger() foxyevent.Logger {
+	select {
+	case <-s.lifecycle.Ready():
+		return server.LoggerFromOptions(s.serverOptions)
+	default:
+		return server.LoggerFromOptions(nil)
+	}
+}
+
 func (s *sseTransport) GetSessionManager() *session.SessionManager {
 	return s.sessionManager
 }
+
+func (s *sseTransport) SetSessionManager(sessionManager *session.SessionManager) {
+	s.sessionManager = sessionManager
+}
@@ -0,0 +1,296 @@
+package sse
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	foxyevent "github.com/strowk/foxy-contexts/pkg/foxy_event"
+	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/server"
+)
+
+func TestMountedTransportDrainsSessionsOnShutdown(t *testing.T) {
+	e := echo.New()
+	tr := NewTransport(WithEcho(e))
+	httpServer := httptest.NewServer(e)
+	defer httpServer.Close()
+
+	shutdownSessions := make(chan struct{}, 1)
+	runDone := make(chan error)
+	go func() {
+		runDone <- tr.Run(&mcp.ServerCapabilities{}, &mcp.Implementation{
+			Name:    "TestServer",
+			Version: "0.0.0",
+		}, server.OnShutdownOption{Callback: func(ctx context.Context) {
+			shutdownSessions <- struct{}{}
+		}})
+	}()
+
+	var resp *http.Response
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		r, err := http.Get(httpServer.URL + "/sse")
+		if !assert.NoError(c, err) {
+			return
+		}
+		if !assert.Equal(c, http.StatusOK, r.StatusCode) {
+			_ = r.Body.Close()
+			return
+		}
+		resp = r
+	}, 5*time.Second, 50*time.Millisecond)
+	defer func() { assert.NoError(t, resp.Body.Close()) }()
+
+	event, err := DecodeEvent(bufio.NewReader(resp.Body))
+	require.NoError(t, err)
+	require.Equal(t, "endpoint", string(event.Event))
+	require.True(t, strings.HasPrefix(string(event.Data), "/message?sessionId="))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, tr.Shutdown(ctx))
+	require.NoError(t, <-runDone)
+	select {
+	case <-shutdownSessions:
+	default:
+		t.Fatal("session was not shut down")
+	}
+}
+
+func TestTransportListensOnChosenPort(t *testing.T) {
+	tr := NewTransport(WithHostname("127.0.0.1"), WithPort(0)).(server.ListeningTransport)
+	runDone := make(chan error)
+	go func() {
+		runDone <- tr.Run(&mcp.ServerCapabilities{}, &mcp.Implementation{
+			Name:    "TestServer",
+			Version: "0.0.0",
+		})
+	}()
+
+	require.Eventually(t, func() bool {
+		return tr.Addr() != nil
+	}, 5*time.Second, 50*time.Millisecond)
+	require.NotZero(t, tr.Addr().(*net.TCPAddr).Port)
+
+	resp, err := http.Get("http://" + tr.Addr().String() + "/sse")
+	require.NoError(t, err)
+	event, err := DecodeEvent(bufio.NewReader(resp.Body))
+	require.NoError(t, err)
+	assert.Equal(t, "endpoint", string(event.Event))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, tr.Shutdown(ctx))
+	assert.ErrorIs(t, <-runDone, http.ErrServerClosed)
+	assert.NoError(t, resp.Body.Close())
+}
+
+type recordingLogger struct {
+	mu     sync.Mutex
+	events []foxyevent.Event
+}
+
+func (l *recordingLogger) LogEvent(e foxyevent.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, e)
+}
+
+func (l *recordingLogger) Events() []foxyevent.Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]foxyevent.Event(nil), l.events...)
+}
+
+func TestShutdownDrainsMessagesInFlight(t *testing.T) {
+	e := echo.New()
+	tr := NewTransport(WithEcho(e))
+	httpServer := httptest.NewServer(e)
+	defer httpServer.Close()
+
+	handling := make(chan struct{})
+	release := make(chan struct{})
+	logger := &recordingLogger{}
+	runDone := make(chan error)
+	go func() {
+		runDone <- tr.Run(&mcp.ServerCapabilities{}, &mcp.Implementation{
+			Name:    "TestServer",
+			Version: "0.0.0",
+		}, server.LoggerOption{Logger: logger}, server.ServerStartCallbackOption{
+			Callback: func(s server.Server) {
+				s.SetRequestHandler(&mcp.ListToolsRequest{}, func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
+					close(handling)
+					<-release
+					return &mcp.ListToolsResult{Tools: []mcp.Tool{}}, nil
+				})
+			},
+		})
+	}()
+
+	var resp *http.Response
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		r, err := http.Get(httpServer.URL + "/sse")
+		if !assert.NoError(c, err) {
+			return
+		}
+		if !assert.Equal(c, http.StatusOK, r.StatusCode) {
+			_ = r.Body.Close()
+			return
+		}
+		resp = r
+	}, 5*time.Second, 50*time.Millisecond)
+	defer func() { assert.NoError(t, resp.Body.Close()) }()
+	stream := bufio.NewReader(resp.Body)
+
+	event, err := DecodeEvent(stream)
+	require.NoError(t, err)
+	messageURL := httpServer.URL + string(event.Data)
+	post := func(msg string) int {
+		r, err := http.Post(messageURL, "application/json", strings.NewReader(msg))
+		require.NoError(t, err)
+		require.NoError(t, r.Body.Close())
+		return r.StatusCode
+	}
+
+	go post(`{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"c","version":"0"}}}`)
+	_, err = DecodeEvent(stream)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusAccepted, post(`{"jsonrpc":"2.0","method":"notifications/initialized"}`))
+
+	posted := make(chan int)
+	go func() {
+		posted <- post(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+	}()
+	<-handling
+
+	shutdownDone := make(chan error)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdownDone <- tr.Shutdown(ctx)
+	}()
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Contains(c, logger.Events(), foxyevent.DrainStarted{Transport: "sse", InFlight: 1})
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, http.StatusServiceUnavailable, post(`{"jsonrpc":"2.0","id":2,"method":"ping"}`),
+		"new messages should be rejected while draining")
+
+	close(release)
+	event, err = DecodeEvent(stream)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":{"tools":[]}}`, string(event.Data))
+	assert.Equal(t, http.StatusAccepted, <-posted)
+
+	rest, err := io.ReadAll(stream)
+	require.NoError(t, err)
+	assert.Contains(t, string(rest), ": shutting down")
+
+	require.NoError(t, <-shutdownDone)
+	require.NoError(t, <-runDone)
+	events := logger.Events()
+	assert.Contains(t, events, foxyevent.DrainClosingStreams{Transport: "sse", Streams: 1})
+	assert.IsType(t, foxyevent.DrainFinished{}, events[len(events)-1])
+}
+
+func TestResponseWithoutStreamDoesNotBlockShutdown(t *testing.T) {
+	e := echo.New()
+	tr := NewTransport(WithEcho(e))
+	httpServer := httptest.NewServer(e)
+	defer httpServer.Close()
+
+	handling := make(chan struct{})
+	release := make(chan struct{})
+	logger := &recordingLogger{}
+	runDone := make(chan error)
+	go func() {
+		runDone <- tr.Run(&mcp.ServerCapabilities{}, &mcp.Implementation{
+			Name:    "TestServer",
+			Version: "0.0.0",
+		}, server.LoggerOption{Logger: logger}, server.ServerStartCallbackOption{
+			Callback: func(s server.Server) {
+				s.SetRequestHandler(&mcp.ListToolsRequest{}, func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
+					close(handling)
+					<-release
+					return &mcp.ListToolsResult{Tools: []mcp.Tool{}}, nil
+				})
+			},
+		})
+	}()
+
+	var resp *http.Response
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		r, err := http.Get(httpServer.URL + "/sse")
+		if !assert.NoError(c, err) {
+			return
+		}
+		if !assert.Equal(c, http.StatusOK, r.StatusCode) {
+			_ = r.Body.Close()
+			return
+		}
+		resp = r
+	}, 5*time.Second, 50*time.Millisecond)
+	stream := bufio.NewReader(resp.Body)
+	event, err := DecodeEvent(stream)
+	require.NoError(t, err)
+	messageURL := httpServer.URL + string(event.Data)
+
+	go func() {
+		r, err := http.Post(messageURL, "application/json", strings.NewReader(`{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"protocolVersion":"2024-11-05","capabilities":{},"clientInfo":{"name":"c","version":"0"}}}`))
+		if err == nil {
+			_ = r.Body.Close()
+		}
+	}()
+	_, err = DecodeEvent(stream)
+	require.NoError(t, err)
+	r, err := http.Post(messageURL, "application/json", strings.NewReader(`{"jsonrpc":"2.0","method":"notifications/initialized"}`))
+	require.NoError(t, err)
+	require.NoError(t, r.Body.Close())
+
+	// client gives up on the request and closes stream, so response has nowhere to go
+	postCtx, cancelPost := context.WithCancel(context.Background())
+	posted := make(chan struct{})
+	go func() {
+		defer close(posted)
+		req, err := http.NewRequestWithContext(postCtx, http.MethodPost, messageURL, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+		if !assert.NoError(t, err) {
+			return
+		}
+		if r, err := http.DefaultClient.Do(req); err == nil {
+			_ = r.Body.Close()
+		}
+	}()
+	<-handling
+	cancelPost()
+	<-posted
+	require.NoError(t, resp.Body.Close())
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.IsType(c, foxyevent.SessionDeleted{}, lastEvent(logger))
+	}, 5*time.Second, 10*time.Millisecond)
+	close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, tr.Shutdown(ctx))
+	require.NoError(t, <-runDone)
+	assert.NotContains(t, logger.Events(), foxyevent.DrainTimedOut{Transport: "sse", InFlight: 1})
+}
+
+func lastEvent(logger *recordingLogger) foxyevent.Event {
+	events := logger.Events()
+	if len(events) == 0 {
+		return nil
+	}
+	return events[len(events)-1]
+}
@@ -0,0 +1,161 @@
+package stdio
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// DEFAULT_MAX_MESSAGE_SIZE is maximum size of message transport reads,
+// unless changed with WithMaxMessageSize
+const DEFAULT_MAX_MESSAGE_SIZE = 4 * 1024 * 1024
+
+// ErrMessageTooLarge is reported when client sends message
+// bigger than maximum size, such message is discarded
+var ErrMessageTooLarge = errors.New("message exceeds maximum size")
+
+// ErrInvalidHeader is reported when message framed with
+// Content-Length header has missing or malformed header
+var ErrInvalidHeader = errors.New("invalid message header")
+
+// Framing defines how messages are separated from each other in the stream.
+type Framing int
+
+const (
+	// FramingNewline separates messages with new lines, as MCP specification
+	// requires, carriage returns before new lines and blank lines are ignored
+	FramingNewline Framing = iota
+	// FramingContentLength prefixes every message with Content-Length header
+	// followed by empty line, same as Language Server Protocol does
+	FramingContentLength
+)
+
+// messageReader reads messages from input one by one
+type messageReader interface {
+	// read returns next message, or error wrapping ErrMessageTooLarge
+	// or ErrInvalidHeader if message was skipped and reading can continue
+	read() ([]byte, error)
+}
+
+func newMessageReader(in io.Reader, framing Framing, maxSize int) messageReader {
+	reader := bufio.NewReader(in)
+	if framing == FramingContentLength {
+		return &contentLengthReader{reader: reader, maxSize: maxSize}
+	}
+	return &newlineReader{reader: reader, maxSize: maxSize}
+}
+
+type newlineReader struct {
+	reader  *bufio.Reader
+	maxSize int
+}
+
+func (r *newlineReader) read() ([]byte, error) {
+	for {
+		line, err := readLine(r.reader, r.maxSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		return line, nil
+	}
+}
+
+// readLine reads line without line ending, line longer than maxSize
+// is discarded up to its end and reported as ErrMessageTooLarge
+func readLine(reader *bufio.Reader, maxSize int) ([]byte, error) {
+	var line []byte
+	tooLarge := false
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if !tooLarge {
+			line = append(line, chunk...)
+			if maxSize > 0 && len(bytes.TrimRight(line, "\r\n")) > maxSize {
+				tooLarge = true
+				line = nil
+			}
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if tooLarge && (err == nil || errors.Is(err, io.EOF)) {
+			// following read reports EOF, if that is where line has ended
+			return nil, fmt.Errorf("%w of %d bytes", ErrMessageTooLarge, maxSize)
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) && len(line) > 0 {
+				// last message might be not terminated by new line
+				return bytes.TrimRight(line, "\r\n"), nil
+			}
+			return nil, err
+		}
+		return bytes.TrimRight(line, "\r\n"), nil
+	}
+}
+
+type contentLengthReader struct {
+	reader  *bufio.Reader
+	maxSize int
+}
+
+func (r *contentLengthReader) read() ([]byte, error) {
+	length := -1
+	headers := 0
+	for {
+		// headers are small, so they are limited the same way as messages
+		line, err := readLine(r.reader, r.maxSize)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 {
+			if headers == 0 {
+				// blank lines between messages are ignored
+				continue
+			}
+			if length < 0 {
+				return nil, fmt.Errorf("%w: missing Content-Length", ErrInvalidHeader)
+			}
+			break
+		}
+		headers++
+		name, value, ok := strings.Cut(string(line), ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidHeader, line)
+		}
+		if !strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			// other headers, such as Content-Type, are not used
+			continue
+		}
+		length, err = strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || length < 0 {
+			return nil, fmt.Errorf("%w: invalid Content-Length %q", ErrInvalidHeader, value)
+		}
+	}
+
+	if r.maxSize > 0 && length > r.maxSize {
+		if _, err := io.CopyN(io.Discard, r.reader, int64(length)); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w of %d bytes", ErrMessageTooLarge, r.maxSize)
+	}
+	message := make([]byte, length)
+	if _, err := io.ReadFull(r.reader, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// frame returns message framed for writing
+func frame(framing Framing, data []byte) []byte {
+	if framing == FramingContentLength {
+		header := fmt.Sprintf("Content-Length: %d\r\n\r\n", len(data))
+		return append([]byte(header), data...)
+	}
+	return append(data, '\n')
+}
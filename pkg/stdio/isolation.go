@@ -0,0 +1,57 @@
+package stdio
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"time"
+
+	foxyevent "github.com/strowk/foxy-contexts/pkg/foxy_event"
+)
+
+var ErrStdoutIsolationNotSupported = errors.New("stdout isolation is not supported on this platform")
+
+// STRAY_OUTPUT_TIMEOUT is how long transport waits for stray output
+// to be consumed when it stops, child processes that have inherited stdout
+// can keep writing to it, so their output is not waited for any longer
+const STRAY_OUTPUT_TIMEOUT = time.Second
+
+// StrayOutput defines where output written to stdout by anything
+// else than transport goes, when stdout is isolated
+type StrayOutput int
+
+const (
+	// StrayOutputToStderr copies stray output to stderr as is
+	StrayOutputToStderr StrayOutput = iota
+	// StrayOutputToLogger logs every line of stray output
+	// as foxyevent.StdioStrayOutput
+	StrayOutputToLogger
+)
+
+// isolate replaces stdout of the process with pipe, which stray output is read from,
+// while transport keeps writing protocol messages to the original stdout
+func (s *stdioTransport) isolate(logger foxyevent.Logger) (restore func(), err error) {
+	consume := func(stray io.Reader) {
+		_, _ = io.Copy(os.Stderr, stray)
+	}
+	if *s.strayOutput == StrayOutputToLogger {
+		consume = func(stray io.Reader) {
+			scanner := bufio.NewScanner(stray)
+			for scanner.Scan() {
+				logger.LogEvent(foxyevent.StdioStrayOutput{Line: scanner.Text()})
+			}
+			// in case line was too long, rest of the output is still drained
+			_, _ = io.Copy(io.Discard, stray)
+		}
+	}
+
+	protocol, restore, err := isolateStdout(consume, STRAY_OUTPUT_TIMEOUT)
+	if err != nil {
+		return nil, err
+	}
+	if s.out == io.Writer(os.Stdout) {
+		s.out = protocol
+	}
+	return restore, nil
+}
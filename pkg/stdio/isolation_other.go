@@ -0,0 +1,13 @@
+//go:build !unix
+
+package stdio
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+func isolateStdout(consume func(io.Reader), timeout time.Duration) (*os.File, func(), error) {
+	return nil, nil, ErrStdoutIsolationNotSupported
+}
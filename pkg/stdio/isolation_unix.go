@@ -0,0 +1,59 @@
+//go:build unix
+
+package stdio
+
+import (
+	"io"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// isolateStdout duplicates stdout file descriptor and returns it for writing
+// protocol messages, while stdout itself is replaced with pipe read by consume,
+// restore puts original stdout back once all stray output is consumed,
+// or once timeout passes, as child processes can keep the pipe open
+func isolateStdout(consume func(io.Reader), timeout time.Duration) (*os.File, func(), error) {
+	stdoutFd := int(os.Stdout.Fd())
+	protocolFd, err := unix.Dup(stdoutFd)
+	if err != nil {
+		return nil, nil, err
+	}
+	unix.CloseOnExec(protocolFd)
+	protocol := os.NewFile(uintptr(protocolFd), "/dev/stdout")
+
+	strayReader, strayWriter, err := os.Pipe()
+	if err != nil {
+		_ = protocol.Close()
+		return nil, nil, err
+	}
+	if err := unix.Dup2(int(strayWriter.Fd()), stdoutFd); err != nil {
+		_ = protocol.Close()
+		_ = strayReader.Close()
+		_ = strayWriter.Close()
+		return nil, nil, err
+	}
+
+	consumed := make(chan struct{})
+	go func() {
+		defer close(consumed)
+		consume(strayReader)
+	}()
+
+	restore := func() {
+		// this closes the last write end of the pipe apart from strayWriter
+		_ = unix.Dup2(protocolFd, stdoutFd)
+		_ = strayWriter.Close()
+		select {
+		case <-consumed:
+			_ = strayReader.Close()
+		case <-time.After(timeout):
+			// closing read end stops consume, output written after that is lost
+			_ = strayReader.Close()
+			<-consumed
+		}
+		_ = protocol.Close()
+	}
+	return protocol, restore, nil
+}
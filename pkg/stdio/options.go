@@ -60,3 +60,58 @@ func WithIn(in io.Reader) StdioTransportOption {
 		in: in,
 	}
 }
+
+type stdioFramingOption struct {
+	framing Framing
+}
+
+func (o *stdioFramingOption) apply(s *stdioTransport) {
+	s.framing = o.framing
+}
+
+// WithFraming sets how messages are separated in input and output,
+// by default they are separated with new lines as MCP specification requires.
+func WithFraming(framing Framing) StdioTransportOption {
+	return &stdioFramingOption{
+		framing: framing,
+	}
+}
+
+type stdioStdoutIsolationOption struct {
+	strayOutput StrayOutput
+}
+
+func (o *stdioStdoutIsolationOption) apply(s *stdioTransport) {
+	s.strayOutput = &o.strayOutput
+}
+
+// WithStdoutIsolation makes transport write protocol messages to duplicate
+// of stdout file descriptor, while stdout of the process is replaced
+// with pipe once transport runs, so that anything else printing to stdout,
+// such as fmt.Println in tool or library, cannot break the session.
+// Stray output goes to stderr or to logger, depending on strayOutput.
+//
+// Isolation is only supported on unix systems, on others Run fails
+// with ErrStdoutIsolationNotSupported.
+func WithStdoutIsolation(strayOutput StrayOutput) StdioTransportOption {
+	return &stdioStdoutIsolationOption{
+		strayOutput: strayOutput,
+	}
+}
+
+type stdioMaxMessageSizeOption struct {
+	size int
+}
+
+func (o *stdioMaxMessageSizeOption) apply(s *stdioTransport) {
+	s.maxMessageSize = o.size
+}
+
+// WithMaxMessageSize limits size of messages in bytes that transport would read,
+// bigger messages are discarded and answered with Invalid Request error.
+// Default is DEFAULT_MAX_MESSAGE_SIZE, size of 0 or less removes the limit.
+func WithMaxMessageSize(size int) StdioTransportOption {
+	return &stdioMaxMessageSizeOption{
+		size: size,
+	}
+}
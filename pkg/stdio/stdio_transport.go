@@ -1,13 +1,17 @@
 package stdio
 
 import (
-	"bufio"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"sync"
+	"time"
 
+	"github.com/strowk/foxy-contexts/pkg/dispatch"
+	"github.com/strowk/foxy-contexts/pkg/drain"
 	foxyevent "github.com/strowk/foxy-contexts/pkg/foxy_event"
 	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
 	"github.com/strowk/foxy-contexts/pkg/mcp"
@@ -20,11 +24,15 @@ func NewTransport(options ...StdioTransportOption) server.Transport {
 		shuttingDown:            make(chan struct{}),
 		stoppedReadingResponses: make(chan struct{}),
 		stoppedReadingInput:     make(chan struct{}),
+		drained:                 make(chan struct{}),
 		stopped:                 make(chan struct{}),
+		drainCtx:                context.Background(),
 
 		in:  os.Stdin,
 		out: os.Stdout,
 
+		maxMessageSize: DEFAULT_MAX_MESSAGE_SIZE,
+
 		newServer: func(
 			capabilities *mcp.ServerCapabilities,
 			serverInfo *mcp.Implementation,
@@ -47,11 +55,25 @@ type stdioTransport struct {
 	shuttingDown            chan struct{}
 	stoppedReadingResponses chan struct{}
 	stoppedReadingInput     chan struct{}
-	stopped                 chan struct{}
+	// drained is closed once requests in flight are handled
+	// and no more responses are expected to be written
+	drained chan struct{}
+	stopped chan struct{}
+
+	shutdownOnce sync.Once
+	// drainCtx bounds waiting for requests in flight,
+	// it is set before shuttingDown is closed
+	drainCtx context.Context
+	requests drain.Group
 
 	in  io.Reader
 	out io.Writer
 
+	framing        Framing
+	maxMessageSize int
+	// strayOutput is set when stdout has to be isolated
+	strayOutput *StrayOutput
+
 	newServer func(
 		capabilities *mcp.ServerCapabilities,
 		serverInfo *mcp.Implementation,
@@ -66,8 +88,15 @@ func (s *stdioTransport) Run(
 	serverInfo *mcp.Implementation,
 	options ...server.ServerOption,
 ) error {
-	server := s.newServer(capabilities, serverInfo, options...)
-	return s.run(server)
+	if s.strayOutput != nil {
+		restore, err := s.isolate(server.LoggerFromOptions(options))
+		if err != nil {
+			return fmt.Errorf("failed to isolate stdout: %w", err)
+		}
+		defer restore()
+	}
+	srv := s.newServer(capabilities, serverInfo, options...)
+	return s.run(srv)
 }
 
 func (s *stdioTransport) run(
@@ -75,19 +104,20 @@ func (s *stdioTransport) run(
 ) error {
 	// local stdio transport is using only one session per whole execution
 	ctx := context.Background()
-	ctx, _, err := s.sessionManager.CreateNewSession(ctx, nil)
+	ctx, sess, err := s.sessionManager.CreateNewSession(ctx, nil)
 	if err != nil {
 		srv.GetLogger().LogEvent(foxyevent.FailedCreatingSession{Err: err})
 		return fmt.Errorf("failed to create session: %w", err)
 	}
+	srv.GetLogger().LogEvent(foxyevent.SessionCreated{SessionId: sess.SessionID.String(), Transport: "stdio"})
 
-	reader := bufio.NewReader(s.in)
+	reader := newMessageReader(s.in, s.framing, s.maxMessageSize)
 	go func() {
 		defer close(s.stoppedReadingResponses)
 	out:
 		for {
 			select {
-			case <-s.shuttingDown:
+			case <-s.drained:
 				break out
 			case res := <-srv.GetResponses():
 				data, err := jsonrpc2.Marshal(res.Id, res.Result, res.Error)
@@ -95,32 +125,47 @@ func (s *stdioTransport) run(
 					srv.GetLogger().LogEvent(foxyevent.StdioFailedMarhalResponse{Err: err})
 				}
 				srv.GetLogger().LogEvent(foxyevent.StdioSendingResponse{Data: data})
-				_, err = s.out.Write(data)
-				if err != nil {
-					srv.GetLogger().LogEvent(foxyevent.StdioFailedWriting{Err: err})
+				if !s.write(srv, data) {
 					break out
 				}
-				_, err = s.out.Write([]byte("\n"))
+			case req := <-srv.GetRequests():
+				data, err := json.Marshal(req)
 				if err != nil {
-					srv.GetLogger().LogEvent(foxyevent.StdioFailedWriting{Err: err})
+					srv.GetLogger().LogEvent(foxyevent.StdioFailedMarhalResponse{Err: err})
+					continue
+				}
+				if !s.write(srv, data) {
 					break out
 				}
 			}
 		}
 	}()
 
+	// messages are queued, so that reading goes on while handler
+	// waits for client to respond to server request
+	queue := dispatch.NewQueue(ctx, srv, &s.requests)
 	go func() {
-		defer close(s.stoppedReadingInput)
-	out:
+		<-queue.Done()
+		close(s.stoppedReadingInput)
+	}()
+
+	go func() {
+		defer queue.Close()
 		for {
-			input, err := reader.ReadBytes('\n')
+			input, err := reader.read()
+			if errors.Is(err, ErrMessageTooLarge) || errors.Is(err, ErrInvalidHeader) {
+				// message was skipped, so client is told about it and reading goes on
+				srv.GetLogger().LogEvent(foxyevent.StdioFailedReadingInput{Err: err})
+				s.reject(srv, err)
+				continue
+			}
 			if err != nil {
 				if !errors.Is(err, io.EOF) {
 					srv.GetLogger().LogEvent(foxyevent.StdioFailedReadingInput{Err: err})
 				}
-				break out
+				return
 			}
-			srv.Handle(ctx, input)
+			queue.Push(input)
 		}
 	}()
 
@@ -129,19 +174,66 @@ func (s *stdioTransport) run(
 	case <-s.shuttingDown:
 	case <-s.stoppedReadingInput:
 		// if we stopped reading input, we can now initiate transport shutdown
-		close(s.shuttingDown)
+		s.shutdown(context.Background())
+	}
+	s.drain(ctx, srv, sess)
+
+	close(s.stopped)
+	return nil
+}
+
+// drain waits until requests in flight are handled and their responses
+// are written, then stops writing output
+func (s *stdioTransport) drain(ctx context.Context, srv server.Server, sess *session.Session) {
+	started := time.Now()
+	logger := srv.GetLogger()
+	logger.LogEvent(foxyevent.DrainStarted{Transport: "stdio", InFlight: s.requests.InFlight()})
+
+	// from now on server would reject new requests
+	srv.Shutdown(ctx)
+
+	if err := s.requests.Drain(s.drainCtx); err != nil {
+		logger.LogEvent(foxyevent.DrainTimedOut{Transport: "stdio", InFlight: s.requests.InFlight()})
 	}
 
-	// wait until we stop reading responses,
+	// wait until we stop writing responses,
 	// before signaling that we are stopped
+	close(s.drained)
 	<-s.stoppedReadingResponses
 
-	close(s.stopped)
-	return nil
+	s.sessionManager.DeleteSession(sess.SessionID)
+	logger.LogEvent(foxyevent.SessionDeleted{SessionId: sess.SessionID.String(), Transport: "stdio"})
+
+	logger.LogEvent(foxyevent.DrainFinished{Transport: "stdio", Duration: time.Since(started)})
 }
 
+// reject responds with Invalid Request error to message that could not be read,
+// id of such message is unknown, so response has null id
+func (s *stdioTransport) reject(srv server.Server, err error) {
+	select {
+	case srv.GetResponses() <- jsonrpc2.JsonRpcResponse{
+		Id:    jsonrpc2.NewNullRequestId(),
+		Error: jsonrpc2.NewInvalidRequestError(err.Error()),
+	}:
+	case <-s.drained:
+	}
+}
+
+// write sends one framed message, returning false if writing failed
+func (s *stdioTransport) write(srv server.Server, data []byte) bool {
+	_, err := s.out.Write(frame(s.framing, data))
+	if err != nil {
+		srv.GetLogger().LogEvent(foxyevent.StdioFailedWriting{Err: err})
+		return false
+	}
+	return true
+}
+
+// Shutdown stops accepting new requests and waits for requests
+// in flight to be handled and their responses to be written,
+// ctx bounds how long transport would wait for them.
 func (s *stdioTransport) Shutdown(ctx context.Context) error {
-	safeClose(s.shuttingDown)
+	s.shutdown(ctx)
 
 	// this waits either till we are stopped or we cannot wait anymore
 	select {
@@ -152,17 +244,20 @@ func (s *stdioTransport) Shutdown(ctx context.Context) error {
 	}
 }
 
-func safeClose(ch chan struct{}) {
-	defer func() {
-		//nolint:errcheck // it is ok to ignore if there was no panic
-		recover()
-		// it is possible to panic if channel is already closed
-		// in which case we just go on, as it is possible that
-		// Shutdown would be called soon after transport is stopped
-	}()
-	close(ch)
+// shutdown initiates shutdown, only the first call has any effect,
+// as it is possible that Shutdown would be called soon after
+// transport has stopped by itself
+func (s *stdioTransport) shutdown(ctx context.Context) {
+	s.shutdownOnce.Do(func() {
+		s.drainCtx = ctx
+		close(s.shuttingDown)
+	})
 }
 
 func (s *stdioTransport) GetSessionManager() *session.SessionManager {
 	return s.sessionManager
 }
+
+func (s *stdioTransport) SetSessionManager(sessionManager *session.SessionManager) {
+	s.sessionManager = sessionManager
+}
@@ -0,0 +1,339 @@
+package stdio
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	foxyevent "github.com/strowk/foxy-contexts/pkg/foxy_event"
+	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/server"
+)
+
+type recordingLogger struct {
+	mu     sync.Mutex
+	events []foxyevent.Event
+}
+
+func (l *recordingLogger) LogEvent(e foxyevent.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, e)
+}
+
+func (l *recordingLogger) Events() []foxyevent.Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]foxyevent.Event(nil), l.events...)
+}
+
+func TestShutdownDrainsRequestsInFlight(t *testing.T) {
+	inReader, inWriter := io.Pipe()
+	outReader, outWriter := io.Pipe()
+	tr := NewTransport(WithIn(inReader), WithOut(outWriter))
+
+	handling := make(chan struct{})
+	release := make(chan struct{})
+	logger := &recordingLogger{}
+	runDone := make(chan error)
+	go func() {
+		runDone <- tr.Run(&mcp.ServerCapabilities{}, &mcp.Implementation{
+			Name:    "TestServer",
+			Version: "0.0.0",
+		}, server.LoggerOption{Logger: logger}, server.ServerStartCallbackOption{
+			Callback: func(s server.Server) {
+				s.SetRequestHandler(&mcp.ListToolsRequest{}, func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
+					close(handling)
+					<-release
+					return &mcp.ListToolsResult{Tools: []mcp.Tool{}}, nil
+				})
+			},
+		})
+	}()
+
+	out := bufio.NewReader(outReader)
+	send := func(msg string) {
+		_, err := inWriter.Write([]byte(msg + "\n"))
+		require.NoError(t, err)
+	}
+	send(`{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"c","version":"0"}}}`)
+	_, err := out.ReadBytes('\n')
+	require.NoError(t, err)
+	send(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	send(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+	<-handling
+
+	shutdownDone := make(chan error)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdownDone <- tr.Shutdown(ctx)
+	}()
+
+	select {
+	case <-shutdownDone:
+		t.Fatal("shutdown finished while request is still in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	line, err := out.ReadBytes('\n')
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":{"tools":[]}}`, string(line))
+
+	require.NoError(t, <-shutdownDone)
+	require.NoError(t, <-runDone)
+
+	events := logger.Events()
+	assert.Contains(t, events, foxyevent.DrainStarted{Transport: "stdio", InFlight: 1})
+	assert.NotContains(t, events, foxyevent.DrainTimedOut{Transport: "stdio", InFlight: 1})
+	assert.IsType(t, foxyevent.DrainFinished{}, events[len(events)-1])
+}
+
+func TestMessagesAreReadWhileHandlerWaitsForClient(t *testing.T) {
+	inReader, inWriter := io.Pipe()
+	outReader, outWriter := io.Pipe()
+	tr := NewTransport(WithIn(inReader), WithOut(outWriter))
+
+	runDone := make(chan error)
+	go func() {
+		runDone <- tr.Run(&mcp.ServerCapabilities{}, &mcp.Implementation{
+			Name:    "TestServer",
+			Version: "0.0.0",
+		}, server.LoggerOption{Logger: &recordingLogger{}}, server.ServerStartCallbackOption{
+			Callback: func(s server.Server) {
+				s.SetRequestHandler(&mcp.ListToolsRequest{}, func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
+					if _, err := s.ListRoots(ctx); err != nil {
+						return nil, jsonrpc2.NewInternalError(err.Error())
+					}
+					return &mcp.ListToolsResult{Tools: []mcp.Tool{}}, nil
+				})
+			},
+		})
+	}()
+
+	out := bufio.NewReader(outReader)
+	send := func(msg string) {
+		_, err := inWriter.Write([]byte(msg + "\n"))
+		require.NoError(t, err)
+	}
+	receive := func() string {
+		line, err := out.ReadBytes('\n')
+		require.NoError(t, err)
+		return string(line)
+	}
+	send(`{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{"roots":{}},"clientInfo":{"name":"c","version":"0"}}}`)
+	receive()
+	send(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	send(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"method":"roots/list"}`, receive())
+
+	// ping comes before response to server request
+	// and must not stop response from being read
+	send(`{"jsonrpc":"2.0","id":2,"method":"ping"}`)
+	send(`{"jsonrpc":"2.0","id":1,"result":{"roots":[]}}`)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":{"tools":[]}}`, receive())
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":2,"result":{}}`, receive())
+
+	require.NoError(t, inWriter.Close())
+	require.NoError(t, <-runDone)
+}
+
+func TestShutdownGivesUpOnDeadline(t *testing.T) {
+	inReader, _ := io.Pipe()
+	outReader, outWriter := io.Pipe()
+	go func() {
+		_, _ = io.Copy(io.Discard, outReader)
+	}()
+	tr := NewTransport(WithIn(inReader), WithOut(outWriter))
+	logger := &recordingLogger{}
+
+	runDone := make(chan error)
+	go func() {
+		runDone <- tr.Run(&mcp.ServerCapabilities{}, &mcp.Implementation{
+			Name:    "TestServer",
+			Version: "0.0.0",
+		}, server.LoggerOption{Logger: logger})
+	}()
+
+	// simulate request stuck in handler
+	st := tr.(*stdioTransport)
+	require.True(t, st.requests.Begin())
+	defer st.requests.End()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	// depending on timing it is either deadline error or transport
+	// has already given up on the request and stopped
+	_ = tr.Shutdown(ctx)
+	require.NoError(t, <-runDone)
+	assert.Contains(t, logger.Events(), foxyevent.DrainTimedOut{Transport: "stdio", InFlight: 1})
+}
+
+// startPiped runs transport with pipes as its input and output
+func startPiped(t *testing.T, options ...StdioTransportOption) (io.Writer, *bufio.Reader) {
+	t.Helper()
+	inReader, inWriter := io.Pipe()
+	outReader, outWriter := io.Pipe()
+	tr := NewTransport(append([]StdioTransportOption{WithIn(inReader), WithOut(outWriter)}, options...)...)
+
+	runDone := make(chan error)
+	go func() {
+		runDone <- tr.Run(&mcp.ServerCapabilities{}, &mcp.Implementation{
+			Name:    "TestServer",
+			Version: "0.0.0",
+		}, server.LoggerOption{Logger: &recordingLogger{}})
+	}()
+	t.Cleanup(func() {
+		_ = inWriter.Close()
+		go func() {
+			_, _ = io.Copy(io.Discard, outReader)
+		}()
+		require.NoError(t, <-runDone)
+	})
+	return inWriter, bufio.NewReader(outReader)
+}
+
+func TestNewlineFramingToleratesBlankLinesAndCRLF(t *testing.T) {
+	in, out := startPiped(t)
+
+	_, err := in.Write([]byte("\r\n\n  \n{\"jsonrpc\":\"2.0\",\"id\":1,\"method\":\"ping\"}\r\n"))
+	require.NoError(t, err)
+	line, err := out.ReadBytes('\n')
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":{}}`, string(line))
+}
+
+func TestMessageTooLargeIsRejected(t *testing.T) {
+	in, out := startPiped(t, WithMaxMessageSize(64))
+
+	_, err := in.Write([]byte(`{"jsonrpc":"2.0","id":1,"method":"ping","params":{"padding":"` + strings.Repeat("x", 8192) + "\"}}\n"))
+	require.NoError(t, err)
+	line, err := out.ReadBytes('\n')
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"Invalid Request","data":"message exceeds maximum size of 64 bytes"}}`, string(line))
+
+	// reading goes on with the next message
+	_, err = in.Write([]byte(`{"jsonrpc":"2.0","id":2,"method":"ping"}` + "\n"))
+	require.NoError(t, err)
+	line, err = out.ReadBytes('\n')
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":2,"result":{}}`, string(line))
+}
+
+func TestUnterminatedLastMessageTooLargeIsRejected(t *testing.T) {
+	reader := bufio.NewReaderSize(strings.NewReader(`{"jsonrpc":"2.0","id":1}`+"\n"+strings.Repeat("x", 8192)), 16)
+
+	line, err := readLine(reader, 64)
+	require.NoError(t, err)
+	assert.Equal(t, `{"jsonrpc":"2.0","id":1}`, string(line))
+
+	_, err = readLine(reader, 64)
+	assert.ErrorIs(t, err, ErrMessageTooLarge)
+
+	_, err = readLine(reader, 64)
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestContentLengthFraming(t *testing.T) {
+	in, out := startPiped(t, WithFraming(FramingContentLength), WithMaxMessageSize(64))
+
+	readMessage := func() string {
+		header, err := out.ReadString('\n')
+		require.NoError(t, err)
+		length, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(header, "Content-Length:")))
+		require.NoError(t, err)
+		blank, err := out.ReadString('\n')
+		require.NoError(t, err)
+		require.Equal(t, "\r\n", blank)
+		message := make([]byte, length)
+		_, err = io.ReadFull(out, message)
+		require.NoError(t, err)
+		return string(message)
+	}
+
+	ping := `{"jsonrpc":"2.0","id":1,"method":"ping"}`
+	_, err := in.Write([]byte(fmt.Sprintf("Content-Length: %d\r\nContent-Type: application/json\r\n\r\n%s", len(ping), ping)))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":{}}`, readMessage())
+
+	_, err = in.Write([]byte(fmt.Sprintf("Content-Length: 100\r\n\r\n%s", strings.Repeat(" ", 100))))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":null,"error":{"code":-32600,"message":"Invalid Request","data":"message exceeds maximum size of 64 bytes"}}`, readMessage())
+}
+
+// ISOLATION_TEST_ENV makes test binary run as stdio server with isolated stdout,
+// value of the variable selects where stray output goes
+const ISOLATION_TEST_ENV = "FOXY_CONTEXTS_STDIO_ISOLATION_TEST"
+
+func TestMain(m *testing.M) {
+	if strayOutput := os.Getenv(ISOLATION_TEST_ENV); strayOutput != "" {
+		runIsolatedServer(strayOutput)
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// runIsolatedServer runs server which prints to stdout when it starts,
+// with strayOutput "child" it also starts process that inherits stdout
+// and outlives the server
+func runIsolatedServer(strayOutput string) {
+	isolation := StrayOutputToStderr
+	if strayOutput == "logger" {
+		isolation = StrayOutputToLogger
+	}
+	err := NewTransport(WithStdoutIsolation(isolation)).Run(
+		&mcp.ServerCapabilities{},
+		&mcp.Implementation{Name: "TestServer", Version: "0.0.0"},
+		server.LoggerOption{Logger: foxyevent.NewSlogLogger(slog.New(slog.NewTextHandler(os.Stderr, nil)))},
+		server.ServerStartCallbackOption{Callback: func(s server.Server) {
+			fmt.Println("stray output")
+			if strayOutput == "child" {
+				child := exec.Command("sleep", "10")
+				child.Stdout = os.Stdout
+				_ = child.Start()
+			}
+		}},
+	)
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+func TestStdoutIsolation(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("stdout isolation is only supported on unix")
+	}
+	for _, strayOutput := range []string{"stderr", "logger", "child"} {
+		t.Run(strayOutput, func(t *testing.T) {
+			started := time.Now()
+			cmd := exec.Command(os.Args[0])
+			cmd.Env = append(os.Environ(), ISOLATION_TEST_ENV+"="+strayOutput)
+			cmd.Stdin = strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}` + "\n")
+			var stdout, stderr strings.Builder
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+			require.NoError(t, cmd.Run())
+
+			assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":{}}`, stdout.String())
+			assert.Contains(t, stderr.String(), "stray output")
+			if strayOutput == "logger" {
+				assert.Contains(t, stderr.String(), `msg="stray output written to stdout"`)
+			}
+			assert.Less(t, time.Since(started), 5*time.Second, "server should not wait for child holding stdout")
+		})
+	}
+}
@@ -1,6 +1,18 @@
 package streamable_http
 
-import "time"
+import (
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/strowk/foxy-contexts/pkg/auth"
+	"github.com/strowk/foxy-contexts/pkg/listener"
+	"github.com/strowk/foxy-contexts/pkg/metrics"
+	"github.com/strowk/foxy-contexts/pkg/origin"
+	"github.com/strowk/foxy-contexts/pkg/tlsconfig"
+)
 
 // KeepStreamAliveInterval is an option for the streamable HTTP transport that sets the keep-alive interval
 // for long-running SSE streams.
@@ -16,6 +28,12 @@ func (o KeepStreamAliveInterval) apply(t *streamableHttpTransport) {
 	t.keepStreamAliveInterval = o.Interval
 }
 
+// Endpoint is an option for the streamable HTTP transport that sets where it listens
+// and which path serves MCP endpoint, zero values keep defaults of 127.0.0.1:8080/mcp.
+//
+// To let the system pick a free port, pass Listener created with
+// net.Listen("tcp", "127.0.0.1:0") and read chosen address back
+// from server.ListeningTransport.Addr.
 type Endpoint struct {
 	Hostname string
 	Port     int
@@ -33,3 +51,160 @@ func (o Endpoint) apply(t *streamableHttpTransport) {
 		t.path = o.Path
 	}
 }
+
+// Listener is an option for the streamable HTTP transport that makes it serve
+// on pre-opened listener instead of listening on Endpoint hostname and port.
+//
+// Transport takes ownership of the listener and closes it on shutdown.
+type Listener struct {
+	Listener net.Listener
+}
+
+func (o Listener) apply(t *streamableHttpTransport) {
+	t.listen = func() (net.Listener, error) {
+		return o.Listener, nil
+	}
+}
+
+// UnixSocket is an option for the streamable HTTP transport that makes it
+// listen on unix domain socket at Path, which exposes server to local
+// clients without opening TCP port.
+//
+// When Mode is not zero, it is set as permissions of the socket file.
+// Stale socket file left from previous run is removed on start.
+type UnixSocket struct {
+	Path string
+	Mode os.FileMode
+}
+
+func (o UnixSocket) apply(t *streamableHttpTransport) {
+	t.listen = func() (net.Listener, error) {
+		return listener.Unix(o.Path, o.Mode)
+	}
+}
+
+// SystemdSocket is an option for the streamable HTTP transport that makes it
+// serve on socket passed by systemd socket activation.
+//
+// Name selects socket by FileDescriptorName= of the socket unit,
+// when empty the first passed socket is used.
+type SystemdSocket struct {
+	Name string
+}
+
+func (o SystemdSocket) apply(t *streamableHttpTransport) {
+	t.listen = func() (net.Listener, error) {
+		return listener.Systemd(o.Name)
+	}
+}
+
+// Auth is an option for the streamable HTTP transport that requires clients
+// to authenticate with OAuth 2.1 bearer tokens validated by Verifier.
+//
+// When Metadata is set, it is served at /.well-known/oauth-protected-resource
+// to let clients discover authorization server. Authenticated principal
+// is bound to the session and available via auth.PrincipalFromContext in handlers.
+type Auth auth.Config
+
+func (o Auth) apply(t *streamableHttpTransport) {
+	config := auth.Config(o)
+	t.auth = &config
+}
+
+// OriginValidation is an option for the streamable HTTP transport that configures
+// which values of Origin and Host headers are accepted and handles CORS for allowed origins.
+//
+// When this option is not given, origin.LocalhostDefaults are applied to requests
+// arriving on loopback interface to protect server from DNS rebinding attacks.
+type OriginValidation origin.Config
+
+func (o OriginValidation) apply(t *streamableHttpTransport) {
+	config := origin.Config(o)
+	t.origin = &config
+}
+
+// TLS is an option for the streamable HTTP transport that makes it serve HTTPS.
+//
+// When client certificates are requested, certificate of the peer is bound
+// to the session and can be obtained from session.Session.PeerCertificate.
+type TLS tlsconfig.Config
+
+func (o TLS) apply(t *streamableHttpTransport) {
+	config := tlsconfig.Config(o)
+	t.tls = &config
+}
+
+// HTTPMiddleware is an option for the streamable HTTP transport that wraps
+// every HTTP request served by transport into given middleware, for example
+// to extract tracing headers or collect metrics. Middlewares run in the order
+// they are given, before any other processing of request by transport,
+// including validation of origin.
+type HTTPMiddleware struct {
+	Middleware func(http.Handler) http.Handler
+}
+
+func (o HTTPMiddleware) apply(t *streamableHttpTransport) {
+	t.httpMiddlewares = append(t.httpMiddlewares, o.Middleware)
+}
+
+// Metrics is an option for the streamable HTTP transport that collects
+// metrics of requests, sessions, streams and traffic and serves them
+// at Path in Prometheus text format, see package metrics for details.
+//
+// When Metrics is nil, new one is created, when Path is empty,
+// metrics.DEFAULT_PATH is used. Metrics endpoint does not require
+// authentication configured by Auth option.
+type Metrics struct {
+	Metrics *metrics.Metrics
+	Path    string
+}
+
+func (o Metrics) apply(t *streamableHttpTransport) {
+	t.metrics = o.Metrics
+	if t.metrics == nil {
+		t.metrics = metrics.New()
+	}
+	t.metricsPath = o.Path
+	if t.metricsPath == "" {
+		t.metricsPath = metrics.DEFAULT_PATH
+	}
+}
+
+// Mount is an option for the streamable HTTP transport that makes it serve
+// MCP endpoints from caller-supplied echo instance or http.ServeMux
+// instead of listening on Endpoint hostname and port.
+//
+// Transport is also an http.Handler, so when neither Echo nor ServeMux
+// is set, it can be mounted into any router:
+//
+//	transport := streamable_http.NewTransport(streamable_http.Mount{})
+//	router.Handle("/mcp", transport.(http.Handler))
+//
+// Mounted transport validates Origin and Host headers the same way as one
+// owning the listener, use OriginValidation option to configure it.
+type Mount struct {
+	Echo     *echo.Echo
+	ServeMux *http.ServeMux
+}
+
+func (o Mount) apply(t *streamableHttpTransport) {
+	t.mount = &o
+}
+
+func (o Mount) register(t *streamableHttpTransport) {
+	paths := []string{t.path}
+	if t.auth != nil && t.auth.Metadata != nil {
+		paths = append(paths, auth.PROTECTED_RESOURCE_METADATA_PATH)
+	}
+	if t.metrics != nil {
+		paths = append(paths, t.metricsPath)
+	}
+	for _, path := range paths {
+		if o.Echo != nil {
+			o.Echo.Any(path, echo.WrapHandler(t))
+		}
+		if o.ServeMux != nil {
+			o.ServeMux.Handle(path, t)
+		}
+	}
+}
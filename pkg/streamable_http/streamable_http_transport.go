@@ -2,25 +2,36 @@ package streamable_http
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
-	"fmt"
 	"io"
+	"net"
+	"net/http"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
+	"github.com/strowk/foxy-contexts/pkg/auth"
+	"github.com/strowk/foxy-contexts/pkg/drain"
 	foxyevent "github.com/strowk/foxy-contexts/pkg/foxy_event"
 	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
 	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/metrics"
+	"github.com/strowk/foxy-contexts/pkg/origin"
 	"github.com/strowk/foxy-contexts/pkg/server"
 	"github.com/strowk/foxy-contexts/pkg/session"
 	"github.com/strowk/foxy-contexts/pkg/sse"
+	"github.com/strowk/foxy-contexts/pkg/tlsconfig"
 )
 
 type streamableHttpTransport struct {
 	e *echo.Echo
 
+	// servers holds server.Server for every session by its uuid.UUID
+	servers sync.Map
+
 	keepStreamAliveInterval time.Duration
 
 	port     int
@@ -28,6 +39,37 @@ type streamableHttpTransport struct {
 	path     string
 
 	sessionManager *session.SessionManager
+
+	auth   *auth.Config
+	origin *origin.Config
+	tls    *tlsconfig.Config
+	mount  *Mount
+
+	// httpMiddlewares wrap every HTTP request served by transport
+	httpMiddlewares []func(http.Handler) http.Handler
+
+	// metrics collects metrics served at metricsPath, if set
+	metrics     *metrics.Metrics
+	metricsPath string
+
+	// listen opens listener when transport is run, by default
+	// it listens on TCP hostname and port
+	listen func() (net.Listener, error)
+	// addr is the address transport is listening on
+	addr   net.Addr
+	addrMu sync.RWMutex
+
+	// ready is closed once transport is running
+	ready chan struct{}
+	// done is closed once transport is shut down
+	done         chan struct{}
+	shutdownOnce sync.Once
+	// requests tracks requests in flight to wait for them on shutdown
+	requests drain.Group
+
+	capabilities  *mcp.ServerCapabilities
+	serverInfo    *mcp.Implementation
+	serverOptions []server.ServerOption
 }
 
 func (t *streamableHttpTransport) Run(
@@ -35,17 +77,96 @@ func (t *streamableHttpTransport) Run(
 	serverInfo *mcp.Implementation,
 	serverOptions ...server.ServerOption,
 ) error {
-
-	e := echo.New()
-	t.e = e
-
-	servers := sync.Map{}
-
 	// ensure that negotiated version would be at least the one with streamable http transport
 	serverOptions = append(serverOptions, server.MinimalProtocolVersionOption{
 		Version: server.MINIMAL_FOR_STREAMABLE_HTTP,
 	})
 
+	// there is no stream open to client to deliver server requests yet
+	serverOptions = append(serverOptions, server.DisableServerRequestsOption{})
+
+	serverOptions = append(serverOptions, t.metrics.ServerOptions()...)
+
+	t.capabilities = capabilities
+	t.serverInfo = serverInfo
+	t.serverOptions = serverOptions
+	close(t.ready)
+
+	if t.mount != nil {
+		// listener is owned by the caller, so transport
+		// is only running until it is shut down
+		<-t.done
+		return nil
+	}
+
+	var tlsConfig *tls.Config
+	if t.tls != nil {
+		var err error
+		tlsConfig, err = t.tls.Build()
+		if err != nil {
+			return err
+		}
+	}
+
+	l, err := t.listen()
+	if err != nil {
+		return err
+	}
+	t.addrMu.Lock()
+	t.addr = l.Addr()
+	t.addrMu.Unlock()
+
+	e := t.e
+	if tlsConfig != nil {
+		e.TLSListener = tls.NewListener(l, tlsConfig)
+		e.TLSServer.TLSConfig = tlsConfig
+		return e.StartServer(e.TLSServer)
+	}
+	e.Listener = l
+	return e.StartServer(e.Server)
+}
+
+func (t *streamableHttpTransport) listenTCP() (net.Listener, error) {
+	return net.Listen("tcp", net.JoinHostPort(t.hostname, strconv.Itoa(t.port)))
+}
+
+// Addr returns address transport is listening on,
+// or nil if it is mounted or not listening yet.
+func (t *streamableHttpTransport) Addr() net.Addr {
+	t.addrMu.RLock()
+	defer t.addrMu.RUnlock()
+	return t.addr
+}
+
+// newEcho creates echo instance serving MCP endpoints of the transport,
+// which is used both when transport owns listener and when it is mounted
+func (t *streamableHttpTransport) newEcho() *echo.Echo {
+	e := echo.New()
+
+	for _, middleware := range t.httpMiddlewares {
+		e.Use(echo.WrapMiddleware(middleware))
+	}
+
+	e.Use(t.available)
+
+	if t.origin != nil {
+		e.Use(origin.Middleware(*t.origin))
+	} else {
+		e.Use(origin.LocalhostMiddleware())
+	}
+
+	var middlewares []echo.MiddlewareFunc
+	if t.metrics != nil {
+		e.GET(t.metricsPath, echo.WrapHandler(t.metrics))
+		middlewares = append(middlewares, echo.WrapMiddleware(t.metrics.HTTPMiddleware))
+	}
+	if t.auth != nil {
+		middlewares = append(middlewares, echo.WrapMiddleware(auth.Middleware(*t.auth)))
+		if t.auth.Metadata != nil {
+			e.GET(auth.PROTECTED_RESOURCE_METADATA_PATH, echo.WrapHandler(auth.MetadataHandler(*t.auth)))
+		}
+	}
+
 	e.DELETE(t.path, func(c echo.Context) error {
 		sessionIdHeader := c.Request().Header.Get("Mcp-Session-Id")
 		if sessionIdHeader == "" {
@@ -55,19 +176,29 @@ func (t *streamableHttpTransport) Run(
 		if err != nil {
 			return echo.NewHTTPError(400, "Wrong session id format, expected UUID")
 		}
-		_, ok := servers.Load(sessionId)
+		if sess, ok := t.sessionManager.FindSessionById(sessionId); ok {
+			if err := bindIdentity(c.Request(), sess); err != nil {
+				return echo.NewHTTPError(403, err.Error())
+			}
+		}
+		s, ok := t.servers.LoadAndDelete(sessionId)
 		if !ok {
 			return echo.NewHTTPError(404, "Requested session id not found in session store")
 		}
-		servers.Delete(sessionId)
+		ctx, _, err := t.sessionManager.ResolveSessionOrCreateNew(c.Request().Context(), sessionId)
+		if err == nil {
+			s.(server.Server).Shutdown(ctx)
+		}
 		t.sessionManager.DeleteSession(sessionId)
+		s.(server.Server).GetLogger().LogEvent(foxyevent.SessionDeleted{SessionId: sessionId.String(), Transport: "streamable_http"})
 		return c.NoContent(204)
-	})
+	}, middlewares...)
 
 	e.POST(t.path, func(c echo.Context) error {
 		w := c.Response()
 		var serv server.Server
 		var sessionIdUsed uuid.UUID
+		created := false
 		if c.Request().Header.Get("Mcp-Session-Id") != "" {
 			sessionId, err := uuid.Parse(c.Request().Header.Get("Mcp-Session-Id"))
 			if err != nil {
@@ -75,7 +206,7 @@ func (t *streamableHttpTransport) Run(
 				// , hence we return 404 Not Found with some details in the body
 				return echo.NewHTTPError(404, "Wrong session id format, expected UUID")
 			}
-			s, ok := servers.Load(sessionId)
+			s, ok := t.servers.Load(sessionId)
 			if !ok {
 				return echo.NewHTTPError(404, "Requested session id not found in session store")
 			}
@@ -84,17 +215,40 @@ func (t *streamableHttpTransport) Run(
 			sessionIdUsed = sessionId
 		} else {
 			sessionId := uuid.New()
-			s := server.NewServer(capabilities, serverInfo, serverOptions...)
-			servers.Store(sessionId, s)
+			s := server.NewServer(t.capabilities, t.serverInfo, t.serverOptions...)
+			t.servers.Store(sessionId, s)
 			w.Header().Set("Mcp-Session-Id", sessionId.String())
 			serv = s
 			sessionIdUsed = sessionId
+			created = true
+		}
+
+		// session created for this request is discarded
+		// if request gets rejected before it is handled
+		reject := func(err error) error {
+			if created {
+				t.servers.Delete(sessionIdUsed)
+				t.sessionManager.DeleteSession(sessionIdUsed)
+				w.Header().Del("Mcp-Session-Id")
+			}
+			return err
 		}
 
-		w.Header().Set("MCP-Session-Id", sessionIdUsed.String())
-		ctx, _, err := t.sessionManager.ResolveSessionOrCreateNew(c.Request().Context(), sessionIdUsed)
+		ctx, sess, err := t.sessionManager.ResolveSessionOrCreateNew(c.Request().Context(), sessionIdUsed)
 		if err != nil {
-			return echo.NewHTTPError(404, "Failed to resolve session")
+			return reject(echo.NewHTTPError(404, "Failed to resolve session"))
+		}
+
+		if err := bindIdentity(c.Request(), sess); err != nil {
+			return reject(echo.NewHTTPError(403, err.Error()))
+		}
+
+		if err := server.ValidateProtocolVersionHeader(ctx, c.Request().Header.Get(server.PROTOCOL_VERSION_HEADER)); err != nil {
+			return reject(echo.NewHTTPError(400, err.Error()))
+		}
+
+		if created {
+			serv.GetLogger().LogEvent(foxyevent.SessionCreated{SessionId: sessionIdUsed.String(), Transport: "streamable_http"})
 		}
 
 		buf, err := io.ReadAll(c.Request().Body)
@@ -133,6 +287,8 @@ func (t *streamableHttpTransport) Run(
 				// must write the header before the first event
 				w.Header().Set("Content-Type", "text/event-stream")
 				w.WriteHeader(200)
+				t.metrics.StreamOpened()
+				defer t.metrics.StreamClosed()
 			}
 			err = ev.MarshalTo(w)
 			if err != nil {
@@ -146,9 +302,62 @@ func (t *streamableHttpTransport) Run(
 			w.WriteHeader(202)
 		}
 		return nil
-	})
+	}, middlewares...)
 
-	return e.Start(fmt.Sprintf("%s:%d", t.hostname, t.port))
+	return e
+}
+
+// available rejects requests until transport is running and after it has been shut down
+func (t *streamableHttpTransport) available(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		select {
+		case <-t.done:
+			return echo.NewHTTPError(503, "Transport is shutting down")
+		default:
+		}
+		select {
+		case <-t.ready:
+		default:
+			return echo.NewHTTPError(503, "Transport is not running yet")
+		}
+		if !t.requests.Begin() {
+			return echo.NewHTTPError(503, "Transport is shutting down")
+		}
+		defer t.requests.End()
+		return next(c)
+	}
+}
+
+// logger returns logger configured for servers once transport is running
+func (t *streamableHttpTransport) logger() foxyevent.Logger {
+	select {
+	case <-t.ready:
+		return server.LoggerFromOptions(t.serverOptions)
+	default:
+		return server.LoggerFromOptions(nil)
+	}
+}
+
+// ServeHTTP allows to serve transport from any http.Server or router,
+// which is useful together with Mount option
+func (t *streamableHttpTransport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t.e.ServeHTTP(w, r)
+}
+
+// bindIdentity makes sure that session is only used by principal
+// and TLS peer that have started it
+func bindIdentity(req *http.Request, sess *session.Session) error {
+	if principal, ok := auth.PrincipalFromContext(req.Context()); ok {
+		if err := sess.BindPrincipal(principal); err != nil {
+			return err
+		}
+	}
+	if cert := tlsconfig.PeerCertificate(req); cert != nil {
+		if err := sess.BindPeerCertificate(cert); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func marshalServerError(r *jsonrpc2.JsonRpcResponse, e error) []byte {
@@ -167,8 +376,40 @@ func marshalServerError(r *jsonrpc2.JsonRpcResponse, e error) []byte {
 	return srvErrStr
 }
 
+// Shutdown stops accepting new requests, waits for requests in flight
+// to be handled and responded to, and then closes all sessions,
+// ctx bounds how long transport would wait for requests.
 func (t *streamableHttpTransport) Shutdown(ctx context.Context) error {
-	return t.e.Shutdown(ctx)
+	started := time.Now()
+	logger := t.logger()
+	t.shutdownOnce.Do(func() {
+		close(t.done)
+	})
+	logger.LogEvent(foxyevent.DrainStarted{Transport: "streamable_http", InFlight: t.requests.InFlight()})
+
+	err := t.requests.Drain(ctx)
+	if err != nil {
+		logger.LogEvent(foxyevent.DrainTimedOut{Transport: "streamable_http", InFlight: t.requests.InFlight()})
+	}
+	if t.mount == nil {
+		if shutdownErr := t.e.Shutdown(ctx); err == nil {
+			err = shutdownErr
+		}
+	}
+	t.servers.Range(func(key, value any) bool {
+		sessionId := key.(uuid.UUID)
+		if sess, ok := t.sessionManager.FindSessionById(sessionId); ok {
+			value.(server.Server).Shutdown(session.WithSession(ctx, sess))
+		} else {
+			value.(server.Server).Shutdown(ctx)
+		}
+		t.servers.Delete(sessionId)
+		t.sessionManager.DeleteSession(sessionId)
+		value.(server.Server).GetLogger().LogEvent(foxyevent.SessionDeleted{SessionId: sessionId.String(), Transport: "streamable_http"})
+		return true
+	})
+	logger.LogEvent(foxyevent.DrainFinished{Transport: "streamable_http", Duration: time.Since(started)})
+	return err
 }
 
 func NewTransport(options ...TransportOption) server.Transport {
@@ -180,10 +421,20 @@ func NewTransport(options ...TransportOption) server.Transport {
 		port:     8080,
 
 		sessionManager: session.NewSessionManager(),
+
+		ready: make(chan struct{}),
+		done:  make(chan struct{}),
 	}
 	for _, o := range options {
 		o.apply(tp)
 	}
+	if tp.listen == nil {
+		tp.listen = tp.listenTCP
+	}
+	tp.e = tp.newEcho()
+	if tp.mount != nil {
+		tp.mount.register(tp)
+	}
 	return tp
 }
 
@@ -194,3 +445,7 @@ type TransportOption interface {
 func (s *streamableHttpTransport) GetSessionManager() *session.SessionManager {
 	return s.sessionManager
 }
+
+func (s *streamableHttpTransport) SetSessionManager(sessionManager *session.SessionManager) {
+	s.sessionManager = sessionManager
+}
@@ -4,16 +4,33 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
 	"io"
+	"math/big"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/strowk/foxy-contexts/pkg/auth"
+	foxyevent "github.com/strowk/foxy-contexts/pkg/foxy_event"
 	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
 	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/metrics"
+	"github.com/strowk/foxy-contexts/pkg/server"
 	"github.com/strowk/foxy-contexts/pkg/sse"
 )
 
@@ -144,6 +161,45 @@ func TestStreamableHttpTransport(t *testing.T) {
 		require.JSONEq(t, `{"jsonrpc":"2.0","result":{},"id":1}`, string(respBody))
 	})
 
+	// testing https://modelcontextprotocol.io/specification/2025-03-26/basic/transports#security-warning
+	t.Run("POST from foreign origin is rejected", func(t *testing.T) {
+		body := `{"method":"ping","params":{},"id":0, "jsonrpc":"2.0"}`
+		req, err := http.NewRequest("POST", "http://localhost:8080/mcp", bytes.NewReader([]byte(body)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json, text/event-stream")
+		req.Header.Set("Origin", "https://evil.example.com")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, resp.Body.Close()) }()
+		require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("POST with rebound host is rejected", func(t *testing.T) {
+		body := `{"method":"ping","params":{},"id":0, "jsonrpc":"2.0"}`
+		req, err := http.NewRequest("POST", "http://localhost:8080/mcp", bytes.NewReader([]byte(body)))
+		require.NoError(t, err)
+		req.Host = "attacker.example.com:8080"
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json, text/event-stream")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, resp.Body.Close()) }()
+		require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("OPTIONS preflight from local origin", func(t *testing.T) {
+		req, err := http.NewRequest("OPTIONS", "http://localhost:8080/mcp", nil)
+		require.NoError(t, err)
+		req.Header.Set("Origin", "http://localhost:6274")
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, resp.Body.Close()) }()
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+		require.Equal(t, "http://localhost:6274", resp.Header.Get("Access-Control-Allow-Origin"))
+	})
+
 	t.Run("POST lifecycle", func(t *testing.T) {
 		body := `{
 			"id":0, 
@@ -195,9 +251,533 @@ func TestStreamableHttpTransport(t *testing.T) {
 		require.Equal(t, http.StatusAccepted, resp.StatusCode)
 		require.Equal(t, "", resp.Header.Get("Content-Type"))
 		require.Equal(t, ``, string(respBody))
+
+		body = `{"method":"ping","params":{},"id":1,"jsonrpc":"2.0"}`
+		req, err = http.NewRequest("POST", "http://localhost:8080/mcp", bytes.NewReader([]byte(body)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json, text/event-stream")
+		req.Header.Set("MCP-Session-Id", sessionId)
+		req.Header.Set("MCP-Protocol-Version", "2024-11-05")
+		resp, err = http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, resp.Body.Close()) }()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("rejected initialize leaves no session", func(t *testing.T) {
+		countSessions := func() int {
+			count := 0
+			tr.(*streamableHttpTransport).servers.Range(func(_, _ any) bool {
+				count++
+				return true
+			})
+			return count
+		}
+		before := countSessions()
+
+		body := `{"id":0,"jsonrpc":"2.0","method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"c","version":"0"}}}`
+		req, err := http.NewRequest("POST", "http://localhost:8080/mcp", bytes.NewReader([]byte(body)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json, text/event-stream")
+		req.Header.Set("MCP-Protocol-Version", "1999-01-01")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, resp.Body.Close()) }()
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("MCP-Session-Id"))
+		assert.Equal(t, before, countSessions())
+	})
+}
+
+func TestStreamableHttpTransportAuth(t *testing.T) {
+	tr := NewTransport(
+		Endpoint{
+			Hostname: "localhost",
+			Port:     8081,
+			Path:     "/mcp",
+		},
+		Auth{
+			Verifier: auth.NewStaticTokenVerifier(map[string]auth.Principal{
+				"alice-token": {Subject: "alice"},
+				"bob-token":   {Subject: "bob"},
+			}),
+			Metadata: &auth.ProtectedResourceMetadata{
+				AuthorizationServers: []string{"https://auth.example.com"},
+			},
+		},
+	)
+
+	waitGroup := sync.WaitGroup{}
+	waitGroup.Add(1)
+
+	go func() {
+		assert.EqualError(t, tr.Run(&mcp.ServerCapabilities{}, &mcp.Implementation{
+			Name:    "TestServer",
+			Version: "0.0.0",
+		}), "http: Server closed")
+		waitGroup.Done()
+	}()
+
+	defer func() {
+		assert.NoError(t, tr.Shutdown(context.Background()))
+		waitGroup.Wait()
+	}()
+
+	assert.EventuallyWithT(t, func(c *assert.CollectT) {
+		resp, err := http.Get("http://localhost:8081" + auth.PROTECTED_RESOURCE_METADATA_PATH)
+		assert.NoError(c, err)
+		defer func() { assert.NoError(c, resp.Body.Close()) }()
+	}, 5*time.Second, 200*time.Millisecond)
+
+	ping := func(token string, sessionId string) *http.Response {
+		body := `{"method":"ping","params":{},"id":0, "jsonrpc":"2.0"}`
+		req, err := http.NewRequest("POST", "http://localhost:8081/mcp", bytes.NewReader([]byte(body)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json, text/event-stream")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if sessionId != "" {
+			req.Header.Set("MCP-Session-Id", sessionId)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { assert.NoError(t, resp.Body.Close()) })
+		return resp
+	}
+
+	t.Run("POST without token", func(t *testing.T) {
+		resp := ping("", "")
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		require.Equal(t,
+			`Bearer realm="mcp", resource_metadata="http://localhost:8081/.well-known/oauth-protected-resource"`,
+			resp.Header.Get("WWW-Authenticate"))
+	})
+
+	t.Run("session is bound to principal", func(t *testing.T) {
+		resp := ping("alice-token", "")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		sessionId := resp.Header.Get("MCP-Session-Id")
+		require.NotEmpty(t, sessionId)
+
+		resp = ping("alice-token", sessionId)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		resp = ping("bob-token", sessionId)
+		require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+}
+
+// selfSigned creates certificate usable both as leaf and as CA, writes it to dir and returns file paths
+func selfSigned(t *testing.T, dir, commonName string) (tls.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: commonName},
+		DNSNames:              []string{"localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+	certFile := filepath.Join(dir, commonName+".crt")
+	keyFile := filepath.Join(dir, commonName+".key")
+	require.NoError(t, os.WriteFile(certFile, certPem, 0o600))
+	require.NoError(t, os.WriteFile(keyFile, keyPem, 0o600))
+
+	cert, err := tls.X509KeyPair(certPem, keyPem)
+	require.NoError(t, err)
+	return cert, certFile, keyFile
+}
+
+func TestStreamableHttpTransportMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	serverCert, serverCertFile, serverKeyFile := selfSigned(t, dir, "server")
+	clientCert, clientCertFile, _ := selfSigned(t, dir, "client")
+
+	tr := NewTransport(
+		Endpoint{
+			Hostname: "localhost",
+			Port:     8082,
+			Path:     "/mcp",
+		},
+		TLS{
+			CertFile:     serverCertFile,
+			KeyFile:      serverKeyFile,
+			ClientCAFile: clientCertFile,
+		},
+	)
+
+	waitGroup := sync.WaitGroup{}
+	waitGroup.Add(1)
+
+	go func() {
+		assert.EqualError(t, tr.Run(&mcp.ServerCapabilities{}, &mcp.Implementation{
+			Name:    "TestServer",
+			Version: "0.0.0",
+		}), "http: Server closed")
+		waitGroup.Done()
+	}()
+
+	defer func() {
+		assert.NoError(t, tr.Shutdown(context.Background()))
+		waitGroup.Wait()
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(serverCert.Leaf)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{clientCert},
+	}}}
+
+	assert.EventuallyWithT(t, func(c *assert.CollectT) {
+		resp, err := client.Get("https://localhost:8082/mcp")
+		assert.NoError(c, err)
+		defer func() { assert.NoError(c, resp.Body.Close()) }()
+	}, 5*time.Second, 200*time.Millisecond)
+
+	t.Run("POST without client certificate", func(t *testing.T) {
+		noCertClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+		_, err := noCertClient.Post("https://localhost:8082/mcp", "application/json",
+			bytes.NewReader([]byte(`{"method":"ping","params":{},"id":0, "jsonrpc":"2.0"}`)))
+		require.Error(t, err)
+	})
+
+	t.Run("POST with client certificate", func(t *testing.T) {
+		resp, err := client.Post("https://localhost:8082/mcp", "application/json",
+			bytes.NewReader([]byte(`{"method":"ping","params":{},"id":0, "jsonrpc":"2.0"}`)))
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, resp.Body.Close()) }()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		sessionId, err := uuid.Parse(resp.Header.Get("MCP-Session-Id"))
+		require.NoError(t, err)
+		sess, ok := tr.GetSessionManager().FindSessionById(sessionId)
+		require.True(t, ok)
+		require.NotNil(t, sess.PeerCertificate())
+		require.Equal(t, "client", sess.PeerCertificate().Subject.CommonName)
+	})
+}
+
+func TestStreamableHttpTransportMounted(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	tr := NewTransport(Mount{ServeMux: mux})
+	httpServer := httptest.NewServer(mux)
+	defer httpServer.Close()
+
+	ping := func() *http.Response {
+		resp, err := http.Post(httpServer.URL+"/mcp", "application/json",
+			bytes.NewReader([]byte(`{"method":"ping","params":{},"id":0, "jsonrpc":"2.0"}`)))
+		require.NoError(t, err)
+		t.Cleanup(func() { assert.NoError(t, resp.Body.Close()) })
+		return resp
+	}
+
+	require.Equal(t, http.StatusServiceUnavailable, ping().StatusCode, "transport should not serve before Run")
+
+	shutdownSessions := make(chan struct{}, 1)
+	runDone := make(chan error)
+	go func() {
+		runDone <- tr.Run(&mcp.ServerCapabilities{}, &mcp.Implementation{
+			Name:    "TestServer",
+			Version: "0.0.0",
+		}, server.OnShutdownOption{Callback: func(ctx context.Context) {
+			shutdownSessions <- struct{}{}
+		}})
+	}()
+
+	assert.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Equal(c, http.StatusOK, ping().StatusCode)
+	}, 5*time.Second, 50*time.Millisecond)
+
+	resp, err := http.Get(httpServer.URL + "/health")
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	req, err := http.NewRequest(http.MethodPost, httpServer.URL+"/mcp",
+		bytes.NewReader([]byte(`{"method":"ping","params":{},"id":0, "jsonrpc":"2.0"}`)))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Origin", "https://evil.example.com")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusForbidden, resp.StatusCode, "mounted transport should reject foreign origin on loopback")
+
+	require.NoError(t, tr.Shutdown(context.Background()))
+	require.NoError(t, <-runDone)
+	select {
+	case <-shutdownSessions:
+	default:
+		t.Fatal("session was not shut down")
+	}
+	require.Equal(t, http.StatusServiceUnavailable, ping().StatusCode, "transport should not serve after Shutdown")
+}
+
+type headerContextKey struct{}
+
+func TestStreamableHttpTransportHTTPMiddleware(t *testing.T) {
+	mux := http.NewServeMux()
+	tr := NewTransport(Mount{ServeMux: mux}, HTTPMiddleware{
+		Middleware: func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ctx := context.WithValue(r.Context(), headerContextKey{}, r.Header.Get("X-Test"))
+				next.ServeHTTP(w, r.WithContext(ctx))
+			})
+		},
+	})
+	httpServer := httptest.NewServer(mux)
+	defer httpServer.Close()
+
+	seen := make(chan any, 1)
+	runDone := make(chan error)
+	go func() {
+		runDone <- tr.Run(&mcp.ServerCapabilities{}, &mcp.Implementation{
+			Name:    "TestServer",
+			Version: "0.0.0",
+		}, server.MiddlewareOption{Middleware: func(next jsonrpc2.CallHandler) jsonrpc2.CallHandler {
+			return func(ctx context.Context, call *jsonrpc2.Call) (jsonrpc2.Result, *jsonrpc2.Error) {
+				seen <- ctx.Value(headerContextKey{})
+				return next(ctx, call)
+			}
+		}})
+	}()
+	defer func() {
+		require.NoError(t, tr.Shutdown(context.Background()))
+		require.NoError(t, <-runDone)
+	}()
+
+	assert.EventuallyWithT(t, func(c *assert.CollectT) {
+		req, err := http.NewRequest(http.MethodPost, httpServer.URL+"/mcp",
+			bytes.NewReader([]byte(`{"method":"ping","params":{},"id":0, "jsonrpc":"2.0"}`)))
+		require.NoError(c, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Test", "from header")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(c, err)
+		assert.NoError(c, resp.Body.Close())
+		assert.Equal(c, http.StatusOK, resp.StatusCode)
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, "from header", <-seen)
+}
+
+func TestStreamableHttpTransportMetrics(t *testing.T) {
+	mux := http.NewServeMux()
+	tr := NewTransport(Mount{ServeMux: mux}, Metrics{})
+	httpServer := httptest.NewServer(mux)
+	defer httpServer.Close()
+
+	runDone := make(chan error)
+	go func() {
+		runDone <- tr.Run(&mcp.ServerCapabilities{}, &mcp.Implementation{
+			Name:    "TestServer",
+			Version: "0.0.0",
+		})
+	}()
+	defer func() {
+		require.NoError(t, tr.Shutdown(context.Background()))
+		require.NoError(t, <-runDone)
+	}()
+
+	assert.EventuallyWithT(t, func(c *assert.CollectT) {
+		resp, err := http.Post(httpServer.URL+"/mcp", "application/json",
+			bytes.NewReader([]byte(`{"method":"ping","params":{},"id":0, "jsonrpc":"2.0"}`)))
+		require.NoError(c, err)
+		assert.NoError(c, resp.Body.Close())
+		assert.Equal(c, http.StatusOK, resp.StatusCode)
+	}, 5*time.Second, 50*time.Millisecond)
+
+	resp, err := http.Get(httpServer.URL + metrics.DEFAULT_PATH)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, metrics.CONTENT_TYPE, resp.Header.Get("Content-Type"))
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `mcp_requests_total{method="ping"} 1`+"\n")
+	assert.Contains(t, string(body), "mcp_received_bytes_total 53\n")
+}
+
+func runTransport(t *testing.T, tr server.Transport) {
+	t.Helper()
+	runDone := make(chan error)
+	go func() {
+		runDone <- tr.Run(&mcp.ServerCapabilities{}, &mcp.Implementation{
+			Name:    "TestServer",
+			Version: "0.0.0",
+		})
+	}()
+	t.Cleanup(func() {
+		require.NoError(t, tr.Shutdown(context.Background()))
+		assert.ErrorIs(t, <-runDone, http.ErrServerClosed)
 	})
 }
 
+func TestStreamableHttpTransportListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	tr := NewTransport(Listener{Listener: l}).(server.ListeningTransport)
+	require.Nil(t, tr.Addr())
+	runTransport(t, tr)
+
+	var addr net.Addr
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		addr = tr.Addr()
+		assert.NotNil(c, addr)
+	}, 5*time.Second, 50*time.Millisecond)
+	require.Equal(t, l.Addr().String(), addr.String())
+
+	resp, err := http.Post("http://"+addr.String()+"/mcp", "application/json",
+		bytes.NewReader([]byte(`{"method":"ping","params":{},"id":0, "jsonrpc":"2.0"}`)))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestStreamableHttpTransportUnixSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "mcp.sock")
+	tr := NewTransport(UnixSocket{Path: socketPath, Mode: 0o600}).(server.ListeningTransport)
+	runTransport(t, tr)
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+		},
+	}}
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		resp, err := client.Post("http://mcp/mcp", "application/json",
+			bytes.NewReader([]byte(`{"method":"ping","params":{},"id":0, "jsonrpc":"2.0"}`)))
+		if !assert.NoError(c, err) {
+			return
+		}
+		assert.NoError(c, resp.Body.Close())
+		assert.Equal(c, http.StatusOK, resp.StatusCode)
+	}, 5*time.Second, 50*time.Millisecond)
+
+	assert.Equal(t, socketPath, tr.Addr().String())
+	info, err := os.Stat(socketPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+}
+
+type recordingLogger struct {
+	mu     sync.Mutex
+	events []foxyevent.Event
+}
+
+func (l *recordingLogger) LogEvent(e foxyevent.Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, e)
+}
+
+func (l *recordingLogger) Events() []foxyevent.Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]foxyevent.Event(nil), l.events...)
+}
+
+func TestStreamableHttpTransportDrainsRequestsOnShutdown(t *testing.T) {
+	mux := http.NewServeMux()
+	tr := NewTransport(Mount{ServeMux: mux})
+	httpServer := httptest.NewServer(mux)
+	defer httpServer.Close()
+
+	handling := make(chan struct{})
+	release := make(chan struct{})
+	logger := &recordingLogger{}
+	runDone := make(chan error)
+	go func() {
+		runDone <- tr.Run(&mcp.ServerCapabilities{}, &mcp.Implementation{
+			Name:    "TestServer",
+			Version: "0.0.0",
+		}, server.LoggerOption{Logger: logger}, server.ServerStartCallbackOption{
+			Callback: func(s server.Server) {
+				s.SetRequestHandler(&mcp.ListToolsRequest{}, func(ctx context.Context, req jsonrpc2.Request) (jsonrpc2.Result, *jsonrpc2.Error) {
+					close(handling)
+					<-release
+					return &mcp.ListToolsResult{Tools: []mcp.Tool{}}, nil
+				})
+			},
+		})
+	}()
+
+	post := func(sessionId string, body string) (*http.Response, []byte) {
+		req, err := http.NewRequest("POST", httpServer.URL+"/mcp", bytes.NewReader([]byte(body)))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		if sessionId != "" {
+			req.Header.Set("Mcp-Session-Id", sessionId)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer func() { assert.NoError(t, resp.Body.Close()) }()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, data
+	}
+
+	var sessionId string
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		resp, _ := post("", `{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"c","version":"0"}}}`)
+		assert.Equal(c, http.StatusOK, resp.StatusCode)
+		sessionId = resp.Header.Get("Mcp-Session-Id")
+	}, 5*time.Second, 50*time.Millisecond)
+	post(sessionId, `{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+
+	type result struct {
+		status int
+		body   []byte
+	}
+	listed := make(chan result)
+	go func() {
+		resp, body := post(sessionId, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+		listed <- result{resp.StatusCode, body}
+	}()
+	<-handling
+
+	shutdownDone := make(chan error)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdownDone <- tr.Shutdown(ctx)
+	}()
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Contains(c, logger.Events(), foxyevent.DrainStarted{Transport: "streamable_http", InFlight: 1})
+	}, 5*time.Second, 10*time.Millisecond)
+	resp, _ := post(sessionId, `{"jsonrpc":"2.0","id":2,"method":"ping"}`)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode, "new requests should be rejected while draining")
+
+	close(release)
+	res := <-listed
+	assert.Equal(t, http.StatusOK, res.status)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":{"tools":[]}}`, string(res.body))
+
+	require.NoError(t, <-shutdownDone)
+	require.NoError(t, <-runDone)
+	events := logger.Events()
+	assert.IsType(t, foxyevent.DrainFinished{}, events[len(events)-1])
+}
+
 func TestMarshalServerError(t *testing.T) {
 	r := &jsonrpc2.JsonRpcResponse{
 		Id: jsonrpc2.NewIntRequestId(1),
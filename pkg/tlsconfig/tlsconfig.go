@@ -0,0 +1,172 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrNoCertificate = errors.New("neither certificate files nor certificates in tls.Config are given")
+
+// Config configures TLS for HTTP transports.
+type Config struct {
+	// CertFile and KeyFile are paths to PEM encoded certificate chain and private key.
+	// Files are checked for changes and reloaded automatically,
+	// so that renewed certificates are used without restart.
+	CertFile string
+	KeyFile  string
+
+	// ReloadCheckInterval is how often files are checked for changes,
+	// defaults to 10 seconds
+	ReloadCheckInterval time.Duration
+
+	// TLSConfig is used as base configuration, it can also provide
+	// certificates instead of CertFile and KeyFile
+	TLSConfig *tls.Config
+
+	// ClientCAFile is path to PEM bundle with certificate authorities
+	// used to verify client certificates
+	ClientCAFile string
+
+	// ClientAuth is policy for client certificates, when ClientCAFile is given
+	// it defaults to tls.RequireAndVerifyClientCert
+	ClientAuth tls.ClientAuthType
+}
+
+// Build creates tls.Config for the server.
+func (c Config) Build() (*tls.Config, error) {
+	var config *tls.Config
+	if c.TLSConfig != nil {
+		config = c.TLSConfig.Clone()
+	} else {
+		config = &tls.Config{}
+	}
+	if config.MinVersion == 0 {
+		config.MinVersion = tls.VersionTLS12
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		reloader, err := NewCertificateReloader(c.CertFile, c.KeyFile, c.ReloadCheckInterval)
+		if err != nil {
+			return nil, err
+		}
+		config.GetCertificate = reloader.GetCertificate
+	} else if len(config.Certificates) == 0 && config.GetCertificate == nil && config.GetConfigForClient == nil {
+		return nil, ErrNoCertificate
+	}
+
+	if c.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", c.ClientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	if c.ClientAuth != tls.NoClientCert {
+		config.ClientAuth = c.ClientAuth
+	}
+
+	return config, nil
+}
+
+// CertificateReloader serves certificate loaded from files
+// and reloads it when files are modified.
+type CertificateReloader struct {
+	certFile      string
+	keyFile       string
+	checkInterval time.Duration
+	now           func() time.Time
+
+	mu          sync.Mutex
+	cert        *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+	lastCheck   time.Time
+}
+
+// NewCertificateReloader loads certificate from given files, which would be
+// checked for modifications at most once per checkInterval.
+func NewCertificateReloader(certFile, keyFile string, checkInterval time.Duration) (*CertificateReloader, error) {
+	if checkInterval <= 0 {
+		checkInterval = 10 * time.Second
+	}
+	r := &CertificateReloader{
+		certFile:      certFile,
+		keyFile:       keyFile,
+		checkInterval: checkInterval,
+		now:           time.Now,
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *CertificateReloader) reload() error {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return fmt.Errorf("failed to read certificate file: %w", err)
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to read key file: %w", err)
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load certificate: %w", err)
+	}
+	r.cert = &cert
+	r.certModTime = certInfo.ModTime()
+	r.keyModTime = keyInfo.ModTime()
+	r.lastCheck = r.now()
+	return nil
+}
+
+func (r *CertificateReloader) changed() bool {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return false
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return false
+	}
+	return !certInfo.ModTime().Equal(r.certModTime) || !keyInfo.ModTime().Equal(r.keyModTime)
+}
+
+// GetCertificate can be used as tls.Config.GetCertificate.
+//
+// When files were modified, but new certificate cannot be loaded
+// (for example key was not yet written), previous certificate is served.
+func (r *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.now().Sub(r.lastCheck) >= r.checkInterval {
+		r.lastCheck = r.now()
+		if r.changed() {
+			// keep serving previous certificate if files are not consistent yet
+			_ = r.reload()
+		}
+	}
+	return r.cert, nil
+}
+
+// PeerCertificate returns certificate that client has presented
+// during TLS handshake, or nil if there was none or it was not verified,
+// which happens when ClientAuth does not require verification.
+func PeerCertificate(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return r.TLS.PeerCertificates[0]
+}
@@ -0,0 +1,131 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeSelfSigned(t *testing.T, certFile, keyFile, commonName string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600))
+}
+
+func commonName(t *testing.T, cert *tls.Certificate) string {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+func TestCertificateReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	writeSelfSigned(t, certFile, keyFile, "first")
+
+	r, err := NewCertificateReloader(certFile, keyFile, time.Minute)
+	require.NoError(t, err)
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	cert, err := r.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "first", commonName(t, cert))
+
+	writeSelfSigned(t, certFile, keyFile, "second")
+	future := time.Now().Add(time.Second)
+	require.NoError(t, os.Chtimes(certFile, future, future))
+	require.NoError(t, os.Chtimes(keyFile, future, future))
+
+	cert, err = r.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "first", commonName(t, cert), "files should not be checked before interval passes")
+
+	now = now.Add(time.Minute)
+	cert, err = r.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "second", commonName(t, cert))
+
+	require.NoError(t, os.WriteFile(keyFile, []byte("garbage"), 0o600))
+	later := future.Add(time.Second)
+	require.NoError(t, os.Chtimes(keyFile, later, later))
+	now = now.Add(time.Minute)
+	cert, err = r.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "second", commonName(t, cert), "previous certificate should be kept when new one is broken")
+}
+
+func TestBuild(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	writeSelfSigned(t, certFile, keyFile, "server")
+
+	_, err := Config{}.Build()
+	assert.ErrorIs(t, err, ErrNoCertificate)
+
+	config, err := Config{CertFile: certFile, KeyFile: keyFile}.Build()
+	require.NoError(t, err)
+	assert.NotNil(t, config.GetCertificate)
+	assert.Equal(t, tls.NoClientCert, config.ClientAuth)
+	assert.Equal(t, uint16(tls.VersionTLS12), config.MinVersion)
+
+	config, err = Config{CertFile: certFile, KeyFile: keyFile, ClientCAFile: certFile}.Build()
+	require.NoError(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, config.ClientAuth)
+	assert.NotNil(t, config.ClientCAs)
+
+	config, err = Config{
+		TLSConfig:    &tls.Config{MinVersion: tls.VersionTLS13, Certificates: []tls.Certificate{{}}},
+		ClientCAFile: certFile,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+	}.Build()
+	require.NoError(t, err)
+	assert.Equal(t, tls.VerifyClientCertIfGiven, config.ClientAuth)
+	assert.Equal(t, uint16(tls.VersionTLS13), config.MinVersion)
+}
+
+func TestPeerCertificate(t *testing.T) {
+	cert := &x509.Certificate{Raw: []byte("client")}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.Nil(t, PeerCertificate(req))
+
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	assert.Nil(t, PeerCertificate(req), "unverified certificate should be ignored")
+
+	req.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+	assert.Same(t, cert, PeerCertificate(req))
+}
@@ -0,0 +1,61 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// defaultPongTimeout is how long client has to answer ping,
+// before its connection is considered dead and closed
+const defaultPongTimeout = 10 * time.Second
+
+// keepAliveWriter hands connection over to WebSocket server in a way
+// that every read from it extends read deadline, so that connection
+// of client that stopped sending anything, including pong frames,
+// which x/net/websocket consumes without reporting them, gets closed
+type keepAliveWriter struct {
+	http.ResponseWriter
+	timeout time.Duration
+}
+
+func (w keepAliveWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	kc := &keepAliveConn{Conn: conn, timeout: w.timeout}
+	if err := kc.extend(); err != nil {
+		_ = conn.Close()
+		return nil, nil, err
+	}
+
+	// client might have sent more than the handshake already,
+	// so buffered data is read before the connection
+	buffered, _ := rw.Reader.Peek(rw.Reader.Buffered())
+	reader := bufio.NewReader(io.MultiReader(bytes.NewReader(bytes.Clone(buffered)), kc))
+	return kc, bufio.NewReadWriter(reader, rw.Writer), nil
+}
+
+// keepAliveConn extends read deadline whenever anything is read
+type keepAliveConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *keepAliveConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		if err := c.extend(); err != nil {
+			return n, err
+		}
+	}
+	return n, err
+}
+
+func (c *keepAliveConn) extend() error {
+	return c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+}
@@ -0,0 +1,154 @@
+package websocket
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/strowk/foxy-contexts/pkg/auth"
+	"github.com/strowk/foxy-contexts/pkg/listener"
+	"github.com/strowk/foxy-contexts/pkg/origin"
+	"github.com/strowk/foxy-contexts/pkg/tlsconfig"
+)
+
+type TransportOption interface {
+	apply(*websocketTransport)
+}
+
+// KeepAliveInterval is an option for the WebSocket transport that sets how often
+// ping frames are sent to connected clients.
+//
+// The default value is 5 seconds. Pings keep connections alive, so that proxies
+// would not close them due to inactivity, and connection is closed once ping
+// cannot be written to it anymore or when client does not send anything,
+// not even pong, for 10 seconds longer than the interval.
+// Set value to 0 to disable pings.
+type KeepAliveInterval struct {
+	Interval time.Duration
+}
+
+func (o KeepAliveInterval) apply(t *websocketTransport) {
+	t.keepAliveInterval = o.Interval
+}
+
+// Endpoint is an option for the WebSocket transport that sets where it listens
+// and which path accepts connections, zero values keep defaults of 127.0.0.1:8080/mcp.
+type Endpoint struct {
+	Hostname string
+	Port     int
+	Path     string
+}
+
+func (o Endpoint) apply(t *websocketTransport) {
+	if o.Port != 0 {
+		t.port = o.Port
+	}
+	if o.Hostname != "" {
+		t.hostname = o.Hostname
+	}
+	if o.Path != "" {
+		t.path = o.Path
+	}
+}
+
+// Listener is an option for the WebSocket transport that makes it serve
+// on pre-opened listener instead of listening on Endpoint hostname and port.
+//
+// Transport takes ownership of the listener and closes it on shutdown.
+type Listener struct {
+	Listener net.Listener
+}
+
+func (o Listener) apply(t *websocketTransport) {
+	t.listen = func() (net.Listener, error) {
+		return o.Listener, nil
+	}
+}
+
+// UnixSocket is an option for the WebSocket transport that makes it
+// listen on unix domain socket, see listener.Unix for details.
+type UnixSocket struct {
+	Path string
+	Mode os.FileMode
+}
+
+func (o UnixSocket) apply(t *websocketTransport) {
+	t.listen = func() (net.Listener, error) {
+		return listener.Unix(o.Path, o.Mode)
+	}
+}
+
+// SystemdSocket is an option for the WebSocket transport that makes it serve
+// on socket passed by systemd socket activation, see listener.Systemd for details.
+type SystemdSocket struct {
+	Name string
+}
+
+func (o SystemdSocket) apply(t *websocketTransport) {
+	t.listen = func() (net.Listener, error) {
+		return listener.Systemd(o.Name)
+	}
+}
+
+// Auth is an option for the WebSocket transport that requires clients to present
+// bearer token validated by Verifier when opening connection, see auth.Config for details.
+type Auth auth.Config
+
+func (o Auth) apply(t *websocketTransport) {
+	config := auth.Config(o)
+	t.auth = &config
+}
+
+// OriginValidation is an option for the WebSocket transport that configures
+// which values of Origin and Host headers are accepted.
+//
+// When this option is not given, browsers are only allowed to open connections
+// from pages of the same origin and origin.LocalhostDefaults are applied
+// to requests arriving on loopback interface.
+type OriginValidation origin.Config
+
+func (o OriginValidation) apply(t *websocketTransport) {
+	config := origin.Config(o)
+	t.origin = &config
+}
+
+// TLS is an option for the WebSocket transport that makes it serve secure
+// WebSocket connections, see tlsconfig.Config for details.
+type TLS tlsconfig.Config
+
+func (o TLS) apply(t *websocketTransport) {
+	config := tlsconfig.Config(o)
+	t.tls = &config
+}
+
+// Mount is an option for the WebSocket transport that makes it accept
+// connections from caller-supplied echo instance or http.ServeMux
+// instead of listening on Endpoint hostname and port.
+//
+// Transport is also an http.Handler, so when neither Echo nor ServeMux
+// is set, it can be mounted into any router.
+type Mount struct {
+	Echo     *echo.Echo
+	ServeMux *http.ServeMux
+}
+
+func (o Mount) apply(t *websocketTransport) {
+	t.mount = &o
+}
+
+func (o Mount) register(t *websocketTransport) {
+	paths := []string{t.path}
+	if t.auth != nil && t.auth.Metadata != nil {
+		paths = append(paths, auth.PROTECTED_RESOURCE_METADATA_PATH)
+	}
+	for _, path := range paths {
+		if o.Echo != nil {
+			o.Echo.Any(path, echo.WrapHandler(t))
+		}
+		if o.ServeMux != nil {
+			o.ServeMux.Handle(path, t)
+		}
+	}
+}
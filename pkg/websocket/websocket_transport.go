@@ -0,0 +1,398 @@
+// Package websocket implements transport serving every WebSocket connection
+// as a separate session, with JSON-RPC messages sent one per text message.
+package websocket
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/strowk/foxy-contexts/pkg/auth"
+	"github.com/strowk/foxy-contexts/pkg/dispatch"
+	"github.com/strowk/foxy-contexts/pkg/drain"
+	foxyevent "github.com/strowk/foxy-contexts/pkg/foxy_event"
+	"github.com/strowk/foxy-contexts/pkg/jsonrpc2"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/origin"
+	"github.com/strowk/foxy-contexts/pkg/server"
+	"github.com/strowk/foxy-contexts/pkg/session"
+	"github.com/strowk/foxy-contexts/pkg/tlsconfig"
+	xwebsocket "golang.org/x/net/websocket"
+)
+
+// SUBPROTOCOL is selected during handshake when client offers it
+// in Sec-WebSocket-Protocol header.
+const SUBPROTOCOL = "mcp"
+
+// writeTimeout limits how long writing single message to client can take,
+// so that stalled client would not block its session forever
+const writeTimeout = 10 * time.Second
+
+type websocketTransport struct {
+	e *echo.Echo
+
+	// servers holds server.Server for every session by its uuid.UUID
+	servers sync.Map
+
+	keepAliveInterval time.Duration
+	pongTimeout       time.Duration
+
+	port     int
+	hostname string
+	path     string
+
+	sessionManager *session.SessionManager
+
+	auth   *auth.Config
+	origin *origin.Config
+	tls    *tlsconfig.Config
+	mount  *Mount
+
+	// listen opens listener when transport is run, by default
+	// it listens on TCP hostname and port
+	listen func() (net.Listener, error)
+	// addr is the address transport is listening on
+	addr   net.Addr
+	addrMu sync.RWMutex
+
+	// lifecycle tracks open connections and messages received over them,
+	// that are being handled, to close them on shutdown
+	lifecycle drain.Lifecycle
+
+	capabilities  *mcp.ServerCapabilities
+	serverInfo    *mcp.Implementation
+	serverOptions []server.ServerOption
+}
+
+func NewTransport(options ...TransportOption) server.Transport {
+	tp := &websocketTransport{
+		keepAliveInterval: 5 * time.Second,
+		pongTimeout:       defaultPongTimeout,
+
+		path:     "/mcp",
+		hostname: "127.0.0.1",
+		port:     8080,
+
+		sessionManager: session.NewSessionManager(),
+	}
+	for _, o := range options {
+		o.apply(tp)
+	}
+	if tp.listen == nil {
+		tp.listen = tp.listenTCP
+	}
+	tp.e = tp.newEcho()
+	if tp.mount != nil {
+		tp.mount.register(tp)
+	}
+	return tp
+}
+
+func (t *websocketTransport) Run(
+	capabilities *mcp.ServerCapabilities,
+	serverInfo *mcp.Implementation,
+	serverOptions ...server.ServerOption,
+) error {
+	t.capabilities = capabilities
+	t.serverInfo = serverInfo
+	t.serverOptions = serverOptions
+	t.lifecycle.Start()
+
+	if t.mount != nil {
+		// listener is owned by the caller, so transport
+		// is only running until it is shut down
+		<-t.lifecycle.Stopping()
+		return nil
+	}
+
+	var tlsConfig *tls.Config
+	if t.tls != nil {
+		var err error
+		tlsConfig, err = t.tls.Build()
+		if err != nil {
+			return err
+		}
+	}
+
+	l, err := t.listen()
+	if err != nil {
+		return err
+	}
+	t.addrMu.Lock()
+	t.addr = l.Addr()
+	t.addrMu.Unlock()
+
+	e := t.e
+	if tlsConfig != nil {
+		e.TLSListener = tls.NewListener(l, tlsConfig)
+		e.TLSServer.TLSConfig = tlsConfig
+		return e.StartServer(e.TLSServer)
+	}
+	e.Listener = l
+	return e.StartServer(e.Server)
+}
+
+func (t *websocketTransport) listenTCP() (net.Listener, error) {
+	return net.Listen("tcp", net.JoinHostPort(t.hostname, strconv.Itoa(t.port)))
+}
+
+// Addr returns address transport is listening on,
+// or nil if it is mounted or not listening yet.
+func (t *websocketTransport) Addr() net.Addr {
+	t.addrMu.RLock()
+	defer t.addrMu.RUnlock()
+	return t.addr
+}
+
+// newEcho creates echo instance accepting WebSocket connections,
+// which is used both when transport owns listener and when it is mounted
+func (t *websocketTransport) newEcho() *echo.Echo {
+	e := echo.New()
+
+	e.Use(t.available)
+
+	if t.origin != nil {
+		e.Use(origin.Middleware(*t.origin))
+	} else {
+		e.Use(origin.LocalhostMiddleware())
+	}
+
+	var middlewares []echo.MiddlewareFunc
+	if t.auth != nil {
+		middlewares = append(middlewares, echo.WrapMiddleware(auth.Middleware(*t.auth)))
+		if t.auth.Metadata != nil {
+			e.GET(auth.PROTECTED_RESOURCE_METADATA_PATH, echo.WrapHandler(auth.MetadataHandler(*t.auth)))
+		}
+	}
+
+	e.GET(t.path, func(c echo.Context) error {
+		if !t.lifecycle.BeginConnection() {
+			return echo.NewHTTPError(http.StatusServiceUnavailable, drain.ErrShuttingDown.Error())
+		}
+		defer t.lifecycle.EndConnection()
+
+		clientIP := c.RealIP()
+		ws := xwebsocket.Server{
+			Handshake: t.handshake,
+			Handler: func(conn *xwebsocket.Conn) {
+				t.serveConnection(conn, clientIP)
+			},
+		}
+		var w http.ResponseWriter = c.Response()
+		if t.keepAliveInterval > 0 {
+			// client has to answer pings, otherwise reading times out
+			w = keepAliveWriter{ResponseWriter: w, timeout: t.keepAliveInterval + t.pongTimeout}
+		}
+		// this returns only after connection is closed
+		ws.ServeHTTP(w, c.Request())
+		return nil
+	}, middlewares...)
+
+	return e
+}
+
+// handshake checks origin of the connection, unless it was already validated
+// by configured middleware, and selects MCP subprotocol if client offers it
+func (t *websocketTransport) handshake(config *xwebsocket.Config, req *http.Request) error {
+	if t.origin == nil {
+		// without explicit configuration, browsers are only allowed
+		// to connect from pages served by this server
+		if o := req.Header.Get(echo.HeaderOrigin); o != "" {
+			u, err := url.Parse(o)
+			if err != nil || u.Host != req.Host {
+				return errors.New("origin is not allowed")
+			}
+		}
+	}
+
+	offered := config.Protocol
+	config.Protocol = nil
+	for _, protocol := range offered {
+		if protocol == SUBPROTOCOL {
+			config.Protocol = []string{SUBPROTOCOL}
+			break
+		}
+	}
+	return nil
+}
+
+// serveConnection serves one session over the connection until
+// either client disconnects or transport is shut down
+func (t *websocketTransport) serveConnection(conn *xwebsocket.Conn, clientIP string) {
+	defer conn.Close()
+
+	sessionId := uuid.New()
+	srv := server.NewServer(t.capabilities, t.serverInfo, t.serverOptions...)
+	ctx, sess, err := t.sessionManager.CreateNewSession(context.Background(), &sessionId)
+	if err != nil {
+		srv.GetLogger().LogEvent(foxyevent.FailedCreatingSession{Err: err})
+		return
+	}
+	// the one who opened the connection owns the session
+	req := conn.Request()
+	if principal, ok := auth.PrincipalFromContext(req.Context()); ok {
+		_ = sess.BindPrincipal(principal)
+		ctx = auth.WithPrincipal(ctx, principal)
+	}
+	if cert := tlsconfig.PeerCertificate(req); cert != nil {
+		_ = sess.BindPeerCertificate(cert)
+	}
+	t.servers.Store(sessionId, srv)
+	srv.GetLogger().LogEvent(foxyevent.SessionCreated{SessionId: sessionId.String(), Transport: "websocket"})
+	defer func() {
+		t.servers.Delete(sessionId)
+		t.sessionManager.DeleteSession(sessionId)
+		srv.GetLogger().LogEvent(foxyevent.SessionDeleted{SessionId: sessionId.String(), Transport: "websocket"})
+	}()
+
+	srv.GetLogger().LogEvent(foxyevent.WebSocketClientConnected{SessionId: sessionId.String(), ClientIP: clientIP})
+
+	stopWriting := make(chan struct{})
+	stoppedWriting := make(chan struct{})
+	go func() {
+		defer close(stoppedWriting)
+		t.write(conn, srv, stopWriting)
+	}()
+
+	// messages are queued, so that reading goes on while handler
+	// waits for client to respond to server request
+	queue := dispatch.NewQueue(ctx, srv, &t.lifecycle.Requests)
+	for {
+		var input []byte
+		if err := xwebsocket.Message.Receive(conn, &input); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+				srv.GetLogger().LogEvent(foxyevent.WebSocketClientDisconnected{SessionId: sessionId.String(), ClientIP: clientIP})
+			} else {
+				srv.GetLogger().LogEvent(foxyevent.WebSocketFailedReading{Err: err})
+			}
+			break
+		}
+		queue.Push(input)
+	}
+	queue.Close()
+	<-queue.Done()
+
+	// session is shut down while writing is still possible,
+	// as callbacks might want to send notifications
+	srv.Shutdown(ctx)
+	close(stopWriting)
+	<-stoppedWriting
+}
+
+// write sends responses, requests and notifications of the server
+// and keep-alive pings to the client until stop is closed
+func (t *websocketTransport) write(conn *xwebsocket.Conn, srv server.Server, stop chan struct{}) {
+	var keepAlive <-chan time.Time
+	if t.keepAliveInterval > 0 {
+		ticker := time.NewTicker(t.keepAliveInterval)
+		defer ticker.Stop()
+		keepAlive = ticker.C
+	}
+
+	closing := t.lifecycle.Closing()
+	send := func(data []byte) {
+		err := conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if err == nil {
+			err = xwebsocket.Message.Send(conn, string(data))
+		}
+		if err != nil {
+			srv.GetLogger().LogEvent(foxyevent.WebSocketFailedWriting{Err: err})
+			// client would not get anything anymore,
+			// but server still has to be able to finish its work
+			_ = conn.Close()
+		}
+	}
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-closing:
+			// transport is shutting down, close frame tells client
+			// that server is going away and reading would stop
+			closing = nil
+			_ = conn.Close()
+		case res := <-srv.GetResponses():
+			data, err := jsonrpc2.Marshal(res.Id, res.Result, res.Error)
+			if err != nil {
+				srv.GetLogger().LogEvent(foxyevent.WebSocketFailedMarshal{Err: err})
+				continue
+			}
+			send(data)
+		case req := <-srv.GetRequests():
+			data, err := json.Marshal(req)
+			if err != nil {
+				srv.GetLogger().LogEvent(foxyevent.WebSocketFailedMarshal{Err: err})
+				continue
+			}
+			send(data)
+		case <-keepAlive:
+			// ping frame is sent as empty message with ping payload type
+			conn.PayloadType = xwebsocket.PingFrame
+			err := conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err == nil {
+				_, err = conn.Write(nil)
+			}
+			conn.PayloadType = xwebsocket.TextFrame
+			if err != nil {
+				srv.GetLogger().LogEvent(foxyevent.WebSocketFailedWriting{Err: err})
+				_ = conn.Close()
+			}
+		}
+	}
+}
+
+// available rejects requests until transport is running and after it has been shut down
+func (t *websocketTransport) available(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if err := t.lifecycle.Available(); err != nil {
+			return echo.NewHTTPError(http.StatusServiceUnavailable, err.Error())
+		}
+		return next(c)
+	}
+}
+
+// ServeHTTP allows to serve transport from any http.Server or router,
+// which is useful together with Mount option
+func (t *websocketTransport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t.e.ServeHTTP(w, r)
+}
+
+// Shutdown stops accepting new connections and messages, waits for messages
+// in flight to be handled and responded to, then closes open connections,
+// ctx bounds how long transport would wait.
+func (t *websocketTransport) Shutdown(ctx context.Context) error {
+	var stopServing func(ctx context.Context) error
+	if t.mount == nil {
+		stopServing = t.e.Shutdown
+	}
+	return t.lifecycle.Shutdown(ctx, t.logger(), "websocket", stopServing)
+}
+
+// logger returns logger configured for servers once transport is running
+func (t *websocketTransport) logger() foxyevent.Logger {
+	select {
+	case <-t.lifecycle.Ready():
+		return server.LoggerFromOptions(t.serverOptions)
+	default:
+		return server.LoggerFromOptions(nil)
+	}
+}
+
+func (t *websocketTransport) GetSessionManager() *session.SessionManager {
+	return t.sessionManager
+}
+
+func (t *websocketTransport) SetSessionManager(sessionManager *session.SessionManager) {
+	t.sessionManager = sessionManager
+}
@@ -0,0 +1,235 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/strowk/foxy-contexts/pkg/mcp"
+	"github.com/strowk/foxy-contexts/pkg/server"
+	xwebsocket "golang.org/x/net/websocket"
+)
+
+func startTransport(t *testing.T, serverOptions ...server.ServerOption) (server.ListeningTransport, string) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	tr := NewTransport(Listener{Listener: l}).(server.ListeningTransport)
+
+	runDone := make(chan error)
+	go func() {
+		runDone <- tr.Run(&mcp.ServerCapabilities{}, &mcp.Implementation{
+			Name:    "TestServer",
+			Version: "0.0.0",
+		}, serverOptions...)
+	}()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		require.NoError(t, tr.Shutdown(ctx))
+		assert.ErrorIs(t, <-runDone, http.ErrServerClosed)
+	})
+
+	require.Eventually(t, func() bool {
+		resp, err := http.Get("http://" + l.Addr().String() + "/mcp")
+		if err != nil {
+			return false
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode != http.StatusServiceUnavailable
+	}, 5*time.Second, 10*time.Millisecond)
+	return tr, l.Addr().String()
+}
+
+func dial(t *testing.T, addr string) *xwebsocket.Conn {
+	t.Helper()
+	conn, err := xwebsocket.Dial("ws://"+addr+"/mcp", SUBPROTOCOL, "http://"+addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func send(t *testing.T, conn *xwebsocket.Conn, msg string) {
+	t.Helper()
+	require.NoError(t, xwebsocket.Message.Send(conn, msg))
+}
+
+func receive(t *testing.T, conn *xwebsocket.Conn) string {
+	t.Helper()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	var msg string
+	require.NoError(t, xwebsocket.Message.Receive(conn, &msg))
+	return msg
+}
+
+func initialize(t *testing.T, conn *xwebsocket.Conn, capabilities string) {
+	t.Helper()
+	send(t, conn, `{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":`+capabilities+`,"clientInfo":{"name":"c","version":"0"}}}`)
+	var res struct {
+		Result *mcp.InitializeResult `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(receive(t, conn)), &res))
+	require.NotNil(t, res.Result)
+	send(t, conn, `{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+}
+
+func TestWebSocketTransport(t *testing.T) {
+	_, addr := startTransport(t)
+	conn := dial(t, addr)
+	assert.Equal(t, []string{SUBPROTOCOL}, conn.Config().Protocol)
+
+	initialize(t, conn, `{}`)
+	send(t, conn, `{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":{}}`, receive(t, conn))
+
+	t.Run("every connection is a separate session", func(t *testing.T) {
+		// initialize can only be sent once per session,
+		// so it succeeding again shows that connection got its own session
+		other := dial(t, addr)
+		initialize(t, other, `{}`)
+		send(t, other, `{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+		assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":{}}`, receive(t, other))
+	})
+}
+
+func TestWebSocketTransportServerRequests(t *testing.T) {
+	roots := make(chan *mcp.ListRootsResult, 1)
+	_, addr := startTransport(t, server.OnInitializedOption{
+		Callback: func(ctx context.Context) {
+			srv, ok := server.FromContext(ctx)
+			require.True(t, ok)
+			result, err := srv.ListRoots(ctx)
+			assert.NoError(t, err)
+			roots <- result
+		},
+	})
+	conn := dial(t, addr)
+	initialize(t, conn, `{"roots":{}}`)
+
+	var req struct {
+		Id     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(receive(t, conn)), &req))
+	require.Equal(t, "roots/list", req.Method)
+	// ping comes before response to server request
+	// and must not stop response from being read
+	send(t, conn, `{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+	send(t, conn, `{"jsonrpc":"2.0","id":`+string(req.Id)+`,"result":{"roots":[{"uri":"file:///src","name":"src"}]}}`)
+
+	select {
+	case result := <-roots:
+		require.Len(t, result.Roots, 1)
+		assert.Equal(t, "file:///src", result.Roots[0].Uri)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not receive response to its request")
+	}
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":{}}`, receive(t, conn))
+}
+
+func TestWebSocketTransportRejectsForeignOrigin(t *testing.T) {
+	_, addr := startTransport(t)
+	_, err := xwebsocket.Dial("ws://"+addr+"/mcp", "", "https://evil.example.com")
+	assert.Error(t, err)
+}
+
+func TestWebSocketTransportClosesConnectionsOnShutdown(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	tr := NewTransport(Listener{Listener: l}, KeepAliveInterval{Interval: 10 * time.Millisecond})
+	shutdownSessions := make(chan struct{}, 1)
+	runDone := make(chan error)
+	go func() {
+		runDone <- tr.Run(&mcp.ServerCapabilities{}, &mcp.Implementation{
+			Name:    "TestServer",
+			Version: "0.0.0",
+		}, server.OnShutdownOption{Callback: func(ctx context.Context) {
+			shutdownSessions <- struct{}{}
+		}})
+	}()
+
+	var conn *xwebsocket.Conn
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		var err error
+		conn, err = xwebsocket.Dial("ws://"+l.Addr().String()+"/mcp", "", "http://"+l.Addr().String())
+		assert.NoError(c, err)
+	}, 5*time.Second, 10*time.Millisecond)
+	defer func() { _ = conn.Close() }()
+
+	// connection stays open while pings are being sent
+	send(t, conn, `{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+	time.Sleep(50 * time.Millisecond)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":{}}`, receive(t, conn))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.NoError(t, tr.Shutdown(ctx))
+	assert.ErrorIs(t, <-runDone, http.ErrServerClosed)
+
+	var msg string
+	assert.Error(t, xwebsocket.Message.Receive(conn, &msg))
+	select {
+	case <-shutdownSessions:
+	default:
+		t.Fatal("session was not shut down")
+	}
+}
+
+func TestWebSocketTransportClosesDeadConnections(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	tr := NewTransport(Listener{Listener: l}, KeepAliveInterval{Interval: 20 * time.Millisecond})
+	wt := tr.(*websocketTransport)
+	wt.pongTimeout = 100 * time.Millisecond
+	runDone := make(chan error)
+	go func() {
+		runDone <- tr.Run(&mcp.ServerCapabilities{}, &mcp.Implementation{
+			Name:    "TestServer",
+			Version: "0.0.0",
+		})
+	}()
+	defer func() {
+		require.NoError(t, tr.Shutdown(context.Background()))
+		assert.ErrorIs(t, <-runDone, http.ErrServerClosed)
+	}()
+
+	sessions := func() int {
+		count := 0
+		wt.servers.Range(func(_, _ any) bool {
+			count++
+			return true
+		})
+		return count
+	}
+
+	var conn *xwebsocket.Conn
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		var err error
+		conn, err = xwebsocket.Dial("ws://"+l.Addr().String()+"/mcp", "", "http://"+l.Addr().String())
+		assert.NoError(c, err)
+	}, 5*time.Second, 10*time.Millisecond)
+	defer func() { _ = conn.Close() }()
+
+	// client that is reading answers pings and stays connected
+	send(t, conn, `{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+	assert.JSONEq(t, `{"jsonrpc":"2.0","id":1,"result":{}}`, receive(t, conn))
+	received := make(chan struct{})
+	go func() {
+		defer close(received)
+		var msg string
+		_ = conn.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+		_ = xwebsocket.Message.Receive(conn, &msg)
+	}()
+	<-received
+	assert.Equal(t, 1, sessions())
+
+	// client that stopped reading does not answer pings anymore
+	assert.Eventually(t, func() bool {
+		return sessions() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,127 @@
+package wiretrace
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// REDACTED replaces values hidden from trace
+const REDACTED = "[REDACTED]"
+
+// RedactPaths hides values found by paths in every message,
+// path is a dot-separated list of members, where "*" matches any
+// member of object or any element of array, for example
+// "params.arguments.password" or "result.contents.*.blob".
+type RedactPaths struct {
+	Paths []string
+}
+
+func (o RedactPaths) apply(t *Tracer) {
+	for _, path := range o.Paths {
+		t.redactor.paths = append(t.redactor.paths, strings.Split(path, "."))
+	}
+}
+
+// RedactKeys hides values of object members with given names
+// anywhere in messages, such as tool arguments named "token" or "apiKey".
+type RedactKeys struct {
+	Keys []string
+}
+
+func (o RedactKeys) apply(t *Tracer) {
+	t.redactor.keys = append(t.redactor.keys, o.Keys...)
+}
+
+type redactor struct {
+	paths [][]string
+	keys  []string
+}
+
+// redact returns message with redactions applied, or message as is
+// if there are no rules. Message, which is not valid JSON, could not be
+// checked for values to hide, so only its length is kept.
+func (r redactor) redact(message []byte) json.RawMessage {
+	if len(r.paths) == 0 && len(r.keys) == 0 {
+		return message
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(message))
+	// numbers are kept as they were, so that large ids are not rounded
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return undecodable(message)
+	}
+
+	if batch, ok := value.([]any); ok {
+		for i := range batch {
+			batch[i] = r.redactValue(batch[i])
+		}
+	} else {
+		value = r.redactValue(value)
+	}
+
+	redacted, err := json.Marshal(value)
+	if err != nil {
+		return undecodable(message)
+	}
+	return redacted
+}
+
+// undecodable returns placeholder of message, which could not be redacted
+func undecodable(message []byte) json.RawMessage {
+	placeholder, _ := json.Marshal(fmt.Sprintf("%s undecodable message of %d bytes", REDACTED, len(message)))
+	return placeholder
+}
+
+func (r redactor) redactValue(value any) any {
+	for _, path := range r.paths {
+		value = redactPath(value, path)
+	}
+	if len(r.keys) > 0 {
+		value = r.redactKeys(value)
+	}
+	return value
+}
+
+func redactPath(value any, path []string) any {
+	if len(path) == 0 {
+		return REDACTED
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		for key, member := range v {
+			if path[0] == "*" || path[0] == key {
+				v[key] = redactPath(member, path[1:])
+			}
+		}
+	case []any:
+		if path[0] == "*" {
+			for i := range v {
+				v[i] = redactPath(v[i], path[1:])
+			}
+		}
+	}
+	return value
+}
+
+func (r redactor) redactKeys(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, member := range v {
+			if slices.Contains(r.keys, key) {
+				v[key] = REDACTED
+			} else {
+				v[key] = r.redactKeys(member)
+			}
+		}
+	case []any:
+		for i := range v {
+			v[i] = r.redactKeys(v[i])
+		}
+	}
+	return value
+}
@@ -0,0 +1,74 @@
+package wiretrace
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	foxyevent "github.com/strowk/foxy-contexts/pkg/foxy_event"
+)
+
+type loggerSink struct {
+	logger foxyevent.Logger
+}
+
+// NewLoggerSink returns sink logging every message as foxyevent.WireMessage
+func NewLoggerSink(logger foxyevent.Logger) Sink {
+	return &loggerSink{logger: logger}
+}
+
+func (s *loggerSink) Write(record Record) {
+	s.logger.LogEvent(foxyevent.WireMessage{
+		Time:      record.Time,
+		SessionId: record.SessionId,
+		Direction: string(record.Direction),
+		Latency:   record.Latency,
+		Message:   string(record.Message),
+	})
+}
+
+type jsonlSink struct {
+	writer io.Writer
+	mu     sync.Mutex
+}
+
+// NewJSONLSink returns sink writing every message to writer as one line
+// of JSON, such as:
+//
+//	{"time":"2025-01-02T15:04:05.000000001Z","session":"...","direction":"out","latency_ms":1.5,"message":{...}}
+//
+// Errors of writer are ignored, so that tracing never interrupts serving.
+func NewJSONLSink(writer io.Writer) Sink {
+	return &jsonlSink{writer: writer}
+}
+
+type jsonlRecord struct {
+	Time      time.Time       `json:"time"`
+	SessionId string          `json:"session,omitempty"`
+	Direction Direction       `json:"direction"`
+	LatencyMs float64         `json:"latency_ms,omitempty"`
+	Message   json.RawMessage `json:"message"`
+}
+
+func (s *jsonlSink) Write(record Record) {
+	message := record.Message
+	if !json.Valid(message) {
+		// message that is not valid JSON is written as string
+		message, _ = json.Marshal(string(record.Message))
+	}
+	line, err := json.Marshal(jsonlRecord{
+		Time:      record.Time,
+		SessionId: record.SessionId,
+		Direction: record.Direction,
+		LatencyMs: float64(record.Latency) / float64(time.Millisecond),
+		Message:   message,
+	})
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, _ = s.writer.Write(append(line, '\n'))
+}
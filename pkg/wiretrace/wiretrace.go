@@ -0,0 +1,224 @@
+// Package wiretrace records JSON-RPC messages exchanged with clients,
+// so that traffic of every session could be inspected when debugging
+// servers or clients.
+//
+// Tracer is passed to server with server.WireTraceOption, which makes
+// every transport trace messages it receives and sends. Every message
+// is written to Sink with time, session, direction and, for responses,
+// latency since the request was seen. Secrets can be hidden from trace
+// with RedactPaths and RedactKeys options.
+package wiretrace
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Direction tells whether message was received or sent by the server
+type Direction string
+
+const (
+	// Inbound messages are received from client
+	Inbound Direction = "in"
+	// Outbound messages are sent to client
+	Outbound Direction = "out"
+)
+
+func (d Direction) opposite() Direction {
+	if d == Inbound {
+		return Outbound
+	}
+	return Inbound
+}
+
+// maxPending limits how many requests waiting for response are remembered
+// to measure latency, when it is reached, requests older than maxPendingAge
+// are forgotten or, if there are none, the oldest one is
+const maxPending = 10000
+
+// maxPendingAge is how long requests are surely remembered, responses
+// that take longer might be traced without latency
+const maxPendingAge = 10 * time.Minute
+
+// Record is one traced message.
+type Record struct {
+	Time time.Time
+	// SessionId is id of the session message belongs to, or empty
+	// if message was sent before session was known
+	SessionId string
+	Direction Direction
+	// Latency is time since request was seen until this message
+	// responded to it, it is zero for messages which are not responses
+	Latency time.Duration
+	// Message is JSON-RPC message as it was sent, with redactions applied
+	Message json.RawMessage
+}
+
+// Sink writes traced messages somewhere, such as NewLoggerSink and NewJSONLSink.
+//
+// Write is called concurrently for messages of different sessions.
+type Sink interface {
+	Write(record Record)
+}
+
+// Tracer traces messages to sink, while it is enabled.
+type Tracer struct {
+	sink     Sink
+	redactor redactor
+
+	enabled atomic.Bool
+
+	// pending holds times when requests were seen to measure latency of responses
+	pending   map[pendingRequest]time.Time
+	pendingMu sync.Mutex
+}
+
+type pendingRequest struct {
+	sessionId string
+	direction Direction
+	id        string
+}
+
+// NewTracer returns tracer writing messages to sink,
+// it is enabled unless StartDisabled option is given.
+func NewTracer(sink Sink, options ...TracerOption) *Tracer {
+	t := &Tracer{
+		sink:    sink,
+		pending: map[pendingRequest]time.Time{},
+	}
+	t.enabled.Store(true)
+	for _, o := range options {
+		o.apply(t)
+	}
+	return t
+}
+
+type TracerOption interface {
+	apply(*Tracer)
+}
+
+// StartDisabled makes tracer start disabled, so that
+// it could be enabled later with SetEnabled
+type StartDisabled struct{}
+
+func (StartDisabled) apply(t *Tracer) {
+	t.enabled.Store(false)
+}
+
+// SetEnabled turns tracing on or off, it can be called at any time,
+// for example from signal handler or admin endpoint.
+func (t *Tracer) SetEnabled(enabled bool) {
+	t.enabled.Store(enabled)
+	if !enabled {
+		t.pendingMu.Lock()
+		clear(t.pending)
+		t.pendingMu.Unlock()
+	}
+}
+
+// Enabled reports whether tracer is tracing messages now, it is safe
+// to call on nil tracer, which is never enabled
+func (t *Tracer) Enabled() bool {
+	return t != nil && t.enabled.Load()
+}
+
+// Trace records message sent or received by the session, message can be
+// single JSON-RPC object or batch. It does nothing when tracer is disabled.
+func (t *Tracer) Trace(sessionId string, direction Direction, message []byte) {
+	if !t.Enabled() {
+		return
+	}
+	now := time.Now()
+	t.sink.Write(Record{
+		Time:      now,
+		SessionId: sessionId,
+		Direction: direction,
+		Latency:   t.measure(now, sessionId, direction, message),
+		Message:   t.redactor.redact(message),
+	})
+}
+
+// envelope holds members of message needed to match responses with requests
+type envelope struct {
+	Id     json.RawMessage `json:"id"`
+	Method *string         `json:"method"`
+}
+
+// measure remembers requests and returns latency of responses to them,
+// for batch it returns the biggest latency of its responses
+func (t *Tracer) measure(now time.Time, sessionId string, direction Direction, message []byte) time.Duration {
+	var envelopes []envelope
+	trimmed := bytes.TrimLeft(message, " \t\r\n")
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &envelopes); err != nil {
+			return 0
+		}
+	} else {
+		var e envelope
+		if err := json.Unmarshal(trimmed, &e); err != nil {
+			return 0
+		}
+		envelopes = append(envelopes, e)
+	}
+
+	t.pendingMu.Lock()
+	defer t.pendingMu.Unlock()
+	var latency time.Duration
+	for _, e := range envelopes {
+		if len(e.Id) == 0 || string(e.Id) == "null" {
+			// notifications are not answered
+			continue
+		}
+		if e.Method != nil {
+			if len(t.pending) >= maxPending {
+				t.evictPending(now)
+			}
+			t.pending[pendingRequest{sessionId: sessionId, direction: direction, id: string(e.Id)}] = now
+			continue
+		}
+		request := pendingRequest{sessionId: sessionId, direction: direction.opposite(), id: string(e.Id)}
+		if seen, ok := t.pending[request]; ok {
+			delete(t.pending, request)
+			latency = max(latency, now.Sub(seen))
+		}
+	}
+	return latency
+}
+
+// evictPending forgets requests older than maxPendingAge, or the oldest
+// request if all of them are recent, it is called with pendingMu held
+func (t *Tracer) evictPending(now time.Time) {
+	var oldest pendingRequest
+	var oldestSeen time.Time
+	for request, seen := range t.pending {
+		if now.Sub(seen) > maxPendingAge {
+			delete(t.pending, request)
+			continue
+		}
+		if oldestSeen.IsZero() || seen.Before(oldestSeen) {
+			oldest, oldestSeen = request, seen
+		}
+	}
+	if len(t.pending) >= maxPending {
+		delete(t.pending, oldest)
+	}
+}
+
+// Forget drops requests of the session that are still waiting for
+// response, it is called by server when session ends and is safe
+// to call on nil tracer
+func (t *Tracer) Forget(sessionId string) {
+	if t == nil {
+		return
+	}
+	t.pendingMu.Lock()
+	defer t.pendingMu.Unlock()
+	for request := range t.pending {
+		if request.sessionId == sessionId {
+			delete(t.pending, request)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package wiretrace
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingSink struct {
+	mu      sync.Mutex
+	records []Record
+}
+
+func (s *recordingSink) Write(record Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, record)
+}
+
+func TestLatencyOfResponses(t *testing.T) {
+	sink := &recordingSink{}
+	tracer := NewTracer(sink)
+
+	tracer.Trace("a", Inbound, []byte(`{"jsonrpc":"2.0","method":"ping","id":1}`))
+	tracer.Trace("a", Outbound, []byte(`{"jsonrpc":"2.0","method":"roots/list","id":1}`))
+	tracer.Trace("b", Outbound, []byte(`{"jsonrpc":"2.0","result":{},"id":1}`))
+	tracer.Trace("a", Outbound, []byte(`{"jsonrpc":"2.0","result":{},"id":1}`))
+	tracer.Trace("a", Inbound, []byte(`[{"jsonrpc":"2.0","result":{"roots":[]},"id":1}]`))
+
+	require.Len(t, sink.records, 5)
+	assert.Equal(t, "a", sink.records[0].SessionId)
+	assert.Equal(t, Inbound, sink.records[0].Direction)
+	assert.Zero(t, sink.records[0].Latency)
+	assert.Zero(t, sink.records[1].Latency)
+	// response of another session does not match request
+	assert.Zero(t, sink.records[2].Latency)
+	assert.Positive(t, sink.records[3].Latency)
+	assert.Positive(t, sink.records[4].Latency)
+	assert.Empty(t, tracer.pending)
+}
+
+func TestPendingRequestsAreForgotten(t *testing.T) {
+	tracer := NewTracer(&recordingSink{})
+	now := time.Now()
+	for i := range maxPending - 1 {
+		tracer.pending[pendingRequest{sessionId: "a", direction: Inbound, id: strconv.Itoa(i)}] = now.Add(time.Duration(i) * time.Millisecond)
+	}
+	old := pendingRequest{sessionId: "b", direction: Inbound, id: "1"}
+	tracer.pending[old] = now.Add(-2 * maxPendingAge)
+
+	// requests that are too old go first
+	tracer.Trace("c", Inbound, []byte(`{"jsonrpc":"2.0","method":"ping","id":1}`))
+	assert.NotContains(t, tracer.pending, old)
+	assert.Contains(t, tracer.pending, pendingRequest{sessionId: "a", direction: Inbound, id: "0"})
+	assert.Len(t, tracer.pending, maxPending)
+
+	// then the oldest one
+	tracer.Trace("c", Inbound, []byte(`{"jsonrpc":"2.0","method":"ping","id":2}`))
+	assert.NotContains(t, tracer.pending, pendingRequest{sessionId: "a", direction: Inbound, id: "0"})
+	assert.Len(t, tracer.pending, maxPending)
+
+	tracer.Forget("a")
+	assert.Len(t, tracer.pending, 2)
+	var nilTracer *Tracer
+	nilTracer.Forget("a")
+}
+
+func TestRedaction(t *testing.T) {
+	sink := &recordingSink{}
+	tracer := NewTracer(sink,
+		RedactPaths{Paths: []string{"params.arguments.password", "result.contents.*.blob"}},
+		RedactKeys{Keys: []string{"token"}},
+	)
+
+	tracer.Trace("a", Inbound, []byte(`{"jsonrpc":"2.0","method":"tools/call","params":{"name":"login","arguments":{"user":"bob","password":"secret","nested":{"token":"t"}}},"id":9007199254740993}`))
+	tracer.Trace("a", Outbound, []byte(`{"jsonrpc":"2.0","result":{"contents":[{"uri":"a","blob":"AAA"},{"uri":"b","blob":"BBB"}]},"id":1}`))
+
+	require.Len(t, sink.records, 2)
+	assert.JSONEq(t,
+		`{"jsonrpc":"2.0","method":"tools/call","params":{"name":"login","arguments":{"user":"bob","password":"[REDACTED]","nested":{"token":"[REDACTED]"}}},"id":9007199254740993}`,
+		string(sink.records[0].Message),
+	)
+	assert.Contains(t, string(sink.records[0].Message), "9007199254740993")
+	assert.JSONEq(t,
+		`{"jsonrpc":"2.0","result":{"contents":[{"uri":"a","blob":"[REDACTED]"},{"uri":"b","blob":"[REDACTED]"}]},"id":1}`,
+		string(sink.records[1].Message),
+	)
+
+	// message, which is not JSON, cannot be redacted, so it is not traced as is
+	tracer.Trace("a", Inbound, []byte(`{"jsonrpc":"2.0","params":{"password":"secret"`))
+	require.Len(t, sink.records, 3)
+	assert.JSONEq(t, `"[REDACTED] undecodable message of 46 bytes"`, string(sink.records[2].Message))
+}
+
+func TestSetEnabled(t *testing.T) {
+	sink := &recordingSink{}
+	tracer := NewTracer(sink, StartDisabled{})
+
+	tracer.Trace("a", Inbound, []byte(`{"jsonrpc":"2.0","method":"ping","id":1}`))
+	assert.Empty(t, sink.records)
+
+	tracer.SetEnabled(true)
+	tracer.Trace("a", Inbound, []byte(`{"jsonrpc":"2.0","method":"ping","id":2}`))
+	tracer.SetEnabled(false)
+	tracer.Trace("a", Outbound, []byte(`{"jsonrpc":"2.0","result":{},"id":2}`))
+	assert.Len(t, sink.records, 1)
+
+	var disabled *Tracer
+	assert.False(t, disabled.Enabled())
+}
+
+func TestJSONLSink(t *testing.T) {
+	var out bytes.Buffer
+	tracer := NewTracer(NewJSONLSink(&out))
+
+	tracer.Trace("a", Inbound, []byte(`{"jsonrpc":"2.0","method":"ping","id":1}`))
+	tracer.Trace("a", Inbound, []byte(`not json`))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var line map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &line))
+	assert.Equal(t, "a", line["session"])
+	assert.Equal(t, "in", line["direction"])
+	assert.Equal(t, map[string]any{"jsonrpc": "2.0", "method": "ping", "id": float64(1)}, line["message"])
+	assert.NotEmpty(t, line["time"])
+
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &line))
+	assert.Equal(t, "not json", line["message"])
+}